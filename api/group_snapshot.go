@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package api
+
+import (
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+)
+
+// GroupSnapshot is a crash-consistent snapshot of several images taken at the same point in time. The
+// rbd images are snapshotted together as members of an rbd group, and a snapshot is recorded for each
+// image that can be restored like any other snapshot.
+type GroupSnapshot struct {
+	apiutils.Metadata `json:"metadata,omitempty"`
+
+	Spec GroupSnapshotSpec `json:"spec"`
+
+	Status GroupSnapshotStatus `json:"status"`
+}
+
+type GroupSnapshotSpec struct {
+	// VolumeImageIDs are the ids of the images snapshotted together. Their rbd images have to be in
+	// the same pool and rbd namespace.
+	VolumeImageIDs []string `json:"volumeImageIds"`
+}
+
+type GroupSnapshotState string
+
+const (
+	GroupSnapshotStatePending GroupSnapshotState = "Pending"
+	GroupSnapshotStateReady   GroupSnapshotState = "Ready"
+	GroupSnapshotStateFailed  GroupSnapshotState = "Failed"
+)
+
+type GroupSnapshotStatus struct {
+	State GroupSnapshotState `json:"state"`
+	// Message is a human-readable description of the state, e.g. why the group snapshot failed.
+	Message string `json:"message,omitempty"`
+	// Pool is the pool of the rbd group and its rbd images.
+	Pool string `json:"pool,omitempty"`
+	// Namespace is the rbd namespace of the rbd group and its rbd images. Empty means the default namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// SnapshotIDs are the ids of the snapshots recorded for the images once the group snapshot is taken.
+	SnapshotIDs []string `json:"snapshotIds,omitempty"`
+}
@@ -4,6 +4,8 @@
 package api
 
 import (
+	"time"
+
 	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
 )
 
@@ -30,6 +32,21 @@ type ImageState string
 const (
 	ImageStatePending   ImageState = "Pending"
 	ImageStateAvailable ImageState = "Available"
+	// ImageStateError is the state of images whose creation failed in a way that is not resolved by retrying.
+	ImageStateError ImageState = "Error"
+)
+
+// ImageReason is a machine-readable reason for the state of an image.
+type ImageReason string
+
+const (
+	ImageReasonSizeSmallerThanSnapshot ImageReason = "SizeSmallerThanSnapshot"
+	ImageReasonSnapshotFailed          ImageReason = "SnapshotFailed"
+	ImageReasonEncryptionFailed        ImageReason = "EncryptionFailed"
+	ImageReasonNoPlatformMatch         ImageReason = "NoPlatformMatch"
+	// ImageReasonRBDImageMissing is the reason of available images whose rbd image has been found
+	// missing by the image reconciler or the consistency check.
+	ImageReasonRBDImageMissing ImageReason = "RBDImageMissing"
 )
 
 type EncryptionState string
@@ -46,6 +63,48 @@ type ImageSpec struct {
 	ImageArchitecture *string         `json:"imageArchitecture"`
 	SnapshotRef       *string         `json:"snapshotRef"`
 	Encryption        *EncryptionSpec `json:"encryption"`
+	// Pool is the pool the rbd image is created in. Empty means the provider pool.
+	Pool string `json:"pool,omitempty"`
+	// DataPool is the pool the data objects of the rbd image are stored in. Empty means Pool.
+	DataPool string `json:"dataPool,omitempty"`
+	// Namespace is the rbd namespace within Pool the rbd image is created in. Empty means the default namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// RBDOptions are the options the rbd image is created with. Unset options use the librbd defaults.
+	RBDOptions *RBDOptions `json:"rbdOptions,omitempty"`
+	// Migration requests the rbd image to be live migrated to other pools. Removing it aborts a
+	// migration that has not been committed yet.
+	Migration *ImageMigration `json:"migration,omitempty"`
+	// Rollback requests the rbd image to be reverted to one of its snapshots. It is removed once the
+	// rollback completed or failed.
+	Rollback *ImageRollback `json:"rollback,omitempty"`
+}
+
+// ImageRollback is the snapshot an rbd image is reverted to.
+type ImageRollback struct {
+	// SnapshotID is the id of the snapshot taken of the image to revert it to.
+	SnapshotID string `json:"snapshotId"`
+}
+
+// ImageMigration are the pools an rbd image is migrated to.
+type ImageMigration struct {
+	// Pool is the pool the rbd image is migrated to. Empty means the provider pool.
+	Pool string `json:"pool,omitempty"`
+	// DataPool is the pool the data objects of the migrated rbd image are stored in. Empty means Pool.
+	DataPool string `json:"dataPool,omitempty"`
+	// Class is the volume class the image is moved to once the migration is committed, if any.
+	Class string `json:"class,omitempty"`
+}
+
+// RBDOptions are the layout options of an rbd image.
+type RBDOptions struct {
+	// Features are the names of the rbd image features, e.g. exclusive-lock.
+	Features []string `json:"features,omitempty"`
+	// ObjectSize is the size of the objects the image is split into in bytes. It is a power of two.
+	ObjectSize uint64 `json:"objectSize,omitempty"`
+	// StripeUnit is the number of bytes written to an object before continuing with the next one.
+	StripeUnit uint64 `json:"stripeUnit,omitempty"`
+	// StripeCount is the number of objects written to in parallel.
+	StripeCount uint64 `json:"stripeCount,omitempty"`
 }
 
 type EncryptionType string
@@ -61,10 +120,160 @@ type EncryptionSpec struct {
 }
 
 type ImageStatus struct {
-	State      ImageState      `json:"state"`
+	State ImageState `json:"state"`
+	// Reason is the reason for the state. It is set if the state is ImageStateError.
+	Reason ImageReason `json:"reason,omitempty"`
+	// Message is a human-readable description of the reason.
+	Message string `json:"message,omitempty"`
+	// LastTransitionTime is the time the state last changed.
+	LastTransitionTime time.Time `json:"lastTransitionTime"`
+
 	Encryption EncryptionState `json:"encryption"`
 	Access     *ImageAccess    `json:"access"`
 	Size       uint64          `json:"size"`
+	// Client is the cephx entity created for the image, e.g. client.volume-<id>. It only has access to
+	// the rbd image and is deleted along with it. Empty if the image is accessed with the shared client.
+	Client string `json:"client,omitempty"`
+	// RBDOptions are the options of the rbd image as reported by ceph.
+	RBDOptions *RBDOptions `json:"rbdOptions,omitempty"`
+	// Migration is the state of the last migration of the rbd image.
+	Migration *ImageMigrationStatus `json:"migration,omitempty"`
+	// Rollback is the state of the last rollback of the rbd image to one of its snapshots.
+	Rollback *ImageRollbackStatus `json:"rollback,omitempty"`
+	// Trash is set while the rbd image of a deleted image is kept in the rbd trash. Clearing the
+	// deletion timestamp of the image within the deferment period restores it.
+	Trash *ImageTrashStatus `json:"trash,omitempty"`
+	// Flatten is set while the rbd images cloned from rbd snapshots of a deleted image that were protected
+	// for clone v1 are flattened.
+	Flatten *FlattenStatus `json:"flatten,omitempty"`
+	// RetainedBy are the ids of the snapshots taken of a deleted image. Its rbd image is kept along with
+	// their rbd snapshots until the last of them is deleted.
+	RetainedBy []string `json:"retainedBy,omitempty"`
+}
+
+// ImageTrashStatus is the rbd trash entry of the rbd image of a deleted image.
+type ImageTrashStatus struct {
+	// ID is the id of the rbd image in the rbd trash.
+	ID string `json:"id"`
+	// DeletionTime is the time the rbd image was moved to the rbd trash.
+	DeletionTime time.Time `json:"deletionTime"`
+	// DefermentEndTime is the time after which the rbd image is removed from the rbd trash.
+	DefermentEndTime time.Time `json:"defermentEndTime"`
+}
+
+// FlattenStatus is the progress of flattening the rbd images cloned from an rbd snapshot protected for
+// clone v1, which has to complete before the rbd snapshot can be removed. The rbd images are flattened
+// by background tasks of the ceph manager.
+type FlattenStatus struct {
+	// Images is the number of cloned rbd images that are not flattened yet.
+	Images int `json:"images"`
+	// Progress is the average progress of flattening them, from 0 to 1.
+	Progress float64 `json:"progress"`
+	// Message is the error reported by ceph for a flatten task that is retried, if any.
+	Message string `json:"message,omitempty"`
+}
+
+// SetState sets the state along with its reason and message. The last transition time is only
+// updated if the state changes.
+func (s *ImageStatus) SetState(state ImageState, reason ImageReason, message string) {
+	if s.State != state {
+		s.LastTransitionTime = time.Now()
+	}
+	s.State = state
+	s.Reason = reason
+	s.Message = message
+}
+
+// IsReleased reports whether the rbd image of a deleted image is only kept in ceph, i.e. in the rbd trash
+// or for the snapshots taken of it. Such images are deleted as far as the volume runtime is concerned.
+func (s *ImageStatus) IsReleased() bool {
+	return s.Trash != nil || len(s.RetainedBy) > 0
+}
+
+type ImageMigrationState string
+
+const (
+	// ImageMigrationStatePrepared is the state of a migration whose target rbd image has been created.
+	// From then on, the rbd image is used from the target pool while its data is still read from the source.
+	ImageMigrationStatePrepared ImageMigrationState = "Prepared"
+	// ImageMigrationStateExecuting is the state of a migration whose data is being copied to the target pools.
+	ImageMigrationStateExecuting ImageMigrationState = "Executing"
+	// ImageMigrationStateCommitted is the state of a completed migration.
+	ImageMigrationStateCommitted ImageMigrationState = "Committed"
+	// ImageMigrationStateAborted is the state of a migration that has been rolled back to the source pools.
+	ImageMigrationStateAborted ImageMigrationState = "Aborted"
+	// ImageMigrationStateFailed is the state of a migration that could not be started.
+	ImageMigrationStateFailed ImageMigrationState = "Failed"
+)
+
+type ImageMigrationStatus struct {
+	State ImageMigrationState `json:"state"`
+	// SourcePool is the pool the rbd image is migrated from.
+	SourcePool string `json:"sourcePool"`
+	// SourceDataPool is the pool the data objects of the rbd image are migrated from.
+	SourceDataPool string `json:"sourceDataPool"`
+	// Pool is the pool the rbd image is migrated to.
+	Pool string `json:"pool"`
+	// DataPool is the pool the data objects of the rbd image are migrated to.
+	DataPool string `json:"dataPool"`
+	// Message is a human-readable description of the state, e.g. the progress reported by ceph.
+	Message string `json:"message,omitempty"`
+	// LastTransitionTime is the time the state last changed.
+	LastTransitionTime time.Time `json:"lastTransitionTime"`
+}
+
+// SetState sets the state along with its message. The last transition time is only updated if the
+// state changes.
+func (s *ImageMigrationStatus) SetState(state ImageMigrationState, message string) {
+	if s.State != state {
+		s.LastTransitionTime = time.Now()
+	}
+	s.State = state
+	s.Message = message
+}
+
+// IsActive returns whether the migration has been prepared but not yet committed or aborted.
+func (s *ImageMigrationStatus) IsActive() bool {
+	return s != nil && (s.State == ImageMigrationStatePrepared || s.State == ImageMigrationStateExecuting)
+}
+
+type ImageRollbackState string
+
+const (
+	// ImageRollbackStatePending is the state of a rollback waiting for the clients of the rbd image to close it.
+	ImageRollbackStatePending ImageRollbackState = "Pending"
+	// ImageRollbackStateRollingBack is the state of a rollback whose snapshot data is being copied to the rbd image.
+	ImageRollbackStateRollingBack ImageRollbackState = "RollingBack"
+	// ImageRollbackStateCompleted is the state of a completed rollback.
+	ImageRollbackStateCompleted ImageRollbackState = "Completed"
+	// ImageRollbackStateFailed is the state of a rollback that could not be started or completed. The
+	// rbd image might have been partially reverted and should be rolled back again.
+	ImageRollbackStateFailed ImageRollbackState = "Failed"
+)
+
+type ImageRollbackStatus struct {
+	State ImageRollbackState `json:"state"`
+	// SnapshotID is the id of the snapshot the rbd image is reverted to.
+	SnapshotID string `json:"snapshotId"`
+	// Message is a human-readable description of the state, e.g. why the rollback failed.
+	Message string `json:"message,omitempty"`
+	// LastTransitionTime is the time the state last changed.
+	LastTransitionTime time.Time `json:"lastTransitionTime"`
+}
+
+// SetState sets the state along with its message. The last transition time is only updated if the
+// state changes.
+func (s *ImageRollbackStatus) SetState(state ImageRollbackState, message string) {
+	if s.State != state {
+		s.LastTransitionTime = time.Now()
+	}
+	s.State = state
+	s.Message = message
+}
+
+// IsActive returns whether the rollback has been requested but not yet completed or failed.
+func (s *ImageRollbackStatus) IsActive() bool {
+	return s != nil && (s.State == ImageRollbackStatePending || s.State == ImageRollbackStateRollingBack)
 }
 
 type ImageAccess struct {
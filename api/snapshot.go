@@ -18,7 +18,9 @@ type Snapshot struct {
 type SnapshotState string
 
 const (
-	SnapshotStatePending   SnapshotState = "Pending"
+	SnapshotStatePending SnapshotState = "Pending"
+	// SnapshotStatePopulated is only found in snapshots stored before api version v1.
+	// It has been replaced by SnapshotStateReady, which it is migrated to when read.
 	SnapshotStatePopulated SnapshotState = "Populated"
 	SnapshotStateReady     SnapshotState = "Ready"
 	SnapshotStateFailed    SnapshotState = "Failed"
@@ -28,9 +30,20 @@ type SnapshotStatus struct {
 	State  SnapshotState `json:"state"`
 	Digest string        `json:"digest"`
 	Size   int64         `json:"size"`
+	// Flatten is set while the rbd images cloned from a deleted snapshot protected for clone v1 are flattened.
+	Flatten *FlattenStatus `json:"flatten,omitempty"`
 }
 
 type SnapshotSource struct {
 	IronCoreImage string `json:"ironcoreImage"`
 	VolumeImageID string `json:"volumeImageId"`
+	// Pool is the pool of the rbd image the snapshot is taken of. Empty means the provider pool.
+	Pool string `json:"pool,omitempty"`
+	// Namespace is the rbd namespace of the rbd image the snapshot is taken of. Empty means the default namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// GroupSnapshotID is the id of the group snapshot the snapshot has been taken with, if any. Its rbd
+	// snapshot is in the group snapshot namespace and is removed along with the group snapshot.
+	GroupSnapshotID string `json:"groupSnapshotId,omitempty"`
+	// SnapName is the name of the rbd snapshot of a group snapshot. Empty means the snapshot id.
+	SnapName string `json:"snapName,omitempty"`
 }
@@ -4,18 +4,26 @@
 package app
 
 import (
+	"cmp"
 	"context"
 	goflag "flag"
 	"fmt"
 	"net"
 	"os"
+	"path"
+	"slices"
 	"time"
 
+	"github.com/ceph/go-ceph/rados"
 	"github.com/go-logr/logr"
 	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/cache"
 	"github.com/ironcore-dev/ceph-provider/internal/ceph"
 	"github.com/ironcore-dev/ceph-provider/internal/controllers"
+	"github.com/ironcore-dev/ceph-provider/internal/credentials"
 	"github.com/ironcore-dev/ceph-provider/internal/encryption"
+	"github.com/ironcore-dev/ceph-provider/internal/fsck"
+	"github.com/ironcore-dev/ceph-provider/internal/leaderelection"
 	"github.com/ironcore-dev/ceph-provider/internal/omap"
 	"github.com/ironcore-dev/ceph-provider/internal/strategy"
 	"github.com/ironcore-dev/ceph-provider/internal/vcr"
@@ -29,6 +37,9 @@ import (
 	"github.com/spf13/pflag"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/sets"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
@@ -47,8 +58,20 @@ type CephOptions struct {
 	KeyFile     string
 	KeyringFile string
 	Pool        string
+	DataPool    string
 	Client      string
 
+	VolumeClientPrefix            string
+	VolumeClientMigrationInterval time.Duration
+
+	ClientKeyCacheTTL time.Duration
+
+	TrashDeferment time.Duration
+
+	FlattenPollInterval time.Duration
+
+	NamespaceLabel string
+
 	ConnectTimeout time.Duration
 
 	BurstFactor            int64
@@ -62,6 +85,18 @@ type CephOptions struct {
 
 	WorkerSize       int
 	OmapIteratorSize int64
+	OmapShards       int
+	ListPageSize     int64
+
+	MigrateStoredObjects bool
+
+	LeaderElection              bool
+	LeaderElectionLeaseDuration time.Duration
+	LeaderElectionRenewDeadline time.Duration
+	LeaderElectionRetryPeriod   time.Duration
+
+	FsckInterval time.Duration
+	FsckRepair   bool
 }
 
 func (o *Options) Defaults() {
@@ -70,7 +105,15 @@ func (o *Options) Defaults() {
 	o.Ceph.BurstDurationInSeconds = 15
 	o.Ceph.PopulatorBufferSize = 5 * 1024 * 1024
 	o.Ceph.WorkerSize = 15
+	o.Ceph.VolumeClientMigrationInterval = time.Second
+	o.Ceph.ClientKeyCacheTTL = 5 * time.Minute
+	o.Ceph.FlattenPollInterval = 5 * time.Second
 	o.Ceph.OmapIteratorSize = 1000
+	o.Ceph.OmapShards = 1
+	o.Ceph.ListPageSize = 1000
+	o.Ceph.LeaderElectionLeaseDuration = leaderelection.DefaultLeaseDuration
+	o.Ceph.LeaderElectionRenewDeadline = leaderelection.DefaultRenewDeadline
+	o.Ceph.LeaderElectionRetryPeriod = leaderelection.DefaultRetryPeriod
 }
 
 func (o *Options) AddFlags(fs *pflag.FlagSet) {
@@ -83,20 +126,43 @@ func (o *Options) AddFlags(fs *pflag.FlagSet) {
 
 	fs.Int64Var(&o.Ceph.PopulatorBufferSize, "populator-buffer-size", o.Ceph.PopulatorBufferSize, "Defines the buffer size (in bytes) which is used for downloading a image.")
 
-	fs.StringVar(&o.Ceph.Monitors, "ceph-monitors", o.Ceph.Monitors, "Ceph Monitors to connect to.")
-	fs.DurationVar(&o.Ceph.ConnectTimeout, "ceph-connect-timeout", o.Ceph.ConnectTimeout, "Connect timeout for establishing a connection to ceph.")
-	fs.StringVar(&o.Ceph.User, "ceph-user", o.Ceph.User, "Ceph User.")
-	fs.StringVar(&o.Ceph.KeyFile, "ceph-key-file", o.Ceph.KeyFile, "ceph-key-file or ceph-keyring-file must be provided (ceph-key-file has precedence). ceph-key-file contains contains only the ceph key.")
-	fs.StringVar(&o.Ceph.KeyringFile, "ceph-keyring-file", o.Ceph.KeyringFile, "ceph-key-file or ceph-keyring-file must be provided (ceph-key-file has precedence)s. ceph-keyring-file contains the ceph key and client information.")
-	fs.StringVar(&o.Ceph.Pool, "ceph-pool", o.Ceph.Pool, "Ceph pool which is used to store objects.")
+	o.Ceph.AddStoreFlags(fs)
+	fs.StringVar(&o.Ceph.DataPool, "ceph-data-pool", o.Ceph.DataPool, "Ceph pool the data objects of the rbd images in ceph-pool are stored in, e.g. an erasure-coded pool with allow_ec_overwrites. Defaults to ceph-pool.")
 	fs.StringVar(&o.Ceph.Client, "ceph-client", o.Ceph.Client, "Ceph client which grants access to pools/images eg. 'client.volumes'")
+	fs.StringVar(&o.Ceph.VolumeClientPrefix, "ceph-volume-client-prefix", o.Ceph.VolumeClientPrefix, "Prefix of the ceph clients created for every volume, eg. 'client.volume-'. Every client only has access to the rbd image of its volume. If empty, ceph-client is handed out to all volumes.")
+	fs.DurationVar(&o.Ceph.VolumeClientMigrationInterval, "ceph-volume-client-migration-interval", o.Ceph.VolumeClientMigrationInterval, "Interval existing volumes are moved from ceph-client to their own ceph clients in.")
+	fs.DurationVar(&o.Ceph.ClientKeyCacheTTL, "ceph-client-key-cache-ttl", o.Ceph.ClientKeyCacheTTL, "Duration the key of ceph-client is cached for. The key is fetched again in this interval and rotated keys are handed out to all volumes using ceph-client.")
+	fs.DurationVar(&o.Ceph.TrashDeferment, "ceph-trash-deferment", o.Ceph.TrashDeferment, "Duration the rbd images of deleted volumes are kept in the rbd trash for. Within it, volumes can be restored with the trash restore command. Zero removes rbd images right away.")
+	fs.DurationVar(&o.Ceph.FlattenPollInterval, "ceph-flatten-poll-interval", o.Ceph.FlattenPollInterval, "Interval the progress of flattening the rbd images cloned from deleted snapshots is checked in. The rbd images are flattened by tasks of the ceph manager.")
+	fs.StringVar(&o.Ceph.NamespaceLabel, "ceph-namespace-label", o.Ceph.NamespaceLabel, "Key of the volume label whose value is the rbd namespace the rbd image of the volume is created in, eg. a tenant or project label. Volumes without the label are created in the default namespace. Label values must be valid rbd namespace names. Quotas stay per pool and the provider stores stay in the default namespace.")
 	fs.StringVar(&o.Ceph.KeyEncryptionKeyPath, "ceph-kek-path", o.Ceph.KeyEncryptionKeyPath, "path to the key encryption key file (32 Bit - KEK) to encrypt volume keys.")
 	fs.IntVar(&o.Ceph.VolumeEventStoreOptions.MaxEvents, "volume-event-max-events", 100, "Maximum number of volume events that can be stored.")
 	fs.DurationVar(&o.Ceph.VolumeEventStoreOptions.TTL, "volume-event-ttl", 5*time.Minute, "Time to live for volume events.")
 	fs.DurationVar(&o.Ceph.VolumeEventStoreOptions.ResyncInterval, "volume-event-resync-interval", 1*time.Minute, "Interval for resynchronizing the volume events.")
 
 	fs.IntVar(&o.Ceph.WorkerSize, "worker-size", o.Ceph.WorkerSize, "Defines the factor to calculate the burst limits.")
-	fs.Int64Var(&o.Ceph.OmapIteratorSize, "omap-iterator-size", o.Ceph.OmapIteratorSize, "Batch size used when iterating omap values during List.")
+	fs.BoolVar(&o.Ceph.MigrateStoredObjects, "migrate-stored-objects", o.Ceph.MigrateStoredObjects, "Rewrites all stored volumes, snapshots and group snapshots of older api versions with the current one on startup.")
+	fs.Int64Var(&o.Ceph.ListPageSize, "list-page-size", o.Ceph.ListPageSize, "Number of stored objects fetched per page when listing volumes and snapshots.")
+
+	fs.BoolVar(&o.Ceph.LeaderElection, "leader-election", o.Ceph.LeaderElection, "Enables leader election. Only the leader runs the reconcilers and serves grpc calls creating, expanding or deleting volumes and snapshots. Standbys serve read-only grpc calls and reject the others with Unavailable.")
+	fs.DurationVar(&o.Ceph.LeaderElectionLeaseDuration, "leader-election-lease-duration", o.Ceph.LeaderElectionLeaseDuration, "Duration after which a lease that has not been renewed expires and can be acquired by a standby.")
+	fs.DurationVar(&o.Ceph.LeaderElectionRenewDeadline, "leader-election-renew-deadline", o.Ceph.LeaderElectionRenewDeadline, "Duration the leader retries renewing its lease before giving up leadership.")
+	fs.DurationVar(&o.Ceph.LeaderElectionRetryPeriod, "leader-election-retry-period", o.Ceph.LeaderElectionRetryPeriod, "Interval between attempts to acquire or renew the lease.")
+
+	fs.DurationVar(&o.Ceph.FsckInterval, "fsck-interval", o.Ceph.FsckInterval, "Interval of the consistency check between the stores and the rbd images. 0 disables the check.")
+	fs.BoolVar(&o.Ceph.FsckRepair, "fsck-repair", o.Ceph.FsckRepair, "Repairs the inconsistencies found by the periodic consistency check.")
+}
+
+// AddStoreFlags adds the flags needed to connect to ceph and access the image and snapshot stores.
+func (o *CephOptions) AddStoreFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Monitors, "ceph-monitors", o.Monitors, "Ceph Monitors to connect to.")
+	fs.DurationVar(&o.ConnectTimeout, "ceph-connect-timeout", o.ConnectTimeout, "Connect timeout for establishing a connection to ceph.")
+	fs.StringVar(&o.User, "ceph-user", o.User, "Ceph User.")
+	fs.StringVar(&o.KeyFile, "ceph-key-file", o.KeyFile, "ceph-key-file or ceph-keyring-file must be provided (ceph-key-file has precedence). ceph-key-file contains contains only the ceph key.")
+	fs.StringVar(&o.KeyringFile, "ceph-keyring-file", o.KeyringFile, "ceph-key-file or ceph-keyring-file must be provided (ceph-key-file has precedence)s. ceph-keyring-file contains the ceph key and client information.")
+	fs.StringVar(&o.Pool, "ceph-pool", o.Pool, "Ceph pool which is used to store objects.")
+	fs.Int64Var(&o.OmapIteratorSize, "omap-iterator-size", o.OmapIteratorSize, "Batch size used when iterating omap values during List.")
+	fs.IntVar(&o.OmapShards, "omap-shards", o.OmapShards, "Number of rados objects the volume and snapshot omap entries are hashed across. Existing unsharded stores are migrated on startup; the value must not be changed afterwards.")
 }
 
 func (o *Options) MarkFlagsRequired(cmd *cobra.Command) {
@@ -132,6 +198,17 @@ func Command() *cobra.Command {
 	opts.AddFlags(cmd.Flags())
 	opts.MarkFlagsRequired(cmd)
 
+	cmd.AddCommand(
+		ExportCommand(),
+		ImportCommand(),
+		FsckCommand(),
+		RetypeCommand(),
+		MigrateCommand(),
+		RollbackCommand(),
+		GroupSnapshotCommand(),
+		TrashCommand(),
+	)
+
 	return cmd
 }
 
@@ -195,122 +272,347 @@ func Run(ctx context.Context, opts Options) error {
 		return fmt.Errorf("failed to init encryptor: %w", err)
 	}
 
-	setupLog.Info("Establishing ceph connection", "Monitors", opts.Ceph.Monitors, "User", opts.Ceph.User, "Timeout", opts.Ceph.ConnectTimeout)
-	connectCtx, cancelConnect := context.WithTimeout(ctx, opts.Ceph.ConnectTimeout)
-	defer cancelConnect()
-	conn, err := ceph.ConnectToRados(connectCtx, ceph.Credentials{
-		Monitors: opts.Ceph.Monitors,
-		User:     opts.Ceph.User,
-		Keyfile:  opts.Ceph.KeyFile,
-	})
+	conn, err := connectToCeph(ctx, setupLog, opts.Ceph)
+	if err != nil {
+		return err
+	}
+
+	// Volumes are accounted to the pool their data objects are stored in.
+	cephCommandClient, err := ceph.NewCommandClient(conn, cmp.Or(opts.Ceph.DataPool, opts.Ceph.Pool))
 	if err != nil {
-		return fmt.Errorf("failed to establish rados connection: %w", err)
+		return fmt.Errorf("failed to initialize ceph command client: %w", err)
 	}
 
-	if err := ceph.CheckIfPoolExists(conn, opts.Ceph.Pool); err != nil {
+	if err := validatePools(cephCommandClient, opts.Ceph.Pool, opts.Ceph.DataPool); err != nil {
 		return fmt.Errorf("configuration invalid: %w", err)
 	}
 
-	setupLog.Info("Configuring image store", "OmapName", omap.NameVolumes)
-	imageStore, err := omap.New(log.WithName("image-events"), conn, opts.Ceph.Pool, omap.Options[*providerapi.Image]{
-		OmapName:       omap.NameVolumes,
-		NewFunc:        func() *providerapi.Image { return &providerapi.Image{} },
-		CreateStrategy: strategy.ImageStrategy,
-		IteratorSize:   opts.Ceph.OmapIteratorSize,
+	classRegistry, classPools, err := loadVolumeClassRegistry(cephCommandClient, opts.PathSupportedVolumeClasses)
+	if err != nil {
+		return err
+	}
+
+	setupLog.Info("Configuring image store", "OmapName", omap.NameVolumes, "Shards", opts.Ceph.OmapShards)
+	imageStore, err := newImageStore(log.WithName("image-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize image store: %w", err)
+	}
+
+	if err := imageStore.MigrateToShards(ctx); err != nil {
+		return fmt.Errorf("failed to migrate image store to shards: %w", err)
+	}
+
+	if opts.Ceph.MigrateStoredObjects {
+		if err := imageStore.MigrateObjects(ctx); err != nil {
+			return fmt.Errorf("failed to migrate stored images: %w", err)
+		}
+	}
+
+	imageCache, err := cache.New(log.WithName("image-cache"), imageStore, cache.Options[*providerapi.Image]{
+		NewFunc: func() *providerapi.Image { return &providerapi.Image{} },
 		FieldIndexers: map[string]store.IndexerFunc[*providerapi.Image]{
 			providerapi.ImageSpecSnapshotRefField: providerapi.SetupImageSpecSnapshotRefFieldIndexer,
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("failed to initialize image store: %w", err)
+		return fmt.Errorf("failed to initialize image cache: %w", err)
 	}
 
 	imageEvents, err := event.NewListWatchSource[*providerapi.Image](
-		imageStore.List,
-		imageStore.Watch,
+		imageCache.List,
+		imageCache.Watch,
 		event.ListWatchSourceOptions{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to initialize image events: %w", err)
 	}
 
-	setupLog.Info("Configuring snapshot store", "OmapName", omap.NameSnapshots)
-	snapshotStore, err := omap.New(log.WithName("snapshot-events"), conn, opts.Ceph.Pool, omap.Options[*providerapi.Snapshot]{
-		OmapName:       omap.NameSnapshots,
-		NewFunc:        func() *providerapi.Snapshot { return &providerapi.Snapshot{} },
-		CreateStrategy: strategy.SnapshotStrategy,
-		IteratorSize:   opts.Ceph.OmapIteratorSize,
-	})
+	setupLog.Info("Configuring snapshot store", "OmapName", omap.NameSnapshots, "Shards", opts.Ceph.OmapShards)
+	snapshotStore, err := newSnapshotStore(log.WithName("snapshot-events"), conn, opts.Ceph)
 	if err != nil {
 		return fmt.Errorf("failed to initialize snapshot store: %w", err)
 	}
 
+	if err := snapshotStore.MigrateToShards(ctx); err != nil {
+		return fmt.Errorf("failed to migrate snapshot store to shards: %w", err)
+	}
+
+	if opts.Ceph.MigrateStoredObjects {
+		if err := snapshotStore.MigrateObjects(ctx); err != nil {
+			return fmt.Errorf("failed to migrate stored snapshots: %w", err)
+		}
+	}
+
+	snapshotCache, err := cache.New(log.WithName("snapshot-cache"), snapshotStore, cache.Options[*providerapi.Snapshot]{
+		NewFunc: func() *providerapi.Snapshot { return &providerapi.Snapshot{} },
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize snapshot cache: %w", err)
+	}
+
 	snapshotEvents, err := event.NewListWatchSource[*providerapi.Snapshot](
-		snapshotStore.List,
-		snapshotStore.Watch,
+		snapshotCache.List,
+		snapshotCache.Watch,
 		event.ListWatchSourceOptions{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to initialize snapshot events: %w", err)
 	}
 
-	volumeEventStore := eventrecorder.NewEventStore(log, opts.Ceph.VolumeEventStoreOptions)
+	setupLog.Info("Configuring group snapshot store", "OmapName", omap.NameGroupSnapshots, "Shards", opts.Ceph.OmapShards)
+	groupSnapshotStore, err := newGroupSnapshotStore(log.WithName("group-snapshot-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize group snapshot store: %w", err)
+	}
 
-	imageReconciler, err := controllers.NewImageReconciler(
-		log.WithName("image-reconciler"),
-		conn,
-		imageStore, snapshotStore,
-		volumeEventStore,
-		imageEvents,
-		snapshotEvents,
-		encryptor,
-		controllers.ImageReconcilerOptions{
-			Monitors:   opts.Ceph.Monitors,
-			Client:     opts.Ceph.Client,
-			Pool:       opts.Ceph.Pool,
-			WorkerSize: opts.Ceph.WorkerSize,
-		},
+	if err := groupSnapshotStore.MigrateToShards(ctx); err != nil {
+		return fmt.Errorf("failed to migrate group snapshot store to shards: %w", err)
+	}
+
+	if opts.Ceph.MigrateStoredObjects {
+		if err := groupSnapshotStore.MigrateObjects(ctx); err != nil {
+			return fmt.Errorf("failed to migrate stored group snapshots: %w", err)
+		}
+	}
+
+	groupSnapshotCache, err := cache.New(log.WithName("group-snapshot-cache"), groupSnapshotStore, cache.Options[*providerapi.GroupSnapshot]{
+		NewFunc: func() *providerapi.GroupSnapshot { return &providerapi.GroupSnapshot{} },
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize group snapshot cache: %w", err)
+	}
+
+	groupSnapshotEvents, err := event.NewListWatchSource[*providerapi.GroupSnapshot](
+		groupSnapshotCache.List,
+		groupSnapshotCache.Watch,
+		event.ListWatchSourceOptions{},
 	)
 	if err != nil {
-		return fmt.Errorf("failed to initialize image reconciler: %w", err)
+		return fmt.Errorf("failed to initialize group snapshot events: %w", err)
+	}
+
+	volumeEventStore := eventrecorder.NewEventStore(log, opts.Ceph.VolumeEventStoreOptions)
+
+	clientCredentials, err := credentials.New(log.WithName("credentials"), cephCommandClient.ClientKey, credentials.Options{
+		TTL: opts.Ceph.ClientKeyCacheTTL,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize credential provider: %w", err)
+	}
+
+	var checker *fsck.Checker
+	if opts.Ceph.FsckInterval > 0 {
+		checker, err = fsck.NewChecker(log.WithName("fsck"), conn, opts.Ceph.Pool, imageCache, snapshotCache, volumeEventStore, fsck.CheckerOptions{
+			Pools: classPools,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to initialize consistency checker: %w", err)
+		}
+	}
+
+	// runReconcilers runs the reconcilers until ctx is done. With leader election enabled,
+	// only the leader runs them while standbys keep serving the grpc server. The reconcilers shut
+	// down their queues once stopped, so they are created anew whenever leadership is acquired.
+	runReconcilers := func(ctx context.Context) error {
+		imageReconciler, err := controllers.NewImageReconciler(
+			log.WithName("image-reconciler"),
+			conn,
+			imageCache, snapshotCache,
+			volumeEventStore,
+			imageEvents,
+			snapshotEvents,
+			encryptor,
+			controllers.ImageReconcilerOptions{
+				Monitors:                      opts.Ceph.Monitors,
+				Client:                        opts.Ceph.Client,
+				Pool:                          opts.Ceph.Pool,
+				DataPool:                      opts.Ceph.DataPool,
+				WorkerSize:                    opts.Ceph.WorkerSize,
+				VolumeClientPrefix:            opts.Ceph.VolumeClientPrefix,
+				VolumeClientMigrationInterval: opts.Ceph.VolumeClientMigrationInterval,
+				Credentials:                   clientCredentials,
+				TrashDeferment:                opts.Ceph.TrashDeferment,
+				FlattenPollInterval:           opts.Ceph.FlattenPollInterval,
+				DesiredLimits: func(image *providerapi.Image) (providerapi.Limits, bool) {
+					className, found := providerapi.GetClassLabelFromObject(image)
+					if !found {
+						return nil, false
+					}
+					class, found := classRegistry.GetClass(className)
+					if !found {
+						return nil, false
+					}
+					return class.Limits(image.Spec.Size, opts.Ceph.BurstFactor, opts.Ceph.BurstDurationInSeconds), true
+				},
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to initialize image reconciler: %w", err)
+		}
+
+		snapshotReconciler, err := controllers.NewSnapshotReconciler(
+			log.WithName("snapshot-reconciler"),
+			conn,
+			snapshotCache,
+			imageCache,
+			snapshotEvents,
+			controllers.SnapshotReconcilerOptions{
+				Pool:                opts.Ceph.Pool,
+				DataPool:            opts.Ceph.DataPool,
+				PopulatorBufferSize: opts.Ceph.PopulatorBufferSize,
+				WorkerSize:          opts.Ceph.WorkerSize,
+				FlattenPollInterval: opts.Ceph.FlattenPollInterval,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to initialize snapshot reconciler: %w", err)
+		}
+
+		groupSnapshotReconciler, err := controllers.NewGroupSnapshotReconciler(
+			log.WithName("group-snapshot-reconciler"),
+			conn,
+			groupSnapshotCache,
+			snapshotCache,
+			imageCache,
+			groupSnapshotEvents,
+			snapshotEvents,
+			controllers.GroupSnapshotReconcilerOptions{
+				Pool:       opts.Ceph.Pool,
+				WorkerSize: opts.Ceph.WorkerSize,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to initialize group snapshot reconciler: %w", err)
+		}
+
+		g, ctx := errgroup.WithContext(ctx)
+
+		if checker != nil {
+			g.Go(func() error {
+				setupLog.Info("Starting consistency checker", "Interval", opts.Ceph.FsckInterval, "Repair", opts.Ceph.FsckRepair)
+				return checker.Start(ctx, opts.Ceph.FsckInterval, fsck.CheckOptions{Repair: opts.Ceph.FsckRepair})
+			})
+		}
+
+		g.Go(func() error {
+			setupLog.Info("Starting credential refresh", "TTL", opts.Ceph.ClientKeyCacheTTL)
+			return clientCredentials.Start(ctx)
+		})
+
+		g.Go(func() error {
+			setupLog.Info("Starting image reconciler")
+			if err := imageReconciler.Start(ctx); err != nil {
+				setupLog.Error(err, "failed to start image reconciler")
+				return err
+			}
+			return nil
+		})
+
+		g.Go(func() error {
+			setupLog.Info("Starting snapshot reconciler")
+			if err := snapshotReconciler.Start(ctx); err != nil {
+				setupLog.Error(err, "failed to start snapshot reconciler")
+				return err
+			}
+			return nil
+		})
+
+		g.Go(func() error {
+			setupLog.Info("Starting group snapshot reconciler")
+			if err := groupSnapshotReconciler.Start(ctx); err != nil {
+				setupLog.Error(err, "failed to start group snapshot reconciler")
+				return err
+			}
+			return nil
+		})
+
+		return g.Wait()
+	}
+
+	var leaderElector *leaderelection.LeaderElector
+	if opts.Ceph.LeaderElection {
+		setupLog.Info("Configuring leader election", "LeaseDuration", opts.Ceph.LeaderElectionLeaseDuration)
+		leaderElector, err = leaderelection.New(log.WithName("leader-election"), conn, opts.Ceph.Pool, leaderelection.Options{
+			LeaseDuration: opts.Ceph.LeaderElectionLeaseDuration,
+			RenewDeadline: opts.Ceph.LeaderElectionRenewDeadline,
+			RetryPeriod:   opts.Ceph.LeaderElectionRetryPeriod,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to initialize leader election: %w", err)
+		}
 	}
 
 	g, ctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
-		setupLog.Info("Starting image reconciler")
-		if err := imageReconciler.Start(ctx); err != nil {
-			setupLog.Error(err, "failed to start image reconciler")
+		setupLog.Info("Starting image store watch")
+		if err := imageStore.Start(ctx); err != nil {
+			setupLog.Error(err, "failed to start image store watch")
 			return err
 		}
 		return nil
 	})
 
-	snapshotReconciler, err := controllers.NewSnapshotReconciler(
-		log.WithName("snapshot-reconciler"),
-		conn,
-		snapshotStore,
-		imageStore,
-		snapshotEvents,
-		controllers.SnapshotReconcilerOptions{
-			Pool:                opts.Ceph.Pool,
-			PopulatorBufferSize: opts.Ceph.PopulatorBufferSize,
-			WorkerSize:          opts.Ceph.WorkerSize,
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("failed to initialize snapshot reconciler: %w", err)
-	}
+	g.Go(func() error {
+		setupLog.Info("Starting snapshot store watch")
+		if err := snapshotStore.Start(ctx); err != nil {
+			setupLog.Error(err, "failed to start snapshot store watch")
+			return err
+		}
+		return nil
+	})
 
 	g.Go(func() error {
-		setupLog.Info("Starting snapshot reconciler")
-		if err := snapshotReconciler.Start(ctx); err != nil {
-			setupLog.Error(err, "failed to start snapshot reconciler")
+		setupLog.Info("Starting group snapshot store watch")
+		if err := groupSnapshotStore.Start(ctx); err != nil {
+			setupLog.Error(err, "failed to start group snapshot store watch")
 			return err
 		}
 		return nil
 	})
 
+	g.Go(func() error {
+		setupLog.Info("Starting image cache")
+		if err := imageCache.Start(ctx); err != nil {
+			setupLog.Error(err, "failed to start image cache")
+			return err
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		setupLog.Info("Starting snapshot cache")
+		if err := snapshotCache.Start(ctx); err != nil {
+			setupLog.Error(err, "failed to start snapshot cache")
+			return err
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		setupLog.Info("Starting group snapshot cache")
+		if err := groupSnapshotCache.Start(ctx); err != nil {
+			setupLog.Error(err, "failed to start group snapshot cache")
+			return err
+		}
+		return nil
+	})
+
+	if leaderElector != nil {
+		g.Go(func() error {
+			setupLog.Info("Starting leader election")
+			if err := leaderElector.Run(ctx, runReconcilers); err != nil {
+				setupLog.Error(err, "leader election failed")
+				return err
+			}
+			return nil
+		})
+	} else {
+		g.Go(func() error {
+			return runReconcilers(ctx)
+		})
+	}
+
 	g.Go(func() error {
 		setupLog.Info("Starting image events")
 		if err := imageEvents.Start(ctx); err != nil {
@@ -329,30 +631,24 @@ func Run(ctx context.Context, opts Options) error {
 		return nil
 	})
 
+	g.Go(func() error {
+		setupLog.Info("Starting group snapshot events")
+		if err := groupSnapshotEvents.Start(ctx); err != nil {
+			setupLog.Error(err, "failed to start group snapshot events")
+			return err
+		}
+		return nil
+	})
+
 	g.Go(func() error {
 		setupLog.Info("Starting volume events garbage collector")
 		volumeEventStore.Start(ctx)
 		return nil
 	})
 
-	supportedClasses, err := vcr.LoadVolumeClassesFile(opts.PathSupportedVolumeClasses)
-	if err != nil {
-		return fmt.Errorf("failed to load supported volume classes: %w", err)
-	}
-
-	classRegistry, err := vcr.NewVolumeClassRegistry(supportedClasses)
-	if err != nil {
-		return fmt.Errorf("failed to initialize volume class registry: %w", err)
-	}
-
-	cephCommandClient, err := ceph.NewCommandClient(conn, opts.Ceph.Pool)
-	if err != nil {
-		return fmt.Errorf("failed to initialize ceph command client: %w", err)
-	}
-
 	srv, err := volumeserver.New(
-		imageStore,
-		snapshotStore,
+		imageCache,
+		snapshotCache,
 		classRegistry,
 		encryptor,
 		cephCommandClient,
@@ -360,15 +656,22 @@ func Run(ctx context.Context, opts Options) error {
 			VolumeEventStore:       volumeEventStore,
 			BurstFactor:            opts.Ceph.BurstFactor,
 			BurstDurationInSeconds: opts.Ceph.BurstDurationInSeconds,
+			NamespaceLabel:         opts.Ceph.NamespaceLabel,
+			ListPageSize:           opts.Ceph.ListPageSize,
 		},
 	)
 	if err != nil {
 		return fmt.Errorf("error creating server: %w", err)
 	}
 
+	isLeader := func() bool { return true }
+	if leaderElector != nil {
+		isLeader = leaderElector.IsLeader
+	}
+
 	g.Go(func() error {
 		setupLog.Info("Starting grpc server")
-		if err := runGRPCServer(ctx, setupLog, log, srv, opts); err != nil {
+		if err := runGRPCServer(ctx, setupLog, log, srv, isLeader, opts); err != nil {
 			setupLog.Error(err, "failed to start grpc server")
 			return err
 		}
@@ -377,7 +680,150 @@ func Run(ctx context.Context, opts Options) error {
 	return g.Wait()
 }
 
-func runGRPCServer(ctx context.Context, setupLog logr.Logger, log logr.Logger, srv *volumeserver.Server, opts Options) error {
+func connectToCeph(ctx context.Context, setupLog logr.Logger, opts CephOptions) (*rados.Conn, error) {
+	setupLog.Info("Establishing ceph connection", "Monitors", opts.Monitors, "User", opts.User, "Timeout", opts.ConnectTimeout)
+	connectCtx, cancelConnect := context.WithTimeout(ctx, opts.ConnectTimeout)
+	defer cancelConnect()
+	conn, err := ceph.ConnectToRados(connectCtx, ceph.Credentials{
+		Monitors: opts.Monitors,
+		User:     opts.User,
+		Keyfile:  opts.KeyFile,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to establish rados connection: %w", err)
+	}
+
+	if err := ceph.CheckIfPoolExists(conn, opts.Pool); err != nil {
+		return nil, fmt.Errorf("configuration invalid: %w", err)
+	}
+	return conn, nil
+}
+
+// loadVolumeClassRegistry loads the supported volume classes and validates the pools they are
+// mapped to. Besides the registry, it returns the pools the rbd images of the classes are
+// created in.
+func loadVolumeClassRegistry(client *ceph.CommandClient, path string) (*vcr.Vcr, []string, error) {
+	supportedClasses, err := vcr.LoadVolumeClassesFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load supported volume classes: %w", err)
+	}
+
+	classRegistry, err := vcr.NewVolumeClassRegistry(supportedClasses)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize volume class registry: %w", err)
+	}
+
+	var pools []string
+	for _, class := range supportedClasses {
+		if err := validatePools(client, class.Pool, class.DataPool); err != nil {
+			return nil, nil, fmt.Errorf("configuration of volume class %s invalid: %w", class.Name, err)
+		}
+		if class.Pool != "" && !slices.Contains(pools, class.Pool) {
+			pools = append(pools, class.Pool)
+		}
+	}
+	return classRegistry, pools, nil
+}
+
+// validatePools checks that rbd images can be created in pool with their data objects stored in
+// dataPool. Empty pools are not checked.
+func validatePools(client *ceph.CommandClient, pool, dataPool string) error {
+	if pool != "" {
+		details, err := client.PoolDetails(pool)
+		if err != nil {
+			return fmt.Errorf("failed to get details of pool %s: %w", pool, err)
+		}
+		if err := ceph.ValidateMetadataPool(details); err != nil {
+			return err
+		}
+	}
+
+	if dataPool != "" {
+		details, err := client.PoolDetails(dataPool)
+		if err != nil {
+			return fmt.Errorf("failed to get details of data pool %s: %w", dataPool, err)
+		}
+		if err := ceph.ValidateDataPool(details); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// connectForCommand connects to ceph for the subcommands operating on the pool. The returned
+// cleanup function closes the connection and removes the temporary key file, if any.
+func connectForCommand(ctx context.Context, opts Options) (*rados.Conn, func(), error) {
+	setupLog := ctrl.LoggerFrom(ctx).WithName("setup")
+
+	cleanupAuth, err := configureCephAuth(&opts.Ceph)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to configure ceph auth: %w", err)
+	}
+
+	conn, err := connectToCeph(ctx, setupLog, opts.Ceph)
+	if err != nil {
+		if err := cleanupAuth(); err != nil {
+			setupLog.Error(err, "failed to cleanup")
+		}
+		return nil, nil, err
+	}
+
+	return conn, func() {
+		conn.Shutdown()
+		if err := cleanupAuth(); err != nil {
+			setupLog.Error(err, "failed to cleanup")
+		}
+	}, nil
+}
+
+func newImageStore(log logr.Logger, conn *rados.Conn, opts CephOptions) (*omap.Store[*providerapi.Image], error) {
+	return omap.New(log, conn, opts.Pool, omap.Options[*providerapi.Image]{
+		OmapName:       omap.NameVolumes,
+		NewFunc:        func() *providerapi.Image { return &providerapi.Image{} },
+		CreateStrategy: strategy.ImageStrategy,
+		Schema:         strategy.ImageSchema,
+		IteratorSize:   opts.OmapIteratorSize,
+		FieldIndexers: map[string]store.IndexerFunc[*providerapi.Image]{
+			providerapi.ImageSpecSnapshotRefField: providerapi.SetupImageSpecSnapshotRefFieldIndexer,
+		},
+		Shards: opts.OmapShards,
+	})
+}
+
+func newSnapshotStore(log logr.Logger, conn *rados.Conn, opts CephOptions) (*omap.Store[*providerapi.Snapshot], error) {
+	return omap.New(log, conn, opts.Pool, omap.Options[*providerapi.Snapshot]{
+		OmapName:       omap.NameSnapshots,
+		NewFunc:        func() *providerapi.Snapshot { return &providerapi.Snapshot{} },
+		CreateStrategy: strategy.SnapshotStrategy,
+		Schema:         strategy.SnapshotSchema,
+		IteratorSize:   opts.OmapIteratorSize,
+		Shards:         opts.OmapShards,
+	})
+}
+
+func newGroupSnapshotStore(log logr.Logger, conn *rados.Conn, opts CephOptions) (*omap.Store[*providerapi.GroupSnapshot], error) {
+	return omap.New(log, conn, opts.Pool, omap.Options[*providerapi.GroupSnapshot]{
+		OmapName:       omap.NameGroupSnapshots,
+		NewFunc:        func() *providerapi.GroupSnapshot { return &providerapi.GroupSnapshot{} },
+		CreateStrategy: strategy.GroupSnapshotStrategy,
+		Schema:         strategy.GroupSnapshotSchema,
+		IteratorSize:   opts.OmapIteratorSize,
+		Shards:         opts.OmapShards,
+	})
+}
+
+// mutatingMethods are the grpc methods writing to the stores. They are served by the leader only.
+var mutatingMethods = sets.New(
+	"CreateVolume",
+	"ExpandVolume",
+	"DeleteVolume",
+	"CreateVolumeSnapshot",
+	"DeleteVolumeSnapshot",
+)
+
+// runGRPCServer serves the volume runtime. Methods writing to the stores are rejected with
+// Unavailable while isLeader reports false, so standbys serve read-only calls.
+func runGRPCServer(ctx context.Context, setupLog logr.Logger, log logr.Logger, srv *volumeserver.Server, isLeader func() bool, opts Options) error {
 	setupLog.V(1).Info("Cleaning up any previous socket")
 	if err := common.CleanupSocketIfExists(opts.Address); err != nil {
 		return fmt.Errorf("error cleaning up socket: %w", err)
@@ -399,6 +845,9 @@ func runGRPCServer(ctx context.Context, setupLog logr.Logger, log logr.Logger, s
 			log := log.WithName(info.FullMethod)
 			ctx = ctrl.LoggerInto(ctx, log)
 			log.V(1).Info("Request")
+			if method := path.Base(info.FullMethod); mutatingMethods.Has(method) && !isLeader() {
+				return nil, status.Errorf(codes.Unavailable, "%s is served by the leader only", method)
+			}
 			resp, err = handler(ctx, req)
 			if err != nil {
 				log.Error(err, "Error handling request")
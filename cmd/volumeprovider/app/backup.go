@@ -0,0 +1,250 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ironcore-dev/ceph-provider/internal/backup"
+	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+type ExportOptions struct {
+	Options
+
+	File   string
+	Format string
+}
+
+func (o *ExportOptions) AddFlags(fs *pflag.FlagSet) {
+	o.Ceph.AddStoreFlags(fs)
+
+	fs.StringVar(&o.File, "file", "-", "File to write the backup to. '-' writes to stdout.")
+	fs.StringVar(&o.Format, "format", string(backup.FormatYAML), "Format of the backup, either 'yaml' or 'json'.")
+}
+
+func ExportCommand() *cobra.Command {
+	var opts ExportOptions
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the volume, snapshot and group snapshot stores to a file.",
+		Long: "Export the volume, snapshot and group snapshot stores of a pool to a versioned backup file. " +
+			"The provider should not be running, since changes made during the export might be missed.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunExport(cmd.Context(), opts)
+		},
+	}
+
+	opts.Defaults()
+	opts.AddFlags(cmd.Flags())
+	_ = cmd.MarkFlagRequired("ceph-monitors")
+	_ = cmd.MarkFlagRequired("ceph-pool")
+
+	return cmd
+}
+
+type ImportOptions struct {
+	Options
+
+	File   string
+	DryRun bool
+	Merge  bool
+}
+
+func (o *ImportOptions) AddFlags(fs *pflag.FlagSet) {
+	o.Ceph.AddStoreFlags(fs)
+
+	fs.StringVar(&o.File, "file", "-", "Backup file to import. '-' reads from stdin.")
+	fs.BoolVar(&o.DryRun, "dry-run", o.DryRun, "Only validate the backup against the pool without writing anything. Fails if the stores still need to be migrated to omap-shards.")
+	fs.BoolVar(&o.Merge, "merge", o.Merge, "Import into a pool that already contains volumes or snapshots, skipping existing ones. Without merge, the import fails if any object of the backup already exists.")
+}
+
+func ImportCommand() *cobra.Command {
+	var opts ImportOptions
+
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import the volume, snapshot and group snapshot stores from a file.",
+		Long: "Import a backup created by export into the volume, snapshot and group snapshot stores of a pool. " +
+			"Objects are restored as they are, including their status. The provider should not be running during the import.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunImport(cmd.Context(), opts)
+		},
+	}
+
+	opts.Defaults()
+	opts.AddFlags(cmd.Flags())
+	_ = cmd.MarkFlagRequired("ceph-monitors")
+	_ = cmd.MarkFlagRequired("ceph-pool")
+
+	return cmd
+}
+
+func RunExport(ctx context.Context, opts ExportOptions) error {
+	log := ctrl.LoggerFrom(ctx)
+	setupLog := log.WithName("setup")
+
+	format := backup.Format(opts.Format)
+	if format != backup.FormatJSON && format != backup.FormatYAML {
+		return fmt.Errorf("unsupported format %q", opts.Format)
+	}
+
+	conn, cleanup, err := connectForCommand(ctx, opts.Options)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	imageStore, err := newImageStore(log.WithName("image-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize image store: %w", err)
+	}
+
+	snapshotStore, err := newSnapshotStore(log.WithName("snapshot-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize snapshot store: %w", err)
+	}
+
+	groupSnapshotStore, err := newGroupSnapshotStore(log.WithName("group-snapshot-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize group snapshot store: %w", err)
+	}
+
+	setupLog.Info("Exporting stores", "Pool", opts.Ceph.Pool)
+	b, err := backup.Export(ctx, opts.Ceph.Pool, imageStore, snapshotStore, groupSnapshotStore)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if opts.File != "-" {
+		f, err := os.Create(opts.File)
+		if err != nil {
+			return fmt.Errorf("failed to create backup file: %w", err)
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				setupLog.Error(err, "failed to close backup file")
+			}
+		}()
+		w = f
+	}
+
+	if err := backup.Write(w, b, format); err != nil {
+		return err
+	}
+
+	setupLog.Info("Exported stores", "Images", len(b.Images.Items), "Snapshots", len(b.Snapshots.Items), "GroupSnapshots", len(b.GroupSnapshots.Items))
+	return nil
+}
+
+func RunImport(ctx context.Context, opts ImportOptions) error {
+	log := ctrl.LoggerFrom(ctx)
+	setupLog := log.WithName("setup")
+
+	var r io.Reader = os.Stdin
+	if opts.File != "-" {
+		f, err := os.Open(opts.File)
+		if err != nil {
+			return fmt.Errorf("failed to open backup file: %w", err)
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				setupLog.Error(err, "failed to close backup file")
+			}
+		}()
+		r = f
+	}
+
+	b, err := backup.Read(r)
+	if err != nil {
+		return err
+	}
+
+	conn, cleanup, err := connectForCommand(ctx, opts.Options)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	imageStore, err := newImageStore(log.WithName("image-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize image store: %w", err)
+	}
+
+	snapshotStore, err := newSnapshotStore(log.WithName("snapshot-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize snapshot store: %w", err)
+	}
+
+	groupSnapshotStore, err := newGroupSnapshotStore(log.WithName("group-snapshot-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize group snapshot store: %w", err)
+	}
+
+	if opts.DryRun {
+		// Entries of a legacy store not yet migrated to its shards are invisible to the sharded
+		// store, so a dry run would validate against empty shards.
+		if err := checkMigratedToShards(ctx, "image", imageStore, opts.Ceph.OmapShards); err != nil {
+			return err
+		}
+		if err := checkMigratedToShards(ctx, "snapshot", snapshotStore, opts.Ceph.OmapShards); err != nil {
+			return err
+		}
+		if err := checkMigratedToShards(ctx, "group snapshot", groupSnapshotStore, opts.Ceph.OmapShards); err != nil {
+			return err
+		}
+	} else {
+		if err := imageStore.MigrateToShards(ctx); err != nil {
+			return fmt.Errorf("failed to migrate image store to shards: %w", err)
+		}
+		if err := snapshotStore.MigrateToShards(ctx); err != nil {
+			return fmt.Errorf("failed to migrate snapshot store to shards: %w", err)
+		}
+		if err := groupSnapshotStore.MigrateToShards(ctx); err != nil {
+			return fmt.Errorf("failed to migrate group snapshot store to shards: %w", err)
+		}
+	}
+
+	setupLog.Info("Importing stores", "Pool", opts.Ceph.Pool, "SourcePool", b.Pool, "CreatedAt", b.CreatedAt, "DryRun", opts.DryRun, "Merge", opts.Merge)
+	res, err := backup.Import(ctx, log.WithName("import"), b, imageStore, snapshotStore, groupSnapshotStore, backup.ImportOptions{
+		DryRun: opts.DryRun,
+		Merge:  opts.Merge,
+	})
+	if err != nil {
+		return err
+	}
+
+	setupLog.Info("Imported stores",
+		"DryRun", opts.DryRun,
+		"RestoredImages", len(res.Images.Restored),
+		"SkippedImages", len(res.Images.Skipped),
+		"RestoredSnapshots", len(res.Snapshots.Restored),
+		"SkippedSnapshots", len(res.Snapshots.Skipped),
+		"RestoredGroupSnapshots", len(res.GroupSnapshots.Restored),
+		"SkippedGroupSnapshots", len(res.GroupSnapshots.Skipped),
+	)
+	return nil
+}
+
+func checkMigratedToShards[E apiutils.Object](ctx context.Context, name string, s *omap.Store[E], shards int) error {
+	needsMigration, err := s.NeedsShardMigration(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check shards of %s store: %w", name, err)
+	}
+	if needsMigration {
+		return fmt.Errorf("%s store has not been migrated to %d shards yet, import without dry-run or start the provider first", name, shards)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"github.com/ironcore-dev/ceph-provider/internal/fsck"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+type FsckOptions struct {
+	Options
+
+	Repair                bool
+	RecreateMissingImages bool
+}
+
+func (o *FsckOptions) AddFlags(fs *pflag.FlagSet) {
+	o.Ceph.AddStoreFlags(fs)
+
+	fs.StringVar(&o.PathSupportedVolumeClasses, "supported-volume-classes", o.PathSupportedVolumeClasses, "File containing supported volume classes. The pools of the classes are checked besides the provider pool.")
+	fs.BoolVar(&o.Repair, "repair", o.Repair, "Repair the inconsistencies found.")
+	fs.BoolVar(&o.RecreateMissingImages, "recreate-missing-images", o.RecreateMissingImages, "With --repair, create the missing rbd images of volumes again, including volumes set to error state by earlier repairs. The volumes get an empty disk or a fresh clone of their snapshot.")
+}
+
+func FsckCommand() *cobra.Command {
+	var opts FsckOptions
+
+	cmd := &cobra.Command{
+		Use:   "fsck",
+		Short: "Check the consistency between the volume and snapshot stores and the rbd images.",
+		Long: "Check the consistency between the volume and snapshot stores and the rbd images of the pools and report " +
+			"every inconsistency by category. With --repair, orphaned rbd images and snapshots are removed and " +
+			"stored objects without rbd image or snapshot are set to an error state. Missing rbd images of volumes " +
+			"are only created again with --recreate-missing-images.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunFsck(cmd.Context(), cmd.OutOrStdout(), opts)
+		},
+	}
+
+	opts.Defaults()
+	opts.AddFlags(cmd.Flags())
+	_ = cmd.MarkFlagRequired("ceph-monitors")
+	_ = cmd.MarkFlagRequired("ceph-pool")
+
+	return cmd
+}
+
+func RunFsck(ctx context.Context, out io.Writer, opts FsckOptions) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	conn, cleanup, err := connectForCommand(ctx, opts.Options)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	imageStore, err := newImageStore(log.WithName("image-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize image store: %w", err)
+	}
+
+	snapshotStore, err := newSnapshotStore(log.WithName("snapshot-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize snapshot store: %w", err)
+	}
+
+	var classPools []string
+	if opts.PathSupportedVolumeClasses != "" {
+		client, err := ceph.NewCommandClient(conn, opts.Ceph.Pool)
+		if err != nil {
+			return fmt.Errorf("failed to initialize ceph command client: %w", err)
+		}
+		if _, classPools, err = loadVolumeClassRegistry(client, opts.PathSupportedVolumeClasses); err != nil {
+			return err
+		}
+	}
+
+	checker, err := fsck.NewChecker(log.WithName("fsck"), conn, opts.Ceph.Pool, imageStore, snapshotStore, nil, fsck.CheckerOptions{
+		Pools: classPools,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize consistency checker: %w", err)
+	}
+
+	res, err := checker.Check(ctx, fsck.CheckOptions{
+		Repair:                opts.Repair,
+		RecreateMissingImages: opts.RecreateMissingImages,
+	})
+	if err != nil {
+		return err
+	}
+
+	var unresolved int
+	for _, issue := range res.Issues {
+		status := "found"
+		switch {
+		case issue.Repaired:
+			status = "repaired"
+		case issue.RepairErr != nil:
+			status = fmt.Sprintf("repair failed: %v", issue.RepairErr)
+			unresolved++
+		default:
+			unresolved++
+		}
+		if _, err := fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\n", issue.Category, issue.Pool, issue.ID, issue.Message, status); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	}
+
+	if unresolved > 0 {
+		return fmt.Errorf("found %d unresolved inconsistencies", unresolved)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ironcore/broker/common/idgen"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+type GroupSnapshotOptions struct {
+	Options
+
+	ID        string
+	VolumeIDs []string
+}
+
+func (o *GroupSnapshotOptions) AddFlags(fs *pflag.FlagSet) {
+	o.Ceph.AddStoreFlags(fs)
+}
+
+func GroupSnapshotCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "group-snapshot",
+		Short: "Manage crash-consistent snapshots of several volumes.",
+		Long: "Manage crash-consistent snapshots of several volumes. " +
+			"The provider snapshots the rbd images of the volumes together in an rbd group and records " +
+			"a volume snapshot for each volume that can be restored like any other volume snapshot.",
+		Args: cobra.NoArgs,
+	}
+
+	cmd.AddCommand(
+		groupSnapshotCreateCommand(),
+		groupSnapshotListCommand(),
+		groupSnapshotDeleteCommand(),
+	)
+
+	return cmd
+}
+
+func groupSnapshotCreateCommand() *cobra.Command {
+	var opts GroupSnapshotOptions
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Snapshot several volumes at the same point in time.",
+		Long: "Request the running provider to snapshot the given volumes at the same point in time. " +
+			"The volumes have to be in the same pool and rbd namespace. The id of the group snapshot is printed.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunGroupSnapshotCreate(cmd.Context(), cmd.OutOrStdout(), opts)
+		},
+	}
+
+	opts.Defaults()
+	opts.AddFlags(cmd.Flags())
+	cmd.Flags().StringSliceVar(&opts.VolumeIDs, "volume-id", opts.VolumeIDs, "IDs of the volumes to snapshot. May be repeated.")
+	_ = cmd.MarkFlagRequired("ceph-monitors")
+	_ = cmd.MarkFlagRequired("ceph-pool")
+	_ = cmd.MarkFlagRequired("volume-id")
+
+	return cmd
+}
+
+func groupSnapshotListCommand() *cobra.Command {
+	var opts GroupSnapshotOptions
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the group snapshots and their volume snapshots.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunGroupSnapshotList(cmd.Context(), cmd.OutOrStdout(), opts)
+		},
+	}
+
+	opts.Defaults()
+	opts.AddFlags(cmd.Flags())
+	_ = cmd.MarkFlagRequired("ceph-monitors")
+	_ = cmd.MarkFlagRequired("ceph-pool")
+
+	return cmd
+}
+
+func groupSnapshotDeleteCommand() *cobra.Command {
+	var opts GroupSnapshotOptions
+
+	cmd := &cobra.Command{
+		Use:   "delete",
+		Short: "Delete a group snapshot along with its volume snapshots.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunGroupSnapshotDelete(cmd.Context(), opts)
+		},
+	}
+
+	opts.Defaults()
+	opts.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&opts.ID, "id", opts.ID, "ID of the group snapshot to delete.")
+	_ = cmd.MarkFlagRequired("ceph-monitors")
+	_ = cmd.MarkFlagRequired("ceph-pool")
+	_ = cmd.MarkFlagRequired("id")
+
+	return cmd
+}
+
+func RunGroupSnapshotCreate(ctx context.Context, out io.Writer, opts GroupSnapshotOptions) error {
+	log := ctrl.LoggerFrom(ctx)
+	setupLog := log.WithName("setup")
+
+	volumeIDs := slices.Compact(slices.Sorted(slices.Values(opts.VolumeIDs)))
+	if len(volumeIDs) < 2 {
+		return fmt.Errorf("must specify at least two distinct volumes")
+	}
+
+	conn, cleanup, err := connectForCommand(ctx, opts.Options)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	imageStore, err := newImageStore(log.WithName("image-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize image store: %w", err)
+	}
+
+	groupSnapshotStore, err := newGroupSnapshotStore(log.WithName("group-snapshot-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize group snapshot store: %w", err)
+	}
+
+	for _, volumeID := range volumeIDs {
+		image, err := imageStore.Get(ctx, volumeID)
+		if err != nil {
+			return fmt.Errorf("failed to get volume %s: %w", volumeID, err)
+		}
+		if image.DeletedAt != nil {
+			return fmt.Errorf("volume %s is being deleted", volumeID)
+		}
+	}
+
+	groupSnapshot, err := groupSnapshotStore.Create(ctx, &providerapi.GroupSnapshot{
+		Metadata: apiutils.Metadata{
+			ID: idgen.Default.Generate(),
+		},
+		Spec: providerapi.GroupSnapshotSpec{
+			VolumeImageIDs: volumeIDs,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create group snapshot: %w", err)
+	}
+
+	setupLog.Info("Requested group snapshot of volumes", "GroupSnapshotID", groupSnapshot.ID, "VolumeIDs", volumeIDs)
+	if _, err := fmt.Fprintln(out, groupSnapshot.ID); err != nil {
+		return fmt.Errorf("failed to write group snapshot id: %w", err)
+	}
+	return nil
+}
+
+func RunGroupSnapshotList(ctx context.Context, out io.Writer, opts GroupSnapshotOptions) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	conn, cleanup, err := connectForCommand(ctx, opts.Options)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	groupSnapshotStore, err := newGroupSnapshotStore(log.WithName("group-snapshot-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize group snapshot store: %w", err)
+	}
+
+	groupSnapshots, err := groupSnapshotStore.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list group snapshots: %w", err)
+	}
+	slices.SortFunc(groupSnapshots, func(a, b *providerapi.GroupSnapshot) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	for _, groupSnapshot := range groupSnapshots {
+		state := string(groupSnapshot.Status.State)
+		if groupSnapshot.DeletedAt != nil {
+			state = "Deleting"
+		}
+		if _, err := fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\n",
+			groupSnapshot.ID,
+			state,
+			strings.Join(groupSnapshot.Spec.VolumeImageIDs, ","),
+			strings.Join(groupSnapshot.Status.SnapshotIDs, ","),
+			groupSnapshot.Status.Message,
+		); err != nil {
+			return fmt.Errorf("failed to write group snapshot list: %w", err)
+		}
+	}
+	return nil
+}
+
+func RunGroupSnapshotDelete(ctx context.Context, opts GroupSnapshotOptions) error {
+	log := ctrl.LoggerFrom(ctx)
+	setupLog := log.WithName("setup")
+
+	conn, cleanup, err := connectForCommand(ctx, opts.Options)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	groupSnapshotStore, err := newGroupSnapshotStore(log.WithName("group-snapshot-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize group snapshot store: %w", err)
+	}
+
+	// The provider deletes the volume snapshots of the group snapshot and its rbd group before
+	// removing it from the store.
+	if err := groupSnapshotStore.Delete(ctx, opts.ID); err != nil {
+		return fmt.Errorf("failed to delete group snapshot %s: %w", opts.ID, err)
+	}
+
+	setupLog.Info("Requested deletion of group snapshot", "GroupSnapshotID", opts.ID)
+	return nil
+}
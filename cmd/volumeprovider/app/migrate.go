@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"fmt"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+type MigrateOptions struct {
+	Options
+
+	VolumeID       string
+	TargetPool     string
+	TargetDataPool string
+	Abort          bool
+}
+
+func (o *MigrateOptions) AddFlags(fs *pflag.FlagSet) {
+	o.Ceph.AddStoreFlags(fs)
+
+	fs.StringVar(&o.VolumeID, "volume-id", o.VolumeID, "ID of the volume to migrate.")
+	fs.StringVar(&o.TargetPool, "target-pool", o.TargetPool, "Pool to migrate the rbd image of the volume to. Defaults to ceph-pool.")
+	fs.StringVar(&o.TargetDataPool, "target-data-pool", o.TargetDataPool, "Pool to store the data objects of the migrated rbd image in. Defaults to target-pool.")
+	fs.BoolVar(&o.Abort, "abort", o.Abort, "Abort the migration of the volume instead of starting one.")
+}
+
+func MigrateCommand() *cobra.Command {
+	var opts MigrateOptions
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Live migrate the rbd image of a volume to other pools.",
+		Long: "Request the running provider to live migrate the rbd image of a volume to other pools. " +
+			"The migration is prepared once no client uses the volume anymore, clients have to reattach the volume afterward. " +
+			"The data is then copied in the background and the migration committed. " +
+			"Until then, the migration can be aborted with --abort.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunMigrate(cmd.Context(), opts)
+		},
+	}
+
+	opts.Defaults()
+	opts.AddFlags(cmd.Flags())
+	_ = cmd.MarkFlagRequired("ceph-monitors")
+	_ = cmd.MarkFlagRequired("ceph-pool")
+	_ = cmd.MarkFlagRequired("volume-id")
+
+	return cmd
+}
+
+func RunMigrate(ctx context.Context, opts MigrateOptions) error {
+	log := ctrl.LoggerFrom(ctx)
+	setupLog := log.WithName("setup")
+
+	conn, cleanup, err := connectForCommand(ctx, opts.Options)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	imageStore, err := newImageStore(log.WithName("image-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize image store: %w", err)
+	}
+
+	image, err := imageStore.Get(ctx, opts.VolumeID)
+	if err != nil {
+		return fmt.Errorf("failed to get volume %s: %w", opts.VolumeID, err)
+	}
+
+	if opts.Abort {
+		if image.Spec.Migration == nil {
+			return fmt.Errorf("volume %s is not being migrated", opts.VolumeID)
+		}
+		image.Spec.Migration = nil
+	} else {
+		if image.DeletedAt != nil {
+			return fmt.Errorf("volume %s is being deleted", opts.VolumeID)
+		}
+		if image.Spec.Migration != nil || image.Status.Migration.IsActive() {
+			return fmt.Errorf("volume %s is already being migrated", opts.VolumeID)
+		}
+		image.Spec.Migration = &providerapi.ImageMigration{
+			Pool:     opts.TargetPool,
+			DataPool: opts.TargetDataPool,
+		}
+	}
+
+	if _, err := imageStore.Update(ctx, image); err != nil {
+		return fmt.Errorf("failed to update volume %s: %w", opts.VolumeID, err)
+	}
+
+	setupLog.Info("Updated migration request of volume", "VolumeID", opts.VolumeID, "Abort", opts.Abort)
+	return nil
+}
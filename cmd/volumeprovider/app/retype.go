@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"github.com/ironcore-dev/ceph-provider/internal/retype"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+type RetypeOptions struct {
+	Options
+
+	VolumeID    string
+	VolumeClass string
+}
+
+func (o *RetypeOptions) AddFlags(fs *pflag.FlagSet) {
+	o.Ceph.AddStoreFlags(fs)
+
+	fs.StringVar(&o.PathSupportedVolumeClasses, "supported-volume-classes", o.PathSupportedVolumeClasses, "File containing supported volume classes.")
+	fs.StringVar(&o.Ceph.DataPool, "ceph-data-pool", o.Ceph.DataPool, "Ceph pool the data objects of the rbd images in ceph-pool are stored in. Defaults to ceph-pool.")
+	fs.Int64Var(&o.Ceph.BurstFactor, "limits-burst-factor", o.Ceph.BurstFactor, "Defines the factor to calculate the burst limits.")
+	fs.Int64Var(&o.Ceph.BurstDurationInSeconds, "limits-burst-duration", o.Ceph.BurstDurationInSeconds, "Defines the burst duration in seconds.")
+	fs.StringVar(&o.VolumeID, "volume-id", o.VolumeID, "ID of the volume to retype.")
+	fs.StringVar(&o.VolumeClass, "volume-class", o.VolumeClass, "Volume class to move the volume to.")
+}
+
+func RetypeCommand() *cobra.Command {
+	var opts RetypeOptions
+
+	cmd := &cobra.Command{
+		Use:   "retype",
+		Short: "Move a volume to another volume class.",
+		Long: "Move a volume to another volume class. The class label of the volume is updated and its limits are " +
+			"recalculated for the new class, which the running provider applies to the rbd image. " +
+			"The flags have to match the ones of the provider. Volumes are live migrated to classes placing them in other pools.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunRetype(cmd.Context(), opts)
+		},
+	}
+
+	opts.Defaults()
+	opts.AddFlags(cmd.Flags())
+	_ = cmd.MarkFlagRequired("ceph-monitors")
+	_ = cmd.MarkFlagRequired("ceph-pool")
+	_ = cmd.MarkFlagRequired("supported-volume-classes")
+	_ = cmd.MarkFlagRequired("volume-id")
+	_ = cmd.MarkFlagRequired("volume-class")
+
+	return cmd
+}
+
+func RunRetype(ctx context.Context, opts RetypeOptions) error {
+	log := ctrl.LoggerFrom(ctx)
+	setupLog := log.WithName("setup")
+
+	conn, cleanup, err := connectForCommand(ctx, opts.Options)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	client, err := ceph.NewCommandClient(conn, opts.Ceph.Pool)
+	if err != nil {
+		return fmt.Errorf("failed to initialize ceph command client: %w", err)
+	}
+
+	classRegistry, _, err := loadVolumeClassRegistry(client, opts.PathSupportedVolumeClasses)
+	if err != nil {
+		return err
+	}
+
+	imageStore, err := newImageStore(log.WithName("image-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize image store: %w", err)
+	}
+
+	image, err := retype.Retype(ctx, log.WithName("retype"), imageStore, classRegistry, opts.VolumeID, opts.VolumeClass, retype.Options{
+		Pool:                   opts.Ceph.Pool,
+		DataPool:               opts.Ceph.DataPool,
+		BurstFactor:            opts.Ceph.BurstFactor,
+		BurstDurationInSeconds: opts.Ceph.BurstDurationInSeconds,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to retype volume %s: %w", opts.VolumeID, err)
+	}
+
+	setupLog.Info("Retyped volume", "VolumeID", image.ID, "VolumeClass", opts.VolumeClass)
+	return nil
+}
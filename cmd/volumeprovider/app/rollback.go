@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"fmt"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+type RollbackOptions struct {
+	Options
+
+	VolumeID   string
+	SnapshotID string
+}
+
+func (o *RollbackOptions) AddFlags(fs *pflag.FlagSet) {
+	o.Ceph.AddStoreFlags(fs)
+
+	fs.StringVar(&o.VolumeID, "volume-id", o.VolumeID, "ID of the volume to roll back.")
+	fs.StringVar(&o.SnapshotID, "snapshot-id", o.SnapshotID, "ID of the volume snapshot to roll the volume back to.")
+}
+
+func RollbackCommand() *cobra.Command {
+	var opts RollbackOptions
+
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: "Revert a volume to one of its snapshots.",
+		Long: "Request the running provider to revert the rbd image of a volume in place to one of its snapshots. " +
+			"The rollback starts once no client uses the volume anymore and discards all data written after the snapshot was taken. " +
+			"Its state is reported in the volume status and events.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunRollback(cmd.Context(), opts)
+		},
+	}
+
+	opts.Defaults()
+	opts.AddFlags(cmd.Flags())
+	_ = cmd.MarkFlagRequired("ceph-monitors")
+	_ = cmd.MarkFlagRequired("ceph-pool")
+	_ = cmd.MarkFlagRequired("volume-id")
+	_ = cmd.MarkFlagRequired("snapshot-id")
+
+	return cmd
+}
+
+func RunRollback(ctx context.Context, opts RollbackOptions) error {
+	log := ctrl.LoggerFrom(ctx)
+	setupLog := log.WithName("setup")
+
+	conn, cleanup, err := connectForCommand(ctx, opts.Options)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	imageStore, err := newImageStore(log.WithName("image-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize image store: %w", err)
+	}
+
+	snapshotStore, err := newSnapshotStore(log.WithName("snapshot-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize snapshot store: %w", err)
+	}
+
+	image, err := imageStore.Get(ctx, opts.VolumeID)
+	if err != nil {
+		return fmt.Errorf("failed to get volume %s: %w", opts.VolumeID, err)
+	}
+
+	if image.DeletedAt != nil {
+		return fmt.Errorf("volume %s is being deleted", opts.VolumeID)
+	}
+	if image.Spec.Migration != nil || image.Status.Migration.IsActive() {
+		return fmt.Errorf("volume %s is being migrated", opts.VolumeID)
+	}
+	if image.Spec.Rollback != nil {
+		return fmt.Errorf("volume %s is already being rolled back to snapshot %s", opts.VolumeID, image.Spec.Rollback.SnapshotID)
+	}
+
+	snapshot, err := snapshotStore.Get(ctx, opts.SnapshotID)
+	if err != nil {
+		return fmt.Errorf("failed to get volume snapshot %s: %w", opts.SnapshotID, err)
+	}
+	if snapshot.Source.VolumeImageID != image.ID {
+		return fmt.Errorf("volume snapshot %s is not a snapshot of volume %s", opts.SnapshotID, opts.VolumeID)
+	}
+	if snapshot.Source.GroupSnapshotID != "" {
+		return fmt.Errorf("volume snapshot %s is part of group snapshot %s, rolling back to it is not supported", opts.SnapshotID, snapshot.Source.GroupSnapshotID)
+	}
+	if snapshot.Status.State != providerapi.SnapshotStateReady {
+		return fmt.Errorf("volume snapshot %s is not ready", opts.SnapshotID)
+	}
+
+	image.Spec.Rollback = &providerapi.ImageRollback{SnapshotID: snapshot.ID}
+	if _, err := imageStore.Update(ctx, image); err != nil {
+		return fmt.Errorf("failed to update volume %s: %w", opts.VolumeID, err)
+	}
+
+	setupLog.Info("Requested rollback of volume", "VolumeID", opts.VolumeID, "SnapshotID", opts.SnapshotID)
+	return nil
+}
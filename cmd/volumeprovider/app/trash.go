@@ -0,0 +1,168 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+type TrashOptions struct {
+	Options
+
+	VolumeID string
+}
+
+func (o *TrashOptions) AddFlags(fs *pflag.FlagSet) {
+	o.Ceph.AddStoreFlags(fs)
+}
+
+func TrashCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "trash",
+		Short: "Manage deleted volumes whose rbd images are kept in the rbd trash.",
+		Long: "Manage deleted volumes whose rbd images are kept in the rbd trash. " +
+			"The provider moves the rbd images of deleted volumes to the rbd trash if ceph-trash-deferment is set " +
+			"and removes them once the deferment ended.",
+		Args: cobra.NoArgs,
+	}
+
+	cmd.AddCommand(
+		trashListCommand(),
+		trashRestoreCommand(),
+	)
+
+	return cmd
+}
+
+func trashListCommand() *cobra.Command {
+	var opts TrashOptions
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the deleted volumes that can be restored.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunTrashList(cmd.Context(), cmd.OutOrStdout(), opts)
+		},
+	}
+
+	opts.Defaults()
+	opts.AddFlags(cmd.Flags())
+	_ = cmd.MarkFlagRequired("ceph-monitors")
+	_ = cmd.MarkFlagRequired("ceph-pool")
+
+	return cmd
+}
+
+func trashRestoreCommand() *cobra.Command {
+	var opts TrashOptions
+
+	cmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Restore a deleted volume from the rbd trash.",
+		Long: "Request the running provider to restore a deleted volume whose rbd image is kept in the rbd trash. " +
+			"The volume is reported again with its original metadata once its rbd image has been restored.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunTrashRestore(cmd.Context(), opts)
+		},
+	}
+
+	opts.Defaults()
+	opts.AddFlags(cmd.Flags())
+	cmd.Flags().StringVar(&opts.VolumeID, "volume-id", opts.VolumeID, "ID of the volume to restore.")
+	_ = cmd.MarkFlagRequired("ceph-monitors")
+	_ = cmd.MarkFlagRequired("ceph-pool")
+	_ = cmd.MarkFlagRequired("volume-id")
+
+	return cmd
+}
+
+func RunTrashList(ctx context.Context, out io.Writer, opts TrashOptions) error {
+	log := ctrl.LoggerFrom(ctx)
+
+	conn, cleanup, err := connectForCommand(ctx, opts.Options)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	imageStore, err := newImageStore(log.WithName("image-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize image store: %w", err)
+	}
+
+	images, err := imageStore.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	var trashed []*providerapi.Image
+	for _, image := range images {
+		if image.DeletedAt != nil && image.Status.Trash != nil {
+			trashed = append(trashed, image)
+		}
+	}
+	slices.SortFunc(trashed, func(a, b *providerapi.Image) int {
+		return a.Status.Trash.DefermentEndTime.Compare(b.Status.Trash.DefermentEndTime)
+	})
+
+	for _, image := range trashed {
+		if _, err := fmt.Fprintf(out, "%s\t%d\t%s\t%s\n",
+			image.ID,
+			image.Spec.Size,
+			image.Status.Trash.DeletionTime.Format(time.RFC3339),
+			image.Status.Trash.DefermentEndTime.Format(time.RFC3339),
+		); err != nil {
+			return fmt.Errorf("failed to write trash list: %w", err)
+		}
+	}
+	return nil
+}
+
+func RunTrashRestore(ctx context.Context, opts TrashOptions) error {
+	log := ctrl.LoggerFrom(ctx)
+	setupLog := log.WithName("setup")
+
+	conn, cleanup, err := connectForCommand(ctx, opts.Options)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	imageStore, err := newImageStore(log.WithName("image-events"), conn, opts.Ceph)
+	if err != nil {
+		return fmt.Errorf("failed to initialize image store: %w", err)
+	}
+
+	image, err := imageStore.Get(ctx, opts.VolumeID)
+	if err != nil {
+		return fmt.Errorf("failed to get volume %s: %w", opts.VolumeID, err)
+	}
+
+	if image.DeletedAt == nil || image.Status.Trash == nil {
+		return fmt.Errorf("volume %s is not in the trash", opts.VolumeID)
+	}
+	if end := image.Status.Trash.DefermentEndTime; !time.Now().Before(end) {
+		return fmt.Errorf("deferment of volume %s ended at %s, it is being purged", opts.VolumeID, end.Format(time.RFC3339))
+	}
+
+	// The provider restores the rbd image of deleted images in the trash whose deletion has been revoked.
+	image.DeletedAt = nil
+	if _, err := imageStore.Update(ctx, image); err != nil {
+		return fmt.Errorf("failed to update volume %s: %w", opts.VolumeID, err)
+	}
+
+	setupLog.Info("Requested restore of volume", "VolumeID", opts.VolumeID)
+	return nil
+}
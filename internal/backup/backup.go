@@ -0,0 +1,378 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	"github.com/ironcore-dev/ceph-provider/internal/strategy"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+const (
+	APIVersion = "v1"
+	Kind       = "VolumeProviderBackup"
+)
+
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+)
+
+// Backup is the file format the image, snapshot and group snapshot stores are exported to.
+type Backup struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Pool       string    `json:"pool"`
+	CreatedAt  time.Time `json:"createdAt"`
+
+	Images         Objects `json:"images"`
+	Snapshots      Objects `json:"snapshots"`
+	GroupSnapshots Objects `json:"groupSnapshots"`
+}
+
+// Objects are the exported objects of a store. APIVersion is the schema version of the objects,
+// so that a backup of an older version can be migrated when imported.
+type Objects struct {
+	APIVersion string            `json:"apiVersion"`
+	Items      []json.RawMessage `json:"items"`
+}
+
+// Export returns a backup of all images, snapshots and group snapshots, including the ones that are
+// being deleted.
+func Export(
+	ctx context.Context,
+	pool string,
+	images store.Store[*api.Image],
+	snapshots store.Store[*api.Snapshot],
+	groupSnapshots store.Store[*api.GroupSnapshot],
+) (*Backup, error) {
+	imageObjects, err := exportObjects(ctx, images, strategy.ImageAPIVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export images: %w", err)
+	}
+
+	snapshotObjects, err := exportObjects(ctx, snapshots, strategy.SnapshotAPIVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export snapshots: %w", err)
+	}
+
+	groupSnapshotObjects, err := exportObjects(ctx, groupSnapshots, strategy.GroupSnapshotAPIVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export group snapshots: %w", err)
+	}
+
+	return &Backup{
+		APIVersion:     APIVersion,
+		Kind:           Kind,
+		Pool:           pool,
+		CreatedAt:      time.Now(),
+		Images:         imageObjects,
+		Snapshots:      snapshotObjects,
+		GroupSnapshots: groupSnapshotObjects,
+	}, nil
+}
+
+func exportObjects[E apiutils.Object](ctx context.Context, s store.Store[E], apiVersion string) (Objects, error) {
+	objs, err := s.List(ctx)
+	if err != nil {
+		return Objects{}, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	slices.SortFunc(objs, func(a, b E) int {
+		return strings.Compare(a.GetID(), b.GetID())
+	})
+
+	items := make([]json.RawMessage, 0, len(objs))
+	for _, obj := range objs {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return Objects{}, fmt.Errorf("failed to marshal object %s: %w", obj.GetID(), err)
+		}
+		items = append(items, data)
+	}
+
+	return Objects{
+		APIVersion: apiVersion,
+		Items:      items,
+	}, nil
+}
+
+// Write writes the backup in the given format.
+func Write(w io.Writer, b *Backup, format Format) error {
+	var (
+		data []byte
+		err  error
+	)
+	switch format {
+	case FormatJSON:
+		data, err = json.MarshalIndent(b, "", "  ")
+	case FormatYAML:
+		data, err = sigsyaml.Marshal(b)
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup: %w", err)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write backup: %w", err)
+	}
+	return nil
+}
+
+// Read reads a backup written in either format.
+func Read(r io.Reader) (*Backup, error) {
+	b := &Backup{}
+	if err := yaml.NewYAMLOrJSONDecoder(r, 4096).Decode(b); err != nil {
+		return nil, fmt.Errorf("failed to decode backup: %w", err)
+	}
+
+	if b.Kind != Kind {
+		return nil, fmt.Errorf("unsupported kind %q, expected %q", b.Kind, Kind)
+	}
+	if b.APIVersion != APIVersion {
+		return nil, fmt.Errorf("unsupported api version %q, expected %q", b.APIVersion, APIVersion)
+	}
+	return b, nil
+}
+
+// Store is a store the objects of a backup are restored into.
+type Store[E apiutils.Object] interface {
+	Get(ctx context.Context, id string) (E, error)
+	Restore(ctx context.Context, obj E) error
+}
+
+type ImportOptions struct {
+	// DryRun only validates the backup against the target stores without writing anything.
+	DryRun bool
+	// Merge restores the objects of a backup into non-empty stores, skipping objects that already
+	// exist. Without Merge, the import fails if any object of the backup already exists.
+	Merge bool
+}
+
+type ObjectResult struct {
+	// Restored are the ids of the objects that have been or, in a dry run, would be restored.
+	Restored []string
+	// Skipped are the ids of the objects that already existed in the store.
+	Skipped []string
+}
+
+type Result struct {
+	Images         ObjectResult
+	Snapshots      ObjectResult
+	GroupSnapshots ObjectResult
+}
+
+// Import validates the backup and restores its objects into the given stores. Objects are written
+// as they are, including their metadata and status. An interrupted import can be resumed by running
+// it again with Merge.
+func Import(
+	ctx context.Context,
+	log logr.Logger,
+	b *Backup,
+	images Store[*api.Image],
+	snapshots Store[*api.Snapshot],
+	groupSnapshots Store[*api.GroupSnapshot],
+	opts ImportOptions,
+) (*Result, error) {
+	imageObjs, err := decodeObjects(b.Images, strategy.ImageSchema, func() *api.Image { return &api.Image{} })
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode images: %w", err)
+	}
+
+	snapshotObjs, err := decodeObjects(b.Snapshots, strategy.SnapshotSchema, func() *api.Snapshot { return &api.Snapshot{} })
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode snapshots: %w", err)
+	}
+
+	groupSnapshotObjs, err := decodeObjects(b.GroupSnapshots, strategy.GroupSnapshotSchema, func() *api.GroupSnapshot { return &api.GroupSnapshot{} })
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode group snapshots: %w", err)
+	}
+
+	imagesToRestore, imageResult, err := plan(ctx, images, imageObjs, opts.Merge)
+	if err != nil {
+		return nil, fmt.Errorf("invalid images: %w", err)
+	}
+
+	snapshotsToRestore, snapshotResult, err := plan(ctx, snapshots, snapshotObjs, opts.Merge)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshots: %w", err)
+	}
+
+	groupSnapshotsToRestore, groupSnapshotResult, err := plan(ctx, groupSnapshots, groupSnapshotObjs, opts.Merge)
+	if err != nil {
+		return nil, fmt.Errorf("invalid group snapshots: %w", err)
+	}
+
+	if err := validateSnapshotRefs(ctx, imageObjs, snapshotObjs, snapshots); err != nil {
+		return nil, fmt.Errorf("invalid images: %w", err)
+	}
+
+	if err := validateGroupSnapshotRefs(ctx, snapshotObjs, groupSnapshotObjs, groupSnapshots); err != nil {
+		return nil, fmt.Errorf("invalid snapshots: %w", err)
+	}
+
+	res := &Result{
+		Images:         imageResult,
+		Snapshots:      snapshotResult,
+		GroupSnapshots: groupSnapshotResult,
+	}
+	if opts.DryRun {
+		return res, nil
+	}
+
+	// Group snapshots are restored before their member snapshots, and snapshots before images, so that
+	// no object ever points to a missing one.
+	if res.GroupSnapshots, err = restore(ctx, log.WithValues("Kind", "GroupSnapshot"), groupSnapshots, groupSnapshotsToRestore, groupSnapshotResult.Skipped, opts.Merge); err != nil {
+		return nil, fmt.Errorf("failed to restore group snapshots: %w", err)
+	}
+
+	if res.Snapshots, err = restore(ctx, log.WithValues("Kind", "Snapshot"), snapshots, snapshotsToRestore, snapshotResult.Skipped, opts.Merge); err != nil {
+		return nil, fmt.Errorf("failed to restore snapshots: %w", err)
+	}
+
+	if res.Images, err = restore(ctx, log.WithValues("Kind", "Image"), images, imagesToRestore, imageResult.Skipped, opts.Merge); err != nil {
+		return nil, fmt.Errorf("failed to restore images: %w", err)
+	}
+
+	return res, nil
+}
+
+func decodeObjects[E apiutils.Object](objs Objects, schema *omap.Schema, newFunc func() E) ([]E, error) {
+	res := make([]E, 0, len(objs.Items))
+	for i, data := range objs.Items {
+		obj := newFunc()
+		if err := schema.DecodeVersion(objs.APIVersion, data, obj); err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		res = append(res, obj)
+	}
+	return res, nil
+}
+
+// plan validates the objects and determines which of them have to be restored.
+func plan[E apiutils.Object](ctx context.Context, s Store[E], objs []E, merge bool) ([]E, ObjectResult, error) {
+	var (
+		toRestore []E
+		res       ObjectResult
+		errs      []error
+		ids       = sets.New[string]()
+	)
+	for i, obj := range objs {
+		id := obj.GetID()
+		if id == "" {
+			errs = append(errs, fmt.Errorf("item %d: must specify id", i))
+			continue
+		}
+		if ids.Has(id) {
+			errs = append(errs, fmt.Errorf("duplicate object %s", id))
+			continue
+		}
+		ids.Insert(id)
+
+		_, err := s.Get(ctx, id)
+		switch {
+		case err == nil && merge:
+			res.Skipped = append(res.Skipped, id)
+		case err == nil:
+			errs = append(errs, fmt.Errorf("object %s %w", id, store.ErrAlreadyExists))
+		case errors.Is(err, store.ErrNotFound):
+			toRestore = append(toRestore, obj)
+			res.Restored = append(res.Restored, id)
+		default:
+			return nil, ObjectResult{}, fmt.Errorf("failed to get object %s: %w", id, err)
+		}
+	}
+	return toRestore, res, errors.Join(errs...)
+}
+
+// validateSnapshotRefs checks that the snapshots images are created from are either part of the
+// backup or already exist in the snapshot store.
+func validateSnapshotRefs(ctx context.Context, images []*api.Image, snapshots []*api.Snapshot, snapshotStore Store[*api.Snapshot]) error {
+	snapshotIDs := sets.New[string]()
+	for _, snapshot := range snapshots {
+		snapshotIDs.Insert(snapshot.ID)
+	}
+
+	var errs []error
+	for _, image := range images {
+		ref := image.Spec.SnapshotRef
+		if ref == nil || snapshotIDs.Has(*ref) {
+			continue
+		}
+
+		_, err := snapshotStore.Get(ctx, *ref)
+		switch {
+		case err == nil:
+		case errors.Is(err, store.ErrNotFound):
+			errs = append(errs, fmt.Errorf("image %s references missing snapshot %s", image.ID, *ref))
+		default:
+			return fmt.Errorf("failed to get snapshot %s: %w", *ref, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateGroupSnapshotRefs checks that the group snapshots snapshots have been taken with are either
+// part of the backup or already exist in the group snapshot store.
+func validateGroupSnapshotRefs(ctx context.Context, snapshots []*api.Snapshot, groupSnapshots []*api.GroupSnapshot, groupSnapshotStore Store[*api.GroupSnapshot]) error {
+	groupSnapshotIDs := sets.New[string]()
+	for _, groupSnapshot := range groupSnapshots {
+		groupSnapshotIDs.Insert(groupSnapshot.ID)
+	}
+
+	var errs []error
+	for _, snapshot := range snapshots {
+		ref := snapshot.Source.GroupSnapshotID
+		if ref == "" || groupSnapshotIDs.Has(ref) {
+			continue
+		}
+
+		_, err := groupSnapshotStore.Get(ctx, ref)
+		switch {
+		case err == nil:
+		case errors.Is(err, store.ErrNotFound):
+			errs = append(errs, fmt.Errorf("snapshot %s references missing group snapshot %s", snapshot.ID, ref))
+		default:
+			return fmt.Errorf("failed to get group snapshot %s: %w", ref, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func restore[E apiutils.Object](ctx context.Context, log logr.Logger, s Store[E], objs []E, skipped []string, merge bool) (ObjectResult, error) {
+	res := ObjectResult{Skipped: skipped}
+	for _, obj := range objs {
+		if err := s.Restore(ctx, obj); err != nil {
+			if merge && errors.Is(err, store.ErrAlreadyExists) {
+				log.V(1).Info("Object has been created concurrently, skipping", "ID", obj.GetID())
+				res.Skipped = append(res.Skipped, obj.GetID())
+				continue
+			}
+			return res, fmt.Errorf("failed to restore object %s: %w", obj.GetID(), err)
+		}
+		log.V(1).Info("Restored object", "ID", obj.GetID())
+		res.Restored = append(res.Restored, obj.GetID())
+	}
+	return res, nil
+}
@@ -0,0 +1,271 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package backup_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/ceph-provider/api"
+	. "github.com/ironcore-dev/ceph-provider/internal/backup"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+// fakeStore is an in-memory store supporting restores.
+type fakeStore[E apiutils.Object] struct {
+	objects map[string]E
+}
+
+func newFakeStore[E apiutils.Object](objs ...E) *fakeStore[E] {
+	s := &fakeStore[E]{objects: make(map[string]E)}
+	for _, obj := range objs {
+		s.objects[obj.GetID()] = obj
+	}
+	return s
+}
+
+func (s *fakeStore[E]) Create(_ context.Context, obj E) (E, error) {
+	return obj, s.Restore(context.Background(), obj)
+}
+
+func (s *fakeStore[E]) Restore(_ context.Context, obj E) error {
+	if _, ok := s.objects[obj.GetID()]; ok {
+		return fmt.Errorf("object with id %q %w", obj.GetID(), store.ErrAlreadyExists)
+	}
+	s.objects[obj.GetID()] = obj
+	return nil
+}
+
+func (s *fakeStore[E]) Get(_ context.Context, id string) (E, error) {
+	obj, ok := s.objects[id]
+	if !ok {
+		var zero E
+		return zero, fmt.Errorf("object with id %q: %w", id, store.ErrNotFound)
+	}
+	return obj, nil
+}
+
+func (s *fakeStore[E]) Update(_ context.Context, obj E) (E, error) {
+	s.objects[obj.GetID()] = obj
+	return obj, nil
+}
+
+func (s *fakeStore[E]) Delete(_ context.Context, id string) error {
+	delete(s.objects, id)
+	return nil
+}
+
+func (s *fakeStore[E]) List(_ context.Context, _ ...store.ListOption) ([]E, error) {
+	var objs []E
+	for _, obj := range s.objects {
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+func (s *fakeStore[E]) Watch(_ context.Context, _ ...store.ListOption) (store.Watch[E], error) {
+	return nil, fmt.Errorf("watch is not supported")
+}
+
+func newImage(id string, snapshotRef *string) *api.Image {
+	return &api.Image{
+		Metadata: apiutils.Metadata{
+			ID:              id,
+			CreatedAt:       time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			ResourceVersion: 3,
+		},
+		Spec: api.ImageSpec{Size: 1024, SnapshotRef: snapshotRef},
+		Status: api.ImageStatus{
+			State: api.ImageStateAvailable,
+		},
+	}
+}
+
+func newSnapshot(id string) *api.Snapshot {
+	return &api.Snapshot{
+		Metadata: apiutils.Metadata{
+			ID:              id,
+			CreatedAt:       time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			ResourceVersion: 2,
+		},
+		Source: api.SnapshotSource{IronCoreImage: "example.org/image:latest"},
+		Status: api.SnapshotStatus{State: api.SnapshotStateReady},
+	}
+}
+
+func newGroupSnapshot(id string, snapshotIDs ...string) *api.GroupSnapshot {
+	return &api.GroupSnapshot{
+		Metadata: apiutils.Metadata{
+			ID:              id,
+			CreatedAt:       time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			ResourceVersion: 2,
+		},
+		Spec: api.GroupSnapshotSpec{VolumeImageIDs: []string{"image-1"}},
+		Status: api.GroupSnapshotStatus{
+			State:       api.GroupSnapshotStateReady,
+			SnapshotIDs: snapshotIDs,
+		},
+	}
+}
+
+func roundTrip(b *Backup, format Format) *Backup {
+	buf := &bytes.Buffer{}
+	Expect(Write(buf, b, format)).To(Succeed())
+	res, err := Read(buf)
+	Expect(err).NotTo(HaveOccurred())
+	return res
+}
+
+var _ = Describe("Backup", func() {
+	var (
+		ctx            context.Context
+		images         *fakeStore[*api.Image]
+		snapshots      *fakeStore[*api.Snapshot]
+		groupSnapshots *fakeStore[*api.GroupSnapshot]
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		images = newFakeStore(
+			newImage("image-1", nil),
+			newImage("image-2", ptr.To("snapshot-1")),
+		)
+		groupSnapshot := newSnapshot("snapshot-2")
+		groupSnapshot.Source = api.SnapshotSource{VolumeImageID: "image-1", GroupSnapshotID: "group-snapshot-1"}
+		snapshots = newFakeStore(newSnapshot("snapshot-1"), groupSnapshot)
+		groupSnapshots = newFakeStore(newGroupSnapshot("group-snapshot-1", "snapshot-2"))
+	})
+
+	DescribeTable("should restore an exported backup into empty stores",
+		func(format Format) {
+			b, err := Export(ctx, "pool", images, snapshots, groupSnapshots)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(b.Images.Items).To(HaveLen(2))
+			Expect(b.Snapshots.Items).To(HaveLen(2))
+			Expect(b.GroupSnapshots.Items).To(HaveLen(1))
+
+			targetImages := newFakeStore[*api.Image]()
+			targetSnapshots := newFakeStore[*api.Snapshot]()
+			targetGroupSnapshots := newFakeStore[*api.GroupSnapshot]()
+			res, err := Import(ctx, logr.Discard(), roundTrip(b, format), targetImages, targetSnapshots, targetGroupSnapshots, ImportOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(res.Images.Restored).To(ConsistOf("image-1", "image-2"))
+			Expect(res.Snapshots.Restored).To(ConsistOf("snapshot-1", "snapshot-2"))
+			Expect(res.GroupSnapshots.Restored).To(ConsistOf("group-snapshot-1"))
+			Expect(targetImages.objects).To(Equal(images.objects))
+			Expect(targetSnapshots.objects).To(Equal(snapshots.objects))
+			Expect(targetGroupSnapshots.objects).To(Equal(groupSnapshots.objects))
+		},
+		Entry("yaml", FormatYAML),
+		Entry("json", FormatJSON),
+	)
+
+	It("should not write anything in a dry run", func() {
+		b, err := Export(ctx, "pool", images, snapshots, groupSnapshots)
+		Expect(err).NotTo(HaveOccurred())
+
+		targetImages := newFakeStore[*api.Image]()
+		targetSnapshots := newFakeStore[*api.Snapshot]()
+		targetGroupSnapshots := newFakeStore[*api.GroupSnapshot]()
+		res, err := Import(ctx, logr.Discard(), b, targetImages, targetSnapshots, targetGroupSnapshots, ImportOptions{DryRun: true})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(res.Images.Restored).To(ConsistOf("image-1", "image-2"))
+		Expect(res.GroupSnapshots.Restored).To(ConsistOf("group-snapshot-1"))
+		Expect(targetImages.objects).To(BeEmpty())
+		Expect(targetSnapshots.objects).To(BeEmpty())
+		Expect(targetGroupSnapshots.objects).To(BeEmpty())
+	})
+
+	It("should fail on existing objects unless merging", func() {
+		b, err := Export(ctx, "pool", images, snapshots, groupSnapshots)
+		Expect(err).NotTo(HaveOccurred())
+
+		existing := newImage("image-1", nil)
+		existing.Spec.Size = 2048
+		targetImages := newFakeStore(existing)
+		targetSnapshots := newFakeStore[*api.Snapshot]()
+		targetGroupSnapshots := newFakeStore[*api.GroupSnapshot]()
+
+		_, err = Import(ctx, logr.Discard(), b, targetImages, targetSnapshots, targetGroupSnapshots, ImportOptions{})
+		Expect(err).To(MatchError(store.ErrAlreadyExists))
+		Expect(targetImages.objects).To(HaveLen(1))
+		Expect(targetSnapshots.objects).To(BeEmpty())
+
+		res, err := Import(ctx, logr.Discard(), b, targetImages, targetSnapshots, targetGroupSnapshots, ImportOptions{Merge: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Images.Restored).To(ConsistOf("image-2"))
+		Expect(res.Images.Skipped).To(ConsistOf("image-1"))
+		Expect(targetImages.objects).To(HaveKeyWithValue("image-1", existing))
+		Expect(targetImages.objects).To(HaveKey("image-2"))
+	})
+
+	It("should reject images referencing missing snapshots", func() {
+		b, err := Export(ctx, "pool", images, newFakeStore[*api.Snapshot](), groupSnapshots)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = Import(ctx, logr.Discard(), b, newFakeStore[*api.Image](), newFakeStore[*api.Snapshot](), newFakeStore[*api.GroupSnapshot](), ImportOptions{})
+		Expect(err).To(MatchError(ContainSubstring("image image-2 references missing snapshot snapshot-1")))
+
+		res, err := Import(ctx, logr.Discard(), b, newFakeStore[*api.Image](), newFakeStore(newSnapshot("snapshot-1")), newFakeStore[*api.GroupSnapshot](), ImportOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Images.Restored).To(ConsistOf("image-1", "image-2"))
+	})
+
+	It("should reject snapshots referencing missing group snapshots", func() {
+		b, err := Export(ctx, "pool", images, snapshots, newFakeStore[*api.GroupSnapshot]())
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = Import(ctx, logr.Discard(), b, newFakeStore[*api.Image](), newFakeStore[*api.Snapshot](), newFakeStore[*api.GroupSnapshot](), ImportOptions{})
+		Expect(err).To(MatchError(ContainSubstring("snapshot snapshot-2 references missing group snapshot group-snapshot-1")))
+
+		res, err := Import(ctx, logr.Discard(), b, newFakeStore[*api.Image](), newFakeStore[*api.Snapshot](), newFakeStore(newGroupSnapshot("group-snapshot-1", "snapshot-2")), ImportOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Snapshots.Restored).To(ConsistOf("snapshot-1", "snapshot-2"))
+	})
+
+	It("should reject duplicate and missing ids", func() {
+		b, err := Export(ctx, "pool", images, snapshots, groupSnapshots)
+		Expect(err).NotTo(HaveOccurred())
+		b.Images.Items = append(b.Images.Items, b.Images.Items[0], json.RawMessage(`{"spec":{}}`))
+
+		_, err = Import(ctx, logr.Discard(), b, newFakeStore[*api.Image](), newFakeStore[*api.Snapshot](), newFakeStore[*api.GroupSnapshot](), ImportOptions{})
+		Expect(err).To(MatchError(ContainSubstring("duplicate object image-1")))
+		Expect(err).To(MatchError(ContainSubstring("item 3: must specify id")))
+	})
+
+	It("should migrate objects of older api versions", func() {
+		b := &Backup{
+			APIVersion: APIVersion,
+			Kind:       Kind,
+			Snapshots: Objects{
+				Items: []json.RawMessage{
+					json.RawMessage(`{"metadata":{"id":"snapshot-1"},"status":{"state":"Populated"}}`),
+				},
+			},
+		}
+
+		targetSnapshots := newFakeStore[*api.Snapshot]()
+		_, err := Import(ctx, logr.Discard(), roundTrip(b, FormatYAML), newFakeStore[*api.Image](), targetSnapshots, newFakeStore[*api.GroupSnapshot](), ImportOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(targetSnapshots.objects["snapshot-1"].Status.State).To(Equal(api.SnapshotStateReady))
+	})
+
+	It("should reject backups of an unknown kind or version", func() {
+		_, err := Read(bytes.NewBufferString(`{"apiVersion":"v1","kind":"Other"}`))
+		Expect(err).To(MatchError(ContainSubstring(`unsupported kind "Other"`)))
+
+		_, err = Read(bytes.NewBufferString(`{"apiVersion":"v0","kind":"VolumeProviderBackup"}`))
+		Expect(err).To(MatchError(ContainSubstring(`unsupported api version "v0"`)))
+	})
+})
@@ -0,0 +1,652 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	"github.com/ironcore-dev/ceph-provider/internal/utils"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const DefaultResyncPeriod = 10 * time.Minute
+
+type Options[E apiutils.Object] struct {
+	NewFunc       func() E
+	FieldIndexers map[string]store.IndexerFunc[E]
+	// ResyncPeriod is the interval the cache is re-listed from the store in, to recover from
+	// dropped watch events. Defaults to DefaultResyncPeriod.
+	ResyncPeriod time.Duration
+}
+
+// Cache is a store.Store in front of another store. It is primed by a List of the store and kept
+// in sync by its Watch. Get and List are served from memory, using indexes on labels and the
+// registered field indexers. Writes are passed to the store and the results are written through.
+// Watches of the cache receive an event for every change of the cache, once it has been applied.
+type Cache[E apiutils.Object] struct {
+	log logr.Logger
+
+	store store.Store[E]
+
+	newFunc      func() E
+	indexers     map[string]store.IndexerFunc[E]
+	resyncPeriod time.Duration
+
+	mu      sync.RWMutex
+	synced  bool
+	objects map[string]E
+	// ids holds the ids of all objects in ascending order for paginated listing.
+	ids []string
+	// tombstones holds the creation timestamp of removed objects, so late events of a removed
+	// object do not add it again.
+	tombstones map[string]time.Time
+	// labelIndex maps label keys to label values to object ids.
+	labelIndex map[string]map[string]sets.Set[string]
+	// fieldIndex maps indexed fields to field values to object ids.
+	fieldIndex map[string]map[string]sets.Set[string]
+	watches    sets.Set[*watch[E]]
+}
+
+func New[E apiutils.Object](log logr.Logger, s store.Store[E], opts Options[E]) (*Cache[E], error) {
+	if s == nil {
+		return nil, fmt.Errorf("must specify store")
+	}
+
+	if opts.NewFunc == nil {
+		return nil, fmt.Errorf("must specify opts.NewFunc")
+	}
+
+	if opts.ResyncPeriod == 0 {
+		opts.ResyncPeriod = DefaultResyncPeriod
+	}
+
+	indexers := make(map[string]store.IndexerFunc[E], len(opts.FieldIndexers))
+	fieldIndex := make(map[string]map[string]sets.Set[string], len(opts.FieldIndexers))
+	for k, v := range opts.FieldIndexers {
+		indexers[k] = v
+		fieldIndex[k] = make(map[string]sets.Set[string])
+	}
+
+	return &Cache[E]{
+		log:          log,
+		store:        s,
+		newFunc:      opts.NewFunc,
+		indexers:     indexers,
+		resyncPeriod: opts.ResyncPeriod,
+		objects:      make(map[string]E),
+		tombstones:   make(map[string]time.Time),
+		labelIndex:   make(map[string]map[string]sets.Set[string]),
+		fieldIndex:   fieldIndex,
+		watches:      sets.New[*watch[E]](),
+	}, nil
+}
+
+// Start primes the cache and keeps it in sync with the store until ctx is done.
+func (c *Cache[E]) Start(ctx context.Context) error {
+	// The watch is started before listing, so no event between both is missed.
+	watch, err := c.store.Watch(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to watch store: %w", err)
+	}
+	defer watch.Stop()
+
+	if err := c.resync(ctx); err != nil {
+		return fmt.Errorf("failed to prime cache: %w", err)
+	}
+	c.log.V(1).Info("Cache synced")
+
+	ticker := time.NewTicker(c.resyncPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case evt := <-watch.Events():
+			c.handleEvent(evt)
+		case <-ticker.C:
+			if err := c.resync(ctx); err != nil {
+				c.log.Error(err, "Failed to resync cache")
+			}
+		}
+	}
+}
+
+func (c *Cache[E]) handleEvent(evt store.WatchEvent[E]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	obj := evt.Object
+	if evt.Type == store.WatchEventTypeDeleted && !isSoftDeleted(obj) {
+		c.remove(obj.GetID(), obj.GetCreatedAt())
+		return
+	}
+	if err := c.apply(obj, false); err != nil {
+		c.log.Error(err, "Failed to apply watch event", "ID", obj.GetID())
+	}
+}
+
+func (c *Cache[E]) resync(ctx context.Context) error {
+	c.mu.RLock()
+	known := sets.KeySet(c.objects)
+	c.mu.RUnlock()
+
+	objs, err := c.store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list store: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	listed := sets.New[string]()
+	for _, obj := range objs {
+		listed.Insert(obj.GetID())
+		if err := c.apply(obj, false); err != nil {
+			return err
+		}
+	}
+
+	// Objects cached before listing that are missing in the list have been removed, while
+	// objects not known before may have been written through while listing.
+	for id := range known.Difference(listed) {
+		if obj, ok := c.objects[id]; ok {
+			c.remove(id, obj.GetCreatedAt())
+		}
+	}
+	for id := range c.tombstones {
+		if !listed.Has(id) {
+			delete(c.tombstones, id)
+		}
+	}
+
+	c.synced = true
+	return nil
+}
+
+// isSoftDeleted reports whether obj is marked for deletion but still kept by its finalizers.
+func isSoftDeleted[E apiutils.Object](obj E) bool {
+	return obj.GetDeletedAt() != nil && len(obj.GetFinalizers()) > 0
+}
+
+// isRemoved reports whether obj has been removed from the store.
+func isRemoved[E apiutils.Object](obj E) bool {
+	return obj.GetDeletedAt() != nil && len(obj.GetFinalizers()) == 0
+}
+
+// apply stores a copy of obj. Unless authoritative, obj is ignored if it is not newer than the
+// cached object, i.e. if it belongs to an older incarnation or has no higher resource version.
+func (c *Cache[E]) apply(obj E, authoritative bool) error {
+	id := obj.GetID()
+	if isRemoved(obj) {
+		c.remove(id, obj.GetCreatedAt())
+		return nil
+	}
+
+	if !authoritative {
+		if createdAt, ok := c.tombstones[id]; ok && !obj.GetCreatedAt().After(createdAt) {
+			return nil
+		}
+		if cur, ok := c.objects[id]; ok {
+			switch {
+			case obj.GetCreatedAt().Before(cur.GetCreatedAt()):
+				return nil
+			case obj.GetCreatedAt().Equal(cur.GetCreatedAt()) && obj.GetResourceVersion() <= cur.GetResourceVersion():
+				return nil
+			}
+		}
+	}
+
+	obj, err := c.copy(obj)
+	if err != nil {
+		return err
+	}
+
+	evtType := store.WatchEventTypeCreated
+	delete(c.tombstones, id)
+	if cur, ok := c.objects[id]; ok {
+		c.unindex(cur)
+		evtType = store.WatchEventTypeUpdated
+		if isSoftDeleted(obj) && !isSoftDeleted(cur) {
+			evtType = store.WatchEventTypeDeleted
+		}
+	} else {
+		i, _ := slices.BinarySearch(c.ids, id)
+		c.ids = slices.Insert(c.ids, i, id)
+	}
+	c.objects[id] = obj
+	c.index(obj)
+	c.emit(evtType, obj, false)
+	return nil
+}
+
+func (c *Cache[E]) remove(id string, createdAt time.Time) {
+	cur, ok := c.objects[id]
+	if ok {
+		c.unindex(cur)
+		delete(c.objects, id)
+		if i, found := slices.BinarySearch(c.ids, id); found {
+			c.ids = slices.Delete(c.ids, i, i+1)
+		}
+		if createdAt.IsZero() || cur.GetCreatedAt().After(createdAt) {
+			createdAt = cur.GetCreatedAt()
+		}
+		c.emit(store.WatchEventTypeDeleted, cur, true)
+	}
+
+	if createdAt.IsZero() {
+		// Without a known incarnation, all objects created so far are considered removed.
+		createdAt = time.Now()
+	}
+	c.tombstones[id] = createdAt
+}
+
+func (c *Cache[E]) index(obj E) {
+	id := obj.GetID()
+	for key, value := range obj.GetLabels() {
+		addToIndex(c.labelIndex, key, value, id)
+	}
+	for field, fn := range c.indexers {
+		addToIndex(c.fieldIndex, field, fn(obj), id)
+	}
+}
+
+func (c *Cache[E]) unindex(obj E) {
+	id := obj.GetID()
+	for key, value := range obj.GetLabels() {
+		removeFromIndex(c.labelIndex, key, value, id)
+	}
+	for field, fn := range c.indexers {
+		removeFromIndex(c.fieldIndex, field, fn(obj), id)
+	}
+}
+
+func addToIndex(index map[string]map[string]sets.Set[string], key, value, id string) {
+	values, ok := index[key]
+	if !ok {
+		values = make(map[string]sets.Set[string])
+		index[key] = values
+	}
+	ids, ok := values[value]
+	if !ok {
+		ids = sets.New[string]()
+		values[value] = ids
+	}
+	ids.Insert(id)
+}
+
+func removeFromIndex(index map[string]map[string]sets.Set[string], key, value, id string) {
+	values := index[key]
+	ids := values[value]
+	ids.Delete(id)
+	if ids.Len() == 0 {
+		delete(values, value)
+	}
+}
+
+// copy returns a deep copy of obj, so cached objects are never shared with callers.
+func (c *Cache[E]) copy(obj E) (E, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return utils.Zero[E](), fmt.Errorf("failed to marshal obj: %w", err)
+	}
+
+	out := c.newFunc()
+	if err := json.Unmarshal(data, out); err != nil {
+		return utils.Zero[E](), fmt.Errorf("failed to unmarshal object: %w", err)
+	}
+	return out, nil
+}
+
+func (c *Cache[E]) writeThrough(obj E) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.apply(obj, true); err != nil {
+		c.log.Error(err, "Failed to write object through", "ID", obj.GetID())
+		c.remove(obj.GetID(), obj.GetCreatedAt())
+	}
+}
+
+func (c *Cache[E]) Create(ctx context.Context, obj E) (E, error) {
+	obj, err := c.store.Create(ctx, obj)
+	if err != nil {
+		return utils.Zero[E](), err
+	}
+
+	c.writeThrough(obj)
+	return obj, nil
+}
+
+func (c *Cache[E]) Update(ctx context.Context, obj E) (E, error) {
+	obj, err := c.store.Update(ctx, obj)
+	if err != nil {
+		return utils.Zero[E](), err
+	}
+
+	c.writeThrough(obj)
+	return obj, nil
+}
+
+func (c *Cache[E]) Delete(ctx context.Context, id string) error {
+	if err := c.store.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	// Delete either marks the object for deletion or removes it, so its state is read back.
+	obj, err := c.store.Get(ctx, id)
+	if err == nil {
+		c.writeThrough(obj)
+		return nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		c.log.Error(err, "Failed to get deleted object, invalidating cache entry", "ID", id)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(id, time.Time{})
+	return nil
+}
+
+func (c *Cache[E]) Get(ctx context.Context, id string) (E, error) {
+	c.mu.RLock()
+	obj, ok := c.objects[id]
+	c.mu.RUnlock()
+	if ok {
+		return c.copy(obj)
+	}
+
+	// Events of objects written by other processes may not have arrived yet, so a cache miss
+	// falls back to the store.
+	obj, err := c.store.Get(ctx, id)
+	if err != nil {
+		return utils.Zero[E](), err
+	}
+
+	c.writeThrough(obj)
+	return obj, nil
+}
+
+// emit sends an event of obj to the watches. It is called with mu held after the change has been
+// applied, so that handlers reading the cache in response to the event observe the change. removed
+// reports whether obj has been removed from the cache.
+func (c *Cache[E]) emit(evtType store.WatchEventType, obj E, removed bool) {
+	if c.watches.Len() == 0 {
+		return
+	}
+
+	id := obj.GetID()
+	obj, err := c.copy(obj)
+	if err != nil {
+		c.log.Error(err, "Failed to copy object for watch event", "ID", id)
+		return
+	}
+
+	for w := range c.watches {
+		var toSend store.WatchEvent[E]
+		switch {
+		case removed:
+			// Object was removed; forward only if the watch was tracking it.
+			if w.members.Has(id) {
+				w.members.Delete(id)
+				toSend = store.WatchEvent[E]{Type: evtType, Object: obj}
+			}
+		case c.matchesOptions(obj, w.opts):
+			w.members.Insert(id)
+			toSend = store.WatchEvent[E]{Type: evtType, Object: obj}
+		case w.members.Has(id):
+			// Object no longer matches the filter. Send deleted event.
+			w.members.Delete(id)
+			toSend = store.WatchEvent[E]{Type: store.WatchEventTypeDeleted, Object: obj}
+		}
+
+		if toSend.Type != "" {
+			select {
+			case w.events <- toSend:
+			default:
+				c.log.Info("Dropping watch event, due to full channel", "ID", id, "Type", toSend.Type)
+			}
+		}
+	}
+}
+
+type watch[E apiutils.Object] struct {
+	cache *Cache[E]
+
+	events  chan store.WatchEvent[E]
+	opts    store.ListOptions
+	members sets.Set[string]
+}
+
+func (w *watch[E]) Stop() {
+	w.cache.mu.Lock()
+	defer w.cache.mu.Unlock()
+
+	w.cache.watches.Delete(w)
+}
+
+func (w *watch[E]) Events() <-chan store.WatchEvent[E] {
+	return w.events
+}
+
+// Watch watches the changes of the cache. Objects primed into the cache after the watch has been
+// started are reported as created.
+func (c *Cache[E]) Watch(_ context.Context, opts ...store.ListOption) (store.Watch[E], error) {
+	listOpts := &store.ListOptions{}
+	for _, opt := range opts {
+		opt.ApplyToList(listOpts)
+	}
+
+	if err := c.validateFieldSelector(*listOpts); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	members := sets.New[string]()
+	for id, obj := range c.objects {
+		if c.matchesOptions(obj, *listOpts) {
+			members.Insert(id)
+		}
+	}
+
+	w := &watch[E]{
+		cache:   c,
+		events:  make(chan store.WatchEvent[E], 1024),
+		opts:    *listOpts,
+		members: members,
+	}
+	c.watches.Insert(w)
+	return w, nil
+}
+
+func (c *Cache[E]) List(ctx context.Context, opts ...store.ListOption) ([]E, error) {
+	listOpts := &store.ListOptions{}
+	for _, opt := range opts {
+		opt.ApplyToList(listOpts)
+	}
+
+	if err := c.validateFieldSelector(*listOpts); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	synced := c.synced
+	c.mu.RUnlock()
+
+	if !synced {
+		return c.store.List(ctx, opts...)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var objs []E
+	for id := range c.candidates(*listOpts) {
+		obj := c.objects[id]
+		if !c.matchesOptions(obj, *listOpts) {
+			continue
+		}
+
+		obj, err := c.copy(obj)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// ListPage lists at most pageOpts.Limit objects matching opts in the order of their ids, starting
+// after pageOpts.Continue. The returned continuation key is the id of the last object visited.
+// Before the cache is synced, all matching objects of the store are returned in a single page.
+func (c *Cache[E]) ListPage(ctx context.Context, pageOpts omap.PageOptions, opts ...store.ListOption) (*omap.Page[E], error) {
+	listOpts := &store.ListOptions{}
+	for _, opt := range opts {
+		opt.ApplyToList(listOpts)
+	}
+
+	if err := c.validateFieldSelector(*listOpts); err != nil {
+		return nil, err
+	}
+
+	if pageOpts.Limit < 0 {
+		return nil, fmt.Errorf("page limit must not be negative")
+	}
+
+	c.mu.RLock()
+	synced := c.synced
+	c.mu.RUnlock()
+
+	if !synced {
+		objs, err := c.store.List(ctx, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &omap.Page[E]{Items: objs}, nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	candidates := c.candidates(*listOpts)
+	start, found := slices.BinarySearch(c.ids, pageOpts.Continue)
+	if found {
+		start++
+	}
+
+	page := &omap.Page[E]{}
+	for i := start; i < len(c.ids); i++ {
+		if pageOpts.Limit > 0 && int64(len(page.Items)) >= pageOpts.Limit {
+			page.Continue = c.ids[i-1]
+			break
+		}
+
+		id := c.ids[i]
+		obj := c.objects[id]
+		if !candidates.Has(id) || !c.matchesOptions(obj, *listOpts) {
+			continue
+		}
+
+		obj, err := c.copy(obj)
+		if err != nil {
+			return nil, err
+		}
+		page.Items = append(page.Items, obj)
+	}
+	return page, nil
+}
+
+// candidates returns the ids of all objects that may match opts, using the label and field
+// indexes for equality, set and existence requirements.
+func (c *Cache[E]) candidates(opts store.ListOptions) sets.Set[string] {
+	var result sets.Set[string]
+	intersect := func(ids sets.Set[string]) {
+		if result == nil {
+			result = ids
+			return
+		}
+		result = result.Intersection(ids)
+	}
+
+	if opts.LabelSelector != nil {
+		if reqs, selectable := opts.LabelSelector.Requirements(); selectable {
+			for _, req := range reqs {
+				switch req.Operator() {
+				case selection.Equals, selection.DoubleEquals, selection.In:
+					ids := sets.New[string]()
+					for _, value := range req.ValuesUnsorted() {
+						ids = ids.Union(c.labelIndex[req.Key()][value])
+					}
+					intersect(ids)
+				case selection.Exists:
+					ids := sets.New[string]()
+					for _, valueIDs := range c.labelIndex[req.Key()] {
+						ids = ids.Union(valueIDs)
+					}
+					intersect(ids)
+				}
+			}
+		}
+	}
+
+	if opts.FieldSelector != nil {
+		for _, req := range opts.FieldSelector.Requirements() {
+			switch req.Operator {
+			case selection.Equals, selection.DoubleEquals:
+				intersect(sets.New[string]().Union(c.fieldIndex[req.Field][req.Value]))
+			}
+		}
+	}
+
+	if result == nil {
+		return sets.KeySet(c.objects)
+	}
+	return result
+}
+
+func (c *Cache[E]) validateFieldSelector(opts store.ListOptions) error {
+	if opts.FieldSelector == nil {
+		return nil
+	}
+	for _, req := range opts.FieldSelector.Requirements() {
+		if _, ok := c.indexers[req.Field]; !ok {
+			return fmt.Errorf("field selector references unindexed field %q", req.Field)
+		}
+	}
+	return nil
+}
+
+func (c *Cache[E]) matchesOptions(obj E, opts store.ListOptions) bool {
+	if opts.LabelSelector != nil && !opts.LabelSelector.Matches(labels.Set(obj.GetLabels())) {
+		return false
+	}
+	if opts.FieldSelector != nil {
+		merged := fields.Set{}
+		for _, req := range opts.FieldSelector.Requirements() {
+			if fn, ok := c.indexers[req.Field]; ok {
+				merged[req.Field] = fn(obj)
+			}
+		}
+		if !opts.FieldSelector.Matches(merged) {
+			return false
+		}
+	}
+	return true
+}
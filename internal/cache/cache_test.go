@@ -0,0 +1,287 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/ceph-provider/api"
+	. "github.com/ironcore-dev/ceph-provider/internal/cache"
+	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+// fakeStore is an in-memory store whose watch events are sent by the test.
+type fakeStore struct {
+	mu      sync.Mutex
+	objects map[string]*api.Image
+	lists   int
+	events  chan store.WatchEvent[*api.Image]
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		objects: make(map[string]*api.Image),
+		events:  make(chan store.WatchEvent[*api.Image], 16),
+	}
+}
+
+func (s *fakeStore) Create(_ context.Context, obj *api.Image) (*api.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.objects[obj.ID]; ok {
+		return nil, store.ErrAlreadyExists
+	}
+	obj.CreatedAt = time.Now()
+	obj.IncrementResourceVersion()
+	s.objects[obj.ID] = obj
+	return obj, nil
+}
+
+func (s *fakeStore) Get(_ context.Context, id string) (*api.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.objects[id]
+	if !ok {
+		return nil, fmt.Errorf("object with id %q: %w", id, store.ErrNotFound)
+	}
+	return obj, nil
+}
+
+func (s *fakeStore) Update(_ context.Context, obj *api.Image) (*api.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if obj.DeletedAt != nil && len(obj.Finalizers) == 0 {
+		delete(s.objects, obj.ID)
+		return obj, nil
+	}
+	obj.IncrementResourceVersion()
+	s.objects[obj.ID] = obj
+	return obj, nil
+}
+
+func (s *fakeStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.objects, id)
+	return nil
+}
+
+func (s *fakeStore) List(_ context.Context, _ ...store.ListOption) ([]*api.Image, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lists++
+	var objs []*api.Image
+	for _, obj := range s.objects {
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+func (s *fakeStore) listCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lists
+}
+
+func (s *fakeStore) Watch(_ context.Context, _ ...store.ListOption) (store.Watch[*api.Image], error) {
+	return s, nil
+}
+
+func (s *fakeStore) Stop() {}
+
+func (s *fakeStore) Events() <-chan store.WatchEvent[*api.Image] {
+	return s.events
+}
+
+func newImage(id string, lbls map[string]string, snapshotRef *string) *api.Image {
+	return &api.Image{
+		Metadata: apiutils.Metadata{ID: id, Labels: lbls},
+		Spec:     api.ImageSpec{SnapshotRef: snapshotRef},
+	}
+}
+
+var _ = Describe("Cache", func() {
+	var (
+		fake  *fakeStore
+		cache *Cache[*api.Image]
+	)
+
+	BeforeEach(func(ctx SpecContext) {
+		fake = newFakeStore()
+		_, err := fake.Create(ctx, newImage("foo", map[string]string{"class": "fast"}, ptr.To("snap-1")))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = fake.Create(ctx, newImage("bar", map[string]string{"class": "slow"}, nil))
+		Expect(err).NotTo(HaveOccurred())
+
+		cache, err = New[*api.Image](logr.Discard(), fake, Options[*api.Image]{
+			NewFunc: func() *api.Image { return &api.Image{} },
+			FieldIndexers: map[string]store.IndexerFunc[*api.Image]{
+				api.ImageSpecSnapshotRefField: api.SetupImageSpecSnapshotRefFieldIndexer,
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		cacheCtx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		go func() {
+			defer GinkgoRecover()
+			Expect(cache.Start(cacheCtx)).To(Succeed())
+		}()
+		Eventually(fake.listCount).Should(Equal(1))
+	})
+
+	It("should list objects by label and field selectors", func(ctx SpecContext) {
+		Eventually(func() ([]*api.Image, error) {
+			return cache.List(ctx, store.MatchingLabels{"class": "fast"})
+		}).Should(ConsistOf(HaveField("ID", "foo")))
+
+		Expect(cache.List(ctx, store.MatchingFields{api.ImageSpecSnapshotRefField: "snap-1"})).To(ConsistOf(HaveField("ID", "foo")))
+
+		Expect(cache.List(ctx, store.HasLabels{"class"})).To(ConsistOf(
+			HaveField("ID", "foo"),
+			HaveField("ID", "bar"),
+		))
+
+		By("ensuring lists are served without listing the store again")
+		Expect(fake.listCount()).To(Equal(1))
+	})
+
+	It("should page through objects in the order of their ids", func(ctx SpecContext) {
+		_, err := fake.Create(ctx, newImage("baz", map[string]string{"class": "fast"}, nil))
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() (*api.Image, error) {
+			return cache.Get(ctx, "baz")
+		}).ShouldNot(BeNil())
+
+		By("listing all objects page by page")
+		var (
+			ids         []string
+			continueKey string
+		)
+		for i := 0; ; i++ {
+			Expect(i).To(BeNumerically("<", 3), "too many pages")
+			page, err := cache.ListPage(ctx, omap.PageOptions{Limit: 1, Continue: continueKey})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Items).To(HaveLen(1))
+			ids = append(ids, page.Items[0].ID)
+			if page.Continue == "" {
+				break
+			}
+			continueKey = page.Continue
+		}
+		Expect(ids).To(Equal([]string{"bar", "baz", "foo"}))
+
+		By("listing the objects matching a selector page by page")
+		page, err := cache.ListPage(ctx, omap.PageOptions{Limit: 1}, store.MatchingLabels{"class": "fast"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Items).To(ConsistOf(HaveField("ID", "baz")))
+		Expect(page.Continue).To(Equal("baz"))
+
+		page, err = cache.ListPage(ctx, omap.PageOptions{Limit: 1, Continue: page.Continue}, store.MatchingLabels{"class": "fast"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Items).To(ConsistOf(HaveField("ID", "foo")))
+		Expect(page.Continue).To(BeEmpty())
+
+		By("ensuring pages are served without listing the store again")
+		Expect(fake.listCount()).To(Equal(1))
+	})
+
+	It("should reject field selectors on unindexed fields", func(ctx SpecContext) {
+		_, err := cache.List(ctx, store.MatchingFields{"spec.unknown": "foo"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should not share cached objects with callers", func(ctx SpecContext) {
+		img, err := cache.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		img.Labels["class"] = "changed"
+
+		Expect(cache.Get(ctx, "foo")).To(HaveField("Labels", HaveKeyWithValue("class", "fast")))
+	})
+
+	It("should keep indexes in sync with watch events", func(ctx SpecContext) {
+		img, err := fake.Get(ctx, "bar")
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := newImage("bar", map[string]string{"class": "fast"}, nil)
+		updated.CreatedAt = img.CreatedAt
+		updated.ResourceVersion = img.ResourceVersion + 1
+		fake.events <- store.WatchEvent[*api.Image]{Type: store.WatchEventTypeUpdated, Object: updated}
+
+		Eventually(func() ([]*api.Image, error) {
+			return cache.List(ctx, store.MatchingLabels{"class": "fast"})
+		}).Should(ConsistOf(HaveField("ID", "foo"), HaveField("ID", "bar")))
+		Expect(cache.List(ctx, store.MatchingLabels{"class": "slow"})).To(BeEmpty())
+	})
+
+	It("should ignore stale events of removed objects", func(ctx SpecContext) {
+		stale, err := cache.Get(ctx, "bar")
+		Expect(err).NotTo(HaveOccurred())
+
+		By("removing the object")
+		Expect(cache.Delete(ctx, "bar")).To(Succeed())
+
+		By("sending a stale update event of the removed object")
+		stale.ResourceVersion++
+		fake.events <- store.WatchEvent[*api.Image]{Type: store.WatchEventTypeUpdated, Object: stale}
+
+		Consistently(func() ([]*api.Image, error) {
+			return cache.List(ctx, store.MatchingLabels{"class": "slow"})
+		}).Should(BeEmpty())
+	})
+
+	It("should emit watch events once the cache has applied the change", func(ctx SpecContext) {
+		watch, err := cache.Watch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(watch.Stop)
+
+		// handle receives the next event and reads the object of the event from the cache, as the
+		// event handlers of the reconcilers do. Created events of priming the cache are skipped.
+		handle := func(evtType store.WatchEventType) (*api.Image, error) {
+			var evt store.WatchEvent[*api.Image]
+			for evt.Type == "" || evt.Type == store.WatchEventTypeCreated {
+				Eventually(watch.Events()).Should(Receive(&evt))
+			}
+			Expect(evt.Type).To(Equal(evtType))
+			return cache.Get(ctx, evt.Object.ID)
+		}
+
+		By("updating an object through the cache")
+		img, err := cache.Get(ctx, "bar")
+		Expect(err).NotTo(HaveOccurred())
+		img.Labels["class"] = "fast"
+		_, err = cache.Update(ctx, img)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(handle(store.WatchEventTypeUpdated)).To(HaveField("Labels", HaveKeyWithValue("class", "fast")))
+
+		By("updating an object in the store")
+		img, err = fake.Get(ctx, "foo")
+		Expect(err).NotTo(HaveOccurred())
+		updated := newImage("foo", map[string]string{"class": "slow"}, nil)
+		updated.CreatedAt = img.CreatedAt
+		updated.ResourceVersion = img.ResourceVersion + 1
+		fake.events <- store.WatchEvent[*api.Image]{Type: store.WatchEventTypeUpdated, Object: updated}
+		Expect(handle(store.WatchEventTypeUpdated)).To(HaveField("Labels", HaveKeyWithValue("class", "slow")))
+
+		By("removing an object from the store")
+		Expect(fake.Delete(ctx, "foo")).To(Succeed())
+		fake.events <- store.WatchEvent[*api.Image]{Type: store.WatchEventTypeDeleted, Object: updated}
+		_, err = handle(store.WatchEventTypeDeleted)
+		Expect(err).To(MatchError(store.ErrNotFound))
+	})
+})
@@ -31,6 +31,17 @@ func ConnectToRados(ctx context.Context, c Credentials) (*rados.Conn, error) {
 		return nil, fmt.Errorf("parsing cmdline args (%v) failed: %w", args, err)
 	}
 
+	// Rbd images whose snapshots are kept in the trash namespace for their clone v2 clones are moved
+	// to the rbd trash on removal, from where ceph removes them along with their last clone.
+	if err := conn.SetConfigOption("rbd_move_parent_to_trash_on_remove", "true"); err != nil {
+		return nil, fmt.Errorf("failed to enable moving parent images to the trash on removal: %w", err)
+	}
+	// Snapshots are not protected before cloning them, which only clone v2 supports. Ceph defaults to
+	// clone v1 on clusters whose require_min_compat_client is below mimic.
+	if err := conn.SetConfigOption("rbd_default_clone_format", "2"); err != nil {
+		return nil, fmt.Errorf("failed to set the default clone format: %w", err)
+	}
+
 	done := make(chan error, 1)
 	go func() {
 		done <- conn.Connect()
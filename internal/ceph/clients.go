@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ceph
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+// ImageClientMonCaps are the monitor caps of the cephx clients created for single rbd images.
+const ImageClientMonCaps = "profile rbd"
+
+// ImageObjects identifies the rados objects of an rbd image.
+type ImageObjects struct {
+	// Pool is the pool of the image.
+	Pool string
+	// DataPool is the pool the data objects of the image are stored in. Empty means Pool.
+	DataPool string
+	// Namespace is the rbd namespace of the image. Its objects are stored in the rados namespace of the
+	// same name, in Pool as well as in DataPool. Empty means the default namespace.
+	Namespace string
+	// Name is the name of the image.
+	Name string
+	// ID is the id of the image, which the names of its header objects are derived from.
+	ID string
+	// DataPrefix is the prefix of the names of the data objects of the image, as reported by ceph.
+	DataPrefix string
+}
+
+// ImageClientOSDCaps returns the osd caps granting read-write access to the objects of the given image
+// and read access to the objects of the images it reads from, e.g. its parents.
+func ImageClientOSDCaps(image ImageObjects, sources ...ImageObjects) string {
+	caps := []string{objectCaps("rx", image.Pool, image.Namespace, "rbd_id."+image.Name)}
+	caps = append(caps, imageObjectCaps("rwx", image)...)
+	for _, source := range sources {
+		caps = append(caps, imageObjectCaps("rx", source)...)
+	}
+	return strings.Join(caps, ", ")
+}
+
+func imageObjectCaps(access string, image ImageObjects) []string {
+	return []string{
+		objectCaps(access, image.Pool, image.Namespace, "rbd_header."+image.ID),
+		objectCaps(access, image.Pool, image.Namespace, "rbd_object_map."+image.ID),
+		objectCaps(access, cmp.Or(image.DataPool, image.Pool), image.Namespace, image.DataPrefix),
+	}
+}
+
+func objectCaps(access, pool, namespace, objectPrefix string) string {
+	if namespace != "" {
+		return fmt.Sprintf("allow %s pool=%s namespace=%s object_prefix %s", access, pool, namespace, objectPrefix)
+	}
+	return fmt.Sprintf("allow %s pool=%s object_prefix %s", access, pool, objectPrefix)
+}
+
+type authCommandRequest struct {
+	Prefix string   `json:"prefix"`
+	Entity string   `json:"entity"`
+	Caps   []string `json:"caps,omitempty"`
+	Format string   `json:"format,omitempty"`
+}
+
+type authKeyResponse struct {
+	Key string `json:"key"`
+}
+
+func (c *CommandClient) authCommand(req authCommandRequest) ([]byte, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s command request data: %w", req.Prefix, err)
+	}
+
+	resp, status, err := c.conn.MonCommand(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to do %s request: %s: %w", req.Prefix, status, err)
+	}
+	return resp, nil
+}
+
+func (c *CommandClient) authKeyCommand(req authCommandRequest) (string, error) {
+	resp, err := c.authCommand(req)
+	if err != nil {
+		return "", err
+	}
+
+	data := &authKeyResponse{}
+	if err := json.Unmarshal(resp, data); err != nil {
+		return "", fmt.Errorf("failed to unmarshal %s command response data: %w", req.Prefix, err)
+	}
+	return data.Key, nil
+}
+
+// ClientKey returns the key of the given cephx entity, e.g. client.volumes.
+func (c *CommandClient) ClientKey(entity string) (string, error) {
+	return c.authKeyCommand(authCommandRequest{
+		Prefix: "auth get-key",
+		Entity: entity,
+		Format: "json",
+	})
+}
+
+// EnsureImageClient creates the given cephx entity with the osd caps of an image client, or updates
+// the caps of an existing entity, and returns its key.
+func (c *CommandClient) EnsureImageClient(entity, osdCaps string) (string, error) {
+	caps := []string{"mon", ImageClientMonCaps, "osd", osdCaps}
+	key, createErr := c.authKeyCommand(authCommandRequest{
+		Prefix: "auth get-or-create-key",
+		Entity: entity,
+		Caps:   caps,
+		Format: "json",
+	})
+	if createErr == nil {
+		return key, nil
+	}
+
+	// The entity exists with other caps, e.g. since its image has been migrated or flattened.
+	if _, err := c.authCommand(authCommandRequest{
+		Prefix: "auth caps",
+		Entity: entity,
+		Caps:   caps,
+	}); err != nil {
+		return "", errors.Join(createErr, err)
+	}
+	return c.ClientKey(entity)
+}
+
+// DeleteClient deletes the given cephx entity, revoking its access. Missing entities are ignored.
+func (c *CommandClient) DeleteClient(entity string) error {
+	if _, err := c.authCommand(authCommandRequest{
+		Prefix: "auth del",
+		Entity: entity,
+	}); err != nil && !errors.Is(err, rados.ErrNotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ceph
+
+import (
+	"testing"
+)
+
+func TestImageClientOSDCaps(t *testing.T) {
+	image := ImageObjects{Pool: "ssd", DataPool: "ssd-ec", Name: "img_vol", ID: "1a2b", DataPrefix: "rbd_data.3.1a2b"}
+	parent := ImageObjects{Pool: "rbd", Name: "snap_os", ID: "3c4d", DataPrefix: "rbd_data.3c4d"}
+
+	tests := []struct {
+		sources  []ImageObjects
+		expected string
+	}{
+		{
+			expected: "allow rx pool=ssd object_prefix rbd_id.img_vol, " +
+				"allow rwx pool=ssd object_prefix rbd_header.1a2b, " +
+				"allow rwx pool=ssd object_prefix rbd_object_map.1a2b, " +
+				"allow rwx pool=ssd-ec object_prefix rbd_data.3.1a2b",
+		},
+		{
+			sources: []ImageObjects{parent},
+			expected: "allow rx pool=ssd object_prefix rbd_id.img_vol, " +
+				"allow rwx pool=ssd object_prefix rbd_header.1a2b, " +
+				"allow rwx pool=ssd object_prefix rbd_object_map.1a2b, " +
+				"allow rwx pool=ssd-ec object_prefix rbd_data.3.1a2b, " +
+				"allow rx pool=rbd object_prefix rbd_header.3c4d, " +
+				"allow rx pool=rbd object_prefix rbd_object_map.3c4d, " +
+				"allow rx pool=rbd object_prefix rbd_data.3c4d",
+		},
+		{
+			sources: []ImageObjects{{Pool: "rbd", Namespace: "tenant-a", Name: "img_src", ID: "5e6f", DataPrefix: "rbd_data.5e6f"}},
+			expected: "allow rx pool=ssd object_prefix rbd_id.img_vol, " +
+				"allow rwx pool=ssd object_prefix rbd_header.1a2b, " +
+				"allow rwx pool=ssd object_prefix rbd_object_map.1a2b, " +
+				"allow rwx pool=ssd-ec object_prefix rbd_data.3.1a2b, " +
+				"allow rx pool=rbd namespace=tenant-a object_prefix rbd_header.5e6f, " +
+				"allow rx pool=rbd namespace=tenant-a object_prefix rbd_object_map.5e6f, " +
+				"allow rx pool=rbd namespace=tenant-a object_prefix rbd_data.5e6f",
+		},
+	}
+
+	for _, tt := range tests {
+		if caps := ImageClientOSDCaps(image, tt.sources...); caps != tt.expected {
+			t.Errorf("expected caps %q, got %q", tt.expected, caps)
+		}
+	}
+}
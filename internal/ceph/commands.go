@@ -57,7 +57,9 @@ type PoolStats struct {
 }
 
 type Command interface {
-	PoolStats() (*PoolStats, error)
+	// PoolStats returns the stats of the given pool. An empty pool name refers to the pool the
+	// command client has been created for.
+	PoolStats(poolName string) (*PoolStats, error)
 }
 
 func NewCommandClient(conn *rados.Conn, poolName string) (*CommandClient, error) {
@@ -72,7 +74,11 @@ type CommandClient struct {
 	poolName string
 }
 
-func (c *CommandClient) PoolStats() (*PoolStats, error) {
+func (c *CommandClient) PoolStats(poolName string) (*PoolStats, error) {
+	if poolName == "" {
+		poolName = c.poolName
+	}
+
 	req, err := json.Marshal(CommandRequest{
 		Prefix: "df",
 		Detail: "",
@@ -93,10 +99,10 @@ func (c *CommandClient) PoolStats() (*PoolStats, error) {
 	}
 
 	for _, pool := range data.Pools {
-		if pool.Name == c.poolName {
+		if pool.Name == poolName {
 			return &pool.Stats, nil
 		}
 	}
 
-	return nil, fmt.Errorf("no pool stats with pool name %s found", c.poolName)
+	return nil, fmt.Errorf("no pool stats with pool name %s found", poolName)
 }
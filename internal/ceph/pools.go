@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ceph
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type PoolType int
+
+const (
+	PoolTypeReplicated PoolType = 1
+	PoolTypeErasure    PoolType = 3
+)
+
+const (
+	PoolFlagECOverwrites = "ec_overwrites"
+	ApplicationRBD       = "rbd"
+)
+
+type PoolDetails struct {
+	Name                string                     `json:"pool_name"`
+	Type                PoolType                   `json:"type"`
+	FlagsNames          string                     `json:"flags_names"`
+	ErasureCodeProfile  string                     `json:"erasure_code_profile"`
+	ApplicationMetadata map[string]json.RawMessage `json:"application_metadata"`
+}
+
+func (p *PoolDetails) IsErasureCoded() bool {
+	return p.Type == PoolTypeErasure
+}
+
+func (p *PoolDetails) HasFlag(flag string) bool {
+	return slices.Contains(strings.Split(p.FlagsNames, ","), flag)
+}
+
+func (p *PoolDetails) HasApplication(application string) bool {
+	_, ok := p.ApplicationMetadata[application]
+	return ok
+}
+
+// ValidateMetadataPool checks that the headers of rbd images can be stored in the pool.
+// They rely on omap, which is not supported by erasure-coded pools.
+func ValidateMetadataPool(p *PoolDetails) error {
+	if p.IsErasureCoded() {
+		return fmt.Errorf("pool %s is erasure-coded and can only be used as data pool", p.Name)
+	}
+	return nil
+}
+
+// ValidateDataPool checks that the data objects of rbd images can be stored in the pool.
+// Erasure-coded pools need overwrites to be enabled and to be tagged for rbd.
+func ValidateDataPool(p *PoolDetails) error {
+	if !p.IsErasureCoded() {
+		return nil
+	}
+	if !p.HasFlag(PoolFlagECOverwrites) {
+		return fmt.Errorf("erasure-coded pool %s does not allow overwrites, enable allow_ec_overwrites", p.Name)
+	}
+	if !p.HasApplication(ApplicationRBD) {
+		return fmt.Errorf("erasure-coded pool %s is not tagged with application %s", p.Name, ApplicationRBD)
+	}
+	return nil
+}
+
+func (c *CommandClient) PoolDetails(poolName string) (*PoolDetails, error) {
+	req, err := json.Marshal(CommandRequest{
+		Prefix: "osd pool ls",
+		Detail: "detail",
+		Format: "json",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal osd pool ls command request data: %w", err)
+	}
+
+	resp, _, err := c.conn.MonCommand(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to do osd pool ls request: %w", err)
+	}
+
+	return findPoolDetails(resp, poolName)
+}
+
+func findPoolDetails(resp []byte, poolName string) (*PoolDetails, error) {
+	var pools []PoolDetails
+	if err := json.Unmarshal(resp, &pools); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal osd pool ls command response data: %w", err)
+	}
+
+	for _, pool := range pools {
+		if pool.Name == poolName {
+			return &pool, nil
+		}
+	}
+
+	return nil, fmt.Errorf("pool %s not found", poolName)
+}
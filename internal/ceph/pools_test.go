@@ -0,0 +1,55 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ceph
+
+import (
+	"strings"
+	"testing"
+)
+
+const poolLsDetail = `[
+  {"pool": 1, "pool_name": "rbd", "type": 1, "flags_names": "hashpspool,selfmanaged_snaps", "erasure_code_profile": "", "application_metadata": {"rbd": {}}},
+  {"pool": 2, "pool_name": "ec", "type": 3, "flags_names": "hashpspool,ec_overwrites,selfmanaged_snaps", "erasure_code_profile": "k2m1", "application_metadata": {"rbd": {}}},
+  {"pool": 3, "pool_name": "ec-no-overwrites", "type": 3, "flags_names": "hashpspool", "erasure_code_profile": "k2m1", "application_metadata": {"rbd": {}}},
+  {"pool": 4, "pool_name": "ec-untagged", "type": 3, "flags_names": "hashpspool,ec_overwrites", "erasure_code_profile": "k2m1", "application_metadata": {}}
+]`
+
+func TestValidatePools(t *testing.T) {
+	tests := []struct {
+		pool        string
+		metadataErr string
+		dataErr     string
+	}{
+		{pool: "rbd"},
+		{pool: "ec", metadataErr: "erasure-coded"},
+		{pool: "ec-no-overwrites", metadataErr: "erasure-coded", dataErr: "allow_ec_overwrites"},
+		{pool: "ec-untagged", metadataErr: "erasure-coded", dataErr: "not tagged with application rbd"},
+	}
+
+	for _, tt := range tests {
+		details, err := findPoolDetails([]byte(poolLsDetail), tt.pool)
+		if err != nil {
+			t.Fatalf("failed to find pool %s: %v", tt.pool, err)
+		}
+
+		checkPoolErr(t, tt.pool, "metadata", ValidateMetadataPool(details), tt.metadataErr)
+		checkPoolErr(t, tt.pool, "data", ValidateDataPool(details), tt.dataErr)
+	}
+}
+
+func TestFindPoolDetailsNotFound(t *testing.T) {
+	if _, err := findPoolDetails([]byte(poolLsDetail), "unknown"); err == nil {
+		t.Fatal("expected an error for an unknown pool")
+	}
+}
+
+func checkPoolErr(t *testing.T, pool, kind string, err error, expected string) {
+	t.Helper()
+	switch {
+	case expected == "" && err != nil:
+		t.Errorf("pool %s: unexpected %s pool error: %v", pool, kind, err)
+	case expected != "" && (err == nil || !strings.Contains(err.Error(), expected)):
+		t.Errorf("pool %s: expected %s pool error containing %q, got %v", pool, kind, expected, err)
+	}
+}
@@ -4,8 +4,11 @@
 package controllers
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
+	"math/bits"
+	"slices"
 
 	"github.com/ceph/go-ceph/rados"
 	librbd "github.com/ceph/go-ceph/rbd"
@@ -18,8 +21,9 @@ import (
 )
 
 const (
-	ImageRBDIDPrefix    = "img_"
-	SnapshotRBDIDPrefix = "snap_"
+	ImageRBDIDPrefix         = "img_"
+	SnapshotRBDIDPrefix      = "snap_"
+	GroupSnapshotRBDIDPrefix = "grp_"
 
 	ImageSnapshotVersion = "v1"
 )
@@ -32,20 +36,172 @@ func SnapshotIDToRBDID(snapshotID string) string {
 	return SnapshotRBDIDPrefix + snapshotID
 }
 
-func getSnapshotSourceDetails(snapshot *providerapi.Snapshot) (parentName string, snapName string, err error) {
+// GroupSnapshotIDToRBDID returns the name of the rbd group of the group snapshot with the given id.
+func GroupSnapshotIDToRBDID(groupSnapshotID string) string {
+	return GroupSnapshotRBDIDPrefix + groupSnapshotID
+}
+
+// groupSnapshotMemberID returns the id of the snapshot of an image taken with a group snapshot.
+func groupSnapshotMemberID(groupSnapshotID, imageID string) string {
+	return groupSnapshotID + "-" + imageID
+}
+
+// GetSnapshotSourceDetails returns the rbd image and rbd snapshot name backing the given snapshot.
+func GetSnapshotSourceDetails(snapshot *providerapi.Snapshot) (parentName string, snapName string, err error) {
 	switch {
 	case snapshot.Source.IronCoreImage != "":
 		parentName = SnapshotIDToRBDID(snapshot.ID)
 		snapName = ImageSnapshotVersion
 	case snapshot.Source.VolumeImageID != "":
 		parentName = ImageIDToRBDID(snapshot.Source.VolumeImageID)
-		snapName = snapshot.ID
+		snapName = cmp.Or(snapshot.Source.SnapName, snapshot.ID)
 	default:
 		return "", "", fmt.Errorf("snapshot source is not present")
 	}
 	return parentName, snapName, nil
 }
 
+// ImagePool returns the pool of the rbd image backing the given image.
+func ImagePool(image *providerapi.Image, defaultPool string) string {
+	if image.Spec.Pool != "" {
+		return image.Spec.Pool
+	}
+	return defaultPool
+}
+
+// ImageDataPool returns the pool the data objects of the rbd image backing the given image are stored in.
+// defaultDataPool is the data pool of the images in the default pool, if any.
+func ImageDataPool(image *providerapi.Image, defaultPool, defaultDataPool string) string {
+	if image.Spec.DataPool != "" {
+		return image.Spec.DataPool
+	}
+	if image.Spec.Pool == "" && defaultDataPool != "" {
+		return defaultDataPool
+	}
+	return ImagePool(image, defaultPool)
+}
+
+// SnapshotPool returns the pool of the rbd image the given snapshot is taken of.
+func SnapshotPool(snapshot *providerapi.Snapshot, defaultPool string) string {
+	if snapshot.Source.Pool != "" {
+		return snapshot.Source.Pool
+	}
+	return defaultPool
+}
+
+// ImageHandle returns the handle clients access the rbd image backing the given image with, i.e.
+// pool/image or pool/namespace/image for images in an rbd namespace.
+func ImageHandle(image *providerapi.Image, defaultPool string) string {
+	if image.Spec.Namespace != "" {
+		return fmt.Sprintf("%s/%s/%s", ImagePool(image, defaultPool), image.Spec.Namespace, ImageIDToRBDID(image.ID))
+	}
+	return fmt.Sprintf("%s/%s", ImagePool(image, defaultPool), ImageIDToRBDID(image.ID))
+}
+
+// openIOContext opens an io context for the given pool that is scoped to the given rbd namespace.
+// An empty namespace is the default namespace of the pool.
+func openIOContext(conn *rados.Conn, pool, namespace string) (*rados.IOContext, error) {
+	ioCtx, err := conn.OpenIOContext(pool)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get io context for pool %s: %w", pool, err)
+	}
+	ioCtx.SetNamespace(namespace)
+	return ioCtx, nil
+}
+
+// ensureNamespace creates the given rbd namespace in the pool if it does not exist yet.
+func ensureNamespace(log logr.Logger, conn *rados.Conn, pool, namespace string) error {
+	if namespace == "" {
+		return nil
+	}
+
+	ioCtx, err := conn.OpenIOContext(pool)
+	if err != nil {
+		return fmt.Errorf("unable to get io context for pool %s: %w", pool, err)
+	}
+	defer ioCtx.Destroy()
+
+	exists, err := librbd.NamespaceExists(ioCtx, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to check if namespace %s exists in pool %s: %w", namespace, pool, err)
+	}
+	if exists {
+		return nil
+	}
+
+	if err := librbd.NamespaceCreate(ioCtx, namespace); err != nil && !errors.Is(err, librbd.ErrExist) {
+		return fmt.Errorf("failed to create namespace %s in pool %s: %w", namespace, pool, err)
+	}
+	log.V(1).Info("Created rbd namespace", "pool", pool, "namespace", namespace)
+	return nil
+}
+
+// setRBDOptions sets the features, object size and striping of an rbd image to be created or cloned.
+func setRBDOptions(options *librbd.ImageOptions, rbdOptions *providerapi.RBDOptions) error {
+	if rbdOptions == nil {
+		return nil
+	}
+
+	if len(rbdOptions.Features) > 0 {
+		features := slices.Clone(rbdOptions.Features)
+		if rbdOptions.StripeUnit != 0 && !slices.Contains(features, librbd.FeatureNameStripingV2) {
+			features = append(features, librbd.FeatureNameStripingV2)
+		}
+		if err := options.SetUint64(librbd.ImageOptionFeatures, uint64(librbd.FeatureSetFromNames(features))); err != nil {
+			return fmt.Errorf("failed to set features: %w", err)
+		}
+	}
+
+	if rbdOptions.ObjectSize != 0 {
+		if err := options.SetUint64(librbd.ImageOptionOrder, uint64(bits.TrailingZeros64(rbdOptions.ObjectSize))); err != nil {
+			return fmt.Errorf("failed to set order: %w", err)
+		}
+	}
+
+	if rbdOptions.StripeUnit != 0 {
+		if err := options.SetUint64(librbd.ImageOptionStripeUnit, rbdOptions.StripeUnit); err != nil {
+			return fmt.Errorf("failed to set stripe unit: %w", err)
+		}
+		if err := options.SetUint64(librbd.ImageOptionStripeCount, rbdOptions.StripeCount); err != nil {
+			return fmt.Errorf("failed to set stripe count: %w", err)
+		}
+	}
+	return nil
+}
+
+// getRBDOptions returns the features, object size and striping of an rbd image.
+func getRBDOptions(img *librbd.Image) (*providerapi.RBDOptions, error) {
+	features, err := img.GetFeatures()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get features: %w", err)
+	}
+	featureSet := librbd.FeatureSet(features)
+	featureNames := featureSet.Names()
+	slices.Sort(featureNames)
+
+	info, err := img.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat image: %w", err)
+	}
+
+	stripeUnit, err := img.GetStripeUnit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stripe unit: %w", err)
+	}
+
+	stripeCount, err := img.GetStripeCount()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stripe count: %w", err)
+	}
+
+	return &providerapi.RBDOptions{
+		Features:    featureNames,
+		ObjectSize:  info.Obj_size,
+		StripeUnit:  stripeUnit,
+		StripeCount: stripeCount,
+	}, nil
+}
+
 func closeImage(log logr.Logger, img *librbd.Image) {
 	if closeErr := img.Close(); closeErr != nil && !errors.Is(closeErr, librbd.ErrImageNotOpen) {
 		log.Error(closeErr, "failed to close image")
@@ -82,28 +238,8 @@ func openImage(ioCtx *rados.IOContext, imageName string) (*librbd.Image, error)
 	return img, nil
 }
 
-func flattenImage(log logr.Logger, conn *rados.Conn, pool string, imageName string) error {
-	log.V(2).Info("Flatten cloned image", "clonedImageId", imageName)
-
-	ioCtx, err := conn.OpenIOContext(pool)
-	if err != nil {
-		return fmt.Errorf("unable to open io context for pool %s: %w", pool, err)
-	}
-	defer ioCtx.Destroy()
-
-	img, err := openImage(ioCtx, imageName)
-	if err != nil {
-		return err
-	}
-	defer closeImage(log, img)
-
-	if err := img.Flatten(); err != nil {
-		return fmt.Errorf("failed to flatten cloned image %s: %w", imageName, err)
-	}
-	log.V(2).Info("Flattened cloned image", "clonedImageId", imageName)
-	return nil
-}
-
+// createSnapshot creates an rbd snapshot of the given rbd image. It is not protected, as it is cloned
+// with clone v2, which does not require protected snapshots.
 func createSnapshot(log logr.Logger, ioCtx *rados.IOContext, snapshotName string, imageName string) error {
 	img, err := openImage(ioCtx, imageName)
 	if err != nil {
@@ -111,22 +247,19 @@ func createSnapshot(log logr.Logger, ioCtx *rados.IOContext, snapshotName string
 	}
 	defer closeImage(log, img)
 
-	imgSnap, err := img.CreateSnapshot(snapshotName)
-	if err != nil {
+	if _, err := img.CreateSnapshot(snapshotName); err != nil {
 		return fmt.Errorf("unable to create snapshot %s: %w", snapshotName, err)
 	}
 	log.Info("Snapshot created")
 
-	if err := imgSnap.Protect(); err != nil {
-		return fmt.Errorf("unable to protect snapshot %s: %w", snapshotName, err)
-	}
-
 	if err := img.SetSnapshot(snapshotName); err != nil {
 		return fmt.Errorf("failed to set snapshot %s for image %s: %w", snapshotName, imageName, err)
 	}
 	return nil
 }
 
+// removeSnapshot unprotects and removes an rbd snapshot. Snapshots that still have clone v2 clones are
+// moved to the trash namespace by ceph and removed along with their last clone.
 func removeSnapshot(snapshot *librbd.Snapshot) error {
 	isProtected, err := snapshot.IsProtected()
 	if err != nil {
@@ -145,59 +278,92 @@ func removeSnapshot(snapshot *librbd.Snapshot) error {
 	return nil
 }
 
-func flattenChildImages(log logr.Logger, conn *rados.Conn, img *librbd.Image) error {
-	pools, childImgs, err := img.ListChildren()
-	if err != nil {
-		return fmt.Errorf("unable to list children: %w", err)
-	}
-	log.V(2).Info("Snapshot references", "pools", len(pools), "rbd-images", len(childImgs))
-
-	for i, snapChildImgName := range childImgs {
-		if err := flattenImage(log, conn, pools[i], snapChildImgName); err != nil {
-			return err
-		}
-	}
-	return nil
+func snapshotExists(log logr.Logger, ioCtx *rados.IOContext, imageName string, snapshotName string) (bool, error) {
+	_, exists, err := findSnapshot(log, ioCtx, imageName, snapshotName)
+	return exists, err
 }
 
-func snapshotExistsAndProtected(log logr.Logger, ioCtx *rados.IOContext, imageName string, snapshotName string) (bool, bool, error) {
+// findSnapshot returns the id of the rbd snapshot with the given name of an rbd image, if it exists.
+// Unlike librbd, which only looks up snapshots in the user namespace by name, it also finds the rbd
+// snapshots of group snapshots.
+func findSnapshot(log logr.Logger, ioCtx *rados.IOContext, imageName string, snapshotName string) (uint64, bool, error) {
 	img, err := openImage(ioCtx, imageName)
 	if err != nil {
 		if errors.Is(err, librbd.ErrNotFound) {
-			return false, false, nil
+			return 0, false, nil
 		}
-		return false, false, err
+		return 0, false, err
 	}
 	defer closeImage(log, img)
 
-	snapshot := img.GetSnapshot(snapshotName)
-	if isProtected, err := snapshot.IsProtected(); err != nil {
-		if !errors.Is(err, librbd.ErrNotFound) {
-			return false, false, fmt.Errorf("failed to check if snapshot %s is protected: %w", snapshotName, err)
+	snaps, err := img.GetSnapshotNames()
+	if err != nil {
+		return 0, false, fmt.Errorf("unable to list snapshots: %w", err)
+	}
+	for _, snap := range snaps {
+		if snap.Name == snapshotName {
+			return snap.Id, true, nil
 		}
-		return false, false, nil
-	} else if !isProtected {
-		log.V(2).Info("Snapshot exists but is not protected", "snapshotId", snapshotName)
-		return true, false, nil
 	}
-	log.V(2).Info("Snapshot already exists and is protected", "snapshotId", snapshotName)
-	return true, true, nil
+	return 0, false, nil
 }
 
-func protectSnapshot(log logr.Logger, ioCtx *rados.IOContext, imageName string, snapshotName string) error {
-	img, err := openImage(ioCtx, imageName)
+// unprotectSnapshot unprotects an rbd snapshot that was protected for clone v1 if it has no clones
+// anymore, so that it is moved to the trash namespace on removal instead of requiring its clones to
+// be flattened. Snapshots with clones stay protected.
+func unprotectSnapshot(log logr.Logger, ioCtx *rados.IOContext, imageName string, snapshotName string) error {
+	img, err := librbd.OpenImage(ioCtx, imageName, snapshotName)
 	if err != nil {
-		return err
+		if errors.Is(err, librbd.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to open image %s at snapshot %s: %w", imageName, snapshotName, err)
 	}
 	defer closeImage(log, img)
 
 	snapshot := img.GetSnapshot(snapshotName)
-	if err := snapshot.Protect(); err != nil {
-		return fmt.Errorf("unable to protect existing snapshot %s: %w", snapshotName, err)
+	isProtected, err := snapshot.IsProtected()
+	if err != nil {
+		return fmt.Errorf("failed to check if snapshot %s is protected: %w", snapshotName, err)
 	}
-	if err := img.SetSnapshot(snapshotName); err != nil {
-		return fmt.Errorf("failed to set snapshot %s for image %s: %w", snapshotName, imageName, err)
+	if !isProtected {
+		return nil
 	}
-	log.V(2).Info("Successfully protected snapshot", "snapshotId", snapshotName)
+
+	children, err := img.ListChildrenAttributes()
+	if err != nil {
+		return fmt.Errorf("unable to list children: %w", err)
+	}
+	if len(children) > 0 {
+		log.V(2).Info("Snapshot has clones, keeping it protected", "snapshotId", snapshotName, "clones", len(children))
+		return nil
+	}
+
+	if err := snapshot.Unprotect(); err != nil {
+		return fmt.Errorf("unable to unprotect snapshot %s: %w", snapshotName, err)
+	}
+	log.V(1).Info("Unprotected snapshot", "snapshotId", snapshotName)
 	return nil
 }
+
+// snapshotsInNamespace returns the rbd snapshots of img in the given snapshot namespace. The snapshots
+// created by the provider are in the user namespace. Ceph moves them to the trash namespace if they are
+// removed while they still have clones.
+func snapshotsInNamespace(img *librbd.Image, nsType librbd.SnapNamespaceType) ([]librbd.SnapInfo, error) {
+	snaps, err := img.GetSnapshotNames()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list snapshots: %w", err)
+	}
+
+	var res []librbd.SnapInfo
+	for _, snap := range snaps {
+		snapNSType, err := img.GetSnapNamespaceType(snap.Id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get namespace of snapshot %s: %w", snap.Name, err)
+		}
+		if snapNSType == nsType {
+			res = append(res, snap)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// executions tracks long-running operations on rbd images executed in the background, e.g. executing
+// a migration or rolling back to a snapshot, which copy the data of an rbd image and must not block a
+// reconcile worker.
+type executions struct {
+	mu      sync.Mutex
+	running sets.Set[string]
+	results map[string]error
+}
+
+func newExecutions() *executions {
+	return &executions{
+		running: sets.New[string](),
+		results: map[string]error{},
+	}
+}
+
+// start runs execute for the given image id unless it is already running. done is called afterward.
+func (e *executions) start(id string, execute func() error, done func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running.Has(id) {
+		return
+	}
+	e.running.Insert(id)
+	delete(e.results, id)
+
+	go func() {
+		err := execute()
+
+		e.mu.Lock()
+		e.running.Delete(id)
+		e.results[id] = err
+		e.mu.Unlock()
+
+		done()
+	}()
+}
+
+// result returns whether the operation of the given image id is running, and whether its last
+// execution finished along with its error. The result is kept until it is forgotten or the operation
+// is started again, so that it is not lost if it could not be recorded.
+func (e *executions) result(id string) (running, finished bool, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running.Has(id) {
+		return true, false, nil
+	}
+	err, finished = e.results[id]
+	return false, finished, err
+}
+
+// forget drops the result of the last execution of the given image id once it has been recorded.
+func (e *executions) forget(id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.results, id)
+}
@@ -0,0 +1,189 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/ceph/go-ceph/rbd/admin"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+const flattenTaskAction = "flatten"
+
+// flattenTasks flattens cloned rbd images in the background with tasks of the rbd_support module of
+// the ceph manager, so that flattening does not block a reconcile worker. The tasks are persisted by
+// ceph and are found again by the rbd image they flatten, so that they are resumed after a restart.
+type flattenTasks struct {
+	tasks *admin.TaskAdmin
+}
+
+func newFlattenTasks(conn *rados.Conn) *flattenTasks {
+	return &flattenTasks{
+		tasks: admin.NewFromConn(conn).Task(),
+	}
+}
+
+// flattenChildren adds a flatten task for every rbd image cloned from img that has none yet. It returns
+// the progress of the tasks, or nil once all cloned rbd images are flattened.
+func (f *flattenTasks) flattenChildren(log logr.Logger, img *librbd.Image) (*providerapi.FlattenStatus, error) {
+	children, err := img.ListChildrenAttributes()
+	if err != nil {
+		return nil, fmt.Errorf("unable to list children: %w", err)
+	}
+	log.V(2).Info("Snapshot references", "rbd-images", len(children))
+	if len(children) == 0 {
+		return nil, nil
+	}
+
+	tasks, err := f.tasks.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list flatten tasks: %w", err)
+	}
+
+	status := &providerapi.FlattenStatus{Images: len(children)}
+	var progress float64
+	for _, child := range children {
+		// Cloned rbd images in the trash are flattened or removed once they are restored or purged.
+		if child.Trash {
+			log.V(2).Info("Cloned image is in the trash", "clonedImageId", child.ImageName)
+			continue
+		}
+
+		task := findFlattenTask(tasks, child.PoolName, child.PoolNamespace, child.ImageName)
+		if task == nil {
+			log.V(1).Info("Adding flatten task", "clonedImageId", child.ImageName)
+			added, err := f.tasks.AddFlatten(admin.NewImageSpec(child.PoolName, child.PoolNamespace, child.ImageName))
+			if err != nil {
+				return nil, fmt.Errorf("failed to add flatten task for cloned image %s: %w", child.ImageName, err)
+			}
+			task = &added
+		}
+
+		progress += task.Progress
+		if task.RetryMessage != "" {
+			status.Message = fmt.Sprintf("flattening cloned image %s: %s", child.ImageName, task.RetryMessage)
+		}
+	}
+	status.Progress = progress / float64(len(children))
+	return status, nil
+}
+
+// cancel cancels the task flattening the given rbd image, e.g. because it is removed anyway.
+func (f *flattenTasks) cancel(log logr.Logger, pool, namespace, imageName string) error {
+	tasks, err := f.tasks.List()
+	if err != nil {
+		return fmt.Errorf("failed to list flatten tasks: %w", err)
+	}
+	return f.cancelTask(log, findFlattenTask(tasks, pool, namespace, imageName))
+}
+
+// cancelChildren cancels the tasks flattening the rbd images cloned from img, e.g. because the deletion
+// of img has been revoked.
+func (f *flattenTasks) cancelChildren(log logr.Logger, img *librbd.Image) error {
+	children, err := img.ListChildrenAttributes()
+	if err != nil {
+		return fmt.Errorf("unable to list children: %w", err)
+	}
+
+	tasks, err := f.tasks.List()
+	if err != nil {
+		return fmt.Errorf("failed to list flatten tasks: %w", err)
+	}
+
+	for _, child := range children {
+		if err := f.cancelTask(log, findFlattenTask(tasks, child.PoolName, child.PoolNamespace, child.ImageName)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *flattenTasks) cancelTask(log logr.Logger, task *admin.TaskResponse) error {
+	if task == nil {
+		return nil
+	}
+
+	log.V(1).Info("Cancelling flatten task", "taskId", task.ID, "clonedImageId", task.Refs.ImageName)
+	if _, err := f.tasks.Cancel(task.ID); err != nil {
+		return fmt.Errorf("failed to cancel flatten task %s: %w", task.ID, err)
+	}
+	return nil
+}
+
+// flattenChildImages flattens the rbd images cloned from the snapshots of img in the background and
+// tracks their progress in the status of the image. It returns false while they are not flattened yet.
+func (r *ImageReconciler) flattenChildImages(ctx context.Context, log logr.Logger, img *librbd.Image, image *providerapi.Image) (bool, error) {
+	flatten, err := r.flatten.flattenChildren(log, img)
+	if err != nil {
+		return false, fmt.Errorf("failed to flatten snapshot child images: %w", err)
+	}
+
+	if !ptr.Equal(image.Status.Flatten, flatten) {
+		started, done := image.Status.Flatten == nil, flatten == nil
+		image.Status.Flatten = flatten
+		if _, err := r.images.Update(ctx, image); err != nil {
+			return false, fmt.Errorf("failed to update image flatten status: %w", err)
+		}
+		switch {
+		case started:
+			r.Eventf(image.Metadata, corev1.EventTypeNormal, "FlatteningChildImages", "DeleteImage", "Flattening %d images cloned from the image snapshots", flatten.Images)
+		case done:
+			r.Eventf(image.Metadata, corev1.EventTypeNormal, "FlattenedChildImages", "DeleteImage", "Flattened the images cloned from the image snapshots")
+		}
+	}
+
+	if flatten != nil {
+		log.V(1).Info("Waiting for snapshot child images to be flattened", "images", flatten.Images, "progress", flatten.Progress)
+		r.queue.AddAfter(image.ID, r.flattenPollInterval)
+		return false, nil
+	}
+	return true, nil
+}
+
+// cancelFlattenChildImages cancels flattening the rbd images cloned from the snapshots of an image
+// whose deletion has been revoked.
+func (r *ImageReconciler) cancelFlattenChildImages(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
+	img, err := openImage(ioCtx, ImageIDToRBDID(image.ID))
+	if err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return err
+	}
+	if err == nil {
+		defer closeImage(log, img)
+		if err := r.flatten.cancelChildren(log, img); err != nil {
+			return err
+		}
+	}
+
+	image.Status.Flatten = nil
+	if _, err := r.images.Update(ctx, image); err != nil {
+		return fmt.Errorf("failed to update image flatten status: %w", err)
+	}
+	r.Eventf(image.Metadata, corev1.EventTypeNormal, "CancelledFlatteningChildImages", "ReconcileImage", "Cancelled flattening the images cloned from the image snapshots")
+	log.V(1).Info("Cancelled flattening snapshot child images")
+	return nil
+}
+
+func findFlattenTask(tasks []admin.TaskResponse, pool, namespace, imageName string) *admin.TaskResponse {
+	for i, task := range tasks {
+		if isFlattenTask(task, pool, namespace, imageName) {
+			return &tasks[i]
+		}
+	}
+	return nil
+}
+
+func isFlattenTask(task admin.TaskResponse, pool, namespace, imageName string) bool {
+	return task.Refs.Action == flattenTaskAction &&
+		task.Refs.PoolName == pool &&
+		task.Refs.PoolNamespace == namespace &&
+		task.Refs.ImageName == imageName
+}
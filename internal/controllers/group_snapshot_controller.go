@@ -0,0 +1,542 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/utils"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/eventutils/event"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	GroupSnapshotFinalizer = "group-snapshot"
+)
+
+type GroupSnapshotReconcilerOptions struct {
+	Pool       string
+	WorkerSize int
+}
+
+func NewGroupSnapshotReconciler(
+	log logr.Logger,
+	conn *rados.Conn,
+	store store.Store[*providerapi.GroupSnapshot],
+	snapshots store.Store[*providerapi.Snapshot],
+	images store.Store[*providerapi.Image],
+	events event.Source[*providerapi.GroupSnapshot],
+	snapshotEvents event.Source[*providerapi.Snapshot],
+	opts GroupSnapshotReconcilerOptions,
+) (*GroupSnapshotReconciler, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("must specify conn")
+	}
+
+	if store == nil {
+		return nil, fmt.Errorf("must specify store")
+	}
+
+	if snapshots == nil {
+		return nil, fmt.Errorf("must specify snapshot store")
+	}
+
+	if images == nil {
+		return nil, fmt.Errorf("must specify image store")
+	}
+
+	if events == nil {
+		return nil, fmt.Errorf("must specify events")
+	}
+
+	if snapshotEvents == nil {
+		return nil, fmt.Errorf("must specify snapshot events")
+	}
+
+	if opts.Pool == "" {
+		return nil, fmt.Errorf("must specify pool")
+	}
+
+	if opts.WorkerSize == 0 {
+		opts.WorkerSize = 15
+	}
+
+	return &GroupSnapshotReconciler{
+		log:            log,
+		conn:           conn,
+		queue:          workqueue.NewTypedRateLimitingQueue[string](workqueue.DefaultTypedControllerRateLimiter[string]()),
+		store:          store,
+		snapshots:      snapshots,
+		images:         images,
+		events:         events,
+		snapshotEvents: snapshotEvents,
+		pool:           opts.Pool,
+		workerSize:     opts.WorkerSize,
+	}, nil
+}
+
+// GroupSnapshotReconciler takes crash-consistent snapshots of several images with rbd groups. The rbd
+// images are added to an rbd group, snapshotted together and removed from the rbd group again, so that
+// they can be part of other group snapshots. A snapshot is recorded for each image, which can be
+// restored like any other snapshot. The group snapshot and its rbd group are removed once all its
+// snapshots are deleted.
+type GroupSnapshotReconciler struct {
+	log   logr.Logger
+	conn  *rados.Conn
+	queue workqueue.TypedRateLimitingInterface[string]
+
+	store          store.Store[*providerapi.GroupSnapshot]
+	snapshots      store.Store[*providerapi.Snapshot]
+	images         store.Store[*providerapi.Image]
+	events         event.Source[*providerapi.GroupSnapshot]
+	snapshotEvents event.Source[*providerapi.Snapshot]
+
+	pool string
+
+	workerSize int
+}
+
+func (r *GroupSnapshotReconciler) Start(ctx context.Context) error {
+	log := r.log
+
+	reg, err := r.events.AddHandler(event.HandlerFunc[*providerapi.GroupSnapshot](func(evt event.Event[*providerapi.GroupSnapshot]) {
+		r.queue.Add(evt.Object.ID)
+	}))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = r.events.RemoveHandler(reg)
+	}()
+
+	snapEventReg, err := r.snapshotEvents.AddHandler(event.HandlerFunc[*providerapi.Snapshot](func(evt event.Event[*providerapi.Snapshot]) {
+		// The group snapshot is removed once the last of its snapshots is deleted.
+		if id := evt.Object.Source.GroupSnapshotID; evt.Type == event.TypeDeleted && id != "" {
+			r.queue.Add(id)
+		}
+	}))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = r.snapshotEvents.RemoveHandler(snapEventReg)
+	}()
+
+	go func() {
+		<-ctx.Done()
+		r.queue.ShutDown()
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < r.workerSize; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r.processNextWorkItem(ctx, log) {
+			}
+		}()
+	}
+
+	wg.Wait()
+	return nil
+}
+
+func (r *GroupSnapshotReconciler) processNextWorkItem(ctx context.Context, log logr.Logger) bool {
+	id, shutdown := r.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer r.queue.Done(id)
+
+	log = log.WithValues("groupSnapshotId", id)
+	ctx = logr.NewContext(ctx, log)
+
+	if err := r.reconcileGroupSnapshot(ctx, id); err != nil {
+		log.Error(err, "failed to reconcile group snapshot")
+		r.queue.AddRateLimited(id)
+		return true
+	}
+
+	r.queue.Forget(id)
+	return true
+}
+
+func (r *GroupSnapshotReconciler) reconcileGroupSnapshot(ctx context.Context, id string) error {
+	log := logr.FromContextOrDiscard(ctx)
+	log.V(2).Info("Get group snapshot from store")
+	groupSnapshot, err := r.store.Get(ctx, id)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("failed to fetch group snapshot from store: %w", err)
+		}
+		return nil
+	}
+
+	if groupSnapshot.DeletedAt != nil {
+		if err := r.deleteGroupSnapshot(ctx, log, groupSnapshot); err != nil {
+			return fmt.Errorf("failed to delete group snapshot: %w", err)
+		}
+		log.V(1).Info("Successfully deleted group snapshot")
+		return nil
+	}
+
+	if !slices.Contains(groupSnapshot.Finalizers, GroupSnapshotFinalizer) {
+		groupSnapshot.Finalizers = append(groupSnapshot.Finalizers, GroupSnapshotFinalizer)
+		if _, err := r.store.Update(ctx, groupSnapshot); err != nil {
+			return fmt.Errorf("failed to set finalizers: %w", err)
+		}
+	}
+
+	switch groupSnapshot.Status.State {
+	case providerapi.GroupSnapshotStateReady:
+		return r.releaseGroupSnapshot(ctx, log, groupSnapshot)
+	case providerapi.GroupSnapshotStateFailed:
+		log.V(1).Info("Group snapshot failed, not retrying", "message", groupSnapshot.Status.Message)
+		return nil
+	default:
+		return r.takeGroupSnapshot(ctx, log, groupSnapshot)
+	}
+}
+
+// takeGroupSnapshot snapshots the rbd images of the group snapshot together and records a snapshot
+// for each of them. All steps are repeatable, so that an interrupted group snapshot is completed.
+func (r *GroupSnapshotReconciler) takeGroupSnapshot(ctx context.Context, log logr.Logger, groupSnapshot *providerapi.GroupSnapshot) error {
+	images, message, err := r.getGroupSnapshotImages(ctx, groupSnapshot)
+	if err != nil {
+		return err
+	}
+	if message != "" {
+		return r.failGroupSnapshot(ctx, groupSnapshot, message)
+	}
+
+	// The pool is recorded before the rbd group is created, so that it is removed along with the group snapshot.
+	pool, namespace := ImagePool(images[0], r.pool), images[0].Spec.Namespace
+	if groupSnapshot.Status.Pool != pool || groupSnapshot.Status.Namespace != namespace {
+		groupSnapshot.Status.Pool, groupSnapshot.Status.Namespace = pool, namespace
+		if _, err := r.store.Update(ctx, groupSnapshot); err != nil {
+			return fmt.Errorf("failed to update group snapshot: %w", err)
+		}
+	}
+
+	ioCtx, err := openIOContext(r.conn, pool, namespace)
+	if err != nil {
+		return err
+	}
+	defer ioCtx.Destroy()
+
+	groupName := GroupSnapshotIDToRBDID(groupSnapshot.ID)
+	taken, err := isGroupSnapshotTaken(log, ioCtx, groupName, groupSnapshot.ID)
+	if err != nil {
+		return err
+	}
+	if !taken {
+		if err := r.snapshotGroup(log, ioCtx, groupName, groupSnapshot.ID, images); err != nil {
+			return err
+		}
+	}
+
+	// The rbd images leave the rbd group once they are snapshotted, so that they can be part of other
+	// group snapshots. Their rbd snapshots of the group snapshot are kept.
+	for _, image := range images {
+		if err := librbd.GroupImageRemove(ioCtx, groupName, ioCtx, ImageIDToRBDID(image.ID)); err != nil && !errors.Is(err, librbd.ErrNotFound) {
+			return fmt.Errorf("failed to remove rbd image %s from rbd group: %w", ImageIDToRBDID(image.ID), err)
+		}
+	}
+
+	info, err := librbd.GroupSnapGetInfo(ioCtx, groupName, groupSnapshot.ID)
+	if err != nil {
+		// Librbd supports looking up and cloning the rbd snapshots of group snapshots as of ceph squid.
+		// The rbd group snapshot is removed right away, as the rbd images cannot be removed while
+		// they have rbd snapshots of it.
+		if errors.Is(err, librbd.ErrNotImplemented) {
+			if err := removeGroup(log, ioCtx, groupName, groupSnapshot.ID); err != nil {
+				return err
+			}
+			return r.failGroupSnapshot(ctx, groupSnapshot, fmt.Sprintf("group snapshots are not supported by librbd: %s", err))
+		}
+		return fmt.Errorf("failed to get rbd group snapshot info: %w", err)
+	}
+
+	var snapshotIDs []string
+	for _, image := range images {
+		snapshot, err := r.createGroupSnapshotMember(ctx, log, groupSnapshot, image, info.SnapName)
+		if err != nil {
+			return err
+		}
+		snapshotIDs = append(snapshotIDs, snapshot.ID)
+	}
+
+	groupSnapshot.Status.State = providerapi.GroupSnapshotStateReady
+	groupSnapshot.Status.SnapshotIDs = snapshotIDs
+	if _, err := r.store.Update(ctx, groupSnapshot); err != nil {
+		return fmt.Errorf("failed to update group snapshot: %w", err)
+	}
+	log.V(1).Info("Group snapshot is ready", "snapshots", snapshotIDs)
+	return nil
+}
+
+// getGroupSnapshotImages returns the images of the group snapshot. If they cannot be snapshotted
+// together, the reason is returned as message.
+func (r *GroupSnapshotReconciler) getGroupSnapshotImages(ctx context.Context, groupSnapshot *providerapi.GroupSnapshot) ([]*providerapi.Image, string, error) {
+	if len(groupSnapshot.Spec.VolumeImageIDs) == 0 {
+		return nil, "group snapshot has no volumes", nil
+	}
+
+	var images []*providerapi.Image
+	for _, id := range groupSnapshot.Spec.VolumeImageIDs {
+		image, err := r.images.Get(ctx, id)
+		if err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				return nil, "", fmt.Errorf("failed to get image %s: %w", id, err)
+			}
+			return nil, fmt.Sprintf("volume %s not found", id), nil
+		}
+		if image.DeletedAt != nil || image.Status.IsReleased() {
+			return nil, fmt.Sprintf("volume %s is deleted", id), nil
+		}
+		if image.Spec.Migration != nil || image.Status.Migration.IsActive() {
+			return nil, fmt.Sprintf("volume %s is being migrated", id), nil
+		}
+		if image.Status.State != providerapi.ImageStateAvailable {
+			return nil, "", fmt.Errorf("volume %s is not available, current state is: %s", id, image.Status.State)
+		}
+		if len(images) > 0 && (ImagePool(image, r.pool) != ImagePool(images[0], r.pool) || image.Spec.Namespace != images[0].Spec.Namespace) {
+			return nil, fmt.Sprintf("volume %s is not in the pool and rbd namespace of volume %s", id, images[0].ID), nil
+		}
+		images = append(images, image)
+	}
+	return images, "", nil
+}
+
+// isGroupSnapshotTaken reports whether the rbd group snapshot has been taken. Incomplete rbd group
+// snapshots, e.g. of an interrupted snapshot, are removed to be taken again.
+func isGroupSnapshotTaken(log logr.Logger, ioCtx *rados.IOContext, groupName, snapName string) (bool, error) {
+	snaps, err := librbd.GroupSnapList(ioCtx, groupName)
+	if err != nil {
+		if errors.Is(err, librbd.ErrNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to list rbd group snapshots: %w", err)
+	}
+
+	for _, snap := range snaps {
+		if snap.Name != snapName {
+			continue
+		}
+		if snap.State == librbd.GroupSnapStateComplete {
+			return true, nil
+		}
+
+		log.V(1).Info("Removing incomplete rbd group snapshot")
+		if err := librbd.GroupSnapRemove(ioCtx, groupName, snapName); err != nil {
+			return false, fmt.Errorf("failed to remove incomplete rbd group snapshot: %w", err)
+		}
+	}
+	return false, nil
+}
+
+// snapshotGroup adds the rbd images to the rbd group and snapshots them together.
+func (r *GroupSnapshotReconciler) snapshotGroup(log logr.Logger, ioCtx *rados.IOContext, groupName, snapName string, images []*providerapi.Image) error {
+	log.V(2).Info("Creating rbd group", "group", groupName)
+	if err := librbd.GroupCreate(ioCtx, groupName); err != nil && !errors.Is(err, librbd.ErrExist) {
+		return fmt.Errorf("failed to create rbd group: %w", err)
+	}
+
+	for _, image := range images {
+		if err := addGroupImage(log, ioCtx, groupName, ImageIDToRBDID(image.ID)); err != nil {
+			return err
+		}
+	}
+
+	log.V(1).Info("Creating rbd group snapshot", "images", len(images))
+	if err := librbd.GroupSnapCreate(ioCtx, groupName, snapName); err != nil {
+		return fmt.Errorf("failed to create rbd group snapshot: %w", err)
+	}
+	return nil
+}
+
+// addGroupImage adds an rbd image to the rbd group unless it is already a member. Rbd images can
+// only be member of one rbd group, so adding it fails while it is snapshotted with another group.
+func addGroupImage(log logr.Logger, ioCtx *rados.IOContext, groupName, imageName string) error {
+	img, err := openImage(ioCtx, imageName)
+	if err != nil {
+		return err
+	}
+	group, err := img.GetGroup()
+	closeImage(log, img)
+	if err != nil {
+		return fmt.Errorf("failed to get rbd group of rbd image %s: %w", imageName, err)
+	}
+
+	switch group.Name {
+	case groupName:
+		return nil
+	case "":
+		log.V(2).Info("Adding rbd image to rbd group", "image", imageName)
+		if err := librbd.GroupImageAdd(ioCtx, groupName, ioCtx, imageName); err != nil {
+			return fmt.Errorf("failed to add rbd image %s to rbd group: %w", imageName, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("rbd image %s is member of rbd group %s", imageName, group.Name)
+	}
+}
+
+// createGroupSnapshotMember records the snapshot of an image taken with the group snapshot.
+func (r *GroupSnapshotReconciler) createGroupSnapshotMember(ctx context.Context, log logr.Logger, groupSnapshot *providerapi.GroupSnapshot, image *providerapi.Image, snapName string) (*providerapi.Snapshot, error) {
+	snapshot := &providerapi.Snapshot{
+		Metadata: apiutils.Metadata{
+			ID:         groupSnapshotMemberID(groupSnapshot.ID, image.ID),
+			Finalizers: []string{SnapshotFinalizer},
+		},
+		Source: providerapi.SnapshotSource{
+			VolumeImageID:   image.ID,
+			Pool:            image.Spec.Pool,
+			Namespace:       image.Spec.Namespace,
+			GroupSnapshotID: groupSnapshot.ID,
+			SnapName:        snapName,
+		},
+	}
+	if err := providerapi.SetLabelsAnnotationForOject(snapshot, map[string]string{}); err != nil {
+		return nil, fmt.Errorf("failed to set snapshot labels: %w", err)
+	}
+	if err := providerapi.SetAnnotationsAnnotationForObject(snapshot, map[string]string{}); err != nil {
+		return nil, fmt.Errorf("failed to set snapshot annotations: %w", err)
+	}
+	providerapi.SetManagerLabel(snapshot, providerapi.VolumeManager)
+
+	created, err := r.snapshots.Create(ctx, snapshot)
+	switch {
+	case err == nil:
+		snapshot = created
+	case errors.Is(err, store.ErrAlreadyExists):
+		if snapshot, err = r.snapshots.Get(ctx, snapshot.ID); err != nil {
+			return nil, fmt.Errorf("failed to get snapshot: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("failed to create snapshot: %w", err)
+	}
+
+	if snapshot.Status.State == providerapi.SnapshotStateReady {
+		return snapshot, nil
+	}
+	snapshot.Status.State = providerapi.SnapshotStateReady
+	snapshot.Status.Size = int64(image.Status.Size)
+	if _, err := r.snapshots.Update(ctx, snapshot); err != nil {
+		return nil, fmt.Errorf("failed to update snapshot: %w", err)
+	}
+	log.V(2).Info("Recorded snapshot of group snapshot", "snapshotId", snapshot.ID, "imageId", image.ID)
+	return snapshot, nil
+}
+
+func (r *GroupSnapshotReconciler) failGroupSnapshot(ctx context.Context, groupSnapshot *providerapi.GroupSnapshot, message string) error {
+	groupSnapshot.Status.State = providerapi.GroupSnapshotStateFailed
+	groupSnapshot.Status.Message = message
+	if _, err := r.store.Update(ctx, groupSnapshot); err != nil {
+		return fmt.Errorf("failed to update group snapshot: %w", err)
+	}
+	return nil
+}
+
+// releaseGroupSnapshot deletes a ready group snapshot once all its snapshots have been deleted.
+func (r *GroupSnapshotReconciler) releaseGroupSnapshot(ctx context.Context, log logr.Logger, groupSnapshot *providerapi.GroupSnapshot) error {
+	remaining, err := r.countSnapshots(ctx, groupSnapshot, false)
+	if err != nil {
+		return err
+	}
+	if remaining > 0 {
+		log.V(2).Info("Group snapshot is ready", "snapshots", remaining)
+		return nil
+	}
+
+	log.V(1).Info("All snapshots of the group snapshot are deleted, deleting it")
+	if err := r.store.Delete(ctx, groupSnapshot.ID); store.IgnoreErrNotFound(err) != nil {
+		return fmt.Errorf("failed to delete group snapshot: %w", err)
+	}
+	return nil
+}
+
+func (r *GroupSnapshotReconciler) deleteGroupSnapshot(ctx context.Context, log logr.Logger, groupSnapshot *providerapi.GroupSnapshot) error {
+	if !slices.Contains(groupSnapshot.Finalizers, GroupSnapshotFinalizer) {
+		log.V(1).Info("group snapshot has no finalizer: done")
+		return nil
+	}
+
+	// The rbd snapshots of the group snapshot are kept until all its snapshots are deleted. Restored
+	// volumes are unaffected, ceph keeps the rbd snapshots with clones in the trash namespace.
+	remaining, err := r.countSnapshots(ctx, groupSnapshot, true)
+	if err != nil {
+		return err
+	}
+	if remaining > 0 {
+		log.V(1).Info("Waiting for the snapshots of the group snapshot to be deleted", "snapshots", remaining)
+		return nil
+	}
+
+	if pool := groupSnapshot.Status.Pool; pool != "" {
+		ioCtx, err := openIOContext(r.conn, pool, groupSnapshot.Status.Namespace)
+		if err != nil {
+			return err
+		}
+		defer ioCtx.Destroy()
+
+		if err := removeGroup(log, ioCtx, GroupSnapshotIDToRBDID(groupSnapshot.ID), groupSnapshot.ID); err != nil {
+			return err
+		}
+	}
+
+	groupSnapshot.Finalizers = utils.DeleteSliceElement(groupSnapshot.Finalizers, GroupSnapshotFinalizer)
+	if _, err := r.store.Update(ctx, groupSnapshot); store.IgnoreErrNotFound(err) != nil {
+		return fmt.Errorf("failed to update group snapshot metadata: %w", err)
+	}
+	log.V(2).Info("Removed group snapshot finalizer")
+	return nil
+}
+
+// removeGroup removes the rbd group snapshot and the rbd group of a group snapshot, if they exist.
+func removeGroup(log logr.Logger, ioCtx *rados.IOContext, groupName, snapName string) error {
+	log.V(2).Info("Removing rbd group snapshot")
+	if err := librbd.GroupSnapRemove(ioCtx, groupName, snapName); err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return fmt.Errorf("failed to remove rbd group snapshot: %w", err)
+	}
+	log.V(2).Info("Removing rbd group")
+	if err := librbd.GroupRemove(ioCtx, groupName); err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return fmt.Errorf("failed to remove rbd group: %w", err)
+	}
+	return nil
+}
+
+// countSnapshots returns the number of snapshots of the group snapshot that still exist. If del is
+// set, the snapshots are deleted.
+func (r *GroupSnapshotReconciler) countSnapshots(ctx context.Context, groupSnapshot *providerapi.GroupSnapshot, del bool) (int, error) {
+	var remaining int
+	for _, imageID := range groupSnapshot.Spec.VolumeImageIDs {
+		id := groupSnapshotMemberID(groupSnapshot.ID, imageID)
+		snapshot, err := r.snapshots.Get(ctx, id)
+		if err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				return 0, fmt.Errorf("failed to get snapshot %s: %w", id, err)
+			}
+			continue
+		}
+		remaining++
+
+		if del && snapshot.DeletedAt == nil {
+			if err := r.snapshots.Delete(ctx, id); store.IgnoreErrNotFound(err) != nil {
+				return 0, fmt.Errorf("failed to delete snapshot %s: %w", id, err)
+			}
+		}
+	}
+	return remaining, nil
+}
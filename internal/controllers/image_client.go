@@ -0,0 +1,291 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// clientMigrationSchedule spreads the migration of existing images to their own cephx clients over
+// time, so that enabling per-image clients does not flood the monitors with auth commands.
+type clientMigrationSchedule struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+	slots    map[string]time.Time
+}
+
+func newClientMigrationSchedule(interval time.Duration) *clientMigrationSchedule {
+	return &clientMigrationSchedule{
+		interval: interval,
+		slots:    map[string]time.Time{},
+	}
+}
+
+// wait returns how long the migration of the given image id has to wait. The first call for an id
+// reserves the next free slot.
+func (s *clientMigrationSchedule) wait(id string, now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	slot, ok := s.slots[id]
+	if !ok {
+		slot = now
+		if s.next.After(now) {
+			slot = s.next
+		}
+		s.next = slot.Add(s.interval)
+		s.slots[id] = slot
+	}
+
+	if d := slot.Sub(now); d > 0 {
+		return d
+	}
+	delete(s.slots, id)
+	return 0
+}
+
+// setImageAccess sets the access to the rbd image of the given image. If per-image clients are
+// enabled, the cephx client of the image is created or its caps are updated. ioCtx is the io context
+// of the pool of the image.
+func (r *ImageReconciler) setImageAccess(log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
+	var (
+		user, key string
+		err       error
+	)
+	if r.volumeClientPrefix != "" {
+		user, key, err = r.fetchImageAuth(log, ioCtx, image)
+	} else {
+		user, key, err = r.fetchAuth(log)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch credentials: %w", err)
+	}
+
+	image.Status.Access = &providerapi.ImageAccess{
+		Monitors: r.monitors,
+		Handle:   ImageHandle(image, r.pool),
+		User:     user,
+		UserKey:  key,
+	}
+	return nil
+}
+
+// updateImageAccess updates the access of an available image that is accessed with the shared client
+// once the key of the shared client has been rotated.
+func (r *ImageReconciler) updateImageAccess(ctx context.Context, log logr.Logger, image *providerapi.Image) error {
+	if image.Status.Client != "" || image.Status.Access == nil {
+		return nil
+	}
+
+	user, key, err := r.fetchAuth(log)
+	if err != nil {
+		return fmt.Errorf("failed to fetch credentials: %w", err)
+	}
+	if image.Status.Access.User == user && image.Status.Access.UserKey == key {
+		return nil
+	}
+
+	log.V(1).Info("Updating image access to the rotated client key")
+	image.Status.Access.User, image.Status.Access.UserKey = user, key
+	if _, err := r.images.Update(ctx, image); err != nil {
+		return fmt.Errorf("failed to update image access: %w", err)
+	}
+	r.Eventf(image.Metadata, corev1.EventTypeNormal, "ImageAccessUpdated", "UpdateImageAccess", "Updated access of image to the rotated key of ceph client %s", r.client)
+	return nil
+}
+
+// migrateImageClient moves an available image that is accessed with the shared client to its own
+// cephx client. Clients that attached the image before keep using the shared client until they
+// reattach it.
+func (r *ImageReconciler) migrateImageClient(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
+	if r.volumeClientPrefix == "" || image.Status.Client != "" {
+		return nil
+	}
+
+	if d := r.clientMigrations.wait(image.ID, time.Now()); d > 0 {
+		log.V(2).Info("Waiting to move image to its own ceph client", "wait", d)
+		r.queue.AddAfter(image.ID, d)
+		return nil
+	}
+
+	log.V(1).Info("Moving image to its own ceph client")
+	if err := r.setImageAccess(log, ioCtx, image); err != nil {
+		return err
+	}
+	if _, err := r.images.Update(ctx, image); err != nil {
+		return fmt.Errorf("failed to update image access: %w", err)
+	}
+	r.Eventf(image.Metadata, corev1.EventTypeNormal, "ImageClientCreated", "CreateImageClient", "Moved image to its own ceph client %s", image.Status.Client)
+	return nil
+}
+
+// fetchImageAuth creates the cephx client of the image or updates its caps and returns its
+// credentials.
+func (r *ImageReconciler) fetchImageAuth(log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) (string, string, error) {
+	caps, err := r.imageClientCaps(log, ioCtx, image)
+	if err != nil {
+		return "", "", err
+	}
+
+	entity := r.volumeClientPrefix + image.ID
+	log.V(3).Info("Ensuring image client", "name", entity)
+	key, err := r.cephClient.EnsureImageClient(entity, caps)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to ensure ceph client %s: %w", entity, err)
+	}
+	image.Status.Client = entity
+
+	return strings.TrimPrefix(entity, "client."), key, nil
+}
+
+// deleteImageClient revokes the access of the cephx client of the image, if any.
+func (r *ImageReconciler) deleteImageClient(log logr.Logger, image *providerapi.Image) error {
+	if image.Status.Client == "" {
+		return nil
+	}
+
+	if err := r.cephClient.DeleteClient(image.Status.Client); err != nil {
+		return fmt.Errorf("failed to delete ceph client %s: %w", image.Status.Client, err)
+	}
+	log.V(2).Info("Ceph client deleted", "name", image.Status.Client)
+	return nil
+}
+
+// imageClientCaps returns the osd caps of the cephx client of the image. Besides the rbd image, the
+// client can read the images it is cloned from and, while it is migrated, its migration source.
+func (r *ImageReconciler) imageClientCaps(log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) (string, error) {
+	rbdID := ImageIDToRBDID(image.ID)
+	img, err := openImage(ioCtx, rbdID)
+	if err != nil {
+		return "", err
+	}
+	defer closeImage(log, img)
+
+	objects, err := r.imageObjects(img, ImagePool(image, r.pool), image.Spec.Namespace, rbdID)
+	if err != nil {
+		return "", err
+	}
+
+	sources, err := r.parentObjects(log, img, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if image.Status.Migration.IsActive() {
+		status, err := librbd.MigrationStatus(ioCtx, rbdID)
+		if err != nil {
+			return "", fmt.Errorf("failed to get migration status: %w", err)
+		}
+		source, err := r.openImageByID(int64(status.SourcePoolID), status.SourcePoolNamespace, status.SourceImageID)
+		if err != nil {
+			return "", fmt.Errorf("failed to open migration source: %w", err)
+		}
+		defer source.close(log)
+
+		sourceObjects, err := r.imageObjects(source.img, source.pool, status.SourcePoolNamespace, status.SourceImageName)
+		if err != nil {
+			return "", err
+		}
+		sources = append(sources, sourceObjects)
+	}
+
+	return ceph.ImageClientOSDCaps(objects, sources...), nil
+}
+
+func (r *ImageReconciler) parentObjects(log logr.Logger, img *librbd.Image, objects []ceph.ImageObjects) ([]ceph.ImageObjects, error) {
+	parentInfo, err := img.GetParent()
+	if err != nil {
+		if errors.Is(err, librbd.ErrNotFound) {
+			return objects, nil
+		}
+		return nil, fmt.Errorf("failed to get parent: %w", err)
+	}
+
+	parent, err := r.openImageByID(int64(parentInfo.Image.PoolID), parentInfo.Image.PoolNamespace, parentInfo.Image.ImageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open parent %s/%s: %w", parentInfo.Image.PoolName, parentInfo.Image.ImageName, err)
+	}
+	defer parent.close(log)
+
+	parentObjects, err := r.imageObjects(parent.img, parent.pool, parentInfo.Image.PoolNamespace, parentInfo.Image.ImageName)
+	if err != nil {
+		return nil, err
+	}
+	return r.parentObjects(log, parent.img, append(objects, parentObjects))
+}
+
+func (r *ImageReconciler) imageObjects(img *librbd.Image, pool, namespace, name string) (ceph.ImageObjects, error) {
+	id, err := img.GetId()
+	if err != nil {
+		return ceph.ImageObjects{}, fmt.Errorf("failed to get image id: %w", err)
+	}
+
+	info, err := img.Stat()
+	if err != nil {
+		return ceph.ImageObjects{}, fmt.Errorf("failed to stat image: %w", err)
+	}
+
+	dataPoolID, err := img.GetDataPoolID()
+	if err != nil {
+		return ceph.ImageObjects{}, fmt.Errorf("failed to get data pool id: %w", err)
+	}
+	dataPool, err := r.conn.GetPoolByID(dataPoolID)
+	if err != nil {
+		return ceph.ImageObjects{}, fmt.Errorf("failed to get data pool %d: %w", dataPoolID, err)
+	}
+
+	return ceph.ImageObjects{
+		Pool:       pool,
+		DataPool:   dataPool,
+		Namespace:  namespace,
+		Name:       name,
+		ID:         id,
+		DataPrefix: info.Block_name_prefix,
+	}, nil
+}
+
+type openedImage struct {
+	pool  string
+	ioCtx *rados.IOContext
+	img   *librbd.Image
+}
+
+func (i *openedImage) close(log logr.Logger) {
+	closeImage(log, i.img)
+	i.ioCtx.Destroy()
+}
+
+// openImageByID opens an rbd image read-only by its id, which also works for images in the trash.
+func (r *ImageReconciler) openImageByID(poolID int64, namespace, id string) (*openedImage, error) {
+	pool, err := r.conn.GetPoolByID(poolID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pool %d: %w", poolID, err)
+	}
+
+	ioCtx, err := openIOContext(r.conn, pool, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := librbd.OpenImageByIdReadOnly(ioCtx, id, librbd.NoSnapshot)
+	if err != nil {
+		ioCtx.Destroy()
+		return nil, fmt.Errorf("failed to open image %s: %w", id, err)
+	}
+
+	return &openedImage{pool: pool, ioCtx: ioCtx, img: img}, nil
+}
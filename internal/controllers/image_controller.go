@@ -5,20 +5,24 @@ package controllers
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"slices"
-	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/ceph/go-ceph/rados"
 	librbd "github.com/ceph/go-ceph/rbd"
 	"github.com/containerd/containerd/reference"
 	"github.com/go-logr/logr"
 	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"github.com/ironcore-dev/ceph-provider/internal/credentials"
 	"github.com/ironcore-dev/ceph-provider/internal/encryption"
+	"github.com/ironcore-dev/ceph-provider/internal/limits"
 	"github.com/ironcore-dev/ceph-provider/internal/round"
 	"github.com/ironcore-dev/ceph-provider/internal/utils"
 	"github.com/ironcore-dev/ironcore-image/oci/remote"
@@ -35,13 +39,35 @@ const (
 	LimitMetadataPrefix = "conf_"
 	WWNKey              = "wwn"
 	imageDigestLabel    = "image-digest"
+	qosLimitPrefix      = "rbd_qos_"
 )
 
 type ImageReconcilerOptions struct {
-	Monitors   string
-	Client     string
-	Pool       string
+	Monitors string
+	Client   string
+	Pool     string
+	// DataPool is the pool the data objects of the rbd images in Pool are stored in. Defaults to Pool.
+	DataPool   string
 	WorkerSize int
+	// DesiredLimits returns the limits an image should have with the current configuration, e.g.
+	// after the burst factor or the capabilities of its class changed. The limits of images it
+	// returns false for are left as they are.
+	DesiredLimits func(image *providerapi.Image) (providerapi.Limits, bool)
+	// VolumeClientPrefix is the prefix of the cephx clients created for every image, e.g.
+	// client.volume-. Every client only has access to its rbd image. Empty hands out Client to all images.
+	VolumeClientPrefix string
+	// VolumeClientMigrationInterval is the interval existing images are moved from Client to their
+	// own clients in. Defaults to a second.
+	VolumeClientMigrationInterval time.Duration
+	// TrashDeferment is the duration the rbd images of deleted images are kept in the rbd trash for.
+	// Within it, images are restored by clearing their deletion timestamp. Zero removes rbd images right away.
+	TrashDeferment time.Duration
+	// FlattenPollInterval is the interval the flatten tasks of the rbd images cloned from the snapshots
+	// of deleted images are checked in. Defaults to 5 seconds.
+	FlattenPollInterval time.Duration
+	// Credentials provides the key of Client. The access of available images using Client is updated
+	// whenever it reports a rotated key. Defaults to a provider fetching the key with auth get-key.
+	Credentials *credentials.Provider
 }
 
 func NewImageReconciler(
@@ -95,6 +121,33 @@ func NewImageReconciler(
 		opts.WorkerSize = 15
 	}
 
+	if opts.VolumeClientPrefix != "" && !strings.HasPrefix(opts.VolumeClientPrefix, "client.") {
+		return nil, fmt.Errorf("volume client prefix %q must start with client.", opts.VolumeClientPrefix)
+	}
+
+	if opts.TrashDeferment < 0 {
+		return nil, fmt.Errorf("trash deferment must not be negative")
+	}
+
+	if opts.VolumeClientMigrationInterval == 0 {
+		opts.VolumeClientMigrationInterval = time.Second
+	}
+
+	if opts.FlattenPollInterval == 0 {
+		opts.FlattenPollInterval = 5 * time.Second
+	}
+
+	cephClient, err := ceph.NewCommandClient(conn, opts.Pool)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize ceph command client: %w", err)
+	}
+
+	if opts.Credentials == nil {
+		if opts.Credentials, err = credentials.New(log.WithName("credentials"), cephClient.ClientKey, credentials.Options{}); err != nil {
+			return nil, fmt.Errorf("failed to initialize credential provider: %w", err)
+		}
+	}
+
 	return &ImageReconciler{
 		log:            log,
 		conn:           conn,
@@ -107,8 +160,23 @@ func NewImageReconciler(
 		monitors:       opts.Monitors,
 		client:         opts.Client,
 		pool:           opts.Pool,
+		dataPool:       opts.DataPool,
 		keyEncryption:  keyEncryption,
 		workerSize:     opts.WorkerSize,
+		desiredLimits:  opts.DesiredLimits,
+
+		migrationExecutions: newExecutions(),
+		rollbackExecutions:  newExecutions(),
+
+		cephClient:         cephClient,
+		volumeClientPrefix: opts.VolumeClientPrefix,
+		clientMigrations:   newClientMigrationSchedule(opts.VolumeClientMigrationInterval),
+		credentials:        opts.Credentials,
+
+		trashDeferment: opts.TrashDeferment,
+
+		flatten:             newFlattenTasks(conn),
+		flattenPollInterval: opts.FlattenPollInterval,
 	}, nil
 }
 
@@ -128,10 +196,26 @@ type ImageReconciler struct {
 	monitors string
 	client   string
 	pool     string
+	dataPool string
 
 	keyEncryption encryption.Encryptor
 
 	workerSize int
+
+	desiredLimits func(image *providerapi.Image) (providerapi.Limits, bool)
+
+	migrationExecutions *executions
+	rollbackExecutions  *executions
+
+	cephClient         *ceph.CommandClient
+	volumeClientPrefix string
+	clientMigrations   *clientMigrationSchedule
+	credentials        *credentials.Provider
+
+	trashDeferment time.Duration
+
+	flatten             *flattenTasks
+	flattenPollInterval time.Duration
 }
 
 func (r *ImageReconciler) Start(ctx context.Context) error {
@@ -148,6 +232,14 @@ func (r *ImageReconciler) Start(ctx context.Context) error {
 	}()
 
 	snapEventReg, err := r.snapshotEvents.AddHandler(event.HandlerFunc[*providerapi.Snapshot](func(evt event.Event[*providerapi.Snapshot]) {
+		// The rbd image of a deleted image is kept until the last snapshot taken of it is removed.
+		if evt.Type == event.TypeDeleted {
+			if id := evt.Object.Source.VolumeImageID; id != "" {
+				r.queue.Add(id)
+			}
+			return
+		}
+
 		if evt.Type != event.TypeUpdated || evt.Object.Status.State != providerapi.SnapshotStateReady {
 			return
 		}
@@ -172,6 +264,25 @@ func (r *ImageReconciler) Start(ctx context.Context) error {
 		_ = r.snapshotEvents.RemoveHandler(snapEventReg)
 	}()
 
+	removeRotationHandler := r.credentials.AddRotationHandler(func(entity, _ string) {
+		if entity != r.client {
+			return
+		}
+
+		imageList, err := r.images.List(ctx)
+		if err != nil {
+			log.Error(err, "failed to list images")
+			return
+		}
+
+		for _, img := range imageList {
+			if img.Status.State == providerapi.ImageStateAvailable && img.Status.Client == "" {
+				r.queue.Add(img.ID)
+			}
+		}
+	})
+	defer removeRotationHandler()
+
 	go func() {
 		<-ctx.Done()
 		r.queue.ShutDown()
@@ -202,6 +313,19 @@ func (r *ImageReconciler) processNextWorkItem(ctx context.Context, log logr.Logg
 	ctx = logr.NewContext(ctx, log)
 
 	if err := r.reconcileImage(ctx, id); err != nil {
+		var imgErr *imageError
+		if errors.As(err, &imgErr) {
+			ok, setErr := r.setImageError(ctx, id, imgErr)
+			if setErr != nil {
+				log.Error(setErr, "failed to set image error state")
+			}
+			if ok {
+				log.Error(err, "failed to reconcile image, not retrying")
+				r.queue.Forget(id)
+				return true
+			}
+		}
+
 		log.Error(err, "failed to reconcile image")
 		r.queue.AddRateLimited(id)
 		return true
@@ -215,20 +339,100 @@ const (
 	ImageFinalizer = "image"
 )
 
+// imageError is a failure that is not resolved by retrying. Instead of being retried, the image
+// is put into the error state with the reason of the failure.
+type imageError struct {
+	reason providerapi.ImageReason
+	err    error
+}
+
+func newImageError(reason providerapi.ImageReason, err error) error {
+	return &imageError{reason: reason, err: err}
+}
+
+func (e *imageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *imageError) Unwrap() error {
+	return e.err
+}
+
+// isPermanentRBDError reports whether err is an rbd error that is not resolved by retrying, i.e.
+// invalid arguments or operations not supported by librbd or the cluster.
+func isPermanentRBDError(err error) bool {
+	var errCode interface{ ErrorCode() int }
+	if !errors.As(err, &errCode) {
+		return false
+	}
+	switch syscall.Errno(-errCode.ErrorCode()) {
+	case syscall.EINVAL, syscall.EOPNOTSUPP, syscall.ENOSYS:
+		return true
+	default:
+		return false
+	}
+}
+
+// setImageError puts the image into the error state. It reports false if the image is being
+// deleted, since its deletion has to be retried regardless of the failure.
+func (r *ImageReconciler) setImageError(ctx context.Context, id string, imgErr *imageError) (bool, error) {
+	image, err := r.images.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return true, nil
+		}
+		return false, fmt.Errorf("failed to get image: %w", err)
+	}
+
+	if image.DeletedAt != nil {
+		return false, nil
+	}
+
+	image.Status.SetState(providerapi.ImageStateError, imgErr.reason, imgErr.err.Error())
+	if _, err := r.images.Update(ctx, image); store.IgnoreErrNotFound(err) != nil {
+		return false, fmt.Errorf("failed to update image state: %w", err)
+	}
+	r.Eventf(image.Metadata, corev1.EventTypeWarning, string(imgErr.reason), "ReconcileImage", "Image creation failed: %s", imgErr.err)
+	return true, nil
+}
+
 func (r *ImageReconciler) deleteImage(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
 	if !slices.Contains(image.Finalizers, ImageFinalizer) {
 		log.V(1).Info("image has no finalizer: done")
 		return nil
 	}
 
-	if err := r.deleteImageSnapshots(ctx, log, ioCtx, image); err != nil {
-		return fmt.Errorf("failed to delete image snapshots: %w", err)
+	if image.Status.Trash != nil {
+		if purged, err := r.purgeImage(log, ioCtx, image); err != nil || !purged {
+			return err
+		}
+	} else {
+		if deleted, err := r.deleteImageSnapshots(ctx, log, ioCtx, image); err != nil {
+			return fmt.Errorf("failed to delete image snapshots: %w", err)
+		} else if !deleted {
+			return nil
+		}
+
+		// Flattening the rbd image is pointless once it is removed and would keep it open.
+		if err := r.flatten.cancel(log, ImagePool(image, r.pool), image.Spec.Namespace, ImageIDToRBDID(image.ID)); err != nil {
+			return err
+		}
+
+		if r.trashDeferment > 0 {
+			if trashed, err := r.trashImage(ctx, log, ioCtx, image); err != nil || trashed {
+				return err
+			}
+		}
+
+		if err := librbd.RemoveImage(ioCtx, ImageIDToRBDID(image.ID)); err != nil && !errors.Is(err, librbd.ErrNotFound) {
+			return fmt.Errorf("failed to remove rbd image: %w", err)
+		}
+		log.V(2).Info("Rbd image deleted")
 	}
 
-	if err := librbd.RemoveImage(ioCtx, ImageIDToRBDID(image.ID)); err != nil && !errors.Is(err, librbd.ErrNotFound) {
-		return fmt.Errorf("failed to remove rbd image: %w", err)
+	if err := r.deleteImageClient(log, image); err != nil {
+		return err
 	}
-	log.V(2).Info("Rbd image deleted")
 
 	image.Finalizers = utils.DeleteSliceElement(image.Finalizers, ImageFinalizer)
 	if _, err := r.images.Update(ctx, image); store.IgnoreErrNotFound(err) != nil {
@@ -240,186 +444,142 @@ func (r *ImageReconciler) deleteImage(ctx context.Context, log logr.Logger, ioCt
 	return nil
 }
 
-// since ceph does not allow deletion of rbd image if it has snapshots, we will follow below steps to achieve it
-// 1. Clone each snapshot into separate rbd image and create snapshot of that cloned rbd image with same name as snapshot.
-// 2. Flatten all child images(cloned images from step 1 and rbd images which are restored using this snapshot) of each snapshot.
-// 3. Remove all snapshots of rbd image and update each snapshot source in store to cloned rbd image id
-func (r *ImageReconciler) deleteImageSnapshots(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
+// deleteImageSnapshots removes the rbd snapshots of a deleted image that do not back a snapshot. The rbd
+// image is kept along with the rbd snapshots that do until the snapshots are deleted. As clones use clone
+// v2, ceph moves rbd snapshots that still have clones to the trash namespace on removal and keeps the rbd
+// image until their last clone is removed, so that clones neither have to be flattened nor the snapshots
+// cloned into rbd images of their own. It returns false while the rbd image is kept for snapshots.
+func (r *ImageReconciler) deleteImageSnapshots(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) (bool, error) {
 	img, err := openImage(ioCtx, ImageIDToRBDID(image.ID))
 	if err != nil {
 		if !errors.Is(err, librbd.ErrNotFound) {
-			return err
+			return false, err
 		}
 		log.V(2).Info("Rbd image not found, it was probably already deleted")
-		return nil
+		return true, nil
 	}
 	defer closeImage(log, img)
 
-	snaps, err := img.GetSnapshotNames()
+	snaps, err := snapshotsInNamespace(img, librbd.SnapNamespaceTypeUser)
 	if err != nil {
-		return fmt.Errorf("unable to list snapshots: %w", err)
+		return false, err
 	}
 	log.V(2).Info("Image snapshots", "count", len(snaps))
 
-	// clone all snapshots into rbd image and create corresponding snapshot
+	var retainedBy []string
 	for _, snapInfo := range snaps {
 		snapName := snapInfo.Name
-		log.V(2).Info("Create snapshot clone", "snapshotId", snapName)
-		// cloned image name will be same as snapshot name
-		if err := r.cloneSnapshot(ctx, log, ioCtx, snapName, image); err != nil {
-			return fmt.Errorf("failed to create snapshot clone: %w", err)
-		}
-
-		if isSnapshotExist, isSnapshotProtected, err := snapshotExistsAndProtected(log, ioCtx, ImageIDToRBDID(snapName), snapName); err != nil {
-			return fmt.Errorf("failed to check if snapshot %s exists: %w", snapName, err)
-		} else if isSnapshotExist {
-			if !isSnapshotProtected {
-				// Snapshot exists but not protected - just protect it
-				if err := protectSnapshot(log, ioCtx, ImageIDToRBDID(snapName), snapName); err != nil {
-					return fmt.Errorf("failed to protect snapshot: %w", err)
-				}
-			}
-			log.V(2).Info("Snapshot of cloned image is already created")
+		snapshot, err := r.snapshots.Get(ctx, snapName)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return false, fmt.Errorf("failed to get snapshot %s: %w", snapName, err)
+		}
+		if err == nil && snapshot.Source.VolumeImageID == image.ID {
+			retainedBy = append(retainedBy, snapName)
 			continue
 		}
 
-		log.V(2).Info("Create snapshot of cloned image", "clonedImageId", snapName)
-		if err := createSnapshot(log, ioCtx, snapName, ImageIDToRBDID(snapName)); err != nil {
-			return fmt.Errorf("failed to create snapshot of cloned image: %w", err)
+		if removed, err := r.removeImageSnapshot(ctx, log, ioCtx, image, snapName); err != nil || !removed {
+			return false, err
 		}
 	}
 
-	// flatten all child images of the original image's snapshots
-	if err := flattenChildImages(log, r.conn, img); err != nil {
-		return fmt.Errorf("failed to flatten snapshot child images: %w", err)
+	groupSnaps, err := snapshotsInNamespace(img, librbd.SnapNamespaceTypeGroup)
+	if err != nil {
+		return false, err
 	}
-
-	// remove snapshot and update snapshot source in store
-	for _, snapInfo := range snaps {
-		snapName := snapInfo.Name
-		snap := img.GetSnapshot(snapName)
-
-		log.V(2).Info("Remove snapshot", "snapshotId", snapName)
-		if err := removeSnapshot(snap); err != nil {
-			return err
-		}
-
-		snapshot, err := r.snapshots.Get(ctx, snapName)
+	if len(groupSnaps) > 0 {
+		groupRetainedBy, err := r.groupSnapshotsRetaining(ctx, image, groupSnaps)
 		if err != nil {
-			if !errors.Is(err, store.ErrNotFound) {
-				return fmt.Errorf("failed to get snapshot %s: %w", snapName, err)
-			}
-			log.V(2).Info("Snapshot not found in store, skipping update", "snapshotId", snapName)
-			continue
+			return false, err
 		}
+		retainedBy = append(retainedBy, groupRetainedBy...)
 
-		log.V(2).Info("Update snapshot source in store")
-		snapshot.Source.VolumeImageID = snapName
-		if _, err := r.snapshots.Update(ctx, snapshot); err != nil {
-			return fmt.Errorf("failed to update snapshot source: %w", err)
+		// The rbd snapshots of group snapshots are removed by the group snapshot reconciler once all
+		// snapshots of the group snapshot are deleted, which might not have happened yet.
+		if len(retainedBy) == 0 {
+			return false, fmt.Errorf("waiting for %d rbd snapshots of group snapshots to be removed", len(groupSnaps))
 		}
 	}
-	return nil
-}
 
-func (r *ImageReconciler) cloneSnapshot(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, snapName string, image *providerapi.Image) error {
-	rbdExists, err := r.isImageExisting(ioCtx, snapName)
-	if err != nil {
-		return fmt.Errorf("failed to check rbd image existence: %w", err)
-	}
-
-	storeExists := true
-	if _, err := r.images.Get(ctx, snapName); err != nil {
-		if !errors.Is(err, store.ErrNotFound) {
-			return fmt.Errorf("failed to check image in store: %w", err)
+	if !slices.Equal(image.Status.RetainedBy, retainedBy) {
+		image.Status.RetainedBy = retainedBy
+		if _, err := r.images.Update(ctx, image); err != nil {
+			return false, fmt.Errorf("failed to update retaining snapshots: %w", err)
+		}
+		if len(retainedBy) > 0 {
+			r.Eventf(image.Metadata, corev1.EventTypeNormal, "ImageRetained", "DeleteImage", "Keeping image until the %d snapshots taken of it are deleted", len(retainedBy))
 		}
-		storeExists = false
 	}
 
-	if rbdExists && storeExists {
-		log.V(2).Info("Snapshot clone is already created")
-		return nil
+	if len(retainedBy) > 0 {
+		// The image is reconciled again whenever a snapshot taken of it is removed from the store.
+		log.V(1).Info("Keeping rbd image for its snapshots", "snapshots", retainedBy)
+		return false, nil
 	}
+	return true, nil
+}
 
-	clonedImage := &providerapi.Image{
-		Metadata: apiutils.Metadata{
-			ID: snapName,
-		},
-		Spec: providerapi.ImageSpec{
-			Size:        image.Spec.Size,
-			Limits:      image.Spec.Limits,
-			SnapshotRef: ptr.To(snapName),
-			Encryption:  image.Spec.Encryption,
-		},
+// groupSnapshotsRetaining returns the ids of the snapshots of group snapshots that keep the given rbd
+// snapshots of an image in the group snapshot namespace.
+func (r *ImageReconciler) groupSnapshotsRetaining(ctx context.Context, image *providerapi.Image, groupSnaps []librbd.SnapInfo) ([]string, error) {
+	snapshots, err := r.snapshots.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
 	}
 
-	if !rbdExists {
-		options := librbd.NewRbdImageOptions()
-		defer options.Destroy()
-		if err := options.SetString(librbd.ImageOptionDataPool, r.pool); err != nil {
-			return fmt.Errorf("failed to set data pool: %w", err)
+	var res []string
+	for _, snapshot := range snapshots {
+		if snapshot.Source.VolumeImageID != image.ID || snapshot.Source.GroupSnapshotID == "" {
+			continue
 		}
-
-		log.V(2).Info("Creating image from snapshot", "snapshotId", snapName)
-		if ok, err := r.createImageFromSnapshot(ctx, log, ioCtx, clonedImage, snapName, options); err != nil {
-			return fmt.Errorf("failed to create image from snapshot: %w", err)
-		} else if !ok {
-			return nil
+		if slices.ContainsFunc(groupSnaps, func(snap librbd.SnapInfo) bool { return snap.Name == snapshot.Source.SnapName }) {
+			res = append(res, snapshot.ID)
 		}
-	} else {
-		log.V(2).Info("Rbd image for snapshot clone already exists")
 	}
+	return res, nil
+}
 
-	log.V(2).Info("Setting parent image metadata to cloned image")
-	metadata, err := providerapi.GetObjectMetadataFromObjectID(image.Metadata)
+// removeImageSnapshot removes an rbd snapshot of a deleted image that does not back a snapshot, e.g.
+// because the snapshot has been moved to an rbd image of its own before clone v2 was used. The clones
+// of rbd snapshots protected for clone v1 are flattened first. It returns false while they are not
+// flattened yet.
+func (r *ImageReconciler) removeImageSnapshot(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image, snapName string) (bool, error) {
+	img, err := librbd.OpenImage(ioCtx, ImageIDToRBDID(image.ID), snapName)
 	if err != nil {
-		return fmt.Errorf("failed to get metadata from image: %w", err)
-	}
-	if err := providerapi.SetObjectMetadataFromMetadata(clonedImage, metadata); err != nil {
-		return fmt.Errorf("failed to set metadata: %w", err)
+		if !errors.Is(err, librbd.ErrNotFound) {
+			return false, fmt.Errorf("failed to open rbd image at snapshot %s: %w", snapName, err)
+		}
+		return true, nil
 	}
+	defer closeImage(log, img)
 
-	log.V(2).Info("Setting class label to cloned image")
-	class, found := providerapi.GetClassLabelFromObject(image)
-	if !found {
-		return fmt.Errorf("class label not found on image")
+	snap := img.GetSnapshot(snapName)
+	isProtected, err := snap.IsProtected()
+	if err != nil {
+		return false, fmt.Errorf("failed to check if snapshot %s is protected: %w", snapName, err)
 	}
-	providerapi.SetClassLabelForObject(clonedImage, class)
-
-	providerapi.SetManagerLabel(clonedImage, providerapi.VolumeManager)
-	if _, err := r.images.Create(ctx, clonedImage); err != nil {
-		return fmt.Errorf("failed to create image: %w", err)
+	if isProtected {
+		if flattened, err := r.flattenChildImages(ctx, log, img, image); err != nil || !flattened {
+			return false, err
+		}
 	}
 
-	return nil
-}
-
-type fetchAuthResponse struct {
-	Key string `json:"key"`
+	log.V(2).Info("Remove snapshot", "snapshotId", snapName)
+	if err := removeSnapshot(snap); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
+// fetchAuth returns the credentials of the shared client. Its key is cached by the credential provider.
 func (r *ImageReconciler) fetchAuth(log logr.Logger) (string, string, error) {
-	cmd1, err := json.Marshal(map[string]string{
-		"prefix": "auth get-key",
-		"entity": r.client,
-		"format": "json",
-	})
-	if err != nil {
-		return "", "", fmt.Errorf("unable to marshal command: %w", err)
-	}
-
-	log.V(3).Info("Try to fetch client", "name", r.client)
-	data, _, err := r.conn.MonCommand(cmd1)
+	log.V(3).Info("Fetching client key", "name", r.client)
+	key, err := r.credentials.Key(r.client)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to execute mon command: %w", err)
+		return "", "", err
 	}
 
-	response := fetchAuthResponse{}
-	if err := json.Unmarshal(data, &response); err != nil {
-		return "", "", fmt.Errorf("unable to unmarshal response: %w", err)
-	}
-
-	return strings.TrimPrefix(r.client, "client."), response.Key, nil
+	return strings.TrimPrefix(r.client, "client."), key, nil
 }
 
 func (r *ImageReconciler) reconcileSnapshot(ctx context.Context, log logr.Logger, img *providerapi.Image) error {
@@ -443,6 +603,7 @@ func (r *ImageReconciler) reconcileSnapshot(ctx context.Context, log logr.Logger
 	if err != nil {
 		if errors.Is(err, remote.ErrNoPlatformMatch) {
 			r.Eventf(img.Metadata, corev1.EventTypeWarning, "NoPlatformMatch", "ResolveImage", "Image %s has no matching platform: %v", img.Spec.Image, err)
+			return newImageError(providerapi.ImageReasonNoPlatformMatch, fmt.Errorf("failed to resolve image ref in os image source: %w", err))
 		}
 		return fmt.Errorf("failed to resolve image ref in os image source: %w", err)
 	}
@@ -549,12 +710,6 @@ func (r *ImageReconciler) updateImage(ctx context.Context, log logr.Logger, ioCt
 
 func (r *ImageReconciler) reconcileImage(ctx context.Context, id string) error {
 	log := logr.FromContextOrDiscard(ctx)
-	ioCtx, err := r.conn.OpenIOContext(r.pool)
-	if err != nil {
-		return fmt.Errorf("unable to get io context: %w", err)
-	}
-	defer ioCtx.Destroy()
-
 	img, err := r.images.Get(ctx, id)
 	if err != nil {
 		if !errors.Is(err, store.ErrNotFound) {
@@ -563,7 +718,21 @@ func (r *ImageReconciler) reconcileImage(ctx context.Context, id string) error {
 		return nil
 	}
 
+	pool := ImagePool(img, r.pool)
+	ioCtx, err := openIOContext(r.conn, pool, img.Spec.Namespace)
+	if err != nil {
+		return err
+	}
+	defer ioCtx.Destroy()
+
 	if img.DeletedAt != nil {
+		if img.Status.Migration.IsActive() {
+			// The image is deleted from its source pool once the migration is rolled back.
+			if err := r.abortMigration(ctx, log, img); err != nil {
+				return fmt.Errorf("failed to abort migration: %w", err)
+			}
+			return nil
+		}
 		if err := r.deleteImage(ctx, log, ioCtx, img); err != nil {
 			return fmt.Errorf("failed to delete image: %w", err)
 		}
@@ -571,6 +740,19 @@ func (r *ImageReconciler) reconcileImage(ctx context.Context, id string) error {
 		return nil
 	}
 
+	if img.Status.Trash != nil {
+		if err := r.restoreImage(ctx, log, ioCtx, img); err != nil {
+			return fmt.Errorf("failed to restore image: %w", err)
+		}
+		return nil
+	}
+
+	if img.Status.Flatten != nil {
+		if err := r.cancelFlattenChildImages(ctx, log, ioCtx, img); err != nil {
+			return fmt.Errorf("failed to cancel flattening: %w", err)
+		}
+	}
+
 	if !slices.Contains(img.Finalizers, ImageFinalizer) {
 		img.Finalizers = append(img.Finalizers, ImageFinalizer)
 		if _, err := r.images.Update(ctx, img); err != nil {
@@ -579,6 +761,15 @@ func (r *ImageReconciler) reconcileImage(ctx context.Context, id string) error {
 		return nil
 	}
 
+	if img.Status.State == providerapi.ImageStateError {
+		log.V(1).Info("Image is in error state, not retrying", "Reason", img.Status.Reason)
+		return nil
+	}
+
+	if err := r.updateDesiredLimits(ctx, log, img); err != nil {
+		return fmt.Errorf("failed to update desired limits: %w", err)
+	}
+
 	if err := r.reconcileSnapshot(ctx, log, img); err != nil {
 		return fmt.Errorf("failed to reconcile snapshot: %w", err)
 	}
@@ -591,18 +782,60 @@ func (r *ImageReconciler) reconcileImage(ctx context.Context, id string) error {
 
 	if imageExists {
 		if img.Status.State == providerapi.ImageStateAvailable {
+			migrating, err := r.reconcileMigration(ctx, log, img)
+			if err != nil {
+				return fmt.Errorf("failed to migrate image: %w", err)
+			}
+			if migrating {
+				return nil
+			}
+			rollingBack, err := r.reconcileRollback(ctx, log, ioCtx, img)
+			if err != nil {
+				return fmt.Errorf("failed to roll back image: %w", err)
+			}
+			if rollingBack {
+				return nil
+			}
 			if err := r.updateImage(ctx, log, ioCtx, img); err != nil {
 				return fmt.Errorf("failed to update image: %w", err)
 			}
+			if err := r.setImageLimits(log, ioCtx, img); err != nil {
+				return fmt.Errorf("failed to set limits: %w", err)
+			}
+			if err := r.migrateImageClient(ctx, log, ioCtx, img); err != nil {
+				return fmt.Errorf("failed to move image to its own client: %w", err)
+			}
+			if err := r.updateImageAccess(ctx, log, img); err != nil {
+				return fmt.Errorf("failed to update image access: %w", err)
+			}
 			return nil
 		}
+	} else if img.Status.State == providerapi.ImageStateAvailable {
+		// The rbd image of an available image has been lost. Recreating it would hand out a blank
+		// disk, so the image is failed like the consistency check does. Recreation is left to the
+		// operator.
+		log.Info("Rbd image of available image does not exist, setting image to error state")
+		img.Status.SetState(providerapi.ImageStateError, providerapi.ImageReasonRBDImageMissing, fmt.Sprintf("rbd image %s does not exist", ImageIDToRBDID(img.ID)))
+		if _, err := r.images.Update(ctx, img); err != nil {
+			return fmt.Errorf("failed to update image state: %w", err)
+		}
+		r.Eventf(img.Metadata, corev1.EventTypeWarning, "MissingImageFailed", "ReconcileImage", "Rbd image does not exist, the image has been set to error state")
+		return nil
 	} else {
+		if err := ensureNamespace(log, r.conn, pool, img.Spec.Namespace); err != nil {
+			return err
+		}
+
 		options := librbd.NewRbdImageOptions()
 		defer options.Destroy()
-		if err := options.SetString(librbd.ImageOptionDataPool, r.pool); err != nil {
+		dataPool := ImageDataPool(img, r.pool, r.dataPool)
+		if err := options.SetString(librbd.ImageOptionDataPool, dataPool); err != nil {
 			return fmt.Errorf("failed to set data pool: %w", err)
 		}
-		log.V(2).Info("Configured pool", "pool", r.pool)
+		log.V(2).Info("Configured pool", "pool", pool, "namespace", img.Spec.Namespace, "dataPool", dataPool)
+		if err := setRBDOptions(options, img.Spec.RBDOptions); err != nil {
+			return err
+		}
 
 		switch {
 		case img.Spec.SnapshotRef != nil:
@@ -637,18 +870,14 @@ func (r *ImageReconciler) reconcileImage(ctx context.Context, id string) error {
 		return fmt.Errorf("failed to set limits: %w", err)
 	}
 
-	user, key, err := r.fetchAuth(log)
-	if err != nil {
-		return fmt.Errorf("failed to fetch credentials: %w", err)
+	if err := r.setRBDOptionsStatus(log, ioCtx, img); err != nil {
+		return fmt.Errorf("failed to get rbd options: %w", err)
 	}
 
-	img.Status.Access = &providerapi.ImageAccess{
-		Monitors: r.monitors,
-		Handle:   fmt.Sprintf("%s/%s", r.pool, ImageIDToRBDID(img.ID)),
-		User:     user,
-		UserKey:  key,
+	if err := r.setImageAccess(log, ioCtx, img); err != nil {
+		return err
 	}
-	img.Status.State = providerapi.ImageStateAvailable
+	img.Status.SetState(providerapi.ImageStateAvailable, "", "")
 	img.Status.Size = round.OffBytes(img.Spec.Size)
 	if _, err = r.images.Update(ctx, img); err != nil {
 		return fmt.Errorf("failed to update image metadate: %w", err)
@@ -659,27 +888,86 @@ func (r *ImageReconciler) reconcileImage(ctx context.Context, id string) error {
 	return nil
 }
 
-func (r *ImageReconciler) setImageLimits(log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
-	if len(image.Spec.Limits) <= 0 {
+// updateDesiredLimits updates the limits of the image in the store if they differ from the ones
+// it should have with the current configuration.
+func (r *ImageReconciler) updateDesiredLimits(ctx context.Context, log logr.Logger, image *providerapi.Image) error {
+	if r.desiredLimits == nil {
+		return nil
+	}
+
+	desired, ok := r.desiredLimits(image)
+	if !ok || maps.Equal(desired, image.Spec.Limits) {
 		return nil
 	}
 
-	log.V(1).Info("Configuring limits")
+	log.V(1).Info("Updating limits to the current configuration")
+	image.Spec.Limits = desired
+	if _, err := r.images.Update(ctx, image); err != nil {
+		return fmt.Errorf("failed to update image limits: %w", err)
+	}
+	return nil
+}
+
+// setImageLimits configures the limits of the image as rbd image metadata. Limits that differ are
+// set and limits the image should not have anymore are removed, so that manual changes are undone.
+func (r *ImageReconciler) setImageLimits(log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
 	img, err := openImage(ioCtx, ImageIDToRBDID(image.ID))
 	if err != nil {
 		return err
 	}
 	defer closeImage(log, img)
 
-	for limit, value := range image.Spec.Limits {
-		if err := img.SetMetadata(fmt.Sprintf("%s%s", LimitMetadataPrefix, limit), strconv.FormatInt(value, 10)); err != nil {
-			r.Eventf(image.Metadata, corev1.EventTypeWarning, "SetImageLimitFailed", "SetImageLimits", "Failed to set image limit: %s", err)
-			return fmt.Errorf("failed to set limit (%s): %w", limit, err)
+	metadata, err := img.ListMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to list image metadata: %w", err)
+	}
+
+	current := map[providerapi.LimitType]string{}
+	for key, value := range metadata {
+		if strings.HasPrefix(key, LimitMetadataPrefix+qosLimitPrefix) {
+			current[providerapi.LimitType(strings.TrimPrefix(key, LimitMetadataPrefix))] = value
 		}
-		r.Eventf(image.Metadata, corev1.EventTypeNormal, "SetImageLimitSucceeded", "SetImageLimits", "Image limit set. limit: %s value: %d", limit, value)
-		log.V(3).Info("Set image limit", "limit", limit, "value", value)
 	}
 
+	changes := limits.Diff(image.Spec.Limits, current)
+	if len(changes) == 0 {
+		log.V(2).Info("Limits up to date")
+		return nil
+	}
+
+	log.V(1).Info("Configuring limits", "changes", len(changes))
+	for _, change := range changes {
+		key := fmt.Sprintf("%s%s", LimitMetadataPrefix, change.Limit)
+		if change.Desired == "" {
+			err = img.RemoveMetadata(key)
+		} else {
+			err = img.SetMetadata(key, change.Desired)
+		}
+		if err != nil {
+			r.Eventf(image.Metadata, corev1.EventTypeWarning, "SetImageLimitFailed", "SetImageLimits", "Failed to set image limit %s: %s", change.Limit, err)
+			return fmt.Errorf("failed to set limit (%s): %w", change.Limit, err)
+		}
+		log.V(3).Info("Set image limit", "limit", change.Limit, "current", change.Current, "desired", change.Desired)
+	}
+	r.Eventf(image.Metadata, corev1.EventTypeNormal, "SetImageLimitSucceeded", "SetImageLimits", "Image limits set: %s", limits.FormatChanges(changes))
+
+	return nil
+}
+
+func (r *ImageReconciler) setRBDOptionsStatus(log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
+	img, err := openImage(ioCtx, ImageIDToRBDID(image.ID))
+	if err != nil {
+		return err
+	}
+	defer closeImage(log, img)
+
+	rbdOptions, err := getRBDOptions(img)
+	if err != nil {
+		return err
+	}
+	image.Status.RBDOptions = rbdOptions
+	log.V(3).Info("Got rbd options", "features", rbdOptions.Features, "objectSize", rbdOptions.ObjectSize, "stripeUnit", rbdOptions.StripeUnit, "stripeCount", rbdOptions.StripeCount)
+
 	return nil
 }
 
@@ -707,7 +995,7 @@ func (r *ImageReconciler) setEncryptionHeader(ctx context.Context, log logr.Logg
 	log.V(1).Info("Configuring encryption")
 	passphrase, err := r.keyEncryption.Decrypt(image.Spec.Encryption.EncryptedPassphrase)
 	if err != nil {
-		return fmt.Errorf("failed to decrypt passphrase: %w", err)
+		return newImageError(providerapi.ImageReasonEncryptionFailed, fmt.Errorf("failed to decrypt passphrase: %w", err))
 	}
 
 	img, err := openImage(ioCtx, ImageIDToRBDID(image.ID))
@@ -720,7 +1008,12 @@ func (r *ImageReconciler) setEncryptionHeader(ctx context.Context, log logr.Logg
 		Alg:        librbd.EncryptionAlgorithmAES256,
 		Passphrase: passphrase,
 	}); err != nil {
-		return fmt.Errorf("failed to set encryption format: %w", err)
+		err = fmt.Errorf("failed to set encryption format: %w", err)
+		if isPermanentRBDError(err) {
+			return newImageError(providerapi.ImageReasonEncryptionFailed, err)
+		}
+		// Transient failures, e.g. of rados or a busy image, are retried.
+		return err
 	}
 
 	image.Status.Encryption = providerapi.EncryptionStateHeaderSet
@@ -756,29 +1049,34 @@ func (r *ImageReconciler) createImageFromSnapshot(ctx context.Context, log logr.
 
 	if snapshot.Status.Size > int64(image.Spec.Size) {
 		r.Eventf(image.Metadata, corev1.EventTypeWarning, "ImageSizeIsSmallerThanSnapshotSize", "CreateImageFromSnapshot", "image %s size is smaller than snapshot size: %d < %d", image.ID, image.Spec.Size, snapshot.Status.Size)
-		return false, fmt.Errorf("image %s size is smaller than snapshot size: (%d < %d)", image.ID, image.Spec.Size, snapshot.Status.Size)
+		return false, newImageError(providerapi.ImageReasonSizeSmallerThanSnapshot, fmt.Errorf("image %s size is smaller than snapshot size: (%d < %d)", image.ID, image.Spec.Size, snapshot.Status.Size))
+	}
+
+	if snapshot.Status.State == providerapi.SnapshotStateFailed {
+		return false, newImageError(providerapi.ImageReasonSnapshotFailed, fmt.Errorf("snapshot %s failed", snapshot.ID))
 	}
 
-	if snapshot.Status.State != providerapi.SnapshotStateReady && snapshot.Status.State != providerapi.SnapshotStatePopulated {
+	if snapshot.Status.State != providerapi.SnapshotStateReady {
 		log.V(1).Info("snapshot is not populated", "state", snapshot.Status.State)
 		return false, nil
 	}
 
-	parentName, snapName, err := getSnapshotSourceDetails(snapshot)
+	parentName, snapName, err := GetSnapshotSourceDetails(snapshot)
 	if err != nil {
 		return false, fmt.Errorf("failed to get snapshot source details: %w", err)
 	}
 
-	log.V(2).Info("Check if rbd snapshot exists", "snapshotId", snapName)
-	isSnapshotExist, isSnapshotProtected, err := snapshotExistsAndProtected(log, ioCtx, parentName, snapName)
+	parentPool := SnapshotPool(snapshot, r.pool)
+	parentIoCtx, err := openIOContext(r.conn, parentPool, snapshot.Source.Namespace)
 	if err != nil {
-		return false, fmt.Errorf("failed to check volume image snapshot existence: %w", err)
+		return false, err
 	}
-	if isSnapshotExist && !isSnapshotProtected {
-		if err := protectSnapshot(log, ioCtx, parentName, snapName); err != nil {
-			return false, fmt.Errorf("failed to protect snapshot %s: %w", snapName, err)
-		}
-		isSnapshotExist = true
+	defer parentIoCtx.Destroy()
+
+	log.V(2).Info("Check if rbd snapshot exists", "snapshotId", snapName, "pool", parentPool)
+	snapID, isSnapshotExist, err := findSnapshot(log, parentIoCtx, parentName, snapName)
+	if err != nil {
+		return false, fmt.Errorf("failed to check volume image snapshot existence: %w", err)
 	}
 	if !isSnapshotExist {
 		log.V(1).Info("Rbd snapshot does not exist. Mark snapshot as failed", "snapshotName", snapName)
@@ -790,15 +1088,24 @@ func (r *ImageReconciler) createImageFromSnapshot(ctx context.Context, log logr.
 	}
 	log.V(2).Info("Checked rbd snapshot existence", "snapshotId", snapName, "isSnapshotExist", isSnapshotExist)
 
-	ioCtx2, err := r.conn.OpenIOContext(r.pool)
-	if err != nil {
-		return false, fmt.Errorf("unable to get io context: %w", err)
+	// Clone v2 does not require the snapshot to be protected and lets it be removed while it has clones.
+	if err := options.SetUint64(librbd.ImageOptionCloneFormat, 2); err != nil {
+		return false, fmt.Errorf("failed to set clone format: %w", err)
 	}
-	defer ioCtx2.Destroy()
 
-	log.V(1).Info("Cloning Image", "ParentName", parentName, "SnapName", snapName, "ImageID", image.ID)
-	if err = librbd.CloneImage(ioCtx2, parentName, snapName, ioCtx, ImageIDToRBDID(image.ID), options); err != nil {
+	log.V(1).Info("Cloning Image", "ParentPool", parentPool, "ParentNamespace", snapshot.Source.Namespace, "ParentName", parentName, "SnapName", snapName, "ImageID", image.ID)
+	// The rbd snapshots of group snapshots are not in the user namespace and can only be cloned by id.
+	if snapshot.Source.GroupSnapshotID != "" {
+		err = librbd.CloneImageByID(parentIoCtx, parentName, snapID, ioCtx, ImageIDToRBDID(image.ID), options)
+	} else {
+		err = librbd.CloneImage(parentIoCtx, parentName, snapName, ioCtx, ImageIDToRBDID(image.ID), options)
+	}
+	if err != nil {
 		r.Eventf(image.Metadata, corev1.EventTypeWarning, "CreateImageFromSnapshotFailed", "CreateImageFromSnapshot", "Failed to clone rbd image: %s", err)
+		// Librbd supports cloning by snapshot id as of ceph squid, retrying would not help.
+		if errors.Is(err, librbd.ErrNotImplemented) {
+			return false, newImageError(providerapi.ImageReasonSnapshotFailed, fmt.Errorf("cloning snapshots of group snapshots is not supported by librbd: %w", err))
+		}
 		return false, fmt.Errorf("failed to clone rbd image: %w", err)
 	}
 	log.V(2).Info("Cloned image")
@@ -0,0 +1,292 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// reconcileMigration drives the live migration of the rbd image to the pools requested in the spec:
+// the migration is prepared, executed in the background and committed, or aborted if the request is
+// removed. The state is tracked in the image status and in ceph, so that a migration is resumed after
+// a restart. It returns whether a migration is in progress.
+func (r *ImageReconciler) reconcileMigration(ctx context.Context, log logr.Logger, image *providerapi.Image) (bool, error) {
+	active := image.Status.Migration.IsActive()
+	switch {
+	case image.Spec.Migration == nil && !active:
+		return false, nil
+	case image.Spec.Migration == nil:
+		return true, r.abortMigration(ctx, log, image)
+	case !active:
+		return r.prepareMigration(ctx, log, image)
+	default:
+		return true, r.executeMigration(ctx, log, image)
+	}
+}
+
+func (r *ImageReconciler) prepareMigration(ctx context.Context, log logr.Logger, image *providerapi.Image) (bool, error) {
+	target := &providerapi.Image{Spec: providerapi.ImageSpec{Pool: image.Spec.Migration.Pool, DataPool: image.Spec.Migration.DataPool}}
+	sourcePool, sourceDataPool := ImagePool(image, r.pool), ImageDataPool(image, r.pool, r.dataPool)
+	pool, dataPool := ImagePool(target, r.pool), ImageDataPool(target, r.pool, r.dataPool)
+	if pool == sourcePool && dataPool == sourceDataPool {
+		log.V(1).Info("Image is already stored in the requested pools")
+		image.Spec.Migration = nil
+		if _, err := r.images.Update(ctx, image); err != nil {
+			return false, fmt.Errorf("failed to remove migration request: %w", err)
+		}
+		return false, nil
+	}
+
+	log = log.WithValues("sourcePool", sourcePool, "sourceDataPool", sourceDataPool, "pool", pool, "dataPool", dataPool)
+	sourceIoCtx, err := openIOContext(r.conn, sourcePool, image.Spec.Namespace)
+	if err != nil {
+		return true, err
+	}
+	defer sourceIoCtx.Destroy()
+
+	if err := ensureNamespace(log, r.conn, pool, image.Spec.Namespace); err != nil {
+		return true, err
+	}
+	ioCtx, err := openIOContext(r.conn, pool, image.Spec.Namespace)
+	if err != nil {
+		return true, err
+	}
+	defer ioCtx.Destroy()
+
+	rbdID := ImageIDToRBDID(image.ID)
+	// Once the migration is prepared, librbd moves the source image to the trash. If the image could
+	// not be updated afterward, the prepared migration is resumed from the target image.
+	if status, err := librbd.MigrationStatus(ioCtx, rbdID); err == nil {
+		log.V(1).Info("Resuming prepared migration", "state", status.StateDescription)
+		return true, r.setMigrationPrepared(ctx, log, ioCtx, image, sourcePool, sourceDataPool, pool, dataPool)
+	}
+
+	img, err := openImage(sourceIoCtx, rbdID)
+	if err != nil {
+		return true, err
+	}
+	snapshots, err := img.GetSnapshotNames()
+	if err != nil {
+		closeImage(log, img)
+		return true, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	watchers, err := img.ListWatchers()
+	closeImage(log, img)
+	if err != nil {
+		return true, fmt.Errorf("failed to list watchers: %w", err)
+	}
+
+	if len(snapshots) > 0 {
+		return true, r.failMigration(ctx, image, sourcePool, sourceDataPool, pool, dataPool, "migrating volumes with snapshots is not supported")
+	}
+
+	// Clients have to reopen the image in the target pool once it is prepared.
+	if len(watchers) > 0 {
+		r.Eventf(image.Metadata, corev1.EventTypeWarning, "MigrationWaitingForClients", "MigrateImage", "Waiting for %d clients to close the image before migrating it", len(watchers))
+		return true, fmt.Errorf("image is in use by %d clients", len(watchers))
+	}
+
+	options := librbd.NewRbdImageOptions()
+	defer options.Destroy()
+	if err := options.SetString(librbd.ImageOptionDataPool, dataPool); err != nil {
+		return true, fmt.Errorf("failed to set data pool: %w", err)
+	}
+
+	log.V(1).Info("Preparing migration")
+	if err := librbd.MigrationPrepare(sourceIoCtx, rbdID, ioCtx, rbdID, options); err != nil {
+		r.Eventf(image.Metadata, corev1.EventTypeWarning, "MigrationPrepareFailed", "MigrateImage", "Failed to prepare migration: %s", err)
+		return true, fmt.Errorf("failed to prepare migration: %w", err)
+	}
+	return true, r.setMigrationPrepared(ctx, log, ioCtx, image, sourcePool, sourceDataPool, pool, dataPool)
+}
+
+// setMigrationPrepared records the prepared migration in the image status and moves the access of the
+// image to the target pool.
+func (r *ImageReconciler) setMigrationPrepared(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image, sourcePool, sourceDataPool, pool, dataPool string) error {
+	image.Status.Migration = &providerapi.ImageMigrationStatus{
+		SourcePool:     sourcePool,
+		SourceDataPool: sourceDataPool,
+		Pool:           pool,
+		DataPool:       dataPool,
+	}
+	image.Status.Migration.SetState(providerapi.ImageMigrationStatePrepared, "")
+	image.Spec.Pool, image.Spec.DataPool = pool, dataPool
+	if err := r.setImageAccess(log, ioCtx, image); err != nil {
+		return err
+	}
+	if _, err := r.images.Update(ctx, image); err != nil {
+		return fmt.Errorf("failed to update image: %w", err)
+	}
+	r.Eventf(image.Metadata, corev1.EventTypeNormal, "MigrationPrepared", "MigrateImage", "Prepared migration from pool %s to pool %s", sourcePool, pool)
+	log.V(1).Info("Prepared migration")
+	return nil
+}
+
+func (r *ImageReconciler) failMigration(ctx context.Context, image *providerapi.Image, sourcePool, sourceDataPool, pool, dataPool, message string) error {
+	image.Status.Migration = &providerapi.ImageMigrationStatus{
+		SourcePool:     sourcePool,
+		SourceDataPool: sourceDataPool,
+		Pool:           pool,
+		DataPool:       dataPool,
+	}
+	image.Status.Migration.SetState(providerapi.ImageMigrationStateFailed, message)
+	image.Spec.Migration = nil
+	if _, err := r.images.Update(ctx, image); err != nil {
+		return fmt.Errorf("failed to update image: %w", err)
+	}
+	r.Eventf(image.Metadata, corev1.EventTypeWarning, "MigrationFailed", "MigrateImage", "Failed to migrate image: %s", message)
+	return nil
+}
+
+func (r *ImageReconciler) executeMigration(ctx context.Context, log logr.Logger, image *providerapi.Image) error {
+	running, _, err := r.migrationExecutions.result(image.ID)
+	if running {
+		log.V(2).Info("Migration is executing")
+		return nil
+	}
+	// The state of the migration is tracked by ceph, so the result is not needed afterward.
+	r.migrationExecutions.forget(image.ID)
+	if err != nil {
+		r.Eventf(image.Metadata, corev1.EventTypeWarning, "MigrationExecutionFailed", "MigrateImage", "Failed to execute migration: %s", err)
+		return fmt.Errorf("failed to execute migration: %w", err)
+	}
+
+	pool, namespace := image.Status.Migration.Pool, image.Spec.Namespace
+	ioCtx, err := openIOContext(r.conn, pool, namespace)
+	if err != nil {
+		return err
+	}
+	defer ioCtx.Destroy()
+
+	rbdID := ImageIDToRBDID(image.ID)
+	status, err := librbd.MigrationStatus(ioCtx, rbdID)
+	if err != nil {
+		if !isNotMigratingError(err) {
+			return fmt.Errorf("failed to get migration status: %w", err)
+		}
+		// The image exists in the target pool without a migration, so the migration was committed,
+		// but the image could not be updated afterward.
+		log.V(1).Info("Migration is already committed")
+		return r.setMigrationCommitted(ctx, log, ioCtx, image)
+	}
+
+	switch status.State {
+	case librbd.MigrationImagePrepared, librbd.MigrationImageExecuting:
+		log.V(1).Info("Executing migration", "state", status.StateDescription)
+		r.migrationExecutions.start(image.ID, func() error {
+			ioCtx, err := openIOContext(r.conn, pool, namespace)
+			if err != nil {
+				return err
+			}
+			defer ioCtx.Destroy()
+
+			return librbd.MigrationExecute(ioCtx, rbdID)
+		}, func() {
+			r.queue.Add(image.ID)
+		})
+
+		if image.Status.Migration.State == providerapi.ImageMigrationStateExecuting && image.Status.Migration.Message == status.StateDescription {
+			return nil
+		}
+		image.Status.Migration.SetState(providerapi.ImageMigrationStateExecuting, status.StateDescription)
+		if _, err := r.images.Update(ctx, image); err != nil {
+			return fmt.Errorf("failed to update image: %w", err)
+		}
+		r.Eventf(image.Metadata, corev1.EventTypeNormal, "MigrationExecuting", "MigrateImage", "Executing migration to pool %s", pool)
+		return nil
+
+	case librbd.MigrationImageExecuted:
+		log.V(1).Info("Committing migration")
+		if err := librbd.MigrationCommit(ioCtx, rbdID); err != nil {
+			r.Eventf(image.Metadata, corev1.EventTypeWarning, "MigrationCommitFailed", "MigrateImage", "Failed to commit migration: %s", err)
+			return fmt.Errorf("failed to commit migration: %w", err)
+		}
+		return r.setMigrationCommitted(ctx, log, ioCtx, image)
+
+	default:
+		return fmt.Errorf("migration in unexpected state %d: %s", status.State, status.StateDescription)
+	}
+}
+
+// setMigrationCommitted records the committed migration in the image status and applies the class
+// requested with the migration.
+func (r *ImageReconciler) setMigrationCommitted(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
+	image.Status.Migration.SetState(providerapi.ImageMigrationStateCommitted, "")
+	if err := r.setImageAccess(log, ioCtx, image); err != nil {
+		return err
+	}
+	if class := image.Spec.Migration.Class; class != "" {
+		providerapi.SetClassLabelForObject(image, class)
+	}
+	image.Spec.Migration = nil
+	if _, err := r.images.Update(ctx, image); err != nil {
+		return fmt.Errorf("failed to update image: %w", err)
+	}
+	r.Eventf(image.Metadata, corev1.EventTypeNormal, "MigrationCommitted", "MigrateImage", "Migrated image from pool %s to pool %s", image.Status.Migration.SourcePool, image.Status.Migration.Pool)
+	log.V(1).Info("Committed migration")
+	return nil
+}
+
+// abortMigration rolls back a prepared migration, so that the rbd image is used from its source pools again.
+func (r *ImageReconciler) abortMigration(ctx context.Context, log logr.Logger, image *providerapi.Image) error {
+	if running, _, _ := r.migrationExecutions.result(image.ID); running {
+		log.V(1).Info("Waiting for the migration execution to finish before aborting")
+		return nil
+	}
+
+	migration := image.Status.Migration
+	ioCtx, err := openIOContext(r.conn, migration.Pool, image.Spec.Namespace)
+	if err != nil {
+		return err
+	}
+	defer ioCtx.Destroy()
+
+	sourceIoCtx, err := openIOContext(r.conn, migration.SourcePool, image.Spec.Namespace)
+	if err != nil {
+		return err
+	}
+	defer sourceIoCtx.Destroy()
+
+	rbdID := ImageIDToRBDID(image.ID)
+	// If the image exists in the source pool without a migration, the migration was aborted, but the
+	// image could not be updated afterward.
+	if _, err := librbd.MigrationStatus(sourceIoCtx, rbdID); isNotMigratingError(err) {
+		log.V(1).Info("Migration is already aborted")
+	} else {
+		log.V(1).Info("Aborting migration")
+		if err := librbd.MigrationAbort(ioCtx, rbdID); err != nil {
+			r.Eventf(image.Metadata, corev1.EventTypeWarning, "MigrationAbortFailed", "MigrateImage", "Failed to abort migration: %s", err)
+			return fmt.Errorf("failed to abort migration: %w", err)
+		}
+	}
+
+	migration.SetState(providerapi.ImageMigrationStateAborted, "")
+	image.Spec.Pool, image.Spec.DataPool = migration.SourcePool, migration.SourceDataPool
+	image.Spec.Migration = nil
+	if err := r.setImageAccess(log, sourceIoCtx, image); err != nil {
+		return err
+	}
+	if _, err := r.images.Update(ctx, image); err != nil {
+		return fmt.Errorf("failed to update image: %w", err)
+	}
+	r.Eventf(image.Metadata, corev1.EventTypeNormal, "MigrationAborted", "MigrateImage", "Aborted migration to pool %s", migration.Pool)
+	log.V(1).Info("Aborted migration")
+	return nil
+}
+
+// isNotMigratingError reports whether err is the error librbd returns for the migration status of an
+// existing rbd image that is not being migrated.
+func isNotMigratingError(err error) bool {
+	var errCode interface{ ErrorCode() int }
+	return errors.As(err, &errCode) && syscall.Errno(-errCode.ErrorCode()) == syscall.EINVAL
+}
@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// reconcileRollback reverts the rbd image to the snapshot requested in the spec. The rollback waits
+// for all clients to close the rbd image and copies the snapshot data in the background. As the rbd
+// image is resized to the size of the snapshot, it is grown to the requested size again afterward.
+// It returns whether a rollback is in progress.
+func (r *ImageReconciler) reconcileRollback(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) (bool, error) {
+	rollback := image.Spec.Rollback
+	if rollback == nil {
+		return false, nil
+	}
+	log = log.WithValues("rollbackSnapshotId", rollback.SnapshotID)
+
+	running, finished, err := r.rollbackExecutions.result(image.ID)
+	switch {
+	case running:
+		log.V(2).Info("Rollback is running")
+		return true, nil
+	case finished:
+		// The result is only dropped once it is recorded, as the rollback would be started again otherwise.
+		if err != nil {
+			err = r.failRollback(ctx, image, fmt.Sprintf("failed to roll back: %s", err))
+		} else {
+			err = r.completeRollback(ctx, log, image)
+		}
+		if err != nil {
+			return true, err
+		}
+		r.rollbackExecutions.forget(image.ID)
+		return true, nil
+	}
+
+	snapshot, err := r.snapshots.Get(ctx, rollback.SnapshotID)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			return true, fmt.Errorf("failed to get snapshot: %w", err)
+		}
+		return true, r.failRollback(ctx, image, fmt.Sprintf("snapshot %s not found", rollback.SnapshotID))
+	}
+	if snapshot.Source.VolumeImageID != image.ID || snapshot.Status.State != providerapi.SnapshotStateReady {
+		return true, r.failRollback(ctx, image, fmt.Sprintf("snapshot %s is not a ready snapshot of the image", rollback.SnapshotID))
+	}
+	// Librbd only rolls back to rbd snapshots in the user namespace.
+	if snapshot.Source.GroupSnapshotID != "" {
+		return true, r.failRollback(ctx, image, fmt.Sprintf("snapshot %s is part of group snapshot %s", rollback.SnapshotID, snapshot.Source.GroupSnapshotID))
+	}
+
+	rbdID := ImageIDToRBDID(image.ID)
+	exists, err := snapshotExists(log, ioCtx, rbdID, snapshot.ID)
+	if err != nil {
+		return true, err
+	}
+	if !exists {
+		return true, r.failRollback(ctx, image, fmt.Sprintf("rbd snapshot %s not found", snapshot.ID))
+	}
+
+	img, err := openImage(ioCtx, rbdID)
+	if err != nil {
+		return true, err
+	}
+	watchers, err := img.ListWatchers()
+	closeImage(log, img)
+	if err != nil {
+		return true, fmt.Errorf("failed to list watchers: %w", err)
+	}
+
+	// Clients must not read or write the rbd image while its data is replaced.
+	if len(watchers) > 0 {
+		message := fmt.Sprintf("waiting for %d clients to close the image", len(watchers))
+		if status := image.Status.Rollback; status == nil || status.SnapshotID != snapshot.ID || status.State != providerapi.ImageRollbackStatePending || status.Message != message {
+			if err := r.setRollbackState(ctx, image, snapshot.ID, providerapi.ImageRollbackStatePending, message); err != nil {
+				return true, err
+			}
+		}
+		r.Eventf(image.Metadata, corev1.EventTypeWarning, "RollbackWaitingForClients", "RollbackImage", "Waiting for %d clients to close the image before rolling it back", len(watchers))
+		return true, fmt.Errorf("image is in use by %d clients", len(watchers))
+	}
+
+	log.V(1).Info("Rolling back image to snapshot")
+	pool, namespace := ImagePool(image, r.pool), image.Spec.Namespace
+	r.rollbackExecutions.start(image.ID, func() error {
+		ioCtx, err := openIOContext(r.conn, pool, namespace)
+		if err != nil {
+			return err
+		}
+		defer ioCtx.Destroy()
+
+		img, err := openImage(ioCtx, rbdID)
+		if err != nil {
+			return err
+		}
+		defer closeImage(log, img)
+
+		return img.GetSnapshot(snapshot.ID).Rollback()
+	}, func() {
+		r.queue.Add(image.ID)
+	})
+
+	// The rollback might have been interrupted by a restart, upon which it is started again.
+	if status := image.Status.Rollback; status != nil && status.SnapshotID == snapshot.ID && status.State == providerapi.ImageRollbackStateRollingBack {
+		return true, nil
+	}
+	if err := r.setRollbackState(ctx, image, snapshot.ID, providerapi.ImageRollbackStateRollingBack, ""); err != nil {
+		return true, err
+	}
+	r.Eventf(image.Metadata, corev1.EventTypeNormal, "RollingBack", "RollbackImage", "Rolling back image to snapshot %s", snapshot.ID)
+	return true, nil
+}
+
+func (r *ImageReconciler) completeRollback(ctx context.Context, log logr.Logger, image *providerapi.Image) error {
+	snapshotID := image.Spec.Rollback.SnapshotID
+	image.Spec.Rollback = nil
+	if err := r.setRollbackState(ctx, image, snapshotID, providerapi.ImageRollbackStateCompleted, ""); err != nil {
+		return err
+	}
+	r.Eventf(image.Metadata, corev1.EventTypeNormal, "RolledBack", "RollbackImage", "Rolled back image to snapshot %s", snapshotID)
+	log.V(1).Info("Rolled back image to snapshot")
+	return nil
+}
+
+func (r *ImageReconciler) failRollback(ctx context.Context, image *providerapi.Image, message string) error {
+	snapshotID := image.Spec.Rollback.SnapshotID
+	image.Spec.Rollback = nil
+	if err := r.setRollbackState(ctx, image, snapshotID, providerapi.ImageRollbackStateFailed, message); err != nil {
+		return err
+	}
+	r.Eventf(image.Metadata, corev1.EventTypeWarning, "RollbackFailed", "RollbackImage", "Failed to roll back image: %s", message)
+	return nil
+}
+
+// setRollbackState records the state of the rollback to the given snapshot in the image status.
+func (r *ImageReconciler) setRollbackState(ctx context.Context, image *providerapi.Image, snapshotID string, state providerapi.ImageRollbackState, message string) error {
+	status := image.Status.Rollback
+	if status == nil || status.SnapshotID != snapshotID {
+		status = &providerapi.ImageRollbackStatus{SnapshotID: snapshotID}
+		image.Status.Rollback = status
+	}
+	status.SetState(state, message)
+	if _, err := r.images.Update(ctx, image); err != nil {
+		return fmt.Errorf("failed to update image rollback status: %w", err)
+	}
+	return nil
+}
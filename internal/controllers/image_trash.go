@@ -0,0 +1,166 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// trashImage moves the rbd image of a deleted image to the rbd trash, where it is kept for the trash
+// deferment. It returns false if the rbd image does not exist.
+func (r *ImageReconciler) trashImage(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) (bool, error) {
+	rbdID := ImageIDToRBDID(image.ID)
+	entry, err := findTrashEntry(ioCtx, rbdID)
+	if err != nil {
+		return false, err
+	}
+
+	// The rbd image might have been moved to the trash before the image could be updated.
+	if entry == nil {
+		exists, err := r.isImageExisting(ioCtx, image.ID)
+		if err != nil {
+			return false, fmt.Errorf("failed to check image existence: %w", err)
+		}
+		if !exists {
+			return false, nil
+		}
+
+		log.V(1).Info("Moving rbd image to the trash", "deferment", r.trashDeferment)
+		if err := librbd.GetImage(ioCtx, rbdID).Trash(r.trashDeferment); err != nil {
+			r.Eventf(image.Metadata, corev1.EventTypeWarning, "ImageTrashFailed", "DeleteImage", "Failed to move image to the trash: %s", err)
+			return false, fmt.Errorf("failed to move rbd image to the trash: %w", err)
+		}
+
+		if entry, err = findTrashEntry(ioCtx, rbdID); err != nil {
+			return false, err
+		}
+		if entry == nil {
+			return false, fmt.Errorf("rbd image %s not found in the trash", rbdID)
+		}
+	}
+
+	// The client of the image must not access it while it is in the trash.
+	if err := r.deleteImageClient(log, image); err != nil {
+		return false, err
+	}
+
+	image.Status.Trash = &providerapi.ImageTrashStatus{
+		ID:               entry.Id,
+		DeletionTime:     entry.DeletionTime,
+		DefermentEndTime: entry.DefermentEndTime,
+	}
+	if _, err := r.images.Update(ctx, image); err != nil {
+		return false, fmt.Errorf("failed to update image: %w", err)
+	}
+	r.Eventf(image.Metadata, corev1.EventTypeNormal, "ImageTrashed", "DeleteImage", "Moved image to the trash, it can be restored until %s", entry.DefermentEndTime.Format(time.RFC3339))
+	log.V(1).Info("Moved rbd image to the trash", "defermentEndTime", entry.DefermentEndTime)
+
+	r.queue.AddAfter(image.ID, time.Until(entry.DefermentEndTime))
+	return true, nil
+}
+
+// purgeImage removes the rbd image of a deleted image from the rbd trash once its deferment ended.
+// It returns false while the deferment has not ended yet.
+func (r *ImageReconciler) purgeImage(log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) (bool, error) {
+	if d := time.Until(image.Status.Trash.DefermentEndTime); d > 0 {
+		log.V(2).Info("Rbd image is kept in the trash", "remaining", d)
+		r.queue.AddAfter(image.ID, d)
+		return false, nil
+	}
+
+	log.V(1).Info("Removing rbd image from the trash")
+	rbdID := ImageIDToRBDID(image.ID)
+	if err := librbd.TrashRemove(ioCtx, image.Status.Trash.ID, false); err != nil {
+		if !errors.Is(err, librbd.ErrNotFound) {
+			hasClones, cloneErr := hasTrashedSnapshots(log, ioCtx, image.Status.Trash.ID)
+			if cloneErr != nil {
+				return false, errors.Join(fmt.Errorf("failed to remove rbd image from the trash: %w", err), cloneErr)
+			}
+			if !hasClones {
+				return false, fmt.Errorf("failed to remove rbd image from the trash: %w", err)
+			}
+
+			// Rbd images whose snapshots are kept in the trash namespace for their clones cannot be
+			// removed from the trash. They are restored and removed instead, upon which ceph moves them
+			// back to the trash and removes them along with their last clone.
+			log.V(1).Info("Rbd image is kept for the clones of its snapshots, restoring it to remove it")
+			if err := librbd.TrashRestore(ioCtx, image.Status.Trash.ID, rbdID); err != nil {
+				return false, fmt.Errorf("failed to restore rbd image from the trash: %w", err)
+			}
+		}
+
+		// The rbd image might have been restored to be removed before.
+		if err := librbd.RemoveImage(ioCtx, rbdID); err != nil && !errors.Is(err, librbd.ErrNotFound) {
+			return false, fmt.Errorf("failed to remove rbd image: %w", err)
+		}
+	}
+	log.V(2).Info("Rbd image removed from the trash")
+	return true, nil
+}
+
+// hasTrashedSnapshots reports whether the rbd image with the given id has snapshots that are kept in the
+// trash namespace because they still have clones.
+func hasTrashedSnapshots(log logr.Logger, ioCtx *rados.IOContext, id string) (bool, error) {
+	img, err := librbd.OpenImageById(ioCtx, id, librbd.NoSnapshot)
+	if err != nil {
+		return false, fmt.Errorf("failed to open rbd image %s: %w", id, err)
+	}
+	defer closeImage(log, img)
+
+	snaps, err := snapshotsInNamespace(img, librbd.SnapNamespaceTypeTrash)
+	if err != nil {
+		return false, err
+	}
+	return len(snaps) > 0, nil
+}
+
+// restoreImage restores the rbd image of an image whose deletion has been revoked from the rbd trash.
+func (r *ImageReconciler) restoreImage(ctx context.Context, log logr.Logger, ioCtx *rados.IOContext, image *providerapi.Image) error {
+	log.V(1).Info("Restoring rbd image from the trash")
+	if err := librbd.TrashRestore(ioCtx, image.Status.Trash.ID, ImageIDToRBDID(image.ID)); err != nil {
+		// The rbd image might have been restored before the image could be updated.
+		if exists, existsErr := r.isImageExisting(ioCtx, image.ID); existsErr != nil || !exists {
+			r.Eventf(image.Metadata, corev1.EventTypeWarning, "ImageRestoreFailed", "RestoreImage", "Failed to restore image from the trash: %s", err)
+			return fmt.Errorf("failed to restore rbd image from the trash: %w", err)
+		}
+	}
+
+	image.Status.Trash = nil
+	if image.Status.Access != nil {
+		if err := r.setImageAccess(log, ioCtx, image); err != nil {
+			return err
+		}
+	}
+	if _, err := r.images.Update(ctx, image); err != nil {
+		return fmt.Errorf("failed to update image: %w", err)
+	}
+	r.Eventf(image.Metadata, corev1.EventTypeNormal, "ImageRestored", "RestoreImage", "Restored image from the trash")
+	log.V(1).Info("Restored rbd image from the trash")
+	return nil
+}
+
+// findTrashEntry returns the most recent rbd trash entry of the rbd image with the given name, if any.
+func findTrashEntry(ioCtx *rados.IOContext, name string) (*librbd.TrashInfo, error) {
+	entries, err := librbd.GetTrashList(ioCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash: %w", err)
+	}
+
+	var res *librbd.TrashInfo
+	for i, entry := range entries {
+		if entry.Name == name && (res == nil || entry.DeletionTime.After(res.DeletionTime)) {
+			res = &entries[i]
+		}
+	}
+	return res, nil
+}
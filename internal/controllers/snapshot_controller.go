@@ -24,12 +24,18 @@ import (
 	"github.com/ironcore-dev/provider-utils/storeutils/store"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/ptr"
 )
 
 type SnapshotReconcilerOptions struct {
-	Pool                string
+	Pool string
+	// DataPool is the pool the data objects of the rbd os images are stored in. Defaults to Pool.
+	DataPool            string
 	PopulatorBufferSize int64
 	WorkerSize          int
+	// FlattenPollInterval is the interval the flatten tasks of the rbd images cloned from deleted
+	// snapshots are checked in. Defaults to 5 seconds.
+	FlattenPollInterval time.Duration
 }
 
 func NewSnapshotReconciler(
@@ -68,6 +74,10 @@ func NewSnapshotReconciler(
 		opts.WorkerSize = 15
 	}
 
+	if opts.FlattenPollInterval == 0 {
+		opts.FlattenPollInterval = 5 * time.Second
+	}
+
 	return &SnapshotReconciler{
 		log:                 log,
 		conn:                conn,
@@ -76,8 +86,11 @@ func NewSnapshotReconciler(
 		images:              images,
 		events:              events,
 		pool:                opts.Pool,
+		dataPool:            opts.DataPool,
 		populatorBufferSize: opts.PopulatorBufferSize,
 		workerSize:          opts.WorkerSize,
+		flatten:             newFlattenTasks(conn),
+		flattenPollInterval: opts.FlattenPollInterval,
 	}, nil
 }
 
@@ -91,9 +104,13 @@ type SnapshotReconciler struct {
 	events event.Source[*providerapi.Snapshot]
 
 	pool                string
+	dataPool            string
 	populatorBufferSize int64
 
 	workerSize int
+
+	flatten             *flattenTasks
+	flattenPollInterval time.Duration
 }
 
 func (r *SnapshotReconciler) Start(ctx context.Context) error {
@@ -158,7 +175,18 @@ func (r *SnapshotReconciler) deleteSnapshot(ctx context.Context, log logr.Logger
 		return nil
 	}
 
-	rbdID, snapshotID, err := getSnapshotSourceDetails(snapshot)
+	// The rbd snapshots of group snapshots are removed along with the group snapshot by the group
+	// snapshot reconciler once all its snapshots are deleted.
+	if snapshot.Source.GroupSnapshotID != "" {
+		snapshot.Finalizers = utils.DeleteSliceElement(snapshot.Finalizers, SnapshotFinalizer)
+		if _, err := r.store.Update(ctx, snapshot); store.IgnoreErrNotFound(err) != nil {
+			return fmt.Errorf("failed to update snapshot metadata: %w", err)
+		}
+		log.V(2).Info("Removed snapshot finalizer")
+		return nil
+	}
+
+	rbdID, snapshotID, err := GetSnapshotSourceDetails(snapshot)
 	if err != nil {
 		return fmt.Errorf("failed to get snapshot source details: %w", err)
 	}
@@ -182,12 +210,21 @@ func (r *SnapshotReconciler) deleteSnapshot(ctx context.Context, log logr.Logger
 		}
 	}()
 
-	if err := flattenChildImages(log, r.conn, img); err != nil {
-		return fmt.Errorf("failed to flatten snapshot child images: %w", err)
+	rbdSnapshot := img.GetSnapshot(snapshotID)
+	isProtected, err := rbdSnapshot.IsProtected()
+	if err != nil {
+		return fmt.Errorf("failed to check if snapshot is protected: %w", err)
+	}
+
+	// Snapshots protected for clone v1 can only be removed once their clones are flattened. All
+	// other snapshots are kept in the trash namespace by ceph until their last clone is removed.
+	if isProtected {
+		if flattened, err := r.flattenChildImages(ctx, log, img, snapshot); err != nil || !flattened {
+			return err
+		}
 	}
 
 	log.V(2).Info("Remove snapshot")
-	rbdSnapshot := img.GetSnapshot(snapshotID)
 	if err := removeSnapshot(rbdSnapshot); err != nil {
 		return fmt.Errorf("failed to remove snapshot: %w", err)
 	}
@@ -206,14 +243,16 @@ func (r *SnapshotReconciler) deleteSnapshot(ctx context.Context, log logr.Logger
 			return fmt.Errorf("unable to close ironcore os-image: %w", err)
 		}
 
+		// If its snapshot is kept in the trash namespace for its clones, ceph moves the os-image to the
+		// rbd trash and removes it along with the last clone.
 		if err := librbd.RemoveImage(ioCtx, rbdID); err != nil {
 			return fmt.Errorf("unable to remove ironcore os-image: %w", err)
 		}
 		log.V(2).Info("Ironcore os-image removed")
 	}
 
-	// deletes parent rbd image of snapshot which is created during source volume deletion
-	// and has no any other reference except snapshot
+	// deletes parent rbd image of snapshot which was created during source volume deletion before
+	// snapshots were kept with the rbd image of their volume and has no any other reference except snapshot
 	if rbdID == ImageIDToRBDID(snapshotID) {
 		log.V(2).Info("Remove parent rbd image")
 		if err := r.images.Delete(ctx, snapshotID); store.IgnoreErrNotFound(err) != nil {
@@ -224,14 +263,31 @@ func (r *SnapshotReconciler) deleteSnapshot(ctx context.Context, log logr.Logger
 	return nil
 }
 
-func (r *SnapshotReconciler) reconcileSnapshot(ctx context.Context, id string) error {
-	log := logr.FromContextOrDiscard(ctx)
-	ioCtx, err := r.conn.OpenIOContext(r.pool)
+// flattenChildImages flattens the rbd images cloned from the snapshot in the background and tracks
+// their progress in the status of the snapshot. It returns false while they are not flattened yet.
+func (r *SnapshotReconciler) flattenChildImages(ctx context.Context, log logr.Logger, img *librbd.Image, snapshot *providerapi.Snapshot) (bool, error) {
+	flatten, err := r.flatten.flattenChildren(log, img)
 	if err != nil {
-		return fmt.Errorf("unable to get io context: %w", err)
+		return false, fmt.Errorf("failed to flatten snapshot child images: %w", err)
 	}
-	defer ioCtx.Destroy()
 
+	if !ptr.Equal(snapshot.Status.Flatten, flatten) {
+		snapshot.Status.Flatten = flatten
+		if _, err := r.store.Update(ctx, snapshot); err != nil {
+			return false, fmt.Errorf("failed to update snapshot flatten status: %w", err)
+		}
+	}
+
+	if flatten != nil {
+		log.V(1).Info("Waiting for snapshot child images to be flattened", "images", flatten.Images, "progress", flatten.Progress)
+		r.queue.AddAfter(snapshot.ID, r.flattenPollInterval)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (r *SnapshotReconciler) reconcileSnapshot(ctx context.Context, id string) error {
+	log := logr.FromContextOrDiscard(ctx)
 	log.V(2).Info("Get snapshot from store")
 	snapshot, err := r.store.Get(ctx, id)
 	if err != nil {
@@ -241,6 +297,13 @@ func (r *SnapshotReconciler) reconcileSnapshot(ctx context.Context, id string) e
 		return nil
 	}
 
+	pool := SnapshotPool(snapshot, r.pool)
+	ioCtx, err := openIOContext(r.conn, pool, snapshot.Source.Namespace)
+	if err != nil {
+		return err
+	}
+	defer ioCtx.Destroy()
+
 	if snapshot.DeletedAt != nil {
 		if err := r.deleteSnapshot(ctx, log, ioCtx, snapshot); err != nil {
 			return fmt.Errorf("failed to delete snapshot: %w", err)
@@ -256,33 +319,20 @@ func (r *SnapshotReconciler) reconcileSnapshot(ctx context.Context, id string) e
 		}
 	}
 
-	rbdID, snapshotID, err := getSnapshotSourceDetails(snapshot)
-	if err != nil {
-		return fmt.Errorf("failed to get snapshot source details: %w", err)
+	// The snapshots of group snapshots are taken and marked ready by the group snapshot reconciler.
+	if snapshot.Source.GroupSnapshotID != "" {
+		log.V(2).Info("Snapshot is part of a group snapshot", "groupSnapshotId", snapshot.Source.GroupSnapshotID, "state", snapshot.Status.State)
+		return nil
 	}
 
-	log.V(2).Info("Check if rbd snapshot exists")
-	isSnapshotExist, isSnapshotProtected, err := snapshotExistsAndProtected(log, ioCtx, rbdID, snapshotID)
+	rbdID, snapshotID, err := GetSnapshotSourceDetails(snapshot)
 	if err != nil {
-		return fmt.Errorf("failed to check snapshot existence: %w", err)
-	}
-
-	if isSnapshotExist && !isSnapshotProtected {
-		// Snapshot exists but not protected - just protect it
-		if err := protectSnapshot(log, ioCtx, rbdID, snapshotID); err != nil {
-			return fmt.Errorf("failed to protect snapshot: %w", err)
-		}
+		return fmt.Errorf("failed to get snapshot source details: %w", err)
 	}
 
-	// SnapshotStatePopulated is no longer actively used. It has been replaced by SnapshotStateReady.
-	// This block will transition any snapshots that are in SnapshotStatePopulated to SnapshotStateReady.
-	if snapshot.Status.State == providerapi.SnapshotStatePopulated {
-		log.V(1).Info("Snapshot already populated")
-		snapshot.Status.State = providerapi.SnapshotStateReady
-		if _, err = r.store.Update(ctx, snapshot); err != nil {
-			return fmt.Errorf("failed to update snapshot: %w", err)
-		}
-		return nil
+	// Snapshots protected for clone v1 are unprotected once they have no clones anymore.
+	if err := unprotectSnapshot(log, ioCtx, rbdID, snapshotID); err != nil {
+		return fmt.Errorf("failed to unprotect snapshot: %w", err)
 	}
 
 	if snapshot.Status.State == providerapi.SnapshotStateReady {
@@ -342,11 +392,14 @@ func (r *SnapshotReconciler) reconcileIroncoreImageSnapshot(ctx context.Context,
 	options := librbd.NewRbdImageOptions()
 	defer options.Destroy()
 
-	//TODO: different pool for OS images?
-	if err := options.SetString(librbd.RbdImageOptionDataPool, r.pool); err != nil {
+	dataPool := r.pool
+	if r.dataPool != "" {
+		dataPool = r.dataPool
+	}
+	if err := options.SetString(librbd.RbdImageOptionDataPool, dataPool); err != nil {
 		return fmt.Errorf("failed to set data pool: %w", err)
 	}
-	log.V(2).Info("Configured pool", "pool", r.pool)
+	log.V(2).Info("Configured pool", "pool", r.pool, "dataPool", dataPool)
 
 	rbdImageID := SnapshotIDToRBDID(snapshot.ID)
 	roundedSize := round.OffBytes(snapshotSize)
@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/utils/clock"
+)
+
+// KeyFunc returns the key of the given cephx entity, e.g. by running auth get-key.
+type KeyFunc func(entity string) (string, error)
+
+// RotationHandler is called with the new key of a cephx entity whose key changed.
+type RotationHandler func(entity, key string)
+
+type Options struct {
+	// TTL is the duration keys are cached for. Defaults to 5 minutes.
+	TTL time.Duration
+	// Clock is the clock the age of cached keys is measured with. Defaults to the real clock.
+	Clock clock.PassiveClock
+}
+
+func setOptionsDefaults(o *Options) {
+	if o.TTL == 0 {
+		o.TTL = 5 * time.Minute
+	}
+	if o.Clock == nil {
+		o.Clock = clock.RealClock{}
+	}
+}
+
+// Provider caches the keys of cephx entities, so that not every lookup results in a monitor command.
+// Keys are fetched again once they are older than the TTL or are refreshed. If a fetched key
+// differs from the cached one, the key has been rotated and the rotation handlers are called.
+type Provider struct {
+	log   logr.Logger
+	fetch KeyFunc
+	ttl   time.Duration
+	clock clock.PassiveClock
+
+	mu       sync.Mutex
+	entries  map[string]*entry
+	handlers map[int]RotationHandler
+	nextID   int
+}
+
+type entry struct {
+	// mu serializes fetching the key, so that concurrent lookups result in a single monitor command.
+	mu        sync.Mutex
+	key       string
+	fetchedAt time.Time
+	valid     bool
+}
+
+// New returns a new Provider fetching keys with fetch.
+func New(log logr.Logger, fetch KeyFunc, opts Options) (*Provider, error) {
+	if fetch == nil {
+		return nil, fmt.Errorf("must specify key func")
+	}
+	if opts.TTL < 0 {
+		return nil, fmt.Errorf("ttl must not be negative")
+	}
+
+	setOptionsDefaults(&opts)
+
+	return &Provider{
+		log:      log,
+		fetch:    fetch,
+		ttl:      opts.TTL,
+		clock:    opts.Clock,
+		entries:  map[string]*entry{},
+		handlers: map[int]RotationHandler{},
+	}, nil
+}
+
+// Key returns the key of the given cephx entity. The key is only fetched if it is not cached or its
+// cached value is expired or has been invalidated by a failed refresh.
+func (p *Provider) Key(entity string) (string, error) {
+	p.mu.Lock()
+	e, ok := p.entries[entity]
+	if !ok {
+		e = &entry{}
+		p.entries[entity] = e
+	}
+	p.mu.Unlock()
+
+	e.mu.Lock()
+	if e.valid && p.clock.Since(e.fetchedAt) < p.ttl {
+		key := e.key
+		e.mu.Unlock()
+		return key, nil
+	}
+
+	key, err := p.fetch(entity)
+	if err != nil {
+		e.mu.Unlock()
+		return "", fmt.Errorf("failed to fetch key of %s: %w", entity, err)
+	}
+	rotated := !e.fetchedAt.IsZero() && e.key != key
+	e.key, e.fetchedAt, e.valid = key, p.clock.Now(), true
+	e.mu.Unlock()
+
+	if rotated {
+		p.log.Info("Key of ceph client has been rotated", "Entity", entity)
+		p.notify(entity, key)
+	}
+	return key, nil
+}
+
+// invalidate marks the cached key of the given cephx entity as stale, so that it is fetched again on
+// the next lookup.
+func (p *Provider) invalidate(entity string) {
+	p.mu.Lock()
+	e, ok := p.entries[entity]
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	e.mu.Lock()
+	e.valid = false
+	e.mu.Unlock()
+}
+
+// Refresh fetches the keys of all known cephx entities again and calls the rotation handlers for the
+// keys that changed.
+func (p *Provider) Refresh() error {
+	p.mu.Lock()
+	entities := sets.List(sets.KeySet(p.entries))
+	p.mu.Unlock()
+
+	var errs []error
+	for _, entity := range entities {
+		p.invalidate(entity)
+		if _, err := p.Key(entity); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AddRotationHandler adds a handler that is called whenever a rotated key is fetched. The returned
+// function removes the handler again.
+func (p *Provider) AddRotationHandler(handler RotationHandler) (remove func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	id := p.nextID
+	p.nextID++
+	p.handlers[id] = handler
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.handlers, id)
+	}
+}
+
+func (p *Provider) notify(entity, key string) {
+	p.mu.Lock()
+	handlers := make([]RotationHandler, 0, len(p.handlers))
+	for _, id := range slices.Sorted(maps.Keys(p.handlers)) {
+		handlers = append(handlers, p.handlers[id])
+	}
+	p.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(entity, key)
+	}
+}
+
+// Start refreshes the cached keys every TTL until ctx is done, so that rotated keys are picked up
+// even if no keys are looked up.
+func (p *Provider) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := p.Refresh(); err != nil {
+			p.log.Error(err, "Failed to refresh ceph client keys")
+		}
+	}, p.ttl)
+	return nil
+}
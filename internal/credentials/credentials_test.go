@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package credentials_test
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/ironcore-dev/ceph-provider/internal/credentials"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+type fakeKeys struct {
+	mu      sync.Mutex
+	keys    map[string]string
+	fetches int
+	err     error
+}
+
+func (f *fakeKeys) key(entity string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fetches++
+	if f.err != nil {
+		return "", f.err
+	}
+	return f.keys[entity], nil
+}
+
+func (f *fakeKeys) set(entity, key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys[entity] = key
+}
+
+var _ = Describe("Provider", func() {
+	var (
+		keys     *fakeKeys
+		clock    *testingclock.FakePassiveClock
+		provider *Provider
+		rotated  []string
+	)
+
+	BeforeEach(func() {
+		keys = &fakeKeys{keys: map[string]string{"client.volumes": "key-1"}}
+		clock = testingclock.NewFakePassiveClock(time.Now())
+		rotated = nil
+
+		var err error
+		provider, err = New(logr.Discard(), keys.key, Options{TTL: time.Minute, Clock: clock})
+		Expect(err).NotTo(HaveOccurred())
+		provider.AddRotationHandler(func(entity, key string) {
+			rotated = append(rotated, entity+"="+key)
+		})
+	})
+
+	It("should cache keys until the ttl expires", func() {
+		Expect(provider.Key("client.volumes")).To(Equal("key-1"))
+		Expect(provider.Key("client.volumes")).To(Equal("key-1"))
+		Expect(keys.fetches).To(Equal(1))
+
+		clock.SetTime(clock.Now().Add(time.Minute))
+		Expect(provider.Key("client.volumes")).To(Equal("key-1"))
+		Expect(keys.fetches).To(Equal(2))
+		Expect(rotated).To(BeEmpty())
+	})
+
+	It("should refresh all known keys and call the rotation handlers for changed keys", func() {
+		Expect(provider.Key("client.volumes")).To(Equal("key-1"))
+
+		keys.set("client.volumes", "key-2")
+		Expect(provider.Key("client.volumes")).To(Equal("key-1"))
+
+		Expect(provider.Refresh()).To(Succeed())
+		Expect(rotated).To(ConsistOf("client.volumes=key-2"))
+		Expect(provider.Key("client.volumes")).To(Equal("key-2"))
+		Expect(keys.fetches).To(Equal(2))
+	})
+
+	It("should keep the cached key invalid if refreshing fails", func() {
+		Expect(provider.Key("client.volumes")).To(Equal("key-1"))
+
+		keys.err = errors.New("monitors unavailable")
+		Expect(provider.Refresh()).To(MatchError(ContainSubstring("monitors unavailable")))
+		_, err := provider.Key("client.volumes")
+		Expect(err).To(MatchError(ContainSubstring("monitors unavailable")))
+
+		keys.err = nil
+		Expect(provider.Key("client.volumes")).To(Equal("key-1"))
+		Expect(keys.fetches).To(Equal(4))
+		Expect(rotated).To(BeEmpty())
+	})
+
+	It("should not call removed rotation handlers", func() {
+		var calls int
+		remove := provider.AddRotationHandler(func(string, string) { calls++ })
+		remove()
+
+		Expect(provider.Key("client.volumes")).To(Equal("key-1"))
+		keys.set("client.volumes", "key-2")
+		Expect(provider.Refresh()).To(Succeed())
+		Expect(calls).To(BeZero())
+		Expect(rotated).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,662 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package fsck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/go-logr/logr"
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/controllers"
+	eventrecorder "github.com/ironcore-dev/provider-utils/eventutils/recorder"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+type Category string
+
+const (
+	// CategoryOrphanedImage is an rbd volume image without image in the store.
+	CategoryOrphanedImage Category = "OrphanedImage"
+	// CategoryOrphanedOSImage is an rbd os image without snapshot in the store.
+	CategoryOrphanedOSImage Category = "OrphanedOSImage"
+	// CategoryOrphanedSnapshot is an rbd snapshot of a volume image without snapshot in the store.
+	CategoryOrphanedSnapshot Category = "OrphanedSnapshot"
+	// CategoryMissingImage is an available image in the store without rbd image. Images failed for
+	// their missing rbd image by a repair are reported again when checking with RecreateMissingImages.
+	CategoryMissingImage Category = "MissingImage"
+	// CategoryMissingSnapshot is a ready snapshot in the store without rbd snapshot.
+	CategoryMissingSnapshot Category = "MissingSnapshot"
+	// CategoryLeftoverClone is an image created to keep the snapshots of a deleted image,
+	// whose snapshot does not exist anymore.
+	CategoryLeftoverClone Category = "LeftoverClone"
+)
+
+// Issue is an inconsistency between the stores and the rbd images of the pools.
+type Issue struct {
+	Category Category
+	// Pool is the pool of the rbd image or snapshot concerned.
+	Pool string
+	// Namespace is the rbd namespace of the rbd image or snapshot concerned. Empty means the default namespace.
+	Namespace string
+	// ID is the id of the store object or the name of the rbd image or snapshot concerned.
+	ID      string
+	Message string
+
+	// Repaired reports whether the issue has been repaired.
+	Repaired bool
+	// RepairErr is the error that occurred when repairing the issue.
+	RepairErr error
+}
+
+// Result lists the inconsistencies found by a check.
+type Result struct {
+	Issues []Issue
+}
+
+// ByCategory returns the issues grouped by category.
+func (r *Result) ByCategory() map[Category][]Issue {
+	res := make(map[Category][]Issue)
+	for _, issue := range r.Issues {
+		res[issue.Category] = append(res[issue.Category], issue)
+	}
+	return res
+}
+
+type CheckOptions struct {
+	// Repair repairs the issues found. Without Repair, issues are only reported.
+	Repair bool
+	// RecreateMissingImages repairs images without rbd image by letting the image reconciler create
+	// their rbd image again, i.e. an empty disk or a fresh clone of their snapshot. Without it, such
+	// images are repaired by setting them to ImageStateError, so their loss is reported instead of
+	// silently handing out a blank disk.
+	RecreateMissingImages bool
+}
+
+type CheckerOptions struct {
+	// Pools are the pools rbd images are created in besides the provider pool, e.g. the pools of the
+	// volume classes. Objects whose rbd image is in a pool that is not checked are skipped.
+	Pools []string
+}
+
+// Checker cross-references the image and snapshot stores with the rbd images and snapshots of the pools.
+type Checker struct {
+	log logr.Logger
+
+	conn  *rados.Conn
+	pool  string
+	pools []string
+
+	images    store.Store[*providerapi.Image]
+	snapshots store.Store[*providerapi.Snapshot]
+
+	eventRecorder eventrecorder.EventRecorder
+}
+
+// NewChecker returns a new Checker. eventRecorder is optional and records an event for each
+// issue concerning a volume.
+func NewChecker(
+	log logr.Logger,
+	conn *rados.Conn,
+	pool string,
+	images store.Store[*providerapi.Image],
+	snapshots store.Store[*providerapi.Snapshot],
+	eventRecorder eventrecorder.EventRecorder,
+	opts CheckerOptions,
+) (*Checker, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("must specify conn")
+	}
+
+	if pool == "" {
+		return nil, fmt.Errorf("must specify pool")
+	}
+
+	if images == nil {
+		return nil, fmt.Errorf("must specify image store")
+	}
+
+	if snapshots == nil {
+		return nil, fmt.Errorf("must specify snapshot store")
+	}
+
+	pools := sets.New(opts.Pools...)
+	pools.Insert(pool)
+	pools.Delete("")
+
+	return &Checker{
+		log:           log,
+		conn:          conn,
+		pool:          pool,
+		pools:         sets.List(pools),
+		images:        images,
+		snapshots:     snapshots,
+		eventRecorder: eventRecorder,
+	}, nil
+}
+
+// Start runs a check every interval until ctx is done.
+func (c *Checker) Start(ctx context.Context, interval time.Duration, opts CheckOptions) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		res, err := c.Check(ctx, opts)
+		if err != nil {
+			c.log.Error(err, "Consistency check failed")
+			return
+		}
+		for category, issues := range res.ByCategory() {
+			c.log.Info("Found inconsistencies", "Category", category, "Count", len(issues))
+		}
+	}, interval)
+	return nil
+}
+
+// Check returns all inconsistencies between the stores and the pools and repairs them if requested.
+func (c *Checker) Check(ctx context.Context, opts CheckOptions) (*Result, error) {
+	ioCtxs := make(map[string]*rados.IOContext, len(c.pools))
+	defer func() {
+		for _, ioCtx := range ioCtxs {
+			ioCtx.Destroy()
+		}
+	}()
+
+	// The rbd images are listed before the stores: objects are added to the stores before their rbd
+	// images are created and removed from them after their rbd images are removed, so that objects
+	// created or deleted during the check are not reported as orphaned.
+	rbdImages := make(map[string]map[string]sets.Set[string], len(c.pools))
+	for _, pool := range c.pools {
+		namespaces, err := c.listNamespaces(pool)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, namespace := range namespaces {
+			loc := location(pool, namespace)
+			ioCtx, err := c.conn.OpenIOContext(pool)
+			if err != nil {
+				return nil, fmt.Errorf("unable to get io context for pool %s: %w", pool, err)
+			}
+			ioCtx.SetNamespace(namespace)
+			ioCtxs[loc] = ioCtx
+
+			if rbdImages[loc], err = c.listRBDImages(ioCtx); err != nil {
+				return nil, fmt.Errorf("failed to list rbd images of %s: %w", loc, err)
+			}
+		}
+	}
+
+	images, err := c.images.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+
+	snapshots, err := c.snapshots.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	res := &Result{}
+	for _, issue := range findIssues(c.pool, rbdImages, images, snapshots) {
+		log := c.log.WithValues("Category", issue.Category, "Pool", issue.Pool, "Namespace", issue.Namespace, "ID", issue.ID)
+		ioCtx := ioCtxs[location(issue.Pool, issue.Namespace)]
+
+		// Issues are confirmed individually, since objects may have been changed by the
+		// reconcilers after they have been listed.
+		confirmed, err := c.confirm(ctx, ioCtx, issue, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to confirm %s %s: %w", issue.Category, issue.ID, err)
+		}
+		if !confirmed {
+			log.V(1).Info("Inconsistency resolved itself")
+			continue
+		}
+
+		log.Info("Found inconsistency", "Message", issue.Message)
+		if opts.Repair {
+			if err := c.repair(ctx, ioCtx, issue, opts); err != nil {
+				log.Error(err, "Failed to repair inconsistency")
+				issue.RepairErr = err
+			} else {
+				log.Info("Repaired inconsistency")
+				issue.Repaired = true
+			}
+		}
+
+		c.recordEvent(ctx, issue)
+		res.Issues = append(res.Issues, issue)
+	}
+	return res, nil
+}
+
+// listNamespaces returns the rbd namespaces of the pool, starting with the default namespace.
+func (c *Checker) listNamespaces(pool string) ([]string, error) {
+	ioCtx, err := c.conn.OpenIOContext(pool)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get io context for pool %s: %w", pool, err)
+	}
+	defer ioCtx.Destroy()
+
+	namespaces, err := librbd.NamespaceList(ioCtx)
+	if err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return nil, fmt.Errorf("failed to list namespaces of pool %s: %w", pool, err)
+	}
+	slices.Sort(namespaces)
+	return append([]string{""}, namespaces...), nil
+}
+
+// location returns the key of the rbd images of a namespace of a pool, i.e. pool or pool/namespace.
+func location(pool, namespace string) string {
+	if namespace == "" {
+		return pool
+	}
+	return pool + "/" + namespace
+}
+
+// listRBDImages returns the snapshot names of all rbd images managed by the provider.
+func (c *Checker) listRBDImages(ioCtx *rados.IOContext) (map[string]sets.Set[string], error) {
+	names, err := librbd.GetImageNames(ioCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+
+	res := make(map[string]sets.Set[string])
+	for _, name := range names {
+		if !strings.HasPrefix(name, controllers.ImageRBDIDPrefix) && !strings.HasPrefix(name, controllers.SnapshotRBDIDPrefix) {
+			continue
+		}
+
+		snaps, err := c.getSnapshotNames(ioCtx, name)
+		if err != nil {
+			if errors.Is(err, librbd.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		res[name] = snaps
+	}
+	return res, nil
+}
+
+func (c *Checker) getSnapshotNames(ioCtx *rados.IOContext, imageName string) (sets.Set[string], error) {
+	img, err := librbd.OpenImageReadOnly(ioCtx, imageName, librbd.NoSnapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image %s: %w", imageName, err)
+	}
+	defer func() {
+		if err := img.Close(); err != nil {
+			c.log.Error(err, "failed to close image", "ImageName", imageName)
+		}
+	}()
+
+	snaps, err := img.GetSnapshotNames()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots of image %s: %w", imageName, err)
+	}
+
+	res := sets.New[string]()
+	for _, snap := range snaps {
+		// Snapshots in the trash namespace are removed by ceph along with their last clone.
+		nsType, err := img.GetSnapNamespaceType(snap.Id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get namespace of snapshot %s of image %s: %w", snap.Name, imageName, err)
+		}
+		if nsType != librbd.SnapNamespaceTypeUser {
+			continue
+		}
+		res.Insert(snap.Name)
+	}
+	return res, nil
+}
+
+// findIssues cross-references the rbd images of each pool with their snapshot names and the stored
+// objects. rbdImages is keyed by location. Objects whose rbd image is in a pool that has not been
+// listed are skipped, objects in a namespace that does not exist are checked against no rbd images.
+func findIssues(defaultPool string, rbdImages map[string]map[string]sets.Set[string], images []*providerapi.Image, snapshots []*providerapi.Snapshot) []Issue {
+	var issues []Issue
+
+	imageIDs := sets.New[string]()
+	for _, image := range images {
+		imageIDs.Insert(image.ID)
+	}
+	snapshotIDs := sets.New[string]()
+	for _, snapshot := range snapshots {
+		snapshotIDs.Insert(snapshot.ID)
+	}
+
+	for _, loc := range sets.List(sets.KeySet(rbdImages)) {
+		pool, namespace, _ := strings.Cut(loc, "/")
+		poolImages := rbdImages[loc]
+		for _, name := range sets.List(sets.KeySet(poolImages)) {
+			switch {
+			case strings.HasPrefix(name, controllers.ImageRBDIDPrefix):
+				id := strings.TrimPrefix(name, controllers.ImageRBDIDPrefix)
+				// Images keeping the snapshots of deleted images are named after the snapshot and
+				// are created before they are added to the image store.
+				if !imageIDs.Has(id) && !snapshotIDs.Has(id) {
+					issues = append(issues, Issue{
+						Category:  CategoryOrphanedImage,
+						Pool:      pool,
+						Namespace: namespace,
+						ID:        name,
+						Message:   fmt.Sprintf("rbd image %s/%s has no image in the store", loc, name),
+					})
+				}
+
+				for _, snapName := range sets.List(poolImages[name]) {
+					if !snapshotIDs.Has(snapName) {
+						issues = append(issues, Issue{
+							Category:  CategoryOrphanedSnapshot,
+							Pool:      pool,
+							Namespace: namespace,
+							ID:        name + "@" + snapName,
+							Message:   fmt.Sprintf("rbd snapshot %s/%s@%s has no snapshot in the store", loc, name, snapName),
+						})
+					}
+				}
+			case strings.HasPrefix(name, controllers.SnapshotRBDIDPrefix):
+				id := strings.TrimPrefix(name, controllers.SnapshotRBDIDPrefix)
+				if !snapshotIDs.Has(id) {
+					issues = append(issues, Issue{
+						Category:  CategoryOrphanedOSImage,
+						Pool:      pool,
+						Namespace: namespace,
+						ID:        name,
+						Message:   fmt.Sprintf("rbd os image %s/%s has no snapshot in the store", loc, name),
+					})
+				}
+			}
+		}
+	}
+
+	for _, image := range images {
+		if image.DeletedAt != nil {
+			continue
+		}
+
+		pool, namespace := controllers.ImagePool(image, defaultPool), image.Spec.Namespace
+		if _, ok := rbdImages[pool]; !ok {
+			continue
+		}
+		loc := location(pool, namespace)
+		poolImages := rbdImages[loc]
+
+		rbdName := controllers.ImageIDToRBDID(image.ID)
+		if _, ok := poolImages[rbdName]; !ok && (image.Status.State == providerapi.ImageStateAvailable || isMissingImageError(image)) {
+			issues = append(issues, Issue{
+				Category:  CategoryMissingImage,
+				Pool:      pool,
+				Namespace: namespace,
+				ID:        image.ID,
+				Message:   fmt.Sprintf("image %s is available but rbd image %s/%s does not exist", image.ID, loc, rbdName),
+			})
+		}
+
+		if isSnapshotClone(image) && !snapshotIDs.Has(image.ID) {
+			issues = append(issues, Issue{
+				Category:  CategoryLeftoverClone,
+				Pool:      pool,
+				Namespace: namespace,
+				ID:        image.ID,
+				Message:   fmt.Sprintf("image %s keeps the snapshot of a deleted image, but snapshot %s does not exist", image.ID, image.ID),
+			})
+		}
+	}
+
+	for _, snapshot := range snapshots {
+		if snapshot.DeletedAt != nil || snapshot.Status.State != providerapi.SnapshotStateReady {
+			continue
+		}
+		// The rbd snapshots of group snapshots are kept in the group namespace and managed by the group
+		// snapshot reconciler.
+		if snapshot.Source.GroupSnapshotID != "" {
+			continue
+		}
+
+		pool, namespace := controllers.SnapshotPool(snapshot, defaultPool), snapshot.Source.Namespace
+		if _, ok := rbdImages[pool]; !ok {
+			continue
+		}
+		loc := location(pool, namespace)
+		poolImages := rbdImages[loc]
+
+		parentName, snapName, err := controllers.GetSnapshotSourceDetails(snapshot)
+		if err != nil {
+			continue
+		}
+		if snaps, ok := poolImages[parentName]; !ok || !snaps.Has(snapName) {
+			issues = append(issues, Issue{
+				Category:  CategoryMissingSnapshot,
+				Pool:      pool,
+				Namespace: namespace,
+				ID:        snapshot.ID,
+				Message:   fmt.Sprintf("snapshot %s is ready but rbd snapshot %s/%s@%s does not exist", snapshot.ID, loc, parentName, snapName),
+			})
+		}
+	}
+
+	slices.SortStableFunc(issues, func(a, b Issue) int {
+		return strings.Compare(string(a.Category), string(b.Category))
+	})
+	return issues
+}
+
+// isSnapshotClone reports whether the image has been cloned from a snapshot of a deleted image
+// to keep the snapshot. Such images are named after the snapshot they are cloned from.
+func isSnapshotClone(image *providerapi.Image) bool {
+	return image.Spec.SnapshotRef != nil && *image.Spec.SnapshotRef == image.ID
+}
+
+// isMissingImageError reports whether the image has been failed by a repair for its missing rbd image.
+func isMissingImageError(image *providerapi.Image) bool {
+	return image.Status.State == providerapi.ImageStateError && image.Status.Reason == providerapi.ImageReasonRBDImageMissing
+}
+
+func (c *Checker) confirm(ctx context.Context, ioCtx *rados.IOContext, issue Issue, opts CheckOptions) (bool, error) {
+	switch issue.Category {
+	case CategoryOrphanedImage:
+		id := strings.TrimPrefix(issue.ID, controllers.ImageRBDIDPrefix)
+		imageFound, err := found(c.images.Get(ctx, id))
+		if err != nil {
+			return false, err
+		}
+		snapshotFound, err := found(c.snapshots.Get(ctx, id))
+		if err != nil {
+			return false, err
+		}
+		return !imageFound && !snapshotFound, nil
+	case CategoryOrphanedOSImage:
+		snapshotFound, err := found(c.snapshots.Get(ctx, strings.TrimPrefix(issue.ID, controllers.SnapshotRBDIDPrefix)))
+		return !snapshotFound, err
+	case CategoryOrphanedSnapshot:
+		_, snapName, _ := strings.Cut(issue.ID, "@")
+		snapshotFound, err := found(c.snapshots.Get(ctx, snapName))
+		return !snapshotFound, err
+	case CategoryMissingImage:
+		image, err := c.images.Get(ctx, issue.ID)
+		if err != nil {
+			return false, store.IgnoreErrNotFound(err)
+		}
+		if image.DeletedAt != nil {
+			return false, nil
+		}
+		// Failed images have been reported already and are only checked again to be recreated.
+		if image.Status.State != providerapi.ImageStateAvailable && !(isMissingImageError(image) && opts.RecreateMissingImages) {
+			return false, nil
+		}
+		if _, err := c.getSnapshotNames(ioCtx, controllers.ImageIDToRBDID(image.ID)); err != nil {
+			return errors.Is(err, librbd.ErrNotFound), ignoreErrNotFound(err)
+		}
+		return false, nil
+	case CategoryMissingSnapshot:
+		snapshot, err := c.snapshots.Get(ctx, issue.ID)
+		if err != nil {
+			return false, store.IgnoreErrNotFound(err)
+		}
+		if snapshot.DeletedAt != nil || snapshot.Status.State != providerapi.SnapshotStateReady {
+			return false, nil
+		}
+		parentName, snapName, err := controllers.GetSnapshotSourceDetails(snapshot)
+		if err != nil {
+			return false, err
+		}
+		snaps, err := c.getSnapshotNames(ioCtx, parentName)
+		if err != nil {
+			return errors.Is(err, librbd.ErrNotFound), ignoreErrNotFound(err)
+		}
+		return !snaps.Has(snapName), nil
+	case CategoryLeftoverClone:
+		snapshotFound, err := found(c.snapshots.Get(ctx, issue.ID))
+		return !snapshotFound, err
+	default:
+		return false, fmt.Errorf("unknown category %s", issue.Category)
+	}
+}
+
+func (c *Checker) repair(ctx context.Context, ioCtx *rados.IOContext, issue Issue, opts CheckOptions) error {
+	switch issue.Category {
+	case CategoryOrphanedImage, CategoryOrphanedOSImage:
+		return removeRBDImage(ioCtx, issue.ID)
+	case CategoryOrphanedSnapshot:
+		imageName, snapName, _ := strings.Cut(issue.ID, "@")
+		return removeRBDSnapshot(ioCtx, imageName, snapName)
+	case CategoryMissingImage:
+		image, err := c.images.Get(ctx, issue.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get image: %w", err)
+		}
+		if opts.RecreateMissingImages {
+			// The image reconciler creates the rbd image again for pending images.
+			image.Status.SetState(providerapi.ImageStatePending, "", "")
+			image.Status.Access = nil
+		} else {
+			// The image reconciler does not retry images in error state, so the rbd image is not
+			// replaced by a blank one under the same volume.
+			image.Status.SetState(providerapi.ImageStateError, providerapi.ImageReasonRBDImageMissing, issue.Message)
+		}
+		if _, err := c.images.Update(ctx, image); err != nil {
+			return fmt.Errorf("failed to update image: %w", err)
+		}
+		return nil
+	case CategoryMissingSnapshot:
+		snapshot, err := c.snapshots.Get(ctx, issue.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get snapshot: %w", err)
+		}
+		snapshot.Status.State = providerapi.SnapshotStateFailed
+		if _, err := c.snapshots.Update(ctx, snapshot); err != nil {
+			return fmt.Errorf("failed to update snapshot: %w", err)
+		}
+		return nil
+	case CategoryLeftoverClone:
+		// The image reconciler removes the rbd image of deleted images.
+		if err := c.images.Delete(ctx, issue.ID); store.IgnoreErrNotFound(err) != nil {
+			return fmt.Errorf("failed to delete image: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown category %s", issue.Category)
+	}
+}
+
+// removeRBDImage removes an rbd image along with its snapshots. Protected snapshots with
+// children cannot be unprotected, in which case the image is kept.
+func removeRBDImage(ioCtx *rados.IOContext, imageName string) error {
+	img, err := librbd.OpenImage(ioCtx, imageName, librbd.NoSnapshot)
+	if err != nil {
+		return ignoreErrNotFound(err)
+	}
+
+	snaps, err := img.GetSnapshotNames()
+	if err != nil {
+		_ = img.Close()
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	for _, snap := range snaps {
+		if err := removeSnapshot(img.GetSnapshot(snap.Name)); err != nil {
+			_ = img.Close()
+			return fmt.Errorf("failed to remove snapshot %s: %w", snap.Name, err)
+		}
+	}
+
+	if err := img.Close(); err != nil {
+		return fmt.Errorf("failed to close image: %w", err)
+	}
+
+	if err := librbd.RemoveImage(ioCtx, imageName); err != nil {
+		return ignoreErrNotFound(err)
+	}
+	return nil
+}
+
+func removeRBDSnapshot(ioCtx *rados.IOContext, imageName, snapName string) error {
+	img, err := librbd.OpenImage(ioCtx, imageName, librbd.NoSnapshot)
+	if err != nil {
+		return ignoreErrNotFound(err)
+	}
+	defer func() {
+		_ = img.Close()
+	}()
+
+	return removeSnapshot(img.GetSnapshot(snapName))
+}
+
+func removeSnapshot(snapshot *librbd.Snapshot) error {
+	isProtected, err := snapshot.IsProtected()
+	if err != nil {
+		return ignoreErrNotFound(err)
+	}
+
+	if isProtected {
+		if err := snapshot.Unprotect(); err != nil {
+			return fmt.Errorf("unable to unprotect snapshot: %w", err)
+		}
+	}
+
+	if err := snapshot.Remove(); err != nil {
+		return fmt.Errorf("unable to remove snapshot: %w", err)
+	}
+	return nil
+}
+
+func (c *Checker) recordEvent(ctx context.Context, issue Issue) {
+	if c.eventRecorder == nil || issue.Category != CategoryMissingImage {
+		return
+	}
+
+	image, err := c.images.Get(ctx, issue.ID)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case issue.Repaired && image.Status.State == providerapi.ImageStatePending:
+		c.eventRecorder.Eventf(image.Metadata, corev1.EventTypeWarning, "MissingImageRepaired", "ConsistencyCheck", "Rbd image does not exist and will be recreated")
+	case issue.Repaired:
+		c.eventRecorder.Eventf(image.Metadata, corev1.EventTypeWarning, "MissingImageFailed", "ConsistencyCheck", "Rbd image does not exist, the image has been set to error state")
+	default:
+		c.eventRecorder.Eventf(image.Metadata, corev1.EventTypeWarning, "MissingImage", "ConsistencyCheck", "Rbd image does not exist")
+	}
+}
+
+func found[E any](_ E, err error) (bool, error) {
+	if err != nil {
+		return false, store.IgnoreErrNotFound(err)
+	}
+	return true, nil
+}
+
+func ignoreErrNotFound(err error) error {
+	if errors.Is(err, librbd.ErrNotFound) {
+		return nil
+	}
+	return err
+}
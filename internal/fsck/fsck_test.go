@@ -0,0 +1,197 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package fsck
+
+import (
+	"time"
+
+	providerapi "github.com/ironcore-dev/ceph-provider/api"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/ptr"
+)
+
+func newImage(id string, state providerapi.ImageState, snapshotRef *string) *providerapi.Image {
+	return &providerapi.Image{
+		Metadata: apiutils.Metadata{ID: id},
+		Spec:     providerapi.ImageSpec{SnapshotRef: snapshotRef},
+		Status:   providerapi.ImageStatus{State: state},
+	}
+}
+
+func newSnapshot(id string, source providerapi.SnapshotSource) *providerapi.Snapshot {
+	return &providerapi.Snapshot{
+		Metadata: apiutils.Metadata{ID: id},
+		Source:   source,
+		Status:   providerapi.SnapshotStatus{State: providerapi.SnapshotStateReady},
+	}
+}
+
+func issueKeys(issues []Issue) []string {
+	var keys []string
+	for _, issue := range issues {
+		keys = append(keys, string(issue.Category)+":"+issue.ID)
+	}
+	return keys
+}
+
+const defaultPool = "pool"
+
+func inPool(rbdImages map[string]sets.Set[string]) map[string]map[string]sets.Set[string] {
+	return map[string]map[string]sets.Set[string]{defaultPool: rbdImages}
+}
+
+var _ = Describe("findIssues", func() {
+	It("should not report anything for a consistent pool", func() {
+		rbdImages := map[string]sets.Set[string]{
+			"img_vol":      sets.New("snap-vol"),
+			"img_restored": sets.New[string](),
+			"snap_os":      sets.New("v1"),
+		}
+		images := []*providerapi.Image{
+			newImage("vol", providerapi.ImageStateAvailable, nil),
+			newImage("restored", providerapi.ImageStateAvailable, ptr.To("os")),
+			newImage("pending", providerapi.ImageStatePending, nil),
+		}
+		snapshots := []*providerapi.Snapshot{
+			newSnapshot("snap-vol", providerapi.SnapshotSource{VolumeImageID: "vol"}),
+			newSnapshot("os", providerapi.SnapshotSource{IronCoreImage: "example.org/os:latest"}),
+		}
+
+		Expect(findIssues(defaultPool, inPool(rbdImages), images, snapshots)).To(BeEmpty())
+	})
+
+	It("should report every inconsistency by category", func() {
+		deleted := newImage("deleted", providerapi.ImageStateAvailable, nil)
+		deleted.DeletedAt = ptr.To(time.Now())
+
+		rbdImages := map[string]sets.Set[string]{
+			"img_orphan":    sets.New[string](),
+			"img_vol":       sets.New("unknown-snap"),
+			"img_gone-snap": sets.New("gone-snap"),
+			"snap_orphan":   sets.New("v1"),
+			"other":         sets.New[string](),
+		}
+		images := []*providerapi.Image{
+			newImage("vol", providerapi.ImageStateAvailable, nil),
+			newImage("missing", providerapi.ImageStateAvailable, nil),
+			newImage("gone-snap", providerapi.ImageStateAvailable, ptr.To("gone-snap")),
+			deleted,
+		}
+		snapshots := []*providerapi.Snapshot{
+			newSnapshot("missing-snap", providerapi.SnapshotSource{VolumeImageID: "vol"}),
+		}
+
+		Expect(issueKeys(findIssues(defaultPool, inPool(rbdImages), images, snapshots))).To(ConsistOf(
+			"OrphanedImage:img_orphan",
+			"OrphanedSnapshot:img_vol@unknown-snap",
+			"OrphanedSnapshot:img_gone-snap@gone-snap",
+			"OrphanedOSImage:snap_orphan",
+			"MissingImage:missing",
+			"LeftoverClone:gone-snap",
+			"MissingSnapshot:missing-snap",
+		))
+	})
+
+	It("should report images failed for their missing rbd image again", func() {
+		missing := newImage("missing", providerapi.ImageStateError, nil)
+		missing.Status.Reason = providerapi.ImageReasonRBDImageMissing
+		failed := newImage("failed", providerapi.ImageStateError, nil)
+		failed.Status.Reason = providerapi.ImageReasonEncryptionFailed
+
+		Expect(issueKeys(findIssues(defaultPool, inPool(map[string]sets.Set[string]{}), []*providerapi.Image{missing, failed}, nil))).To(ConsistOf(
+			"MissingImage:missing",
+		))
+	})
+
+	It("should not report images kept for the snapshots of deleted images as orphaned", func() {
+		rbdImages := map[string]sets.Set[string]{
+			"img_snap": sets.New("snap"),
+		}
+		snapshots := []*providerapi.Snapshot{
+			newSnapshot("snap", providerapi.SnapshotSource{VolumeImageID: "snap"}),
+		}
+
+		Expect(findIssues(defaultPool, inPool(rbdImages), nil, snapshots)).To(BeEmpty())
+	})
+
+	It("should check each object against the rbd images of its pool", func() {
+		rbdImages := map[string]map[string]sets.Set[string]{
+			defaultPool: {
+				"img_vol": sets.New[string](),
+			},
+			"ssd": {
+				"img_ssd-vol": sets.New("ssd-snap"),
+				"img_vol-ssd": sets.New[string](),
+			},
+		}
+
+		ssdVol := newImage("ssd-vol", providerapi.ImageStateAvailable, nil)
+		ssdVol.Spec.Pool = "ssd"
+		wrongPool := newImage("vol-ssd", providerapi.ImageStateAvailable, nil)
+		unchecked := newImage("unchecked", providerapi.ImageStateAvailable, nil)
+		unchecked.Spec.Pool = "hdd"
+		images := []*providerapi.Image{
+			newImage("vol", providerapi.ImageStateAvailable, nil),
+			ssdVol,
+			wrongPool,
+			unchecked,
+		}
+		snapshots := []*providerapi.Snapshot{
+			newSnapshot("ssd-snap", providerapi.SnapshotSource{VolumeImageID: "ssd-vol", Pool: "ssd"}),
+			newSnapshot("hdd-snap", providerapi.SnapshotSource{VolumeImageID: "unchecked", Pool: "hdd"}),
+		}
+
+		issues := findIssues(defaultPool, rbdImages, images, snapshots)
+		Expect(issueKeys(issues)).To(ConsistOf("MissingImage:vol-ssd"))
+		Expect(issues[0].Pool).To(Equal(defaultPool))
+	})
+
+	It("should check each object against the rbd images of its namespace", func() {
+		rbdImages := map[string]map[string]sets.Set[string]{
+			defaultPool: {
+				"img_default-vol": sets.New[string](),
+			},
+			defaultPool + "/tenant-a": {
+				"img_tenant-vol":    sets.New("tenant-snap"),
+				"img_orphan-in-a":   sets.New[string](),
+				"img_misplaced-vol": sets.New[string](),
+			},
+		}
+
+		tenantVol := newImage("tenant-vol", providerapi.ImageStateAvailable, nil)
+		tenantVol.Spec.Namespace = "tenant-a"
+		missing := newImage("missing-vol", providerapi.ImageStateAvailable, nil)
+		missing.Spec.Namespace = "tenant-b"
+		images := []*providerapi.Image{
+			newImage("default-vol", providerapi.ImageStateAvailable, nil),
+			newImage("misplaced-vol", providerapi.ImageStateAvailable, nil),
+			tenantVol,
+			missing,
+		}
+		snapshots := []*providerapi.Snapshot{
+			newSnapshot("tenant-snap", providerapi.SnapshotSource{VolumeImageID: "tenant-vol", Namespace: "tenant-a"}),
+		}
+
+		issues := findIssues(defaultPool, rbdImages, images, snapshots)
+		Expect(issueKeys(issues)).To(ConsistOf(
+			"OrphanedImage:img_orphan-in-a",
+			"MissingImage:misplaced-vol",
+			"MissingImage:missing-vol",
+		))
+		for _, issue := range issues {
+			switch issue.ID {
+			case "img_orphan-in-a":
+				Expect(issue.Namespace).To(Equal("tenant-a"))
+				Expect(issue.Message).To(ContainSubstring(defaultPool + "/tenant-a/img_orphan-in-a"))
+			case "misplaced-vol":
+				Expect(issue.Namespace).To(BeEmpty())
+			case "missing-vol":
+				Expect(issue.Namespace).To(Equal("tenant-b"))
+			}
+		}
+	})
+})
@@ -0,0 +1,294 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package leaderelection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/go-logr/logr"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/utils/clock"
+)
+
+const (
+	DefaultLockObject = "ironcore.leader"
+	DefaultLockName   = "volumeprovider"
+
+	DefaultLeaseDuration = 15 * time.Second
+	DefaultRenewDeadline = 10 * time.Second
+	DefaultRetryPeriod   = 2 * time.Second
+
+	// lockFlagMayRenew corresponds to LIBRADOS_LOCK_FLAG_MAY_RENEW, which lets the holder
+	// of a lock renew it instead of failing with EEXIST.
+	lockFlagMayRenew byte = 0x1
+)
+
+// ErrLeadershipLost is the reason leadership ended if the lease could not be renewed in time.
+var ErrLeadershipLost = errors.New("leadership lost")
+
+type Options struct {
+	// Identity identifies the candidate as lock cookie. Defaults to the instance id of the rados connection.
+	Identity string
+	// LockObject is the rados object the lock is taken on.
+	LockObject string
+	// LockName is the name of the lock.
+	LockName string
+	// LeaseDuration is the duration after which a lock that has not been renewed expires
+	// and can be acquired by a standby.
+	LeaseDuration time.Duration
+	// RenewDeadline is the duration the leader retries renewing its lease before giving up leadership.
+	RenewDeadline time.Duration
+	// RetryPeriod is the interval between attempts to acquire or renew the lease.
+	RetryPeriod time.Duration
+	// Clock is the clock the lease is timed with. Defaults to the real clock.
+	Clock clock.WithTicker
+}
+
+func setOptionsDefaults(o *Options) {
+	if o.LockObject == "" {
+		o.LockObject = DefaultLockObject
+	}
+	if o.LockName == "" {
+		o.LockName = DefaultLockName
+	}
+	if o.LeaseDuration == 0 {
+		o.LeaseDuration = DefaultLeaseDuration
+	}
+	if o.RenewDeadline == 0 {
+		o.RenewDeadline = DefaultRenewDeadline
+	}
+	if o.RetryPeriod == 0 {
+		o.RetryPeriod = DefaultRetryPeriod
+	}
+	if o.Clock == nil {
+		o.Clock = clock.RealClock{}
+	}
+}
+
+// LeaderElector elects a single leader among processes sharing a pool by holding an exclusive
+// rados lock. The lock is owned by the cephx entity of the connection and expires if it is not
+// renewed within the lease duration, so a standby takes over at most LeaseDuration + RetryPeriod
+// after the leader stopped renewing it.
+type LeaderElector struct {
+	log logr.Logger
+
+	conn *rados.Conn
+	pool string
+
+	cookie string
+
+	lockObject    string
+	lockName      string
+	leaseDuration time.Duration
+	renewDeadline time.Duration
+	retryPeriod   time.Duration
+	clock         clock.WithTicker
+
+	leading atomic.Bool
+}
+
+func New(log logr.Logger, conn *rados.Conn, pool string, opts Options) (*LeaderElector, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("must specify conn")
+	}
+
+	if pool == "" {
+		return nil, fmt.Errorf("must specify pool")
+	}
+
+	setOptionsDefaults(&opts)
+
+	if opts.Identity == "" {
+		opts.Identity = strconv.FormatUint(conn.GetInstanceID(), 10)
+	}
+
+	if opts.LeaseDuration <= opts.RenewDeadline {
+		return nil, fmt.Errorf("lease duration must be greater than renew deadline")
+	}
+
+	if opts.RenewDeadline <= opts.RetryPeriod {
+		return nil, fmt.Errorf("renew deadline must be greater than retry period")
+	}
+
+	return &LeaderElector{
+		log:           log,
+		conn:          conn,
+		pool:          pool,
+		cookie:        opts.Identity,
+		lockObject:    opts.LockObject,
+		lockName:      opts.LockName,
+		leaseDuration: opts.LeaseDuration,
+		renewDeadline: opts.RenewDeadline,
+		retryPeriod:   opts.RetryPeriod,
+		clock:         opts.Clock,
+	}, nil
+}
+
+// Run blocks until ctx is done. Whenever the lease is acquired, it calls run with a context that is
+// canceled once leadership is lost, after which the candidate returns to standby and tries to
+// acquire the lease again. Run returns the error of run, if any, and nil once ctx is done,
+// releasing the lease.
+func (e *LeaderElector) Run(ctx context.Context, run func(ctx context.Context) error) error {
+	log := e.log.WithValues("LockObject", e.lockObject, "Cookie", e.cookie)
+
+	for {
+		log.Info("Acquiring leader lease")
+		if !e.acquire(ctx) {
+			return nil
+		}
+		log.Info("Acquired leader lease")
+
+		err := e.lead(ctx, log, run)
+		if !errors.Is(err, ErrLeadershipLost) {
+			return err
+		}
+		log.Info("Lost leader lease, returning to standby", "Reason", err.Error())
+	}
+}
+
+// lead calls run until leadership is lost or ctx is done and releases the lease afterwards.
+func (e *LeaderElector) lead(ctx context.Context, log logr.Logger, run func(ctx context.Context) error) error {
+	e.leading.Store(true)
+
+	defer func() {
+		e.leading.Store(false)
+		if err := e.release(); err != nil {
+			log.Error(err, "Failed to release leader lease")
+			return
+		}
+		log.Info("Released leader lease")
+	}()
+
+	g, leaderCtx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		return run(leaderCtx)
+	})
+	g.Go(func() error {
+		err := e.renew(leaderCtx)
+		e.leading.Store(false)
+		return err
+	})
+	return g.Wait()
+}
+
+// IsLeader reports whether the lease is held. It reports false as soon as the lease could not be
+// renewed, even while run is still shutting down.
+func (e *LeaderElector) IsLeader() bool {
+	return e.leading.Load()
+}
+
+func (e *LeaderElector) acquire(ctx context.Context) bool {
+	for {
+		ok, err := e.tryLock(ctx, e.retryPeriod)
+		switch {
+		case ctx.Err() != nil:
+			return false
+		case err != nil:
+			e.log.Error(err, "Failed to acquire leader lease")
+		case ok:
+			return true
+		default:
+			e.log.V(2).Info("Leader lease is held by another process")
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-e.clock.After(e.retryPeriod):
+		}
+	}
+}
+
+func (e *LeaderElector) renew(ctx context.Context) error {
+	lastRenew := e.clock.Now()
+	ticker := e.clock.NewTicker(e.retryPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C():
+		}
+
+		remaining := e.renewDeadline - e.clock.Since(lastRenew)
+		if remaining <= 0 {
+			return fmt.Errorf("failed to renew lease within %s: %w", e.renewDeadline, ErrLeadershipLost)
+		}
+
+		ok, err := e.tryLock(ctx, remaining)
+		switch {
+		case err != nil:
+			e.log.Error(err, "Failed to renew leader lease")
+		case !ok:
+			return fmt.Errorf("lease has been acquired by another process: %w", ErrLeadershipLost)
+		default:
+			lastRenew = e.clock.Now()
+			e.log.V(2).Info("Renewed leader lease")
+		}
+	}
+}
+
+// tryLock acquires or renews the lock. It reports false if the lock is held by another process.
+// Since librados calls cannot be canceled, the result is abandoned after the given timeout. The
+// call therefore uses its own io context, which outlives an abandoned attempt.
+func (e *LeaderElector) tryLock(ctx context.Context, timeout time.Duration) (bool, error) {
+	type result struct {
+		ok  bool
+		err error
+	}
+	res := make(chan result, 1)
+
+	go func() {
+		ioCtx, err := e.conn.OpenIOContext(e.pool)
+		if err != nil {
+			res <- result{err: fmt.Errorf("unable to get io context: %w", err)}
+			return
+		}
+		defer ioCtx.Destroy()
+
+		flags := lockFlagMayRenew
+		ret, err := ioCtx.LockExclusive(e.lockObject, e.lockName, e.cookie, "volumeprovider leader", e.leaseDuration, &flags)
+		switch {
+		case err != nil:
+			res <- result{err: fmt.Errorf("failed to lock %s: %w", e.lockObject, err)}
+		case ret == -int(syscall.EBUSY):
+			res <- result{}
+		default:
+			res <- result{ok: true}
+		}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-timer.C:
+		return false, fmt.Errorf("timed out locking %s", e.lockObject)
+	case r := <-res:
+		return r.ok, r.err
+	}
+}
+
+func (e *LeaderElector) release() error {
+	ioCtx, err := e.conn.OpenIOContext(e.pool)
+	if err != nil {
+		return fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer ioCtx.Destroy()
+
+	if _, err := ioCtx.Unlock(e.lockObject, e.lockName, e.cookie); err != nil {
+		return fmt.Errorf("failed to unlock %s: %w", e.lockObject, err)
+	}
+	return nil
+}
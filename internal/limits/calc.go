@@ -4,17 +4,55 @@
 package limits
 
 import (
+	"math"
+
 	"github.com/ironcore-dev/ceph-provider/api"
 )
 
-func Calculate(iops, tps int64, burstFactor, burstDurationInSeconds int64) api.Limits {
+const GiB = 1024 * 1024 * 1024
+
+// ScalingPolicy derives a limit from the size of a volume.
+type ScalingPolicy struct {
+	// Base is the limit of an empty volume.
+	Base int64 `json:"base"`
+	// PerGiB is added to the limit for every GiB of the volume.
+	PerGiB int64 `json:"perGiB"`
+	// Min is the lower cap of the limit.
+	Min int64 `json:"min,omitempty"`
+	// Max is the upper cap of the limit. 0 means no cap.
+	Max int64 `json:"max,omitempty"`
+}
+
+// Apply returns the limit of a volume of the given size in bytes.
+func (p *ScalingPolicy) Apply(size uint64) int64 {
+	value := float64(p.Base) + float64(p.PerGiB)*float64(size)/GiB
+	if p.Max > 0 && value > float64(p.Max) {
+		return p.Max
+	}
+	if value > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return max(int64(math.Round(value)), p.Min)
+}
+
+// Scaling are the policies scaling the IOPS and bandwidth of a volume with its size.
+// Limits without policy are not scaled.
+type Scaling struct {
+	IOPS *ScalingPolicy `json:"iops,omitempty"`
+	TPS  *ScalingPolicy `json:"tps,omitempty"`
+}
+
+func Calculate(iops, tps int64, size uint64, scaling *Scaling, burstFactor, burstDurationInSeconds int64) api.Limits {
 	limits := map[api.LimitType]int64{}
 
-	//TODO: scaling dependent on size
-	var scale int64 = 1
+	if scaling != nil && scaling.IOPS != nil {
+		iops = scaling.IOPS.Apply(size)
+	}
+	if scaling != nil && scaling.TPS != nil {
+		tps = scaling.TPS.Apply(size)
+	}
 
 	//IOPS
-	iops = iops * scale
 	limits[api.IOPSLimit] = iops
 	limits[api.ReadIOPSLimit] = iops
 	limits[api.WriteIOPSLimit] = iops
@@ -27,7 +65,6 @@ func Calculate(iops, tps int64, burstFactor, burstDurationInSeconds int64) api.L
 	limits[api.IOPSBurstDurationLimit] = burstDurationInSeconds
 
 	//TPS
-	tps = tps * scale
 	limits[api.BPSLimit] = tps
 	limits[api.ReadBPSLimit] = tps
 	limits[api.WriteBPSLimit] = tps
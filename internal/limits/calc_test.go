@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package limits_test
+
+import (
+	"github.com/ironcore-dev/ceph-provider/api"
+	. "github.com/ironcore-dev/ceph-provider/internal/limits"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Calculate", func() {
+	It("should use the class capabilities without scaling", func() {
+		limits := Calculate(100, 2000, 10*GiB, nil, 10, 15)
+		Expect(limits).To(SatisfyAll(
+			HaveKeyWithValue(api.IOPSLimit, int64(100)),
+			HaveKeyWithValue(api.ReadIOPSLimit, int64(100)),
+			HaveKeyWithValue(api.WriteIOPSLimit, int64(100)),
+			HaveKeyWithValue(api.IOPSBurstLimit, int64(1000)),
+			HaveKeyWithValue(api.IOPSBurstDurationLimit, int64(15)),
+			HaveKeyWithValue(api.BPSLimit, int64(2000)),
+			HaveKeyWithValue(api.WriteBPSBurstLimit, int64(20000)),
+			HaveKeyWithValue(api.BPSBurstDurationLimit, int64(15)),
+		))
+		Expect(Calculate(100, 2000, 10*1024*GiB, nil, 10, 15)).To(Equal(limits))
+	})
+
+	It("should scale the limits with the size", func() {
+		scaling := &Scaling{
+			IOPS: &ScalingPolicy{Base: 100, PerGiB: 10, Min: 200, Max: 5000},
+			TPS:  &ScalingPolicy{Base: 1000, PerGiB: 100},
+		}
+
+		limits := Calculate(100, 2000, 50*GiB, scaling, 2, 15)
+		Expect(limits).To(SatisfyAll(
+			HaveKeyWithValue(api.IOPSLimit, int64(600)),
+			HaveKeyWithValue(api.IOPSBurstLimit, int64(1200)),
+			HaveKeyWithValue(api.BPSLimit, int64(6000)),
+			HaveKeyWithValue(api.BPSBurstLimit, int64(12000)),
+		))
+	})
+
+	It("should only scale the limits with a policy", func() {
+		limits := Calculate(100, 2000, 50*GiB, &Scaling{TPS: &ScalingPolicy{PerGiB: 1}}, 1, 15)
+		Expect(limits).To(HaveKeyWithValue(api.IOPSLimit, int64(100)))
+		Expect(limits).To(HaveKeyWithValue(api.BPSLimit, int64(50)))
+	})
+})
+
+var _ = Describe("ScalingPolicy", func() {
+	DescribeTable("should apply the minimum and maximum caps",
+		func(size uint64, expected int64) {
+			policy := &ScalingPolicy{Base: 100, PerGiB: 10, Min: 200, Max: 5000}
+			Expect(policy.Apply(size)).To(Equal(expected))
+		},
+		Entry("below minimum", uint64(1*GiB), int64(200)),
+		Entry("in range", uint64(100*GiB), int64(1100)),
+		Entry("partial GiB", uint64(100*GiB+GiB/2), int64(1105)),
+		Entry("above maximum", uint64(10*1024*GiB), int64(5000)),
+	)
+
+	It("should not cap without maximum", func() {
+		policy := &ScalingPolicy{PerGiB: 10}
+		Expect(policy.Apply(10 * 1024 * GiB)).To(Equal(int64(102400)))
+	})
+})
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package limits
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ironcore-dev/ceph-provider/api"
+)
+
+// Change is a limit whose value configured on an rbd image differs from the desired one.
+type Change struct {
+	Limit api.LimitType
+	// Current is the configured value, empty if the limit is not configured.
+	Current string
+	// Desired is the value to configure, empty if the limit has to be removed.
+	Desired string
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Limit, valueOrUnset(c.Current), valueOrUnset(c.Desired))
+}
+
+func valueOrUnset(value string) string {
+	if value == "" {
+		return "<unset>"
+	}
+	return value
+}
+
+// Diff returns the changes needed to turn the current limits of an rbd image into the desired ones,
+// sorted by limit. Current limits that are not desired are removed.
+func Diff(desired api.Limits, current map[api.LimitType]string) []Change {
+	var changes []Change
+	for limit, value := range desired {
+		desiredValue := strconv.FormatInt(value, 10)
+		if currentValue := current[limit]; currentValue != desiredValue {
+			changes = append(changes, Change{Limit: limit, Current: currentValue, Desired: desiredValue})
+		}
+	}
+	for limit, value := range current {
+		if _, ok := desired[limit]; !ok {
+			changes = append(changes, Change{Limit: limit, Current: value})
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b Change) int {
+		return strings.Compare(string(a.Limit), string(b.Limit))
+	})
+	return changes
+}
+
+// FormatChanges returns a human-readable summary of the changes.
+func FormatChanges(changes []Change) string {
+	parts := make([]string, 0, len(changes))
+	for _, change := range changes {
+		parts = append(parts, change.String())
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package limits_test
+
+import (
+	"github.com/ironcore-dev/ceph-provider/api"
+	. "github.com/ironcore-dev/ceph-provider/internal/limits"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Diff", func() {
+	It("should not report changes if the limits are configured", func() {
+		Expect(Diff(
+			api.Limits{api.IOPSLimit: 100, api.BPSLimit: 2000},
+			map[api.LimitType]string{api.IOPSLimit: "100", api.BPSLimit: "2000"},
+		)).To(BeEmpty())
+	})
+
+	It("should set changed and missing limits and remove stale ones", func() {
+		changes := Diff(
+			api.Limits{api.IOPSLimit: 200, api.IOPSBurstLimit: 2000, api.BPSLimit: 2000},
+			map[api.LimitType]string{api.IOPSLimit: "100", api.BPSLimit: "2000", api.ReadBPSLimit: "3000"},
+		)
+		Expect(changes).To(Equal([]Change{
+			{Limit: api.IOPSBurstLimit, Current: "", Desired: "2000"},
+			{Limit: api.IOPSLimit, Current: "100", Desired: "200"},
+			{Limit: api.ReadBPSLimit, Current: "3000", Desired: ""},
+		}))
+		Expect(FormatChanges(changes)).To(Equal(
+			"rbd_qos_iops_burst: <unset> -> 2000, rbd_qos_iops_limit: 100 -> 200, rbd_qos_read_bps_limit: 3000 -> <unset>",
+		))
+	})
+})
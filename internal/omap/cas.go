@@ -0,0 +1,178 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package omap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/ironcore-dev/ceph-provider/internal/utils"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+type casAction int
+
+const (
+	// casSkip leaves the omap entry untouched.
+	casSkip casAction = iota
+	// casSet writes the returned object to the omap entry.
+	casSet
+	// casRemove removes the omap entry.
+	casRemove
+)
+
+// mutateFunc computes the change of an omap entry from its current value. found reports
+// whether the entry exists. Errors returned by a mutateFunc abort the compare-and-swap.
+type mutateFunc[E any] func(current E, found bool) (E, casAction, error)
+
+// ErrConflict is returned if an omap entry could not be written within casMaxAttempts attempts
+// due to concurrent writes to its omap object.
+var ErrConflict = errors.New("omap object changed concurrently")
+
+const (
+	// casMaxAttempts is the number of attempts of a compare-and-swap before it gives up.
+	casMaxAttempts = 10
+	// casInitialBackoff is the backoff after the first conflicting write. It is doubled and jittered
+	// with each further conflict up to casMaxBackoff.
+	casInitialBackoff = 5 * time.Millisecond
+	casMaxBackoff     = 500 * time.Millisecond
+)
+
+// compareAndSwap applies mutate to the omap entry of the given id within a single rados write
+// operation asserting that the omap object has not been written since the entry was read.
+//
+// Librados can compare single omap values (omap_cmp), but go-ceph does not bind it, so the
+// assertion is made on the version of the whole omap object. A write to any other entry of the
+// object lets the assertion fail, in which case the entry is re-read after a jittered backoff and
+// mutate is called again with its current value. Concurrent writers of a hot omap object thereby
+// spread their retries instead of spinning.
+func (s *Store[E]) compareAndSwap(ctx context.Context, ioCtx *rados.IOContext, id string, mutate mutateFunc[E]) error {
+	backoff := wait.Backoff{
+		Duration: casInitialBackoff,
+		Factor:   2,
+		Jitter:   1,
+		Steps:    casMaxAttempts,
+		Cap:      casMaxBackoff,
+	}
+
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		current, version, err := s.getWithVersion(ioCtx, id)
+		found := err == nil
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+
+		obj, action, err := mutate(current, found)
+		if err != nil {
+			return err
+		}
+
+		err = s.writeEntry(ioCtx, id, version, obj, action)
+		if !isConflict(err) {
+			return err
+		}
+		if attempt >= casMaxAttempts {
+			return fmt.Errorf("failed to write object with id %q after %d attempts: %w", id, attempt, ErrConflict)
+		}
+
+		delay := backoff.Step()
+		s.log.V(2).Info("Omap object changed concurrently, retrying", "ID", id, "Attempt", attempt, "Backoff", delay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (s *Store[E]) writeEntry(ioCtx *rados.IOContext, id string, version uint64, obj E, action casAction) error {
+	if action == casSkip {
+		return nil
+	}
+
+	op := rados.CreateWriteOp()
+	defer op.Release()
+
+	// A version of 0 means the omap object did not exist when the entry was read.
+	if version == 0 {
+		op.Create(rados.CreateExclusive)
+	} else {
+		op.AssertVersion(version)
+	}
+
+	switch action {
+	case casSet:
+		data, err := s.encode(obj)
+		if err != nil {
+			return err
+		}
+		op.SetOmap(map[string][]byte{id: data})
+	case casRemove:
+		op.RmOmapKeys([]string{id})
+	}
+
+	if err := op.Operate(ioCtx, s.objectName(id), rados.OperationNoFlag); err != nil {
+		return fmt.Errorf("ceph write operation failed: %w", err)
+	}
+	return nil
+}
+
+// isConflict reports whether a write operation failed due to a concurrent write,
+// i.e. whether its version or exclusive create assertion failed.
+func isConflict(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, rados.ErrObjectExists) {
+		return true
+	}
+
+	var errCode interface{ ErrorCode() int }
+	if !errors.As(err, &errCode) {
+		return false
+	}
+	switch syscall.Errno(-errCode.ErrorCode()) {
+	case syscall.ERANGE, syscall.EOVERFLOW:
+		return true
+	default:
+		return false
+	}
+}
+
+// getWithVersion returns the object of the given id along with the version of its omap object.
+// The version is returned even if the entry does not exist and is 0 if the omap object does not exist.
+func (s *Store[E]) getWithVersion(ioCtx *rados.IOContext, id string) (E, uint64, error) {
+	data, err := getOmapValuesByKeys(ioCtx, s.objectName(id), []string{id})
+	if err != nil {
+		if !errors.Is(err, rados.ErrNotFound) {
+			return utils.Zero[E](), 0, fmt.Errorf("failed to fetch omap value: %w", err)
+		}
+		return utils.Zero[E](), 0, fmt.Errorf("object with id %q: %w", id, store.ErrNotFound)
+	}
+
+	version, err := ioCtx.GetLastVersion()
+	if err != nil {
+		return utils.Zero[E](), 0, fmt.Errorf("failed to get omap object version: %w", err)
+	}
+
+	if data[id] == nil {
+		return utils.Zero[E](), version, fmt.Errorf("object with id %q: %w", id, store.ErrNotFound)
+	}
+
+	obj, err := s.decode(data[id])
+	if err != nil {
+		return utils.Zero[E](), 0, err
+	}
+
+	return obj, version, nil
+}
@@ -4,6 +4,7 @@
 package omap
 
 const (
-	NameVolumes   = "ironcore.csi.volumes"
-	NameSnapshots = "ironcore.csi.snapshots"
+	NameVolumes        = "ironcore.csi.volumes"
+	NameSnapshots      = "ironcore.csi.snapshots"
+	NameGroupSnapshots = "ironcore.csi.groupsnapshots"
 )
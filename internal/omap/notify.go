@@ -0,0 +1,169 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package omap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	DefaultNotifyTimeout      = 5 * time.Second
+	DefaultWatchRetryInterval = 5 * time.Second
+)
+
+// notification is the payload sent to the watchers of an omap object when one of its entries changed.
+type notification struct {
+	Type store.WatchEventType `json:"type"`
+	ID   string               `json:"id"`
+}
+
+// notify informs store instances of other processes watching the omap object of the given id
+// about a mutation. Failures are only logged, since the mutation itself already succeeded.
+func (s *Store[E]) notify(ioCtx *rados.IOContext, evtType store.WatchEventType, id string) {
+	data, err := json.Marshal(notification{Type: evtType, ID: id})
+	if err != nil {
+		s.log.Error(err, "Failed to marshal notification", "ID", id)
+		return
+	}
+
+	_, timeouts, err := ioCtx.NotifyWithTimeout(s.objectName(id), data, s.notifyTimeout)
+	if err != nil {
+		s.log.Error(err, "Failed to notify watchers", "ID", id, "Type", evtType)
+		return
+	}
+	if len(timeouts) > 0 {
+		s.log.Info("Watchers did not acknowledge notification", "ID", id, "Type", evtType, "Timeouts", len(timeouts))
+	}
+}
+
+// Start registers a rados watch on every omap object of the store and forwards mutations
+// made by store instances of other processes to the local watches. It blocks until ctx is done.
+func (s *Store[E]) Start(ctx context.Context) error {
+	ioCtx, err := s.conn.OpenIOContext(s.pool)
+	if err != nil {
+		return fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer ioCtx.Destroy()
+
+	var wg sync.WaitGroup
+	for _, name := range s.objectNames() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.watchObject(ctx, ioCtx, name)
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (s *Store[E]) watchObject(ctx context.Context, ioCtx *rados.IOContext, name string) {
+	log := s.log.WithValues("Object", name)
+
+	var established bool
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		// Notifications sent while the watch was broken are lost, so every re-established
+		// watch starts with a resync of the entries held by the object.
+		resync := established
+		established = true
+
+		if err := s.runObjectWatch(ctx, ioCtx, name, resync); err != nil {
+			log.Error(err, "Rados watch failed, re-establishing")
+		}
+	}, s.watchRetryInterval)
+}
+
+func (s *Store[E]) runObjectWatch(ctx context.Context, ioCtx *rados.IOContext, name string, resync bool) error {
+	// A watch can only be registered on an existing object.
+	if err := ioCtx.Create(name, rados.CreateIdempotent); err != nil {
+		return fmt.Errorf("failed to create omap object: %w", err)
+	}
+
+	watcher, err := ioCtx.Watch(name)
+	if err != nil {
+		return fmt.Errorf("failed to watch omap object: %w", err)
+	}
+	defer func() {
+		if err := watcher.Delete(); err != nil {
+			s.log.Error(err, "Failed to delete rados watch", "Object", name)
+		}
+	}()
+	s.log.V(1).Info("Registered rados watch", "Object", name)
+
+	if resync {
+		if err := s.resyncObject(ioCtx, name); err != nil {
+			return fmt.Errorf("failed to resync omap object: %w", err)
+		}
+	}
+
+	instanceID := rados.NotifierID(s.conn.GetInstanceID())
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.Errors():
+			return fmt.Errorf("rados watch error: %w", err)
+		case evt := <-watcher.Events():
+			if err := evt.Ack(nil); err != nil {
+				s.log.Error(err, "Failed to acknowledge notification", "Object", name)
+			}
+			// Mutations of this process have already been enqueued locally.
+			if evt.NotifierID == instanceID {
+				continue
+			}
+			s.handleNotification(ioCtx, evt.Data)
+		}
+	}
+}
+
+func (s *Store[E]) handleNotification(ioCtx *rados.IOContext, data []byte) {
+	n := notification{}
+	if err := json.Unmarshal(data, &n); err != nil {
+		s.log.Error(err, "Failed to unmarshal notification")
+		return
+	}
+
+	// The entry is re-read, since it may have changed again since the notification was sent.
+	obj, err := s.get(ioCtx, n.ID)
+	switch {
+	case err == nil:
+		s.enqueue(store.WatchEvent[E]{
+			Type:   n.Type,
+			Object: obj,
+		})
+	case errors.Is(err, store.ErrNotFound):
+		obj := s.newFunc()
+		obj.SetID(n.ID)
+		s.enqueue(store.WatchEvent[E]{
+			Type:   store.WatchEventTypeDeleted,
+			Object: obj,
+		})
+	default:
+		s.log.Error(err, "Failed to get notified object", "ID", n.ID)
+	}
+}
+
+// resyncObject enqueues an update event for every entry of the given omap object.
+// Entries deleted while the watch was broken are not detected and are left to the
+// periodic resync of the watch consumers.
+func (s *Store[E]) resyncObject(ioCtx *rados.IOContext, name string) error {
+	_, err := s.iterate(ioCtx, name, "", func(_ string, obj E) bool {
+		s.enqueue(store.WatchEvent[E]{
+			Type:   store.WatchEventTypeUpdated,
+			Object: obj,
+		})
+		return true
+	})
+	return err
+}
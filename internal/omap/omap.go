@@ -5,7 +5,6 @@ package omap
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"sync"
@@ -28,12 +27,43 @@ type CreateStrategy[E apiutils.Object] interface {
 
 var ErrResourceVersionNotLatest = errors.New("resourceVersion is not latest")
 
+// PageOptions configure a single ListPage call.
+type PageOptions struct {
+	// Limit is the maximum number of objects returned. A value of 0 means no limit.
+	Limit int64
+	// Continue is the continuation key returned by a previous ListPage call.
+	Continue string
+}
+
+// Page is a single page of objects returned by ListPage.
+type Page[E apiutils.Object] struct {
+	Items []E
+	// Continue is the omap key the next page starts after. It is empty if there are no more objects.
+	Continue string
+}
+
+// PageLister is implemented by stores supporting paginated listing.
+type PageLister[E apiutils.Object] interface {
+	ListPage(ctx context.Context, pageOpts PageOptions, opts ...store.ListOption) (*Page[E], error)
+}
+
 type Options[E apiutils.Object] struct {
 	OmapName       string
 	NewFunc        func() E
 	CreateStrategy CreateStrategy[E]
 	IteratorSize   int64
 	FieldIndexers  map[string]store.IndexerFunc[E]
+	// Schema versions the stored objects. Objects are stored as plain JSON if no schema is set.
+	Schema *Schema
+	// Shards is the number of rados objects the omap entries are hashed across.
+	// A value of 0 or 1 keeps all entries in the single object named OmapName.
+	Shards int
+	// NotifyTimeout is the time to wait for store instances of other processes to
+	// acknowledge a mutation. Defaults to DefaultNotifyTimeout.
+	NotifyTimeout time.Duration
+	// WatchRetryInterval is the interval to re-establish a broken rados watch.
+	// Defaults to DefaultWatchRetryInterval.
+	WatchRetryInterval time.Duration
 }
 
 func New[E apiutils.Object](log logr.Logger, conn *rados.Conn, pool string, opts Options[E]) (*Store[E], error) {
@@ -57,6 +87,24 @@ func New[E apiutils.Object](log logr.Logger, conn *rados.Conn, pool string, opts
 		return nil, fmt.Errorf("must specify opts.IteratorSize (must be > 0)")
 	}
 
+	if opts.Shards < 0 {
+		return nil, fmt.Errorf("opts.Shards must not be negative")
+	}
+
+	if opts.Schema != nil {
+		if err := opts.Schema.validate(); err != nil {
+			return nil, fmt.Errorf("invalid opts.Schema: %w", err)
+		}
+	}
+
+	if opts.NotifyTimeout == 0 {
+		opts.NotifyTimeout = DefaultNotifyTimeout
+	}
+
+	if opts.WatchRetryInterval == 0 {
+		opts.WatchRetryInterval = DefaultWatchRetryInterval
+	}
+
 	indexers := make(map[string]store.IndexerFunc[E], len(opts.FieldIndexers))
 	for k, v := range opts.FieldIndexers {
 		indexers[k] = v
@@ -70,9 +118,14 @@ func New[E apiutils.Object](log logr.Logger, conn *rados.Conn, pool string, opts
 		conn:     conn,
 		pool:     pool,
 		omapName: opts.OmapName,
+		schema:   opts.Schema,
+		shards:   opts.Shards,
 
 		iteratorSize: opts.IteratorSize,
 
+		notifyTimeout:      opts.NotifyTimeout,
+		watchRetryInterval: opts.WatchRetryInterval,
+
 		watches: sets.New[*watch[E]](),
 
 		newFunc:        opts.NewFunc,
@@ -90,8 +143,13 @@ type Store[E apiutils.Object] struct {
 	conn         *rados.Conn
 	pool         string
 	omapName     string
+	schema       *Schema
+	shards       int
 	iteratorSize int64
 
+	notifyTimeout      time.Duration
+	watchRetryInterval time.Duration
+
 	newFunc        func() E
 	createStrategy CreateStrategy[E]
 
@@ -166,105 +224,184 @@ func getOmapValuesByKeys(ioCtx *rados.IOContext, omapName string, keys []string)
 	}
 }
 
-func (s *Store[E]) deleteOmapValue(ioCtx *rados.IOContext, omapName, key string) error {
-	if err := ioCtx.RmOmapKeys(omapName, []string{key}); err != nil {
-		return fmt.Errorf("unable to delete mapping omap value: %w", err)
+func getOmapValues(ioCtx *rados.IOContext, omapName, startAfter string, maxReturn int64) ([]*rados.OmapKeyValue, bool, error) {
+	op := rados.CreateReadOp()
+	defer op.Release()
+
+	step := op.GetOmapValues(startAfter, "", uint64(maxReturn))
+
+	if err := op.Operate(ioCtx, omapName, rados.OperationNoFlag); err != nil {
+		return nil, false, fmt.Errorf("ceph read operation failed: %w", err)
 	}
 
-	return nil
+	var result []*rados.OmapKeyValue
+	for {
+		kv, err := step.Next()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to iterate over ceph read results: %w", err)
+		}
+		if kv == nil {
+			return result, step.More(), nil
+		}
+		result = append(result, kv)
+	}
 }
 
-func (s *Store[E]) setOmapValue(ioCtx *rados.IOContext, omapName, key string, value []byte) error {
-	if err := ioCtx.SetOmap(omapName, map[string][]byte{
-		key: value,
-	}); err != nil {
-		return fmt.Errorf("unable to set omap values: %w", err)
+// iterate reads the omap of the given object in batches of iteratorSize, starting after the given
+// key, and calls fn for every stored object in key order. Iteration stops early if fn returns false.
+// The returned bool reports whether the omap was read to its end.
+func (s *Store[E]) iterate(ioCtx *rados.IOContext, omapName, startAfter string, fn func(key string, obj E) bool) (bool, error) {
+	for {
+		kvs, more, err := getOmapValues(ioCtx, omapName, startAfter, s.iteratorSize)
+		if err != nil {
+			if errors.Is(err, rados.ErrNotFound) {
+				return true, nil
+			}
+			return false, err
+		}
+
+		for _, kv := range kvs {
+			obj, err := s.decode(kv.Value)
+			if err != nil {
+				return false, err
+			}
+
+			if !fn(kv.Key, obj) {
+				return false, nil
+			}
+			startAfter = kv.Key
+		}
+
+		if !more || len(kvs) == 0 {
+			return true, nil
+		}
 	}
+}
 
-	return nil
+// withIDLock calls fn while holding the lock of the given id. Watchers of other processes are
+// notified after the lock is released, so that an unresponsive watcher does not block further
+// mutations of the id for the notify timeout.
+func (s *Store[E]) withIDLock(id string, fn func() error) error {
+	s.idMu.Lock(id)
+	defer s.idMu.Unlock(id)
+
+	return fn()
 }
 
 func (s *Store[E]) Create(ctx context.Context, obj E) (E, error) {
-	s.idMu.Lock(obj.GetID())
-	defer s.idMu.Unlock(obj.GetID())
-
 	ioCtx, err := s.conn.OpenIOContext(s.pool)
 	if err != nil {
 		return utils.Zero[E](), fmt.Errorf("unable to get io context: %w", err)
 	}
 	defer ioCtx.Destroy()
 
-	_, err = s.get(ioCtx, obj.GetID())
-	switch {
-	case err == nil:
-		return utils.Zero[E](), fmt.Errorf("object with id %q %w", obj.GetID(), store.ErrAlreadyExists)
-	case errors.Is(err, store.ErrNotFound):
-	default:
-		return utils.Zero[E](), fmt.Errorf("failed to get object with id %q %w", obj.GetID(), err)
-	}
+	if err := s.withIDLock(obj.GetID(), func() error {
+		if s.createStrategy != nil {
+			s.createStrategy.PrepareForCreate(obj)
+		}
 
-	if s.createStrategy != nil {
-		s.createStrategy.PrepareForCreate(obj)
-	}
+		obj.SetCreatedAt(time.Now())
+		obj.IncrementResourceVersion()
 
-	obj.SetCreatedAt(time.Now())
-	obj.IncrementResourceVersion()
+		if err := s.compareAndSwap(ctx, ioCtx, obj.GetID(), func(_ E, found bool) (E, casAction, error) {
+			if found {
+				return utils.Zero[E](), casSkip, fmt.Errorf("object with id %q %w", obj.GetID(), store.ErrAlreadyExists)
+			}
+			return obj, casSet, nil
+		}); err != nil {
+			return err
+		}
 
-	obj, err = s.set(ioCtx, obj)
-	if err != nil {
+		s.enqueue(store.WatchEvent[E]{
+			Type:   store.WatchEventTypeCreated,
+			Object: obj,
+		})
+		return nil
+	}); err != nil {
 		return utils.Zero[E](), err
 	}
-
-	s.enqueue(store.WatchEvent[E]{
-		Type:   store.WatchEventTypeCreated,
-		Object: obj,
-	})
+	s.notify(ioCtx, store.WatchEventTypeCreated, obj.GetID())
 
 	return obj, nil
 }
 
-func (s *Store[E]) Delete(ctx context.Context, id string) error {
-	s.idMu.Lock(id)
-	defer s.idMu.Unlock(id)
-
+// Restore writes obj as is, without applying the create strategy or changing its metadata.
+// It is meant for restoring objects from a backup and fails if an object with the same id exists.
+func (s *Store[E]) Restore(ctx context.Context, obj E) error {
 	ioCtx, err := s.conn.OpenIOContext(s.pool)
 	if err != nil {
 		return fmt.Errorf("unable to get io context: %w", err)
 	}
 	defer ioCtx.Destroy()
 
-	obj, err := s.get(ioCtx, id)
-	if err != nil {
+	if err := s.withIDLock(obj.GetID(), func() error {
+		if err := s.compareAndSwap(ctx, ioCtx, obj.GetID(), func(_ E, found bool) (E, casAction, error) {
+			if found {
+				return utils.Zero[E](), casSkip, fmt.Errorf("object with id %q %w", obj.GetID(), store.ErrAlreadyExists)
+			}
+			return obj, casSet, nil
+		}); err != nil {
+			return err
+		}
+
+		s.enqueue(store.WatchEvent[E]{
+			Type:   store.WatchEventTypeCreated,
+			Object: obj,
+		})
+		return nil
+	}); err != nil {
 		return err
 	}
+	s.notify(ioCtx, store.WatchEventTypeCreated, obj.GetID())
 
-	if len(obj.GetFinalizers()) == 0 {
-		return s.delete(ioCtx, id)
-	}
+	return nil
+}
 
-	if obj.GetDeletedAt() != nil {
-		return nil
+func (s *Store[E]) Delete(ctx context.Context, id string) error {
+	ioCtx, err := s.conn.OpenIOContext(s.pool)
+	if err != nil {
+		return fmt.Errorf("unable to get io context: %w", err)
 	}
+	defer ioCtx.Destroy()
 
-	now := time.Now()
-	obj.SetDeletedAt(&now)
-	obj.IncrementResourceVersion()
+	var action casAction
+	if err := s.withIDLock(id, func() error {
+		var deleted E
+		if err := s.compareAndSwap(ctx, ioCtx, id, func(obj E, found bool) (E, casAction, error) {
+			switch {
+			case !found:
+				return utils.Zero[E](), casSkip, fmt.Errorf("object with id %q: %w", id, store.ErrNotFound)
+			case len(obj.GetFinalizers()) == 0:
+				action = casRemove
+				return obj, action, nil
+			case obj.GetDeletedAt() != nil:
+				action = casSkip
+				return obj, action, nil
+			}
 
-	if _, err := s.set(ioCtx, obj); err != nil {
-		return fmt.Errorf("failed to set object metadata: %w", err)
-	}
+			now := time.Now()
+			obj.SetDeletedAt(&now)
+			obj.IncrementResourceVersion()
 
-	s.enqueue(store.WatchEvent[E]{
-		Type:   store.WatchEventTypeDeleted,
-		Object: obj,
-	})
+			deleted, action = obj, casSet
+			return obj, action, nil
+		}); err != nil {
+			return err
+		}
 
-	return nil
-}
+		if action == casSet {
+			s.enqueue(store.WatchEvent[E]{
+				Type:   store.WatchEventTypeDeleted,
+				Object: deleted,
+			})
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
 
-func (s *Store[E]) delete(ioCtx *rados.IOContext, id string) error {
-	if err := s.deleteOmapValue(ioCtx, s.omapName, id); err != nil {
-		return fmt.Errorf("failed to delete object from omap: %w", err)
+	if action != casSkip {
+		s.notify(ioCtx, store.WatchEventTypeDeleted, id)
 	}
 	return nil
 }
@@ -280,41 +417,53 @@ func (s *Store[E]) Get(ctx context.Context, id string) (E, error) {
 }
 
 func (s *Store[E]) Update(ctx context.Context, obj E) (E, error) {
-	s.idMu.Lock(obj.GetID())
-	defer s.idMu.Unlock(obj.GetID())
-
 	ioCtx, err := s.conn.OpenIOContext(s.pool)
 	if err != nil {
 		return utils.Zero[E](), fmt.Errorf("unable to get io context: %w", err)
 	}
 	defer ioCtx.Destroy()
 
-	oldObj, err := s.get(ioCtx, obj.GetID())
-	if err != nil {
-		return utils.Zero[E](), err
-	}
+	var removed bool
+	if err := s.withIDLock(obj.GetID(), func() error {
+		resourceVersion := obj.GetResourceVersion()
+		if err := s.compareAndSwap(ctx, ioCtx, obj.GetID(), func(oldObj E, found bool) (E, casAction, error) {
+			if !found {
+				return utils.Zero[E](), casSkip, fmt.Errorf("object with id %q: %w", obj.GetID(), store.ErrNotFound)
+			}
 
-	if obj.GetDeletedAt() != nil && len(obj.GetFinalizers()) == 0 {
-		if err := s.delete(ioCtx, obj.GetID()); err != nil {
-			return utils.Zero[E](), fmt.Errorf("failed to delete object metadata: %w", err)
-		}
-		return obj, nil
-	}
+			removed = obj.GetDeletedAt() != nil && len(obj.GetFinalizers()) == 0
+			if removed {
+				return obj, casRemove, nil
+			}
 
-	if oldObj.GetResourceVersion() != obj.GetResourceVersion() {
-		return utils.Zero[E](), fmt.Errorf("failed to update object: %w", ErrResourceVersionNotLatest)
-	}
-	obj.IncrementResourceVersion()
+			if oldObj.GetResourceVersion() != resourceVersion {
+				return utils.Zero[E](), casSkip, fmt.Errorf("failed to update object: %w", ErrResourceVersionNotLatest)
+			}
+			// Increment only once, since mutate is called again if the swap is retried.
+			if obj.GetResourceVersion() == resourceVersion {
+				obj.IncrementResourceVersion()
+			}
+			return obj, casSet, nil
+		}); err != nil {
+			return err
+		}
 
-	obj, err = s.set(ioCtx, obj)
-	if err != nil {
+		if !removed {
+			s.enqueue(store.WatchEvent[E]{
+				Type:   store.WatchEventTypeUpdated,
+				Object: obj,
+			})
+		}
+		return nil
+	}); err != nil {
 		return utils.Zero[E](), err
 	}
 
-	s.enqueue(store.WatchEvent[E]{
-		Type:   store.WatchEventTypeUpdated,
-		Object: obj,
-	})
+	if removed {
+		s.notify(ioCtx, store.WatchEventTypeDeleted, obj.GetID())
+		return obj, nil
+	}
+	s.notify(ioCtx, store.WatchEventTypeUpdated, obj.GetID())
 
 	return obj, nil
 }
@@ -383,20 +532,15 @@ func (s *Store[E]) Watch(ctx context.Context, opts ...store.ListOption) (store.W
 		return nil, err
 	}
 
-	// List runs before acquiring watchesMu to avoid a deadlock: List→OpenIOContext
+	// Listing runs before acquiring watchesMu to avoid a deadlock: listMemberIDs→OpenIOContext
 	// may interact with idMu, while mutations hold idMu before calling enqueue→watchesMu.RLock.
-	// This means a mutation between List and watches.Insert may be missed in
+	// This means a mutation between listing and watches.Insert may be missed in
 	// members, but we accept that narrow gap.
-	existing, err := s.List(ctx, opts...)
+	members, err := s.listMemberIDs(*listOpts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list existing objects for watch: %w", err)
 	}
 
-	members := sets.New[string]()
-	for _, obj := range existing {
-		members.Insert(obj.GetID())
-	}
-
 	s.watchesMu.Lock()
 	defer s.watchesMu.Unlock()
 
@@ -412,6 +556,28 @@ func (s *Store[E]) Watch(ctx context.Context, opts ...store.ListOption) (store.W
 	return w, nil
 }
 
+func (s *Store[E]) listMemberIDs(listOpts store.ListOptions) (sets.Set[string], error) {
+	ioCtx, err := s.conn.OpenIOContext(s.pool)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer ioCtx.Destroy()
+
+	members := sets.New[string]()
+	for _, name := range s.objectNames() {
+		if _, err := s.iterate(ioCtx, name, "", func(_ string, obj E) bool {
+			if s.matchesOptions(obj, listOpts) {
+				members.Insert(obj.GetID())
+			}
+			return true
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return members, nil
+}
+
 func (s *Store[E]) List(ctx context.Context, opts ...store.ListOption) ([]E, error) {
 	listOpts := &store.ListOptions{}
 	for _, opt := range opts {
@@ -428,60 +594,84 @@ func (s *Store[E]) List(ctx context.Context, opts ...store.ListOption) ([]E, err
 	}
 	defer ioCtx.Destroy()
 
-	omap, err := ioCtx.GetAllOmapValues(s.omapName, "", "", s.iteratorSize)
-	if err != nil {
-		if errors.Is(err, rados.ErrNotFound) {
-			return nil, nil
-		}
-		return nil, err
-	}
-
 	var objs []E
-	for _, v := range omap {
-		obj := s.newFunc()
-		if err := json.Unmarshal(v, &obj); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal object: %w", err)
-		}
-
-		if !s.matchesOptions(obj, *listOpts) {
-			continue
+	for _, name := range s.objectNames() {
+		if _, err := s.iterate(ioCtx, name, "", func(_ string, obj E) bool {
+			if s.matchesOptions(obj, *listOpts) {
+				objs = append(objs, obj)
+			}
+			return true
+		}); err != nil {
+			return nil, err
 		}
-
-		objs = append(objs, obj)
 	}
 
 	return objs, nil
 }
 
-func (s *Store[E]) set(ioCtx *rados.IOContext, obj E) (E, error) {
-	data, err := json.Marshal(obj)
-	if err != nil {
-		return utils.Zero[E](), fmt.Errorf("failed to marshal obj: %w", err)
+// ListPage lists at most pageOpts.Limit objects matching opts, starting after pageOpts.Continue.
+// The returned continuation key is derived from the last omap key that was read (prefixed with
+// its shard for sharded stores), so objects filtered out by opts are not visited again.
+func (s *Store[E]) ListPage(ctx context.Context, pageOpts PageOptions, opts ...store.ListOption) (*Page[E], error) {
+	listOpts := &store.ListOptions{}
+	for _, opt := range opts {
+		opt.ApplyToList(listOpts)
 	}
 
-	if err := s.setOmapValue(ioCtx, s.omapName, obj.GetID(), data); err != nil {
-		return utils.Zero[E](), fmt.Errorf("failed to put os object mapping: %w", err)
+	if err := s.validateFieldSelector(*listOpts); err != nil {
+		return nil, err
 	}
 
-	return obj, nil
-}
+	if pageOpts.Limit < 0 {
+		return nil, fmt.Errorf("page limit must not be negative")
+	}
 
-func (s *Store[E]) get(ioCtx *rados.IOContext, id string) (E, error) {
-	data, err := getOmapValuesByKeys(ioCtx, s.omapName, []string{id})
+	startShard, startAfter, err := s.decodeContinue(pageOpts.Continue)
 	if err != nil {
-		if !errors.Is(err, rados.ErrNotFound) {
-			return utils.Zero[E](), fmt.Errorf("failed to fetch omap value: %w", err)
-		}
-		return utils.Zero[E](), fmt.Errorf("object with id %q: %w", id, store.ErrNotFound)
+		return nil, err
 	}
-	if data[id] == nil {
-		return utils.Zero[E](), fmt.Errorf("object with id %q: %w", id, store.ErrNotFound)
+
+	ioCtx, err := s.conn.OpenIOContext(s.pool)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get io context: %w", err)
 	}
+	defer ioCtx.Destroy()
 
-	obj := s.newFunc()
-	if err := json.Unmarshal(data[id], obj); err != nil {
-		return utils.Zero[E](), fmt.Errorf("failed to unmarshal object: %w", err)
+	var (
+		page      = &Page[E]{}
+		lastShard = startShard
+		lastKey   = startAfter
+	)
+	names := s.objectNames()
+	for shard := startShard; shard < len(names); shard++ {
+		if shard != startShard {
+			startAfter = ""
+		}
+
+		done, err := s.iterate(ioCtx, names[shard], startAfter, func(key string, obj E) bool {
+			if pageOpts.Limit > 0 && int64(len(page.Items)) >= pageOpts.Limit {
+				return false
+			}
+
+			lastShard, lastKey = shard, key
+			if s.matchesOptions(obj, *listOpts) {
+				page.Items = append(page.Items, obj)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !done {
+			page.Continue = s.encodeContinue(lastShard, lastKey)
+			break
+		}
 	}
 
-	return obj, nil
+	return page, nil
+}
+
+func (s *Store[E]) get(ioCtx *rados.IOContext, id string) (E, error) {
+	obj, _, err := s.getWithVersion(ioCtx, id)
+	return obj, err
 }
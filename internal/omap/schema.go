@@ -0,0 +1,242 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package omap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/ironcore-dev/ceph-provider/internal/utils"
+)
+
+// Schema describes the versioned encoding of stored objects. Objects are written in an envelope
+// carrying the API version and are migrated to the current version when read.
+type Schema struct {
+	// APIVersion is the version objects are written with.
+	APIVersion string
+	// Migrations convert stored objects of older versions step by step to APIVersion.
+	Migrations []Migration
+}
+
+// Migration converts the JSON of a stored object from one API version to the next one.
+// Objects written before versioning was introduced have the empty API version.
+type Migration struct {
+	From    string
+	To      string
+	Migrate func(data []byte) ([]byte, error)
+}
+
+type envelope struct {
+	APIVersion string          `json:"apiVersion"`
+	Object     json.RawMessage `json:"object"`
+}
+
+func (s *Schema) validate() error {
+	if s.APIVersion == "" {
+		return fmt.Errorf("must specify api version")
+	}
+
+	migrations := make(map[string]Migration, len(s.Migrations))
+	for _, m := range s.Migrations {
+		if m.Migrate == nil {
+			return fmt.Errorf("migration from %q to %q must specify a migrate function", m.From, m.To)
+		}
+		if _, ok := migrations[m.From]; ok {
+			return fmt.Errorf("duplicate migration from %q", m.From)
+		}
+		migrations[m.From] = m
+	}
+
+	for from := range migrations {
+		version := from
+		for steps := 0; version != s.APIVersion; steps++ {
+			m, ok := migrations[version]
+			if !ok || steps > len(migrations) {
+				return fmt.Errorf("migrations from %q do not lead to %q", from, s.APIVersion)
+			}
+			version = m.To
+		}
+	}
+	return nil
+}
+
+// unwrap returns the API version and object of stored data. Data without envelope has been
+// written before versioning was introduced and has the empty API version.
+func (s *Schema) unwrap(data []byte) (string, []byte, error) {
+	env := envelope{}
+	if err := json.Unmarshal(data, &env); err != nil {
+		return "", nil, fmt.Errorf("failed to unmarshal envelope: %w", err)
+	}
+	if env.APIVersion == "" || env.Object == nil {
+		return "", data, nil
+	}
+	return env.APIVersion, env.Object, nil
+}
+
+// upgrade returns the object of stored data migrated to the current API version.
+func (s *Schema) upgrade(data []byte) ([]byte, error) {
+	if s == nil {
+		return data, nil
+	}
+
+	version, data, err := s.unwrap(data)
+	if err != nil {
+		return nil, err
+	}
+	return s.migrate(version, data)
+}
+
+// migrate returns the object data of the given API version migrated to the current one.
+func (s *Schema) migrate(version string, data []byte) ([]byte, error) {
+	if s == nil {
+		return data, nil
+	}
+
+	var err error
+	for version != s.APIVersion {
+		m, ok := s.migration(version)
+		if !ok {
+			return nil, fmt.Errorf("no migration from api version %q to %q", version, s.APIVersion)
+		}
+
+		data, err = m.Migrate(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate from api version %q to %q: %w", m.From, m.To, err)
+		}
+		version = m.To
+	}
+	return data, nil
+}
+
+func (s *Schema) migration(from string) (Migration, bool) {
+	for _, m := range s.Migrations {
+		if m.From == from {
+			return m, true
+		}
+	}
+	return Migration{}, false
+}
+
+// wrap returns the object data in an envelope of the current API version.
+func (s *Schema) wrap(data []byte) ([]byte, error) {
+	if s == nil {
+		return data, nil
+	}
+	return json.Marshal(envelope{APIVersion: s.APIVersion, Object: data})
+}
+
+// Decode migrates stored data to the current API version and unmarshals it into obj.
+func (s *Schema) Decode(data []byte, obj any) error {
+	data, err := s.upgrade(data)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, obj); err != nil {
+		return fmt.Errorf("failed to unmarshal object: %w", err)
+	}
+	return nil
+}
+
+// DecodeVersion migrates object data of the given API version to the current one and unmarshals
+// it into obj. Unlike Decode, the data is not expected to be wrapped in an envelope.
+func (s *Schema) DecodeVersion(version string, data []byte, obj any) error {
+	data, err := s.migrate(version, data)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, obj); err != nil {
+		return fmt.Errorf("failed to unmarshal object: %w", err)
+	}
+	return nil
+}
+
+func (s *Store[E]) decode(data []byte) (E, error) {
+	obj := s.newFunc()
+	if err := s.schema.Decode(data, obj); err != nil {
+		return utils.Zero[E](), err
+	}
+	return obj, nil
+}
+
+func (s *Store[E]) encode(obj E) ([]byte, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal obj: %w", err)
+	}
+	return s.schema.wrap(data)
+}
+
+// MigrateObjects rewrites all stored objects of an older API version with the current one.
+// Objects are migrated on read anyway, so this is only needed to drop support for old versions.
+func (s *Store[E]) MigrateObjects(ctx context.Context) error {
+	if s.schema == nil {
+		return nil
+	}
+
+	ioCtx, err := s.conn.OpenIOContext(s.pool)
+	if err != nil {
+		return fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer ioCtx.Destroy()
+
+	log := s.log.WithValues("omap", s.omapName, "APIVersion", s.schema.APIVersion)
+	log.Info("Migrating stored objects")
+
+	var migrated int
+	for _, name := range s.objectNames() {
+		startAfter := ""
+		for {
+			kvs, more, err := getOmapValues(ioCtx, name, startAfter, s.iteratorSize)
+			if err != nil {
+				if errors.Is(err, rados.ErrNotFound) {
+					break
+				}
+				return fmt.Errorf("failed to read omap values of %s: %w", name, err)
+			}
+
+			for _, kv := range kvs {
+				startAfter = kv.Key
+
+				version, _, err := s.schema.unwrap(kv.Value)
+				if err != nil {
+					return fmt.Errorf("failed to decode object %s: %w", kv.Key, err)
+				}
+				if version == s.schema.APIVersion {
+					continue
+				}
+
+				if err := s.rewrite(ctx, ioCtx, kv.Key); err != nil {
+					return fmt.Errorf("failed to migrate object %s: %w", kv.Key, err)
+				}
+				migrated++
+			}
+
+			if !more || len(kvs) == 0 {
+				break
+			}
+		}
+	}
+
+	log.Info("Migrated stored objects", "count", migrated)
+	return nil
+}
+
+// rewrite writes the object of the given id with the current API version. The resource version is
+// not changed, since the object itself has already been migrated when read.
+func (s *Store[E]) rewrite(ctx context.Context, ioCtx *rados.IOContext, id string) error {
+	s.idMu.Lock(id)
+	defer s.idMu.Unlock(id)
+
+	return s.compareAndSwap(ctx, ioCtx, id, func(obj E, found bool) (E, casAction, error) {
+		if !found {
+			return obj, casSkip, nil
+		}
+		return obj, casSet, nil
+	})
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package omap
+
+import (
+	"bytes"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type testObject struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func renameField(from, to string) func(data []byte) ([]byte, error) {
+	return func(data []byte) ([]byte, error) {
+		return bytes.ReplaceAll(data, []byte(`"`+from+`"`), []byte(`"`+to+`"`)), nil
+	}
+}
+
+var _ = Describe("Schema", func() {
+	schema := &Schema{
+		APIVersion: "v2",
+		Migrations: []Migration{
+			{From: "", To: "v1", Migrate: renameField("title", "label")},
+			{From: "v1", To: "v2", Migrate: renameField("label", "name")},
+		},
+	}
+
+	It("should write objects in an envelope of the current api version", func() {
+		data, err := schema.wrap([]byte(`{"name":"foo"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(`{"apiVersion":"v2","object":{"name":"foo"}}`))
+	})
+
+	It("should migrate unversioned objects through all steps", func() {
+		obj := &testObject{}
+		Expect(schema.Decode([]byte(`{"title":"foo","value":"bar"}`), obj)).To(Succeed())
+		Expect(obj).To(Equal(&testObject{Name: "foo", Value: "bar"}))
+	})
+
+	It("should migrate objects of an older api version", func() {
+		obj := &testObject{}
+		Expect(schema.Decode([]byte(`{"apiVersion":"v1","object":{"label":"foo"}}`), obj)).To(Succeed())
+		Expect(obj.Name).To(Equal("foo"))
+	})
+
+	It("should decode objects of the current api version unchanged", func() {
+		data, err := json.Marshal(&testObject{Name: "foo", Value: "bar"})
+		Expect(err).NotTo(HaveOccurred())
+		data, err = schema.wrap(data)
+		Expect(err).NotTo(HaveOccurred())
+
+		obj := &testObject{}
+		Expect(schema.Decode(data, obj)).To(Succeed())
+		Expect(obj).To(Equal(&testObject{Name: "foo", Value: "bar"}))
+	})
+
+	It("should fail to decode objects of an unknown api version", func() {
+		Expect(schema.Decode([]byte(`{"apiVersion":"v3","object":{}}`), &testObject{})).NotTo(Succeed())
+	})
+
+	It("should store plain objects without a schema", func() {
+		var noSchema *Schema
+		data, err := noSchema.wrap([]byte(`{"name":"foo"}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).To(MatchJSON(`{"name":"foo"}`))
+
+		obj := &testObject{}
+		Expect(noSchema.Decode(data, obj)).To(Succeed())
+		Expect(obj.Name).To(Equal("foo"))
+	})
+
+	DescribeTable("validation",
+		func(schema *Schema, matchErr OmegaMatcher) {
+			Expect(schema.validate()).To(matchErr)
+		},
+		Entry("valid schema", schema, Succeed()),
+		Entry("missing api version", &Schema{}, HaveOccurred()),
+		Entry("missing migrate function", &Schema{
+			APIVersion: "v1",
+			Migrations: []Migration{{From: "", To: "v1"}},
+		}, HaveOccurred()),
+		Entry("duplicate migration", &Schema{
+			APIVersion: "v1",
+			Migrations: []Migration{
+				{From: "", To: "v1", Migrate: renameField("a", "b")},
+				{From: "", To: "v1", Migrate: renameField("a", "b")},
+			},
+		}, HaveOccurred()),
+		Entry("migration not leading to the api version", &Schema{
+			APIVersion: "v2",
+			Migrations: []Migration{{From: "", To: "v1", Migrate: renameField("a", "b")}},
+		}, HaveOccurred()),
+		Entry("migration cycle", &Schema{
+			APIVersion: "v3",
+			Migrations: []Migration{
+				{From: "v1", To: "v2", Migrate: renameField("a", "b")},
+				{From: "v2", To: "v1", Migrate: renameField("a", "b")},
+			},
+		}, HaveOccurred()),
+	)
+})
@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package omap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+// ShardCountXattr is the xattr on the base omap object recording the number of shards
+// the store has been migrated to.
+const ShardCountXattr = "ironcore.shards"
+
+func shardIndex(id string, shards int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return int(h.Sum32() % uint32(shards))
+}
+
+func shardObjectName(omapName string, shard int) string {
+	return fmt.Sprintf("%s.%d", omapName, shard)
+}
+
+// objectName returns the name of the rados object holding the omap entry of the given id.
+func (s *Store[E]) objectName(id string) string {
+	if s.shards <= 1 {
+		return s.omapName
+	}
+	return shardObjectName(s.omapName, shardIndex(id, s.shards))
+}
+
+// objectNames returns the names of all rados objects holding omap entries of the store.
+func (s *Store[E]) objectNames() []string {
+	if s.shards <= 1 {
+		return []string{s.omapName}
+	}
+
+	names := make([]string, 0, s.shards)
+	for i := 0; i < s.shards; i++ {
+		names = append(names, shardObjectName(s.omapName, i))
+	}
+	return names
+}
+
+func (s *Store[E]) encodeContinue(shard int, key string) string {
+	if s.shards <= 1 {
+		return key
+	}
+	return strconv.Itoa(shard) + ":" + key
+}
+
+func (s *Store[E]) decodeContinue(continueKey string) (int, string, error) {
+	if s.shards <= 1 || continueKey == "" {
+		return 0, continueKey, nil
+	}
+
+	idx, key, ok := strings.Cut(continueKey, ":")
+	if !ok {
+		return 0, "", fmt.Errorf("invalid continue key %q", continueKey)
+	}
+
+	shard, err := strconv.Atoi(idx)
+	if err != nil || shard < 0 || shard >= s.shards {
+		return 0, "", fmt.Errorf("invalid shard in continue key %q", continueKey)
+	}
+	return shard, key, nil
+}
+
+func (s *Store[E]) storedShardCount(ioCtx *rados.IOContext) (int, error) {
+	xattrs, err := ioCtx.ListXattrs(s.omapName)
+	if err != nil {
+		if errors.Is(err, rados.ErrNotFound) {
+			return 1, nil
+		}
+		return 0, fmt.Errorf("failed to list xattrs: %w", err)
+	}
+
+	data, ok := xattrs[ShardCountXattr]
+	if !ok {
+		return 1, nil
+	}
+
+	shards, err := strconv.Atoi(string(data))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse shard count %q: %w", string(data), err)
+	}
+	return shards, nil
+}
+
+// NeedsShardMigration reports whether the store is sharded but its entries have not been moved
+// from the legacy, unsharded object by MigrateToShards yet.
+func (s *Store[E]) NeedsShardMigration(ctx context.Context) (bool, error) {
+	ioCtx, err := s.conn.OpenIOContext(s.pool)
+	if err != nil {
+		return false, fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer ioCtx.Destroy()
+
+	storedShards, err := s.storedShardCount(ioCtx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get stored shard count: %w", err)
+	}
+	return storedShards != max(s.shards, 1), nil
+}
+
+// MigrateToShards moves the entries of a legacy, unsharded store into its shard objects.
+// It has to run before the store is used, since entries not yet moved are invisible to the
+// sharded store. Changing the shard count of an already sharded store is not supported.
+func (s *Store[E]) MigrateToShards(ctx context.Context) error {
+	ioCtx, err := s.conn.OpenIOContext(s.pool)
+	if err != nil {
+		return fmt.Errorf("unable to get io context: %w", err)
+	}
+	defer ioCtx.Destroy()
+
+	storedShards, err := s.storedShardCount(ioCtx)
+	if err != nil {
+		return fmt.Errorf("failed to get stored shard count: %w", err)
+	}
+
+	switch {
+	case storedShards == max(s.shards, 1):
+		return nil
+	case storedShards > 1:
+		return fmt.Errorf("omap %s is sharded into %d objects, cannot use %d shards", s.omapName, storedShards, s.shards)
+	}
+
+	log := s.log.WithValues("omap", s.omapName, "shards", s.shards)
+	log.Info("Migrating omap entries to shards")
+
+	var migrated int
+	for {
+		kvs, _, err := getOmapValues(ioCtx, s.omapName, "", s.iteratorSize)
+		if err != nil && !errors.Is(err, rados.ErrNotFound) {
+			return fmt.Errorf("failed to read legacy omap values: %w", err)
+		}
+		if len(kvs) == 0 {
+			break
+		}
+
+		shardValues := make(map[string]map[string][]byte)
+		keys := make([]string, 0, len(kvs))
+		for _, kv := range kvs {
+			name := s.objectName(kv.Key)
+			if shardValues[name] == nil {
+				shardValues[name] = make(map[string][]byte)
+			}
+			shardValues[name][kv.Key] = kv.Value
+			keys = append(keys, kv.Key)
+		}
+
+		for name, values := range shardValues {
+			if err := ioCtx.SetOmap(name, values); err != nil {
+				return fmt.Errorf("failed to write omap values to shard %s: %w", name, err)
+			}
+		}
+
+		// Entries are removed only after they have been written to their shard, so an
+		// interrupted migration is resumed by the next start without losing entries.
+		if err := ioCtx.RmOmapKeys(s.omapName, keys); err != nil {
+			return fmt.Errorf("failed to remove migrated legacy omap values: %w", err)
+		}
+
+		migrated += len(kvs)
+		log.V(1).Info("Migrated omap entries", "count", migrated)
+	}
+
+	if err := ioCtx.SetXattr(s.omapName, ShardCountXattr, []byte(strconv.Itoa(s.shards))); err != nil {
+		return fmt.Errorf("failed to record shard count: %w", err)
+	}
+
+	log.Info("Migrated omap entries to shards", "count", migrated)
+	return nil
+}
@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package omap
+
+import (
+	"fmt"
+
+	"github.com/ironcore-dev/ceph-provider/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Shards", func() {
+	Describe("shardIndex", func() {
+		It("should be stable for the same id", func() {
+			Expect(shardIndex("foo", 8)).To(Equal(shardIndex("foo", 8)))
+		})
+
+		It("should stay within the shard count", func() {
+			for i := 0; i < 1000; i++ {
+				Expect(shardIndex(fmt.Sprintf("id-%d", i), 7)).To(And(BeNumerically(">=", 0), BeNumerically("<", 7)))
+			}
+		})
+
+		It("should spread ids across all shards", func() {
+			counts := make(map[int]int)
+			for i := 0; i < 1000; i++ {
+				counts[shardIndex(fmt.Sprintf("id-%d", i), 4)]++
+			}
+			Expect(counts).To(HaveLen(4))
+			for shard, count := range counts {
+				Expect(count).To(BeNumerically(">", 150), "shard %d", shard)
+			}
+		})
+
+		It("should map all ids to the only shard", func() {
+			Expect(shardIndex("foo", 1)).To(Equal(0))
+		})
+	})
+
+	Describe("object names", func() {
+		It("should use the omap name for unsharded stores", func() {
+			s := &Store[*api.Image]{omapName: "foo", shards: 0}
+			Expect(s.objectName("bar")).To(Equal("foo"))
+			Expect(s.objectNames()).To(Equal([]string{"foo"}))
+		})
+
+		It("should use the shard object of the id for sharded stores", func() {
+			s := &Store[*api.Image]{omapName: "foo", shards: 3}
+			Expect(s.objectName("bar")).To(Equal(fmt.Sprintf("foo.%d", shardIndex("bar", 3))))
+			Expect(s.objectNames()).To(Equal([]string{"foo.0", "foo.1", "foo.2"}))
+		})
+	})
+
+	Describe("continue keys", func() {
+		It("should pass the omap key through for unsharded stores", func() {
+			s := &Store[*api.Image]{shards: 1}
+			Expect(s.encodeContinue(0, "foo:bar")).To(Equal("foo:bar"))
+
+			shard, key, err := s.decodeContinue("foo:bar")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(shard).To(Equal(0))
+			Expect(key).To(Equal("foo:bar"))
+		})
+
+		It("should round-trip the shard and omap key for sharded stores", func() {
+			s := &Store[*api.Image]{shards: 4}
+			continueKey := s.encodeContinue(3, "foo:bar")
+			Expect(continueKey).To(Equal("3:foo:bar"))
+
+			shard, key, err := s.decodeContinue(continueKey)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(shard).To(Equal(3))
+			Expect(key).To(Equal("foo:bar"))
+		})
+
+		It("should start at the first shard for an empty continue key", func() {
+			s := &Store[*api.Image]{shards: 4}
+			shard, key, err := s.decodeContinue("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(shard).To(Equal(0))
+			Expect(key).To(BeEmpty())
+		})
+
+		DescribeTable("should reject invalid continue keys of sharded stores",
+			func(continueKey string) {
+				s := &Store[*api.Image]{shards: 4}
+				_, _, err := s.decodeContinue(continueKey)
+				Expect(err).To(HaveOccurred())
+			},
+			Entry("without shard", "foo"),
+			Entry("with non-numeric shard", "a:foo"),
+			Entry("with negative shard", "-1:foo"),
+			Entry("with shard out of range", "4:foo"),
+		)
+	})
+})
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package retype
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/controllers"
+	"github.com/ironcore-dev/ceph-provider/internal/vcr"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+)
+
+type VolumeClassRegistry interface {
+	GetClass(volumeClassName string) (*vcr.VolumeClass, bool)
+}
+
+type Options struct {
+	// Pool is the provider pool, the pool of the images of classes without pool.
+	Pool string
+	// DataPool is the data pool of the images in Pool. Defaults to Pool.
+	DataPool string
+
+	BurstFactor            int64
+	BurstDurationInSeconds int64
+}
+
+// Retype moves the image with the given id to another volume class. The class label of the image is
+// updated and its limits are recalculated for the new class, which the image reconciler then applies
+// to the rbd image. The rbd options of the new class only apply to volumes created afterward.
+//
+// If the new class places volumes in other pools, a live migration of the rbd image is requested
+// instead and the image reconciler moves the image to the new class once the migration is committed.
+func Retype(
+	ctx context.Context,
+	log logr.Logger,
+	images store.Store[*api.Image],
+	classes VolumeClassRegistry,
+	id, className string,
+	opts Options,
+) (*api.Image, error) {
+	image, err := images.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image: %w", err)
+	}
+
+	if image.DeletedAt != nil {
+		return nil, fmt.Errorf("image %s is being deleted", id)
+	}
+
+	if image.Spec.Migration != nil || image.Status.Migration.IsActive() {
+		return nil, fmt.Errorf("image %s is being migrated", id)
+	}
+
+	class, found := classes.GetClass(className)
+	if !found {
+		return nil, fmt.Errorf("volume class '%s' not supported", className)
+	}
+
+	if currentClassName, found := api.GetClassLabelFromObject(image); found && currentClassName == className {
+		log.V(1).Info("Image already has volume class", "Class", className)
+		return image, nil
+	}
+
+	retyped := &api.Image{Spec: api.ImageSpec{Pool: class.Pool, DataPool: class.DataPool}}
+	pool, dataPool := controllers.ImagePool(image, opts.Pool), controllers.ImageDataPool(image, opts.Pool, opts.DataPool)
+	newPool, newDataPool := controllers.ImagePool(retyped, opts.Pool), controllers.ImageDataPool(retyped, opts.Pool, opts.DataPool)
+	if pool != newPool || dataPool != newDataPool {
+		log.V(1).Info("Requesting migration of image", "Class", className, "Pool", newPool, "DataPool", newDataPool)
+		image.Spec.Migration = &api.ImageMigration{
+			Pool:     class.Pool,
+			DataPool: class.DataPool,
+			Class:    className,
+		}
+	} else {
+		log.V(1).Info("Retyping image", "Class", className)
+		api.SetClassLabelForObject(image, className)
+		image.Spec.Limits = class.Limits(image.Spec.Size, opts.BurstFactor, opts.BurstDurationInSeconds)
+	}
+
+	image, err = images.Update(ctx, image)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update image: %w", err)
+	}
+	return image, nil
+}
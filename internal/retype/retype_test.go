@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package retype_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/limits"
+	. "github.com/ironcore-dev/ceph-provider/internal/retype"
+	"github.com/ironcore-dev/ceph-provider/internal/vcr"
+	iri "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+type fakeImageStore struct {
+	store.Store[*api.Image]
+	images map[string]*api.Image
+}
+
+func (s *fakeImageStore) Get(_ context.Context, id string) (*api.Image, error) {
+	image, ok := s.images[id]
+	if !ok {
+		return nil, fmt.Errorf("object with id %q: %w", id, store.ErrNotFound)
+	}
+	return image, nil
+}
+
+func (s *fakeImageStore) Update(_ context.Context, image *api.Image) (*api.Image, error) {
+	s.images[image.ID] = image
+	return image, nil
+}
+
+func newClass(name string, iops, tps int64, pool, dataPool string) *vcr.VolumeClass {
+	return &vcr.VolumeClass{
+		VolumeClass: &iri.VolumeClass{
+			Name:         name,
+			Capabilities: &iri.VolumeClassCapabilities{Iops: iops, Tps: tps},
+		},
+		Pool:     pool,
+		DataPool: dataPool,
+	}
+}
+
+func newImage(id, class string) *api.Image {
+	image := &api.Image{
+		Metadata: apiutils.Metadata{ID: id},
+		Spec: api.ImageSpec{
+			Size:   10 * limits.GiB,
+			Limits: limits.Calculate(10, 100, 10*limits.GiB, nil, 10, 15),
+		},
+	}
+	api.SetClassLabelForObject(image, class)
+	return image
+}
+
+var _ = Describe("Retype", func() {
+	var (
+		ctx     context.Context
+		images  *fakeImageStore
+		classes *vcr.Vcr
+		opts    Options
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		images = &fakeImageStore{images: map[string]*api.Image{
+			"image": newImage("image", "slow"),
+		}}
+
+		var err error
+		classes, err = vcr.NewVolumeClassRegistry([]*vcr.VolumeClass{
+			newClass("slow", 10, 100, "", ""),
+			newClass("fast", 50, 500, "", ""),
+			newClass("ssd", 50, 500, "ssd", ""),
+			newClass("ec", 50, 500, "", "pool-ec"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		opts = Options{Pool: "pool", BurstFactor: 10, BurstDurationInSeconds: 15}
+	})
+
+	It("should update the class label and limits of the image", func() {
+		image, err := Retype(ctx, logr.Discard(), images, classes, "image", "fast", opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		class, found := api.GetClassLabelFromObject(image)
+		Expect(found).To(BeTrue())
+		Expect(class).To(Equal("fast"))
+		Expect(image.Spec.Limits).To(Equal(limits.Calculate(50, 500, 10*limits.GiB, nil, 10, 15)))
+		Expect(images.images["image"]).To(Equal(image))
+	})
+
+	It("should not change an image that already has the class", func() {
+		image, err := Retype(ctx, logr.Discard(), images, classes, "image", "slow", opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(image.Spec.Limits).To(Equal(limits.Calculate(10, 100, 10*limits.GiB, nil, 10, 15)))
+	})
+
+	It("should reject unknown classes and deleted images", func() {
+		_, err := Retype(ctx, logr.Discard(), images, classes, "image", "unknown", opts)
+		Expect(err).To(MatchError(ContainSubstring("volume class 'unknown' not supported")))
+
+		images.images["image"].DeletedAt = ptr.To(time.Now())
+		_, err = Retype(ctx, logr.Discard(), images, classes, "image", "fast", opts)
+		Expect(err).To(MatchError(ContainSubstring("image image is being deleted")))
+
+		_, err = Retype(ctx, logr.Discard(), images, classes, "missing", "fast", opts)
+		Expect(err).To(MatchError(store.ErrNotFound))
+	})
+
+	DescribeTable("should request a migration for classes with other pools",
+		func(className string, migration *api.ImageMigration) {
+			image, err := Retype(ctx, logr.Discard(), images, classes, "image", className, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(image.Spec.Migration).To(Equal(migration))
+
+			class, _ := api.GetClassLabelFromObject(image)
+			Expect(class).To(Equal("slow"))
+			Expect(image.Spec.Limits).To(Equal(limits.Calculate(10, 100, 10*limits.GiB, nil, 10, 15)))
+
+			_, err = Retype(ctx, logr.Discard(), images, classes, "image", "fast", opts)
+			Expect(err).To(MatchError(ContainSubstring("image image is being migrated")))
+		},
+		Entry("pool", "ssd", &api.ImageMigration{Pool: "ssd", Class: "ssd"}),
+		Entry("data pool", "ec", &api.ImageMigration{DataPool: "pool-ec", Class: "ec"}),
+	)
+})
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package strategy
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/omap"
+)
+
+const (
+	ImageAPIVersion         = "v1"
+	SnapshotAPIVersion      = "v1"
+	GroupSnapshotAPIVersion = "v1"
+)
+
+var ImageSchema = &omap.Schema{
+	APIVersion: ImageAPIVersion,
+	Migrations: []omap.Migration{
+		{From: "", To: "v1", Migrate: migrateUnchanged},
+	},
+}
+
+var SnapshotSchema = &omap.Schema{
+	APIVersion: SnapshotAPIVersion,
+	Migrations: []omap.Migration{
+		{From: "", To: "v1", Migrate: migrateSnapshotToV1},
+	},
+}
+
+var GroupSnapshotSchema = &omap.Schema{
+	APIVersion: GroupSnapshotAPIVersion,
+}
+
+func migrateUnchanged(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// migrateSnapshotToV1 replaces the no longer used SnapshotStatePopulated by SnapshotStateReady.
+func migrateSnapshotToV1(data []byte) ([]byte, error) {
+	snapshot := &api.Snapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal snapshot: %w", err)
+	}
+
+	if snapshot.Status.State == api.SnapshotStatePopulated {
+		snapshot.Status.State = api.SnapshotStateReady
+	}
+
+	return json.Marshal(snapshot)
+}
@@ -5,6 +5,7 @@ package strategy
 
 import (
 	"crypto/rand"
+	"time"
 
 	"github.com/ironcore-dev/ceph-provider/api"
 	"github.com/ironcore-dev/ironcore/broker/common/idgen"
@@ -18,6 +19,14 @@ func (snapshotStrategy) PrepareForCreate(obj *api.Snapshot) {
 	obj.Status = api.SnapshotStatus{State: api.SnapshotStatePending}
 }
 
+var GroupSnapshotStrategy = groupSnapshotStrategy{}
+
+type groupSnapshotStrategy struct{}
+
+func (groupSnapshotStrategy) PrepareForCreate(obj *api.GroupSnapshot) {
+	obj.Status = api.GroupSnapshotStatus{State: api.GroupSnapshotStatePending}
+}
+
 var ImageStrategy = imageStrategy{
 	WWNGen: idgen.NewIDGen(rand.Reader, 16),
 }
@@ -28,5 +37,5 @@ type imageStrategy struct {
 
 func (i imageStrategy) PrepareForCreate(obj *api.Image) {
 	obj.Spec.WWN = i.WWNGen.Generate()
-	obj.Status = api.ImageStatus{State: api.ImageStatePending}
+	obj.Status = api.ImageStatus{State: api.ImageStatePending, LastTransitionTime: time.Now()}
 }
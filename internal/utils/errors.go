@@ -19,6 +19,8 @@ var (
 
 	ErrSnapshotNotFound    = errors.New("snapshot not found")
 	ErrSnapshotIsntManaged = errors.New("snapshot isn't managed")
+
+	ErrInvalidVolumeNamespace = errors.New("invalid volume namespace")
 )
 
 func ConvertInternalErrorToGRPC(err error) error {
@@ -31,7 +33,8 @@ func ConvertInternalErrorToGRPC(err error) error {
 	switch {
 	case errors.Is(err, ErrBucketNotFound), errors.Is(err, ErrVolumeNotFound), errors.Is(err, ErrSnapshotNotFound):
 		code = codes.NotFound
-	case errors.Is(err, ErrBucketIsntManaged), errors.Is(err, ErrVolumeIsntManaged), errors.Is(err, ErrSnapshotIsntManaged):
+	case errors.Is(err, ErrBucketIsntManaged), errors.Is(err, ErrVolumeIsntManaged), errors.Is(err, ErrSnapshotIsntManaged),
+		errors.Is(err, ErrInvalidVolumeNamespace):
 		code = codes.InvalidArgument
 	}
 
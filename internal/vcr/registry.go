@@ -6,14 +6,129 @@ package vcr
 import (
 	"fmt"
 	"io"
+	"math/bits"
 	"os"
+	"slices"
 
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/limits"
 	iri "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
 	"k8s.io/apimachinery/pkg/util/yaml"
 )
 
-func LoadVolumeClasses(reader io.Reader) ([]*iri.VolumeClass, error) {
-	var classList []*iri.VolumeClass
+// VolumeClass is a supported volume class together with the ceph pools its images are placed in
+// and the options they are created with.
+type VolumeClass struct {
+	*iri.VolumeClass
+
+	// Pool is the pool the rbd images of the class are created in. Defaults to the provider pool.
+	Pool string `json:"pool,omitempty"`
+	// DataPool is the pool the data objects of the rbd images of the class are stored in. Defaults to Pool.
+	DataPool string `json:"dataPool,omitempty"`
+	// RBDOptions are the features, object size and striping the rbd images of the class are created with.
+	RBDOptions *api.RBDOptions `json:"rbdOptions,omitempty"`
+	// QoSScaling scales the IOPS and bandwidth limits of the volumes of the class with their size.
+	// Without scaling, all volumes get the capabilities of the class as limits.
+	QoSScaling *limits.Scaling `json:"qosScaling,omitempty"`
+}
+
+// Limits returns the limits of a volume of the class with the given size in bytes.
+func (c *VolumeClass) Limits(size uint64, burstFactor, burstDurationInSeconds int64) api.Limits {
+	return limits.Calculate(c.Capabilities.Iops, c.Capabilities.Tps, size, c.QoSScaling, burstFactor, burstDurationInSeconds)
+}
+
+const (
+	FeatureLayering      = "layering"
+	FeatureStriping      = "striping"
+	FeatureExclusiveLock = "exclusive-lock"
+	FeatureObjectMap     = "object-map"
+	FeatureFastDiff      = "fast-diff"
+	FeatureDeepFlatten   = "deep-flatten"
+	FeatureJournaling    = "journaling"
+
+	minObjectSize     = 4 * 1024
+	maxObjectSize     = 32 * 1024 * 1024
+	defaultObjectSize = 4 * 1024 * 1024
+)
+
+var (
+	supportedFeatures = []string{
+		FeatureLayering,
+		FeatureStriping,
+		FeatureExclusiveLock,
+		FeatureObjectMap,
+		FeatureFastDiff,
+		FeatureDeepFlatten,
+		FeatureJournaling,
+	}
+
+	// featureDependencies are the features each feature cannot be enabled without.
+	featureDependencies = map[string]string{
+		FeatureObjectMap:  FeatureExclusiveLock,
+		FeatureFastDiff:   FeatureObjectMap,
+		FeatureJournaling: FeatureExclusiveLock,
+	}
+)
+
+func validateQoSScaling(scaling *limits.Scaling) error {
+	if scaling == nil {
+		return nil
+	}
+
+	for name, policy := range map[string]*limits.ScalingPolicy{"iops": scaling.IOPS, "tps": scaling.TPS} {
+		if policy == nil {
+			continue
+		}
+		if policy.Base < 0 || policy.PerGiB < 0 || policy.Min < 0 || policy.Max < 0 {
+			return fmt.Errorf("%s scaling must not be negative", name)
+		}
+		if policy.Max > 0 && policy.Min > policy.Max {
+			return fmt.Errorf("%s scaling minimum %d must not exceed maximum %d", name, policy.Min, policy.Max)
+		}
+	}
+	return nil
+}
+
+func validateRBDOptions(opts *api.RBDOptions) error {
+	if opts == nil {
+		return nil
+	}
+
+	if len(opts.Features) > 0 {
+		for _, feature := range opts.Features {
+			if !slices.Contains(supportedFeatures, feature) {
+				return fmt.Errorf("unsupported feature %q, supported features are %v", feature, supportedFeatures)
+			}
+			if dependency, ok := featureDependencies[feature]; ok && !slices.Contains(opts.Features, dependency) {
+				return fmt.Errorf("feature %s requires feature %s", feature, dependency)
+			}
+		}
+		// Volumes created from snapshots are clones of the snapshot.
+		if !slices.Contains(opts.Features, FeatureLayering) {
+			return fmt.Errorf("features must include %s", FeatureLayering)
+		}
+	}
+
+	objectSize := opts.ObjectSize
+	if objectSize != 0 {
+		if bits.OnesCount64(objectSize) != 1 || objectSize < minObjectSize || objectSize > maxObjectSize {
+			return fmt.Errorf("object size %d must be a power of two between %d and %d", objectSize, minObjectSize, maxObjectSize)
+		}
+	} else {
+		objectSize = defaultObjectSize
+	}
+
+	if (opts.StripeUnit == 0) != (opts.StripeCount == 0) {
+		return fmt.Errorf("stripe unit and stripe count must be specified together")
+	}
+	if opts.StripeUnit != 0 && objectSize%opts.StripeUnit != 0 {
+		return fmt.Errorf("stripe unit %d must evenly divide the object size %d", opts.StripeUnit, objectSize)
+	}
+	return nil
+}
+
+func LoadVolumeClasses(reader io.Reader) ([]*VolumeClass, error) {
+	var classList []*VolumeClass
 	if err := yaml.NewYAMLOrJSONDecoder(reader, 4096).Decode(&classList); err != nil {
 		return nil, fmt.Errorf("unable to unmarshal volume classes: %w", err)
 	}
@@ -21,7 +136,7 @@ func LoadVolumeClasses(reader io.Reader) ([]*iri.VolumeClass, error) {
 	return classList, nil
 }
 
-func LoadVolumeClassesFile(filename string) ([]*iri.VolumeClass, error) {
+func LoadVolumeClassesFile(filename string) ([]*VolumeClass, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("unable to open volume class file (%s): %w", filename, err)
@@ -31,15 +146,24 @@ func LoadVolumeClassesFile(filename string) ([]*iri.VolumeClass, error) {
 	return LoadVolumeClasses(file)
 }
 
-func NewVolumeClassRegistry(classes []*iri.VolumeClass) (*Vcr, error) {
+func NewVolumeClassRegistry(classes []*VolumeClass) (*Vcr, error) {
 	registry := Vcr{
-		classes: map[string]*iri.VolumeClass{},
+		classes: map[string]*VolumeClass{},
 	}
 
 	for _, class := range classes {
+		if class.VolumeClass == nil {
+			return nil, fmt.Errorf("volume class without name found")
+		}
 		if _, ok := registry.classes[class.Name]; ok {
 			return nil, fmt.Errorf("multiple classes with same name (%s) found", class.Name)
 		}
+		if err := validateRBDOptions(class.RBDOptions); err != nil {
+			return nil, fmt.Errorf("invalid rbd options of class %s: %w", class.Name, err)
+		}
+		if err := validateQoSScaling(class.QoSScaling); err != nil {
+			return nil, fmt.Errorf("invalid qos scaling of class %s: %w", class.Name, err)
+		}
 		registry.classes[class.Name] = class
 	}
 
@@ -47,19 +171,29 @@ func NewVolumeClassRegistry(classes []*iri.VolumeClass) (*Vcr, error) {
 }
 
 type Vcr struct {
-	classes map[string]*iri.VolumeClass
+	classes map[string]*VolumeClass
 }
 
 func (v *Vcr) Get(volumeClassName string) (*iri.VolumeClass, bool) {
 	class, found := v.classes[volumeClassName]
-	return class, found
+	if !found {
+		return nil, false
+	}
+	return class.VolumeClass, true
 }
 
 func (v *Vcr) List() []*iri.VolumeClass {
 	var classes []*iri.VolumeClass
 	for name := range v.classes {
 		class := v.classes[name]
-		classes = append(classes, class)
+		classes = append(classes, class.VolumeClass)
 	}
 	return classes
 }
+
+// GetClass returns the given volume class along with its pools and options. Empty pools are not
+// configured and default to the provider pool.
+func (v *Vcr) GetClass(volumeClassName string) (*VolumeClass, bool) {
+	class, found := v.classes[volumeClassName]
+	return class, found
+}
@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package vcr_test
+
+import (
+	"bytes"
+
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/limits"
+	. "github.com/ironcore-dev/ceph-provider/internal/vcr"
+	iri "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry", func() {
+	It("should load classes with and without pools and rbd options", func() {
+		classes, err := LoadVolumeClasses(bytes.NewBufferString(`
+- name: default
+  capabilities:
+    tps: 100
+    iops: 10
+- name: database
+  capabilities:
+    tps: 200
+    iops: 20
+  pool: ssd
+  qosScaling:
+    iops:
+      base: 1000
+      perGiB: 50
+      max: 20000
+  rbdOptions:
+    features: [layering, exclusive-lock, object-map, fast-diff]
+    objectSize: 1048576
+- name: archive
+  capabilities:
+    tps: 300
+    iops: 30
+  pool: hdd
+  dataPool: hdd-ec
+  rbdOptions:
+    objectSize: 16777216
+    stripeUnit: 1048576
+    stripeCount: 8
+`))
+		Expect(err).NotTo(HaveOccurred())
+
+		registry, err := NewVolumeClassRegistry(classes)
+		Expect(err).NotTo(HaveOccurred())
+
+		class, found := registry.Get("default")
+		Expect(found).To(BeTrue())
+		Expect(class).To(Equal(&iri.VolumeClass{
+			Name:         "default",
+			Capabilities: &iri.VolumeClassCapabilities{Tps: 100, Iops: 10},
+		}))
+
+		database, found := registry.GetClass("database")
+		Expect(found).To(BeTrue())
+		Expect(database.Pool).To(Equal("ssd"))
+		Expect(database.DataPool).To(BeEmpty())
+		Expect(database.QoSScaling).To(Equal(&limits.Scaling{
+			IOPS: &limits.ScalingPolicy{Base: 1000, PerGiB: 50, Max: 20000},
+		}))
+		Expect(database.RBDOptions).To(Equal(&api.RBDOptions{
+			Features:   []string{"layering", "exclusive-lock", "object-map", "fast-diff"},
+			ObjectSize: 1048576,
+		}))
+
+		archive, found := registry.GetClass("archive")
+		Expect(found).To(BeTrue())
+		Expect(archive.Pool).To(Equal("hdd"))
+		Expect(archive.DataPool).To(Equal("hdd-ec"))
+		Expect(archive.RBDOptions.StripeCount).To(Equal(uint64(8)))
+
+		Expect(registry.List()).To(HaveLen(3))
+	})
+
+	It("should reject duplicate classes", func() {
+		_, err := NewVolumeClassRegistry([]*VolumeClass{
+			{VolumeClass: &iri.VolumeClass{Name: "foo"}},
+			{VolumeClass: &iri.VolumeClass{Name: "foo"}, Pool: "other"},
+		})
+		Expect(err).To(MatchError(ContainSubstring("multiple classes with same name (foo) found")))
+	})
+
+	DescribeTable("should validate the rbd options",
+		func(opts *api.RBDOptions, expectedErr string) {
+			_, err := NewVolumeClassRegistry([]*VolumeClass{
+				{VolumeClass: &iri.VolumeClass{Name: "foo"}, RBDOptions: opts},
+			})
+			if expectedErr == "" {
+				Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+		},
+		Entry("no options", nil, ""),
+		Entry("unknown feature", &api.RBDOptions{Features: []string{"layering", "unknown"}}, `unsupported feature "unknown"`),
+		Entry("missing layering", &api.RBDOptions{Features: []string{"exclusive-lock"}}, "features must include layering"),
+		Entry("missing feature dependency", &api.RBDOptions{Features: []string{"layering", "exclusive-lock", "fast-diff"}}, "feature fast-diff requires feature object-map"),
+		Entry("object size not a power of two", &api.RBDOptions{ObjectSize: 3 * 1024 * 1024}, "must be a power of two"),
+		Entry("object size too small", &api.RBDOptions{ObjectSize: 1024}, "must be a power of two"),
+		Entry("stripe unit without stripe count", &api.RBDOptions{StripeUnit: 65536}, "must be specified together"),
+		Entry("stripe unit not dividing object size", &api.RBDOptions{ObjectSize: 65536, StripeUnit: 131072, StripeCount: 2}, "must evenly divide the object size"),
+		Entry("striping with default object size", &api.RBDOptions{StripeUnit: 65536, StripeCount: 16}, ""),
+	)
+
+	DescribeTable("should validate the qos scaling",
+		func(scaling *limits.Scaling, expectedErr string) {
+			_, err := NewVolumeClassRegistry([]*VolumeClass{
+				{VolumeClass: &iri.VolumeClass{Name: "foo"}, QoSScaling: scaling},
+			})
+			if expectedErr == "" {
+				Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+		},
+		Entry("no scaling", nil, ""),
+		Entry("valid scaling", &limits.Scaling{IOPS: &limits.ScalingPolicy{Base: 100, PerGiB: 10, Min: 100, Max: 1000}}, ""),
+		Entry("negative value", &limits.Scaling{TPS: &limits.ScalingPolicy{PerGiB: -1}}, "tps scaling must not be negative"),
+		Entry("minimum above maximum", &limits.Scaling{IOPS: &limits.ScalingPolicy{Min: 1000, Max: 100}}, "iops scaling minimum 1000 must not exceed maximum 100"),
+	)
+})
@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package volumeserver
+
+import (
+	"context"
+
+	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+)
+
+// listPages lists all objects of s matching opts and hands them to fn. If s supports paginated
+// listing, fn is called once per page so only a single page of stored objects is held at a time.
+func listPages[E apiutils.Object](ctx context.Context, s store.Store[E], pageSize int64, fn func(objs []E) error, opts ...store.ListOption) error {
+	pager, ok := s.(omap.PageLister[E])
+	if !ok || pageSize <= 0 {
+		objs, err := s.List(ctx, opts...)
+		if err != nil {
+			return err
+		}
+		return fn(objs)
+	}
+
+	var continueKey string
+	for {
+		page, err := pager.ListPage(ctx, omap.PageOptions{Limit: pageSize, Continue: continueKey}, opts...)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(page.Items); err != nil {
+			return err
+		}
+
+		if page.Continue == "" {
+			return nil
+		}
+		continueKey = page.Continue
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/ironcore-dev/ceph-provider/api"
 	"github.com/ironcore-dev/ceph-provider/internal/ceph"
 	"github.com/ironcore-dev/ceph-provider/internal/encryption"
+	"github.com/ironcore-dev/ceph-provider/internal/vcr"
 	"github.com/ironcore-dev/ironcore/broker/common/idgen"
 	iri "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
 	"github.com/ironcore-dev/provider-utils/eventutils/recorder"
@@ -20,6 +21,7 @@ import (
 type VolumeClassRegistry interface {
 	Get(volumeClassName string) (*iri.VolumeClass, bool)
 	List() []*iri.VolumeClass
+	GetClass(volumeClassName string) (*vcr.VolumeClass, bool)
 }
 
 type Server struct {
@@ -36,6 +38,10 @@ type Server struct {
 	burstFactor            int64
 	burstDurationInSeconds int64
 
+	namespaceLabel string
+
+	listPageSize int64
+
 	keyEncryption encryption.Encryptor
 }
 
@@ -49,6 +55,16 @@ type Options struct {
 	BurstFactor            int64
 	BurstDurationInSeconds int64
 
+	// NamespaceLabel is the key of the IRI volume label whose value is the rbd namespace the rbd image
+	// of the volume is created in, e.g. a tenant or project label. Volumes without the label and all
+	// volumes if NamespaceLabel is empty are created in the default namespace. Namespaces only separate
+	// the rbd images, quotas are enforced per pool and the stores of the provider stay in the default
+	// namespace.
+	NamespaceLabel string
+
+	// ListPageSize is the number of stored objects fetched per page when listing volumes and snapshots.
+	ListPageSize int64
+
 	VolumeEventStore recorder.EventStore
 }
 
@@ -56,6 +72,9 @@ func setOptionsDefaults(o *Options) {
 	if o.IDGen == nil {
 		o.IDGen = idgen.Default
 	}
+	if o.ListPageSize == 0 {
+		o.ListPageSize = 1000
+	}
 }
 
 var _ iri.VolumeRuntimeServer = (*Server)(nil)
@@ -82,5 +101,9 @@ func New(imageStore store.Store[*api.Image],
 
 		burstFactor:            opts.BurstFactor,
 		burstDurationInSeconds: opts.BurstDurationInSeconds,
+
+		namespaceLabel: opts.NamespaceLabel,
+
+		listPageSize: opts.ListPageSize,
 	}, nil
 }
@@ -7,6 +7,7 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
 	"github.com/ironcore-dev/ceph-provider/internal/utils"
 	iri "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
 )
@@ -18,14 +19,28 @@ func (s *Server) Status(ctx context.Context, req *iri.StatusRequest) (*iri.Statu
 	log.V(1).Info("Listing ironcore volume classes")
 	volumeClassList := s.volumeClasses.List()
 
-	log.V(1).Info("Getting ceph pool stats")
-	poolStats, err := s.cephCommandClient.PoolStats()
-	if err != nil {
-		return nil, utils.ConvertInternalErrorToGRPC(fmt.Errorf("failed to get ceph pool stats: %w", err))
-	}
-
 	var volumeClassStatus []*iri.VolumeClassStatus
+	poolStatsByName := map[string]*ceph.PoolStats{}
 	for _, volumeClass := range volumeClassList {
+		// The capacity of a class is determined by the pool its data objects are stored in.
+		var pool string
+		if classConfig, found := s.volumeClasses.GetClass(volumeClass.Name); found {
+			pool = classConfig.Pool
+			if classConfig.DataPool != "" {
+				pool = classConfig.DataPool
+			}
+		}
+
+		poolStats, ok := poolStatsByName[pool]
+		if !ok {
+			log.V(1).Info("Getting ceph pool stats", "Pool", pool)
+			var err error
+			if poolStats, err = s.cephCommandClient.PoolStats(pool); err != nil {
+				return nil, utils.ConvertInternalErrorToGRPC(fmt.Errorf("failed to get ceph pool stats: %w", err))
+			}
+			poolStatsByName[pool] = poolStats
+		}
+
 		volumeClassStatus = append(volumeClassStatus, &iri.VolumeClassStatus{
 			VolumeClass: volumeClass,
 			Quantity:    poolStats.MaxAvail + poolStats.Stored,
@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package volumeserver
+
+import (
+	"fmt"
+
+	"github.com/ironcore-dev/ceph-provider/internal/ceph"
+	"github.com/ironcore-dev/ceph-provider/internal/vcr"
+	iri "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const defaultPool = "default"
+
+type fakeCommandClient struct {
+	stats map[string]*ceph.PoolStats
+	calls []string
+}
+
+func (c *fakeCommandClient) PoolStats(poolName string) (*ceph.PoolStats, error) {
+	if poolName == "" {
+		poolName = defaultPool
+	}
+	c.calls = append(c.calls, poolName)
+
+	stats, ok := c.stats[poolName]
+	if !ok {
+		return nil, fmt.Errorf("no pool stats with pool name %s found", poolName)
+	}
+	return stats, nil
+}
+
+var _ = Describe("Status", func() {
+	var (
+		s      *Server
+		client *fakeCommandClient
+	)
+
+	BeforeEach(func() {
+		registry, err := vcr.NewVolumeClassRegistry([]*vcr.VolumeClass{
+			{VolumeClass: &iri.VolumeClass{Name: "default"}},
+			{VolumeClass: &iri.VolumeClass{Name: "ssd"}, Pool: "ssd"},
+			{VolumeClass: &iri.VolumeClass{Name: "ssd-fast"}, Pool: "ssd"},
+			{VolumeClass: &iri.VolumeClass{Name: "hdd"}, Pool: "hdd-meta", DataPool: "hdd-data"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		client = &fakeCommandClient{
+			stats: map[string]*ceph.PoolStats{
+				defaultPool: {Stored: 1, MaxAvail: 10},
+				"ssd":       {Stored: 2, MaxAvail: 20},
+				"hdd-meta":  {Stored: 3, MaxAvail: 30},
+				"hdd-data":  {Stored: 4, MaxAvail: 40},
+			},
+		}
+		s = &Server{volumeClasses: registry, cephCommandClient: client}
+	})
+
+	It("should report the capacity of each class from its own pool", func(ctx SpecContext) {
+		res, err := s.Status(ctx, &iri.StatusRequest{})
+		Expect(err).NotTo(HaveOccurred())
+
+		quantities := map[string]int64{}
+		for _, status := range res.VolumeClassStatus {
+			quantities[status.VolumeClass.Name] = status.Quantity
+		}
+		Expect(quantities).To(Equal(map[string]int64{
+			"default":  11,
+			"ssd":      22,
+			"ssd-fast": 22,
+			"hdd":      44,
+		}))
+
+		By("fetching the stats of each pool only once")
+		Expect(client.calls).To(ConsistOf(defaultPool, "ssd", "hdd-data"))
+	})
+
+	It("should fail if the stats of a pool are missing", func(ctx SpecContext) {
+		delete(client.stats, "hdd-data")
+
+		_, err := s.Status(ctx, &iri.StatusRequest{})
+		Expect(err).To(MatchError(ContainSubstring("no pool stats with pool name hdd-data found")))
+	})
+})
@@ -6,10 +6,10 @@ package volumeserver
 import (
 	"context"
 	"fmt"
+	"regexp"
 
 	"github.com/go-logr/logr"
 	"github.com/ironcore-dev/ceph-provider/api"
-	"github.com/ironcore-dev/ceph-provider/internal/limits"
 	"github.com/ironcore-dev/ceph-provider/internal/utils"
 	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
 	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
@@ -54,6 +54,11 @@ func (s *Server) createImageFromVolume(ctx context.Context, log logr.Logger, vol
 		}
 	}
 
+	namespace, err := s.volumeNamespace(volume)
+	if err != nil {
+		return nil, err
+	}
+
 	log.V(2).Info("Getting volume data source")
 	var (
 		volImage   string
@@ -73,6 +78,9 @@ func (s *Server) createImageFromVolume(ctx context.Context, log logr.Logger, vol
 			if snapshot.Source.VolumeImageID == "" {
 				return nil, fmt.Errorf("snapshot doesn't have source volume ID")
 			}
+			if snapshot.Source.Namespace != namespace {
+				return nil, fmt.Errorf("snapshot %s belongs to another namespace", snapshot.ID)
+			}
 
 			var snapshotSourceVolume *api.Image
 			if snapshotSourceVolume, err = s.imageStore.Get(ctx, snapshot.Source.VolumeImageID); err != nil {
@@ -109,13 +117,13 @@ func (s *Server) createImageFromVolume(ctx context.Context, log logr.Logger, vol
 	}
 
 	log.V(2).Info("Getting volume class")
-	class, found := s.volumeClasses.Get(volume.Spec.Class)
+	class, found := s.volumeClasses.GetClass(volume.Spec.Class)
 	if !found {
 		return nil, fmt.Errorf("volume class '%s' not supported", volume.Spec.Class)
 	}
 
 	log.V(2).Info("Getting volume limits")
-	calculatedLimits := limits.Calculate(class.Capabilities.Iops, class.Capabilities.Tps, s.burstFactor, s.burstDurationInSeconds)
+	calculatedLimits := class.Limits(imageSize, s.burstFactor, s.burstDurationInSeconds)
 
 	image := &api.Image{
 		Metadata: apiutils.Metadata{
@@ -128,6 +136,10 @@ func (s *Server) createImageFromVolume(ctx context.Context, log logr.Logger, vol
 			ImageArchitecture: volArch,
 			SnapshotRef:       snapshotID,
 			Encryption:        encryptionSpec,
+			Pool:              class.Pool,
+			DataPool:          class.DataPool,
+			Namespace:         namespace,
+			RBDOptions:        class.RBDOptions,
 		},
 	}
 
@@ -148,6 +160,26 @@ func (s *Server) createImageFromVolume(ctx context.Context, log logr.Logger, vol
 	return image, nil
 }
 
+// namespaceRegexp matches the rbd namespaces volumes may be created in. The namespace ends up in the
+// rbd image spec and in ceph caps, so '/', '@', whitespace and the like are not allowed.
+var namespaceRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]{0,61}[A-Za-z0-9])?$`)
+
+// volumeNamespace returns the rbd namespace the rbd image of the given volume is created in.
+func (s *Server) volumeNamespace(volume *iriv1alpha1.Volume) (string, error) {
+	if s.namespaceLabel == "" || volume.Metadata == nil {
+		return "", nil
+	}
+	namespace, ok := volume.Metadata.Labels[s.namespaceLabel]
+	if !ok {
+		return "", nil
+	}
+	if !namespaceRegexp.MatchString(namespace) {
+		return "", fmt.Errorf("%w: value %q of label %s must consist of at most 63 alphanumeric characters, '-', '_' or '.' and start and end with an alphanumeric character",
+			utils.ErrInvalidVolumeNamespace, namespace, s.namespaceLabel)
+	}
+	return namespace, nil
+}
+
 func (s *Server) CreateVolume(ctx context.Context, req *iriv1alpha1.CreateVolumeRequest) (res *iriv1alpha1.CreateVolumeResponse, retErr error) {
 	log := s.loggerFrom(ctx)
 	log.V(1).Info("Creating volume")
@@ -8,8 +8,10 @@ import (
 	"fmt"
 
 	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/ceph-provider/api"
 	"github.com/ironcore-dev/ceph-provider/internal/utils"
 	iri "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
 )
 
 func (s *Server) expandImage(ctx context.Context, log logr.Logger, imageId string, storageBytes int64) error {
@@ -18,6 +20,9 @@ func (s *Server) expandImage(ctx context.Context, log logr.Logger, imageId strin
 	if err != nil {
 		return fmt.Errorf("unable to get ceph image: %w", err)
 	}
+	if cephImage.Status.IsReleased() {
+		return fmt.Errorf("unable to get ceph image %s: %w", imageId, store.ErrNotFound)
+	}
 
 	validatedStorageBytes, err := utils.Int64ToUint64(storageBytes)
 	if err != nil {
@@ -30,6 +35,18 @@ func (s *Server) expandImage(ctx context.Context, log logr.Logger, imageId strin
 
 	log.V(2).Info("Updating ceph image with new size", "storageBytes", storageBytes)
 	cephImage.Spec.Size = validatedStorageBytes
+
+	if className, found := api.GetClassLabelFromObject(cephImage); found {
+		if class, found := s.volumeClasses.GetClass(className); found {
+			log.V(2).Info("Recalculating volume limits for new size", "Class", className)
+			cephImage.Spec.Limits = class.Limits(validatedStorageBytes, s.burstFactor, s.burstDurationInSeconds)
+		}
+	}
+
+	if cephImage.Status.State == api.ImageStateError && cephImage.Status.Reason == api.ImageReasonSizeSmallerThanSnapshot {
+		// The image failed due to its size, so its creation is retried with the new one.
+		cephImage.Status.SetState(api.ImageStatePending, "", "")
+	}
 	if _, err := s.imageStore.Update(ctx, cephImage); err != nil {
 		return fmt.Errorf("failed to update ceph image: %w", err)
 	}
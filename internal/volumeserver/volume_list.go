@@ -28,6 +28,11 @@ func (s *Server) getIriVolume(ctx context.Context, imageId string) (*iri.Volume,
 		return nil, fmt.Errorf("failed to get image %s: %w", imageId, utils.ErrVolumeIsntManaged)
 	}
 
+	// Volumes whose rbd image is only kept in ceph are deleted as far as the volume runtime is concerned.
+	if cephImage.Status.IsReleased() {
+		return nil, fmt.Errorf("failed to get image %s: %w", imageId, store.ErrNotFound)
+	}
+
 	return s.convertImageToIriVolume(cephImage)
 }
 
@@ -50,20 +55,27 @@ func (s *Server) filterVolumes(volumes []*iri.Volume, filter *iri.VolumeFilter)
 	return res
 }
 
-func (s *Server) listVolumes(ctx context.Context) ([]*iri.Volume, error) {
-	cephImages, err := s.imageStore.List(ctx, store.MatchingLabels{api.ManagerLabel: api.VolumeManager})
-	if err != nil {
-		return nil, fmt.Errorf("error listing volumes: %w", err)
-	}
-
+func (s *Server) listVolumes(ctx context.Context, filter *iri.VolumeFilter) ([]*iri.Volume, error) {
 	var res []*iri.Volume
-	for _, cephImage := range cephImages {
-		iriVolume, err := s.convertImageToIriVolume(cephImage)
-		if err != nil {
-			return nil, err
+	if err := listPages(ctx, s.imageStore, s.listPageSize, func(cephImages []*api.Image) error {
+		var volumes []*iri.Volume
+		for _, cephImage := range cephImages {
+			if cephImage.Status.IsReleased() {
+				continue
+			}
+
+			iriVolume, err := s.convertImageToIriVolume(cephImage)
+			if err != nil {
+				return err
+			}
+
+			volumes = append(volumes, iriVolume)
 		}
 
-		res = append(res, iriVolume)
+		res = append(res, s.filterVolumes(volumes, filter)...)
+		return nil
+	}, store.MatchingLabels{api.ManagerLabel: api.VolumeManager}); err != nil {
+		return nil, fmt.Errorf("error listing volumes: %w", err)
 	}
 	return res, nil
 }
@@ -88,13 +100,11 @@ func (s *Server) ListVolumes(ctx context.Context, req *iri.ListVolumesRequest) (
 		}, nil
 	}
 
-	volumes, err := s.listVolumes(ctx)
+	volumes, err := s.listVolumes(ctx, req.Filter)
 	if err != nil {
 		return nil, utils.ConvertInternalErrorToGRPC(err)
 	}
 
-	volumes = s.filterVolumes(volumes, req.Filter)
-
 	log.V(2).Info("Returning volumes list")
 	return &iri.ListVolumesResponse{
 		Volumes: volumes,
@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package volumeserver
+
+import (
+	"strings"
+
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/utils"
+	metav1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
+	iri "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("getIriState", func() {
+	var s *Server
+
+	BeforeEach(func() {
+		s = &Server{}
+	})
+
+	DescribeTable("maps image states to iri volume states",
+		func(state api.ImageState, expected iri.VolumeState) {
+			Expect(s.getIriState(state)).To(Equal(expected))
+		},
+		Entry("pending", api.ImageStatePending, iri.VolumeState_VOLUME_PENDING),
+		Entry("available", api.ImageStateAvailable, iri.VolumeState_VOLUME_AVAILABLE),
+		Entry("error", api.ImageStateError, iri.VolumeState_VOLUME_ERROR),
+	)
+
+	It("fails on unknown states", func() {
+		_, err := s.getIriState("Unknown")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("volumeNamespace", func() {
+	var s *Server
+
+	BeforeEach(func() {
+		s = &Server{namespaceLabel: "tenant"}
+	})
+
+	volumeWithLabels := func(labels map[string]string) *iri.Volume {
+		return &iri.Volume{Metadata: &metav1alpha1.ObjectMetadata{Labels: labels}}
+	}
+
+	It("should use the default namespace if no namespace label is configured", func() {
+		s.namespaceLabel = ""
+		Expect(s.volumeNamespace(volumeWithLabels(map[string]string{"tenant": "foo"}))).To(BeEmpty())
+	})
+
+	It("should use the default namespace for volumes without the label", func() {
+		Expect(s.volumeNamespace(volumeWithLabels(nil))).To(BeEmpty())
+	})
+
+	It("should use the value of the label", func() {
+		Expect(s.volumeNamespace(volumeWithLabels(map[string]string{"tenant": "foo-bar_1.2"}))).To(Equal("foo-bar_1.2"))
+	})
+
+	DescribeTable("should reject invalid namespaces",
+		func(namespace string) {
+			_, err := s.volumeNamespace(volumeWithLabels(map[string]string{"tenant": namespace}))
+			Expect(err).To(MatchError(utils.ErrInvalidVolumeNamespace))
+			Expect(status.Code(utils.ConvertInternalErrorToGRPC(err))).To(Equal(codes.InvalidArgument))
+		},
+		Entry("empty", ""),
+		Entry("with slash", "foo/bar"),
+		Entry("with at sign", "foo@bar"),
+		Entry("with space", "foo bar"),
+		Entry("with leading dash", "-foo"),
+		Entry("too long", strings.Repeat("a", 64)),
+	)
+})
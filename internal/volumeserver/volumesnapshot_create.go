@@ -26,6 +26,9 @@ func (s *Server) createVolumeSnapshot(ctx context.Context, log logr.Logger, volu
 		}
 		return nil, fmt.Errorf("failed to get source volume %s: %w", volumeID, err)
 	}
+	if volume.Status.IsReleased() {
+		return nil, fmt.Errorf("failed to get source volume %s: %w", volumeID, store.ErrNotFound)
+	}
 	if volume.Status.State != api.ImageStateAvailable {
 		return nil, fmt.Errorf("source volume %s is not available, current state is: %s", volumeID, volume.Status.State)
 	}
@@ -36,6 +39,8 @@ func (s *Server) createVolumeSnapshot(ctx context.Context, log logr.Logger, volu
 		},
 		Source: api.SnapshotSource{
 			VolumeImageID: volumeID,
+			Pool:          volume.Spec.Pool,
+			Namespace:     volume.Spec.Namespace,
 		},
 	}
 
@@ -49,20 +49,23 @@ func (s *Server) filterSnapshot(snapshots []*iri.VolumeSnapshot, filter *iri.Vol
 	return res
 }
 
-func (s *Server) listSnapshots(ctx context.Context) ([]*iri.VolumeSnapshot, error) {
-	cephSnapshots, err := s.snapshotStore.List(ctx, store.MatchingLabels{api.ManagerLabel: api.VolumeManager})
-	if err != nil {
-		return nil, fmt.Errorf("error listing snapshots: %w", err)
-	}
-
+func (s *Server) listSnapshots(ctx context.Context, filter *iri.VolumeSnapshotFilter) ([]*iri.VolumeSnapshot, error) {
 	var res []*iri.VolumeSnapshot
-	for _, cephSnapshot := range cephSnapshots {
-		iriSnapshot, err := s.convertSnapshotToIriVolumeSnapshot(cephSnapshot)
-		if err != nil {
-			return nil, err
+	if err := listPages(ctx, s.snapshotStore, s.listPageSize, func(cephSnapshots []*api.Snapshot) error {
+		var snapshots []*iri.VolumeSnapshot
+		for _, cephSnapshot := range cephSnapshots {
+			iriSnapshot, err := s.convertSnapshotToIriVolumeSnapshot(cephSnapshot)
+			if err != nil {
+				return err
+			}
+
+			snapshots = append(snapshots, iriSnapshot)
 		}
 
-		res = append(res, iriSnapshot)
+		res = append(res, s.filterSnapshot(snapshots, filter)...)
+		return nil
+	}, store.MatchingLabels{api.ManagerLabel: api.VolumeManager}); err != nil {
+		return nil, fmt.Errorf("error listing snapshots: %w", err)
 	}
 	return res, nil
 }
@@ -87,13 +90,11 @@ func (s *Server) ListVolumeSnapshots(ctx context.Context, req *iri.ListVolumeSna
 		}, nil
 	}
 
-	snapshots, err := s.listSnapshots(ctx)
+	snapshots, err := s.listSnapshots(ctx, req.Filter)
 	if err != nil {
 		return nil, utils.ConvertInternalErrorToGRPC(err)
 	}
 
-	snapshots = s.filterSnapshot(snapshots, req.Filter)
-
 	log.V(2).Info("Returning volume snapshot list")
 	return &iri.ListVolumeSnapshotsResponse{
 		VolumeSnapshots: snapshots,
@@ -0,0 +1,215 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package integration
+
+import (
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/fsck"
+	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	"github.com/ironcore-dev/ceph-provider/internal/strategy"
+	metav1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
+	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("Consistency check", func() {
+	var (
+		imageStore *omap.Store[*api.Image]
+		checker    *fsck.Checker
+	)
+
+	BeforeEach(func() {
+		var err error
+		imageStore, err = omap.New(logf.Log.WithName("fsck-image-store"), radosConn, cephPoolname, omap.Options[*api.Image]{
+			OmapName:     omap.NameVolumes,
+			NewFunc:      func() *api.Image { return &api.Image{} },
+			Schema:       strategy.ImageSchema,
+			IteratorSize: 1000,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		snapshotStore, err := omap.New(logf.Log.WithName("fsck-snapshot-store"), radosConn, cephPoolname, omap.Options[*api.Snapshot]{
+			OmapName:     omap.NameSnapshots,
+			NewFunc:      func() *api.Snapshot { return &api.Snapshot{} },
+			Schema:       strategy.SnapshotSchema,
+			IteratorSize: 1000,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		checker, err = fsck.NewChecker(logf.Log.WithName("fsck"), radosConn, cephPoolname, imageStore, snapshotStore, nil, fsck.CheckerOptions{})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should report and repair an orphaned rbd image", func(ctx SpecContext) {
+		const orphanName = "img_fsck-orphan"
+
+		By("creating an rbd image without image in the store")
+		options := librbd.NewRbdImageOptions()
+		DeferCleanup(options.Destroy)
+		Expect(librbd.CreateImage(ioctx, orphanName, 1024*1024, options)).To(Succeed())
+
+		By("checking the consistency")
+		res, err := checker.Check(ctx, fsck.CheckOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Issues).To(ContainElement(MatchFields(IgnoreExtras, Fields{
+			"Category": Equal(fsck.CategoryOrphanedImage),
+			"ID":       Equal(orphanName),
+			"Repaired": BeFalse(),
+		})))
+
+		names, err := librbd.GetImageNames(ioctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names).To(ContainElement(orphanName))
+
+		By("repairing the inconsistencies")
+		res, err = checker.Check(ctx, fsck.CheckOptions{Repair: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Issues).To(ContainElement(MatchFields(IgnoreExtras, Fields{
+			"Category": Equal(fsck.CategoryOrphanedImage),
+			"ID":       Equal(orphanName),
+			"Repaired": BeTrue(),
+		})))
+
+		names, err = librbd.GetImageNames(ioctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names).NotTo(ContainElement(orphanName))
+	})
+
+	It("should fail available volumes whose rbd image is lost while the provider is running", func(ctx SpecContext) {
+		By("creating a volume")
+		createResp, err := volumeClient.CreateVolume(ctx, &iriv1alpha1.CreateVolumeRequest{
+			Volume: &iriv1alpha1.Volume{
+				Metadata: &metav1alpha1.ObjectMetadata{
+					Id: "foo",
+				},
+				Spec: &iriv1alpha1.VolumeSpec{
+					Class: "foo",
+					Resources: &iriv1alpha1.VolumeResources{
+						StorageBytes: 1024 * 1024 * 1024,
+					},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		volumeID := createResp.Volume.Metadata.Id
+		DeferCleanup(volumeClient.DeleteVolume, &iriv1alpha1.DeleteVolumeRequest{
+			VolumeId: volumeID,
+		})
+
+		Eventually(ctx, func(g Gomega) *api.Image {
+			image, err := imageStore.Get(ctx, volumeID)
+			g.Expect(err).NotTo(HaveOccurred())
+			return image
+		}).Should(HaveField("Status.State", Equal(api.ImageStateAvailable)))
+
+		By("removing the rbd image of the volume")
+		Expect(librbd.RemoveImage(ioctx, "img_"+volumeID)).To(Succeed())
+
+		By("triggering a reconciliation of the volume")
+		// The image is updated concurrently by the reconciler, so conflicting updates are retried.
+		Eventually(ctx, func() error {
+			image, err := imageStore.Get(ctx, volumeID)
+			if err != nil {
+				return err
+			}
+			if image.Annotations == nil {
+				image.Annotations = map[string]string{}
+			}
+			image.Annotations["fsck-test"] = "reconcile"
+			_, err = imageStore.Update(ctx, image)
+			return err
+		}).Should(Succeed())
+
+		By("ensuring the volume is failed instead of recreated")
+		Eventually(ctx, func(g Gomega) *api.Image {
+			image, err := imageStore.Get(ctx, volumeID)
+			g.Expect(err).NotTo(HaveOccurred())
+			return image
+		}).Should(SatisfyAll(
+			HaveField("Status.State", Equal(api.ImageStateError)),
+			HaveField("Status.Reason", Equal(api.ImageReasonRBDImageMissing)),
+		))
+		Consistently(func() []string {
+			names, err := librbd.GetImageNames(ioctx)
+			Expect(err).NotTo(HaveOccurred())
+			return names
+		}).ShouldNot(ContainElement("img_" + volumeID))
+	})
+
+	It("should fail volumes without rbd image and recreate them on request only", func(ctx SpecContext) {
+		By("creating a volume")
+		createResp, err := volumeClient.CreateVolume(ctx, &iriv1alpha1.CreateVolumeRequest{
+			Volume: &iriv1alpha1.Volume{
+				Metadata: &metav1alpha1.ObjectMetadata{
+					Id: "foo",
+				},
+				Spec: &iriv1alpha1.VolumeSpec{
+					Class: "foo",
+					Resources: &iriv1alpha1.VolumeResources{
+						StorageBytes: 1024 * 1024 * 1024,
+					},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		volumeID := createResp.Volume.Metadata.Id
+		DeferCleanup(volumeClient.DeleteVolume, &iriv1alpha1.DeleteVolumeRequest{
+			VolumeId: volumeID,
+		})
+
+		volumeState := func() iriv1alpha1.VolumeState {
+			resp, err := volumeClient.ListVolumes(ctx, &iriv1alpha1.ListVolumesRequest{
+				Filter: &iriv1alpha1.VolumeFilter{
+					Id: volumeID,
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Volumes).NotTo(BeEmpty())
+			return resp.Volumes[0].Status.State
+		}
+		Eventually(volumeState).Should(Equal(iriv1alpha1.VolumeState_VOLUME_AVAILABLE))
+
+		By("removing the rbd image of the volume")
+		Expect(librbd.RemoveImage(ioctx, "img_"+volumeID)).To(Succeed())
+
+		By("repairing the inconsistencies")
+		res, err := checker.Check(ctx, fsck.CheckOptions{Repair: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Issues).To(ContainElement(MatchFields(IgnoreExtras, Fields{
+			"Category": Equal(fsck.CategoryMissingImage),
+			"ID":       Equal(volumeID),
+			"Repaired": BeTrue(),
+		})))
+
+		By("ensuring the volume is failed instead of recreated")
+		Expect(imageStore.Get(ctx, volumeID)).To(SatisfyAll(
+			HaveField("Status.State", Equal(api.ImageStateError)),
+			HaveField("Status.Reason", Equal(api.ImageReasonRBDImageMissing)),
+		))
+		Eventually(volumeState).Should(Equal(iriv1alpha1.VolumeState_VOLUME_ERROR))
+		Consistently(func() []string {
+			names, err := librbd.GetImageNames(ioctx)
+			Expect(err).NotTo(HaveOccurred())
+			return names
+		}).ShouldNot(ContainElement("img_" + volumeID))
+
+		By("requesting the recreation of missing rbd images")
+		res, err = checker.Check(ctx, fsck.CheckOptions{Repair: true, RecreateMissingImages: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.Issues).To(ContainElement(MatchFields(IgnoreExtras, Fields{
+			"Category": Equal(fsck.CategoryMissingImage),
+			"ID":       Equal(volumeID),
+			"Repaired": BeTrue(),
+		})))
+
+		By("ensuring the volume is available again")
+		Eventually(volumeState).Should(Equal(iriv1alpha1.VolumeState_VOLUME_AVAILABLE))
+	})
+})
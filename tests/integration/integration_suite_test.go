@@ -32,10 +32,13 @@ const (
 	maxEvents            = 5
 	eventTTL             = 2 * time.Second
 	resyncInterval       = 2 * time.Second
+	namespaceLabel       = "tenant"
+	trashDeferment       = 3 * time.Second
 )
 
 var (
 	volumeClient iriv1alpha1.VolumeRuntimeClient
+	radosConn    *rados.Conn
 	ioctx        *rados.IOContext
 
 	cephMonitors        = os.Getenv("CEPH_MONITORS")
@@ -45,6 +48,8 @@ var (
 	cephClientname      = os.Getenv("CEPH_CLIENTNAME")
 	cephConfigFile      = os.Getenv("CEPH_CONFIG_FILE")
 	cephDiskSize        = os.Getenv("CEPH_DISK_SIZE")
+	// cephMigrationPoolname is a second pool volumes are migrated to. Migration tests are skipped without it.
+	cephMigrationPoolname = os.Getenv("CEPH_MIGRATION_POOLNAME")
 )
 
 func TestIntegration_GRPCServer(t *testing.T) {
@@ -96,6 +101,8 @@ var _ = BeforeSuite(func() {
 			KeyringFile:            cephKeyringFilename,
 			Pool:                   cephPoolname,
 			Client:                 cephClientname,
+			NamespaceLabel:         namespaceLabel,
+			TrashDeferment:         trashDeferment,
 			KeyEncryptionKeyPath:   keyEncryptionKeyFile.Name(),
 			BurstDurationInSeconds: 15,
 			VolumeEventStoreOptions: eventrecorder.EventStoreOptions{
@@ -105,6 +112,7 @@ var _ = BeforeSuite(func() {
 			},
 			WorkerSize:       15,
 			OmapIteratorSize: 1000,
+			ListPageSize:     2,
 		},
 	}
 
@@ -131,6 +139,7 @@ var _ = BeforeSuite(func() {
 
 	conn, err := rados.NewConn()
 	Expect(err).NotTo(HaveOccurred())
+	radosConn = conn
 
 	Expect(conn.ReadConfigFile(cephConfigFile)).ToNot(HaveOccurred())
 
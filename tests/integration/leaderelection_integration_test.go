@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package integration
+
+import (
+	"context"
+	"time"
+
+	"github.com/ironcore-dev/ceph-provider/internal/leaderelection"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/clock"
+	testingclock "k8s.io/utils/clock/testing"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("Leader Election", func() {
+	const (
+		lockObject    = "ironcore.test.leader"
+		leaseDuration = 3 * time.Second
+		renewDeadline = 2 * time.Second
+	)
+
+	newElectorWithClock := func(identity string, clk clock.WithTicker) *leaderelection.LeaderElector {
+		elector, err := leaderelection.New(logf.Log.WithName("leader-election-"+identity), radosConn, cephPoolname, leaderelection.Options{
+			Identity:      identity,
+			LockObject:    lockObject,
+			LeaseDuration: leaseDuration,
+			RenewDeadline: renewDeadline,
+			RetryPeriod:   500 * time.Millisecond,
+			Clock:         clk,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return elector
+	}
+
+	newElector := func(identity string) *leaderelection.LeaderElector {
+		return newElectorWithClock(identity, clock.RealClock{})
+	}
+
+	It("should elect a single leader and fail over once it stops", func(ctx SpecContext) {
+		DeferCleanup(func() {
+			Expect(ioctx.Delete(lockObject)).To(Succeed())
+		})
+
+		leading := make(chan string, 2)
+		runElector := func(ctx context.Context, identity string) *leaderelection.LeaderElector {
+			elector := newElector(identity)
+			go func() {
+				defer GinkgoRecover()
+				Expect(elector.Run(ctx, func(ctx context.Context) error {
+					leading <- identity
+					<-ctx.Done()
+					return nil
+				})).To(Succeed())
+			}()
+			return elector
+		}
+
+		ctxA, cancelA := context.WithCancel(ctx)
+		DeferCleanup(cancelA)
+		electorA := runElector(ctxA, "a")
+
+		By("ensuring the first candidate becomes leader")
+		Eventually(leading).Should(Receive(Equal("a")))
+		Expect(electorA.IsLeader()).To(BeTrue())
+
+		ctxB, cancelB := context.WithCancel(ctx)
+		DeferCleanup(cancelB)
+		electorB := runElector(ctxB, "b")
+
+		By("ensuring the second candidate stays on standby")
+		Consistently(leading).ShouldNot(Receive())
+		Expect(electorB.IsLeader()).To(BeFalse())
+
+		By("stopping the leader")
+		cancelA()
+
+		By("ensuring the second candidate takes over")
+		Eventually(leading).Should(Receive(Equal("b")))
+		Expect(electorA.IsLeader()).To(BeFalse())
+		Expect(electorB.IsLeader()).To(BeTrue())
+	})
+
+	It("should return to standby once the lease could not be renewed", func(ctx SpecContext) {
+		DeferCleanup(func() {
+			Expect(ioctx.Delete(lockObject)).To(Succeed())
+		})
+
+		leading := make(chan string, 2)
+		stopped := make(chan string, 2)
+		runElector := func(ctx context.Context, elector *leaderelection.LeaderElector, identity string) <-chan struct{} {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				Expect(elector.Run(ctx, func(ctx context.Context) error {
+					leading <- identity
+					<-ctx.Done()
+					stopped <- identity
+					return nil
+				})).To(Succeed())
+			}()
+			return done
+		}
+
+		// The renewals of the first candidate are timed with a fake clock, so that it stops renewing
+		// its lease until the clock is stepped, as a leader whose renewals stall would.
+		fakeClock := testingclock.NewFakeClock(time.Now())
+		electorA := newElectorWithClock("a", fakeClock)
+		ctxA, cancelA := context.WithCancel(ctx)
+		DeferCleanup(cancelA)
+		doneA := runElector(ctxA, electorA, "a")
+
+		By("ensuring the first candidate becomes leader")
+		Eventually(leading).Should(Receive(Equal("a")))
+
+		electorB := newElector("b")
+		ctxB, cancelB := context.WithCancel(ctx)
+		DeferCleanup(cancelB)
+		runElector(ctxB, electorB, "b")
+
+		By("ensuring the second candidate takes over once the lease expired")
+		start := time.Now()
+		Eventually(leading).WithTimeout(2 * leaseDuration).Should(Receive(Equal("b")))
+		Expect(time.Since(start)).To(BeNumerically(">=", leaseDuration/2))
+		Expect(electorB.IsLeader()).To(BeTrue())
+
+		By("ensuring the first candidate steps down once its renew deadline passed")
+		fakeClock.Step(renewDeadline)
+		Eventually(stopped).Should(Receive(Equal("a")))
+		Eventually(electorA.IsLeader).Should(BeFalse())
+
+		By("ensuring the first candidate keeps running as standby")
+		Consistently(doneA).ShouldNot(BeClosed())
+		Expect(electorB.IsLeader()).To(BeTrue())
+
+		cancelA()
+		Eventually(doneA).Should(BeClosed())
+	})
+})
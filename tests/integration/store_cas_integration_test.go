@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package integration
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("Store Compare-And-Swap", func() {
+	const omapName = "ironcore.test.cas"
+
+	newStore := func() *omap.Store[*api.Image] {
+		s, err := omap.New(logf.Log.WithName("cas-store"), radosConn, cephPoolname, omap.Options[*api.Image]{
+			OmapName:     omapName,
+			NewFunc:      func() *api.Image { return &api.Image{} },
+			IteratorSize: 1000,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return s
+	}
+
+	BeforeEach(func() {
+		DeferCleanup(func() {
+			Expect(ioctx.Delete(omapName)).To(Succeed())
+		})
+	})
+
+	It("should reject conflicting writes of independent stores", func(ctx SpecContext) {
+		// Independent stores do not share their in-process locks, like stores of different replicas.
+		storeA, storeB := newStore(), newStore()
+
+		By("creating an object")
+		created, err := storeA.Create(ctx, &api.Image{Metadata: apiutils.Metadata{ID: "foo"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("creating the same object with the other store")
+		_, err = storeB.Create(ctx, &api.Image{Metadata: apiutils.Metadata{ID: "foo"}})
+		Expect(err).To(MatchError(store.ErrAlreadyExists))
+
+		By("updating the object with both stores based on the same resource version")
+		objA, err := storeA.Get(ctx, created.ID)
+		Expect(err).NotTo(HaveOccurred())
+		objB, err := storeB.Get(ctx, created.ID)
+		Expect(err).NotTo(HaveOccurred())
+
+		objA.Labels = map[string]string{"writer": "a"}
+		_, err = storeA.Update(ctx, objA)
+		Expect(err).NotTo(HaveOccurred())
+
+		objB.Labels = map[string]string{"writer": "b"}
+		_, err = storeB.Update(ctx, objB)
+		Expect(err).To(MatchError(omap.ErrResourceVersionNotLatest))
+
+		Expect(storeB.Get(ctx, created.ID)).To(HaveField("Metadata.Labels", HaveKeyWithValue("writer", "a")))
+	})
+
+	It("should not conflict on writes to other entries of the omap object", func(ctx SpecContext) {
+		storeA, storeB := newStore(), newStore()
+
+		By("creating two objects")
+		foo, err := storeA.Create(ctx, &api.Image{Metadata: apiutils.Metadata{ID: "foo"}})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = storeB.Create(ctx, &api.Image{Metadata: apiutils.Metadata{ID: "bar"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("updating the first object with a version read before the second one was created")
+		foo.Labels = map[string]string{"updated": "true"}
+		_, err = storeA.Update(ctx, foo)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should back off concurrent writes to the same omap object until they succeed", func(ctx SpecContext) {
+		const writers = 8
+
+		By("creating objects with independent stores concurrently")
+		var wg sync.WaitGroup
+		errs := make(chan error, writers)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := newStore().Create(ctx, &api.Image{Metadata: apiutils.Metadata{ID: fmt.Sprintf("foo-%d", i)}})
+				errs <- err
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(newStore().List(ctx)).To(HaveLen(writers))
+	})
+})
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package integration
+
+import (
+	"fmt"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("Store Shards", func() {
+	const (
+		omapName = "ironcore.test.shards"
+		shards   = 4
+	)
+
+	newStore := func(shards int) *omap.Store[*api.Image] {
+		s, err := omap.New(logf.Log.WithName("shard-store"), radosConn, cephPoolname, omap.Options[*api.Image]{
+			OmapName:     omapName,
+			NewFunc:      func() *api.Image { return &api.Image{} },
+			IteratorSize: 2,
+			Shards:       shards,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return s
+	}
+
+	legacyKeys := func() []string {
+		values, err := ioctx.GetOmapValues(omapName, "", "", 100)
+		Expect(err).NotTo(HaveOccurred())
+		var keys []string
+		for key := range values {
+			keys = append(keys, key)
+		}
+		return keys
+	}
+
+	BeforeEach(func() {
+		DeferCleanup(func() {
+			for _, name := range []string{omapName, omapName + ".0", omapName + ".1", omapName + ".2", omapName + ".3"} {
+				Expect(ioctx.Delete(name)).To(Or(Succeed(), MatchError(rados.ErrNotFound)))
+			}
+		})
+	})
+
+	It("should migrate the entries of a legacy store to its shards", func(ctx SpecContext) {
+		By("populating a legacy store")
+		legacyStore := newStore(0)
+		var ids []string
+		for i := 0; i < 5; i++ {
+			obj, err := legacyStore.Create(ctx, &api.Image{Metadata: apiutils.Metadata{ID: fmt.Sprintf("foo-%d", i)}})
+			Expect(err).NotTo(HaveOccurred())
+			ids = append(ids, obj.ID)
+		}
+
+		By("migrating the store to shards")
+		shardedStore := newStore(shards)
+		Expect(shardedStore.NeedsShardMigration(ctx)).To(BeTrue())
+		Expect(shardedStore.MigrateToShards(ctx)).To(Succeed())
+		Expect(shardedStore.NeedsShardMigration(ctx)).To(BeFalse())
+
+		By("ensuring the legacy object is empty and records the shard count")
+		Expect(legacyKeys()).To(BeEmpty())
+		xattrs, err := ioctx.ListXattrs(omapName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(xattrs).To(HaveKeyWithValue(omap.ShardCountXattr, []byte(fmt.Sprint(shards))))
+
+		By("ensuring all entries are served by the sharded store")
+		for _, id := range ids {
+			Expect(shardedStore.Get(ctx, id)).To(HaveField("Metadata.ID", Equal(id)))
+		}
+		Expect(shardedStore.List(ctx)).To(HaveLen(len(ids)))
+
+		By("ensuring a second migration is a no-op")
+		Expect(shardedStore.MigrateToShards(ctx)).To(Succeed())
+		Expect(shardedStore.List(ctx)).To(HaveLen(len(ids)))
+
+		By("ensuring a different shard count is rejected")
+		Expect(newStore(shards + 1).MigrateToShards(ctx)).NotTo(Succeed())
+	})
+
+	It("should resume an interrupted migration", func(ctx SpecContext) {
+		legacyStore, shardedStore := newStore(0), newStore(shards)
+
+		By("populating a legacy store")
+		for i := 0; i < 5; i++ {
+			_, err := legacyStore.Create(ctx, &api.Image{Metadata: apiutils.Metadata{ID: fmt.Sprintf("foo-%d", i)}})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		By("simulating a migration interrupted after writing entries to their shards")
+		// foo-0 has been moved completely, foo-1 has been written to its shard but not yet removed
+		// from the legacy object.
+		for _, id := range []string{"foo-0", "foo-1"} {
+			obj, err := legacyStore.Get(ctx, id)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(shardedStore.Restore(ctx, obj)).To(Succeed())
+		}
+		Expect(ioctx.RmOmapKeys(omapName, []string{"foo-0"})).To(Succeed())
+
+		By("resuming the migration")
+		Expect(shardedStore.MigrateToShards(ctx)).To(Succeed())
+
+		By("ensuring no entry has been lost or duplicated")
+		Expect(legacyKeys()).To(BeEmpty())
+		objs, err := shardedStore.List(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(objs).To(ConsistOf(
+			HaveField("Metadata.ID", "foo-0"),
+			HaveField("Metadata.ID", "foo-1"),
+			HaveField("Metadata.ID", "foo-2"),
+			HaveField("Metadata.ID", "foo-3"),
+			HaveField("Metadata.ID", "foo-4"),
+		))
+	})
+})
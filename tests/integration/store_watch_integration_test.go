@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package integration
+
+import (
+	"context"
+	"time"
+
+	"github.com/ceph/go-ceph/rados"
+
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	"github.com/ironcore-dev/ceph-provider/internal/strategy"
+	metav1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
+	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("Store Watch", func() {
+	It("should propagate mutations of another rados client", func(ctx SpecContext) {
+		By("starting a second image store on a separate rados client")
+		imageStore, err := omap.New(logf.Log.WithName("remote-image-store"), radosConn, cephPoolname, omap.Options[*api.Image]{
+			OmapName:     omap.NameVolumes,
+			NewFunc:      func() *api.Image { return &api.Image{} },
+			Schema:       strategy.ImageSchema,
+			IteratorSize: 1000,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		storeCtx, cancel := context.WithCancel(ctx)
+		DeferCleanup(cancel)
+		go func() {
+			defer GinkgoRecover()
+			Expect(imageStore.Start(storeCtx)).To(Succeed())
+		}()
+
+		watch, err := imageStore.Watch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(watch.Stop)
+
+		By("creating a volume")
+		createResp, err := volumeClient.CreateVolume(ctx, &iriv1alpha1.CreateVolumeRequest{
+			Volume: &iriv1alpha1.Volume{
+				Metadata: &metav1alpha1.ObjectMetadata{
+					Id: "remote-watch",
+				},
+				Spec: &iriv1alpha1.VolumeSpec{
+					Class: "foo",
+					Resources: &iriv1alpha1.VolumeResources{
+						StorageBytes: 1024 * 1024 * 1024,
+					},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(volumeClient.DeleteVolume, &iriv1alpha1.DeleteVolumeRequest{
+			VolumeId: createResp.Volume.Metadata.Id,
+		})
+
+		By("ensuring the second store emits the events of the provider's mutations")
+		Eventually(watch.Events()).Should(Receive(SatisfyAll(
+			HaveField("Type", store.WatchEventTypeCreated),
+			HaveField("Object.Metadata.ID", createResp.Volume.Metadata.Id),
+		)))
+		Eventually(watch.Events()).Should(Receive(SatisfyAll(
+			HaveField("Type", store.WatchEventTypeUpdated),
+			HaveField("Object.Status.State", api.ImageStateAvailable),
+		)))
+	})
+
+	It("should not block mutations of an id while a watcher does not acknowledge notifications", func(ctx SpecContext) {
+		const (
+			omapName      = "ironcore.test.notify"
+			notifyTimeout = 3 * time.Second
+		)
+
+		imageStore, err := omap.New(logf.Log.WithName("notify-image-store"), radosConn, cephPoolname, omap.Options[*api.Image]{
+			OmapName:      omapName,
+			NewFunc:       func() *api.Image { return &api.Image{} },
+			IteratorSize:  1000,
+			NotifyTimeout: notifyTimeout,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			Expect(ioctx.Delete(omapName)).To(Or(Succeed(), MatchError(rados.ErrNotFound)))
+		})
+
+		By("registering a watcher that never acknowledges notifications")
+		Expect(ioctx.Create(omapName, rados.CreateIdempotent)).To(Succeed())
+		watcher, err := ioctx.Watch(omapName)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(watcher.Delete)
+
+		By("creating an object whose notification is not acknowledged")
+		created := make(chan error, 1)
+		go func() {
+			_, err := imageStore.Create(ctx, &api.Image{Metadata: apiutils.Metadata{ID: "foo"}})
+			created <- err
+		}()
+		Eventually(ctx, func() error {
+			_, err := imageStore.Get(ctx, "foo")
+			return err
+		}).Should(Succeed())
+
+		By("ensuring the id can be mutated again while the notification is pending")
+		start := time.Now()
+		_, err = imageStore.Create(ctx, &api.Image{Metadata: apiutils.Metadata{ID: "foo"}})
+		Expect(err).To(MatchError(store.ErrAlreadyExists))
+		Expect(time.Since(start)).To(BeNumerically("<", notifyTimeout/2))
+
+		Eventually(created).WithTimeout(2 * notifyTimeout).Should(Receive(BeNil()))
+	})
+})
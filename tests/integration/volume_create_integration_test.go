@@ -4,12 +4,13 @@
 package integration
 
 import (
-	"encoding/json"
 	"fmt"
 	"strings"
 
+	librbd "github.com/ceph/go-ceph/rbd"
 	"github.com/ironcore-dev/ceph-provider/api"
 	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	"github.com/ironcore-dev/ceph-provider/internal/strategy"
 	metav1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
 	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
 	. "github.com/onsi/ginkgo/v2"
@@ -56,7 +57,7 @@ var _ = Describe("Create Volume", func() {
 			oMap, err := ioctx.GetOmapValues(omap.NameVolumes, "", createResp.Volume.Metadata.Id, 10)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(oMap).To(HaveKey(createResp.Volume.Metadata.Id))
-			Expect(json.Unmarshal(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
+			Expect(strategy.ImageSchema.Decode(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
 			return image
 		}).Should(SatisfyAll(
 			HaveField("Metadata.ID", Equal(createResp.Volume.Metadata.Id)),
@@ -113,6 +114,57 @@ var _ = Describe("Create Volume", func() {
 		))
 	})
 
+	It("should create a volume in the rbd namespace of its tenant", func(ctx SpecContext) {
+		By("creating a volume with a tenant label")
+		createResp, err := volumeClient.CreateVolume(ctx, &iriv1alpha1.CreateVolumeRequest{
+			Volume: &iriv1alpha1.Volume{
+				Metadata: &metav1alpha1.ObjectMetadata{
+					Id:     "foo-tenant",
+					Labels: map[string]string{namespaceLabel: "tenant-a"},
+				},
+				Spec: &iriv1alpha1.VolumeSpec{
+					Class: "foo",
+					Resources: &iriv1alpha1.VolumeResources{
+						StorageBytes: 1024 * 1024 * 1024,
+					},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(volumeClient.DeleteVolume, &iriv1alpha1.DeleteVolumeRequest{
+			VolumeId: createResp.Volume.Metadata.Id,
+		})
+
+		By("ensuring the image is created in the namespace")
+		rbdID := "img_" + createResp.Volume.Metadata.Id
+		Eventually(ctx, func() *api.Image {
+			image := &api.Image{}
+			oMap, err := ioctx.GetOmapValues(omap.NameVolumes, "", createResp.Volume.Metadata.Id, 10)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(oMap).To(HaveKey(createResp.Volume.Metadata.Id))
+			Expect(strategy.ImageSchema.Decode(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
+			return image
+		}).Should(SatisfyAll(
+			HaveField("Spec.Namespace", Equal("tenant-a")),
+			HaveField("Status.State", Equal(api.ImageStateAvailable)),
+			HaveField("Status.Access.Handle", fmt.Sprintf("%s/%s/%s", cephPoolname, "tenant-a", rbdID)),
+		))
+
+		namespaceIoCtx, err := radosConn.OpenIOContext(cephPoolname)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(namespaceIoCtx.Destroy)
+		namespaceIoCtx.SetNamespace("tenant-a")
+
+		names, err := librbd.GetImageNames(namespaceIoCtx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names).To(ContainElement(rbdID))
+
+		names, err = librbd.GetImageNames(ioctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names).NotTo(ContainElement(rbdID))
+	})
+
 	It("should create an encrypted volume", func(ctx SpecContext) {
 		By("creating a volume with encryption key")
 		createResp, err := volumeClient.CreateVolume(ctx, &iriv1alpha1.CreateVolumeRequest{
@@ -155,7 +207,7 @@ var _ = Describe("Create Volume", func() {
 			oMap, err := ioctx.GetOmapValues(omap.NameVolumes, "", createResp.Volume.Metadata.Id, 10)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(oMap).To(HaveKey(createResp.Volume.Metadata.Id))
-			Expect(json.Unmarshal(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
+			Expect(strategy.ImageSchema.Decode(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
 			return image
 		}).Should(SatisfyAll(
 			HaveField("Metadata.ID", Equal(createResp.Volume.Metadata.Id)),
@@ -239,7 +291,7 @@ var _ = Describe("Create Volume", func() {
 			oMap, err := ioctx.GetOmapValues(omap.NameVolumes, "", createResp.Volume.Metadata.Id, 10)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(oMap).To(HaveKey(createResp.Volume.Metadata.Id))
-			Expect(json.Unmarshal(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
+			Expect(strategy.ImageSchema.Decode(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
 			return image
 		}).Should(SatisfyAll(
 			HaveField("Metadata.ID", Equal(createResp.Volume.Metadata.Id)),
@@ -285,7 +337,7 @@ var _ = Describe("Create Volume", func() {
 			oMap, err := ioctx.GetOmapValues(omap.NameSnapshots, "", snapshotID, 10)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(oMap).To(HaveKey(snapshotID))
-			Expect(json.Unmarshal(oMap[snapshotID], snapshot)).NotTo(HaveOccurred())
+			Expect(strategy.SnapshotSchema.Decode(oMap[snapshotID], snapshot)).NotTo(HaveOccurred())
 			return snapshot
 		}).Should(SatisfyAll(
 			HaveField("Metadata.ID", Equal(snapshotID)),
@@ -339,7 +391,7 @@ var _ = Describe("Create Volume", func() {
 			oMap, err := ioctx.GetOmapValues(omap.NameVolumes, "", volCreateResp.Volume.Metadata.Id, 10)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(oMap).To(HaveKey(volCreateResp.Volume.Metadata.Id))
-			Expect(json.Unmarshal(oMap[volCreateResp.Volume.Metadata.Id], volImage)).NotTo(HaveOccurred())
+			Expect(strategy.ImageSchema.Decode(oMap[volCreateResp.Volume.Metadata.Id], volImage)).NotTo(HaveOccurred())
 			return volImage
 		}).Should(SatisfyAll(
 			HaveField("Metadata.ID", Equal(volCreateResp.Volume.Metadata.Id)),
@@ -4,12 +4,13 @@
 package integration
 
 import (
-	"encoding/json"
 	"fmt"
 	"strings"
 
+	librbd "github.com/ceph/go-ceph/rbd"
 	"github.com/ironcore-dev/ceph-provider/api"
 	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	"github.com/ironcore-dev/ceph-provider/internal/strategy"
 	metav1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
 	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
 	. "github.com/onsi/ginkgo/v2"
@@ -40,7 +41,7 @@ var _ = Describe("Delete Volume", func() {
 			oMap, err := ioctx.GetOmapValues(omap.NameVolumes, "", createResp.Volume.Metadata.Id, 10)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(oMap).To(HaveKey(createResp.Volume.Metadata.Id))
-			Expect(json.Unmarshal(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
+			Expect(strategy.ImageSchema.Decode(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
 			return image
 		}).Should(SatisfyAll(
 			HaveField("Metadata.ID", Equal(createResp.Volume.Metadata.Id)),
@@ -73,11 +74,118 @@ var _ = Describe("Delete Volume", func() {
 			Expect(resp.Volumes).To(BeEmpty())
 		})
 
-		By("ensuring the image has been deleted inside the ceph cluster")
-		Eventually(func() {
+		By("ensuring the image has been deleted inside the ceph cluster after the trash deferment")
+		Eventually(func(g Gomega) {
 			oMap, err := ioctx.GetOmapValues(omap.NameVolumes, "", createResp.Volume.Metadata.Id, 10)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(oMap).NotTo(HaveKey(createResp.Volume.Metadata.Id))
+		}).WithTimeout(trashDeferment + eventuallyTimeout).Should(Succeed())
+	})
+
+	It("should keep the rbd image of a deleted volume until its snapshots are deleted", func(ctx SpecContext) {
+		By("creating a volume")
+		createResp, err := volumeClient.CreateVolume(ctx, &iriv1alpha1.CreateVolumeRequest{
+			Volume: &iriv1alpha1.Volume{
+				Metadata: &metav1alpha1.ObjectMetadata{
+					Id: "foo",
+				},
+				Spec: &iriv1alpha1.VolumeSpec{
+					Class: "foo",
+					Resources: &iriv1alpha1.VolumeResources{
+						StorageBytes: 1024 * 1024 * 1024,
+					},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		volumeID := createResp.Volume.Metadata.Id
+		rbdID := "img_" + volumeID
+
+		By("ensuring volume is in available state")
+		Eventually(func() *iriv1alpha1.VolumeStatus {
+			resp, err := volumeClient.ListVolumes(ctx, &iriv1alpha1.ListVolumesRequest{
+				Filter: &iriv1alpha1.VolumeFilter{
+					Id: volumeID,
+				},
+			})
 			Expect(err).NotTo(HaveOccurred())
-			Expect(oMap).NotTo(HaveKey(createResp.Volume.Metadata.Id))
+			Expect(resp.Volumes).NotTo(BeEmpty())
+			return resp.Volumes[0].Status
+		}).Should(HaveField("State", Equal(iriv1alpha1.VolumeState_VOLUME_AVAILABLE)))
+
+		By("creating a volume snapshot")
+		createSnapshotResp, err := volumeClient.CreateVolumeSnapshot(ctx, &iriv1alpha1.CreateVolumeSnapshotRequest{
+			VolumeSnapshot: &iriv1alpha1.VolumeSnapshot{
+				Metadata: &metav1alpha1.ObjectMetadata{
+					Id: "foo-snap",
+				},
+				Spec: &iriv1alpha1.VolumeSnapshotSpec{
+					VolumeId: volumeID,
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		snapshotID := createSnapshotResp.VolumeSnapshot.Metadata.Id
+
+		By("ensuring volume snapshot is in available state")
+		Eventually(func() *iriv1alpha1.VolumeSnapshotStatus {
+			resp, err := volumeClient.ListVolumeSnapshots(ctx, &iriv1alpha1.ListVolumeSnapshotsRequest{
+				Filter: &iriv1alpha1.VolumeSnapshotFilter{
+					Id: snapshotID,
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.VolumeSnapshots).To(HaveLen(1))
+			return resp.VolumeSnapshots[0].Status
+		}).Should(HaveField("State", Equal(iriv1alpha1.VolumeSnapshotState_VOLUME_SNAPSHOT_READY)))
+
+		By("deleting the volume")
+		_, err = volumeClient.DeleteVolume(ctx, &iriv1alpha1.DeleteVolumeRequest{
+			VolumeId: volumeID,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("ensuring the image is retained by the snapshot")
+		Eventually(ctx, func(g Gomega) *api.Image {
+			image := &api.Image{}
+			oMap, err := ioctx.GetOmapValues(omap.NameVolumes, "", volumeID, 10)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(oMap).To(HaveKey(volumeID))
+			g.Expect(strategy.ImageSchema.Decode(oMap[volumeID], image)).To(Succeed())
+			return image
+		}).Should(HaveField("Status.RetainedBy", ConsistOf(snapshotID)))
+
+		By("ensuring the volume is not listed anymore")
+		resp, err := volumeClient.ListVolumes(ctx, &iriv1alpha1.ListVolumesRequest{
+			Filter: &iriv1alpha1.VolumeFilter{
+				Id: volumeID,
+			},
 		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Volumes).To(BeEmpty())
+
+		By("ensuring the rbd image and its snapshot are kept")
+		img, err := librbd.OpenImage(ioctx, rbdID, snapshotID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(img.Close()).To(Succeed())
+
+		By("deleting the volume snapshot")
+		_, err = volumeClient.DeleteVolumeSnapshot(ctx, &iriv1alpha1.DeleteVolumeSnapshotRequest{
+			VolumeSnapshotId: snapshotID,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("ensuring the image has been deleted inside the ceph cluster")
+		Eventually(ctx, func(g Gomega) {
+			oMap, err := ioctx.GetOmapValues(omap.NameVolumes, "", volumeID, 10)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(oMap).NotTo(HaveKey(volumeID))
+
+			names, err := librbd.GetImageNames(ioctx)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(names).NotTo(ContainElement(rbdID))
+		}).WithTimeout(trashDeferment + eventuallyTimeout).Should(Succeed())
 	})
 })
@@ -4,17 +4,19 @@
 package integration
 
 import (
-	"encoding/json"
 	"fmt"
 	"strings"
 
+	librbd "github.com/ceph/go-ceph/rbd"
 	"github.com/ironcore-dev/ceph-provider/api"
 	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	"github.com/ironcore-dev/ceph-provider/internal/strategy"
 	metav1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
 	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/api/resource"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 var _ = Describe("Expand Volume", func() {
@@ -55,7 +57,7 @@ var _ = Describe("Expand Volume", func() {
 			oMap, err := ioctx.GetOmapValues(omap.NameVolumes, "", createResp.Volume.Metadata.Id, 10)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(oMap).To(HaveKey(createResp.Volume.Metadata.Id))
-			Expect(json.Unmarshal(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
+			Expect(strategy.ImageSchema.Decode(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
 			return image
 		}).Should(SatisfyAll(
 			HaveField("Metadata.ID", Equal(createResp.Volume.Metadata.Id)),
@@ -125,7 +127,7 @@ var _ = Describe("Expand Volume", func() {
 			oMap, err := ioctx.GetOmapValues(omap.NameVolumes, "", createResp.Volume.Metadata.Id, 10)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(oMap).To(HaveKey(createResp.Volume.Metadata.Id))
-			Expect(json.Unmarshal(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
+			Expect(strategy.ImageSchema.Decode(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
 			return image
 		}).Should(SatisfyAll(
 			HaveField("Metadata.ID", Equal(createResp.Volume.Metadata.Id)),
@@ -181,4 +183,76 @@ var _ = Describe("Expand Volume", func() {
 			)),
 		))
 	})
+
+	It("should not retry the creation of a volume whose rbd image is missing on expand", func(ctx SpecContext) {
+		imageStore, err := omap.New(logf.Log.WithName("expand-image-store"), radosConn, cephPoolname, omap.Options[*api.Image]{
+			OmapName:     omap.NameVolumes,
+			NewFunc:      func() *api.Image { return &api.Image{} },
+			Schema:       strategy.ImageSchema,
+			IteratorSize: 1000,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("creating a volume")
+		createResp, err := volumeClient.CreateVolume(ctx, &iriv1alpha1.CreateVolumeRequest{
+			Volume: &iriv1alpha1.Volume{
+				Metadata: &metav1alpha1.ObjectMetadata{
+					Id: "foo",
+				},
+				Spec: &iriv1alpha1.VolumeSpec{
+					Class: "foo",
+					Resources: &iriv1alpha1.VolumeResources{
+						StorageBytes: 1024 * 1024 * 1024,
+					},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		volumeID := createResp.Volume.Metadata.Id
+		DeferCleanup(volumeClient.DeleteVolume, &iriv1alpha1.DeleteVolumeRequest{
+			VolumeId: volumeID,
+		})
+
+		Eventually(ctx, func(g Gomega) *api.Image {
+			image, err := imageStore.Get(ctx, volumeID)
+			g.Expect(err).NotTo(HaveOccurred())
+			return image
+		}).Should(HaveField("Status.State", Equal(api.ImageStateAvailable)))
+
+		By("removing the rbd image and failing the volume")
+		Expect(librbd.RemoveImage(ioctx, "img_"+volumeID)).To(Succeed())
+		Eventually(ctx, func() error {
+			image, err := imageStore.Get(ctx, volumeID)
+			if err != nil {
+				return err
+			}
+			image.Status.SetState(api.ImageStateError, api.ImageReasonRBDImageMissing, "rbd image is missing")
+			_, err = imageStore.Update(ctx, image)
+			return err
+		}).Should(Succeed())
+
+		By("expanding the volume")
+		_, err = volumeClient.ExpandVolume(ctx, &iriv1alpha1.ExpandVolumeRequest{
+			VolumeId: volumeID,
+			Resources: &iriv1alpha1.VolumeResources{
+				StorageBytes: 2 * 1024 * 1024 * 1024,
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("ensuring the volume stays failed and its rbd image is not recreated")
+		Consistently(ctx, func(g Gomega) *api.Image {
+			image, err := imageStore.Get(ctx, volumeID)
+			g.Expect(err).NotTo(HaveOccurred())
+			return image
+		}).Should(SatisfyAll(
+			HaveField("Spec.Size", Equal(uint64(2*1024*1024*1024))),
+			HaveField("Status.State", Equal(api.ImageStateError)),
+			HaveField("Status.Reason", Equal(api.ImageReasonRBDImageMissing)),
+		))
+		names, err := librbd.GetImageNames(ioctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names).NotTo(ContainElement("img_" + volumeID))
+	})
 })
@@ -0,0 +1,161 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package integration
+
+import (
+	"strings"
+
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	"github.com/ironcore-dev/ceph-provider/internal/strategy"
+	metav1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
+	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
+	apiutils "github.com/ironcore-dev/provider-utils/apiutils/api"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("Group Snapshot Volumes", func() {
+	It("should snapshot several volumes at the same point in time", func(ctx SpecContext) {
+		groupSnapshotStore, err := omap.New(logf.Log.WithName("group-snapshot-store"), radosConn, cephPoolname, omap.Options[*api.GroupSnapshot]{
+			OmapName:       omap.NameGroupSnapshots,
+			NewFunc:        func() *api.GroupSnapshot { return &api.GroupSnapshot{} },
+			CreateStrategy: strategy.GroupSnapshotStrategy,
+			Schema:         strategy.GroupSnapshotSchema,
+			IteratorSize:   1000,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("creating two volumes")
+		var volumeIDs []string
+		for _, id := range []string{"foo", "bar"} {
+			createResp, err := volumeClient.CreateVolume(ctx, &iriv1alpha1.CreateVolumeRequest{
+				Volume: &iriv1alpha1.Volume{
+					Metadata: &metav1alpha1.ObjectMetadata{
+						Id: id,
+					},
+					Spec: &iriv1alpha1.VolumeSpec{
+						Class: "foo",
+						Resources: &iriv1alpha1.VolumeResources{
+							StorageBytes: 1024 * 1024 * 1024,
+						},
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			volumeIDs = append(volumeIDs, createResp.Volume.Metadata.Id)
+		}
+
+		By("ensuring the volumes are in available state")
+		for _, volumeID := range volumeIDs {
+			Eventually(func() *iriv1alpha1.VolumeStatus {
+				resp, err := volumeClient.ListVolumes(ctx, &iriv1alpha1.ListVolumesRequest{
+					Filter: &iriv1alpha1.VolumeFilter{
+						Id: volumeID,
+					},
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp.Volumes).NotTo(BeEmpty())
+				return resp.Volumes[0].Status
+			}).Should(HaveField("State", Equal(iriv1alpha1.VolumeState_VOLUME_AVAILABLE)))
+		}
+
+		By("creating a group snapshot of the volumes")
+		groupSnapshot, err := groupSnapshotStore.Create(ctx, &api.GroupSnapshot{
+			Metadata: apiutils.Metadata{
+				ID: "foo-group",
+			},
+			Spec: api.GroupSnapshotSpec{
+				VolumeImageIDs: volumeIDs,
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("ensuring the group snapshot has been taken")
+		Eventually(ctx, func(g Gomega) api.GroupSnapshotState {
+			groupSnapshot, err = groupSnapshotStore.Get(ctx, groupSnapshot.ID)
+			g.Expect(err).NotTo(HaveOccurred())
+			return groupSnapshot.Status.State
+		}).Should(Or(Equal(api.GroupSnapshotStateReady), Equal(api.GroupSnapshotStateFailed)))
+		if groupSnapshot.Status.State == api.GroupSnapshotStateFailed && strings.Contains(groupSnapshot.Status.Message, "not supported") {
+			Skip("librbd does not support group snapshots: " + groupSnapshot.Status.Message)
+		}
+		Expect(groupSnapshot.Status.State).To(Equal(api.GroupSnapshotStateReady), groupSnapshot.Status.Message)
+		Expect(groupSnapshot.Status.SnapshotIDs).To(HaveLen(len(volumeIDs)))
+
+		By("ensuring a volume snapshot is reported for each volume")
+		for _, snapshotID := range groupSnapshot.Status.SnapshotIDs {
+			resp, err := volumeClient.ListVolumeSnapshots(ctx, &iriv1alpha1.ListVolumeSnapshotsRequest{
+				Filter: &iriv1alpha1.VolumeSnapshotFilter{
+					Id: snapshotID,
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.VolumeSnapshots).To(ConsistOf(SatisfyAll(
+				HaveField("Spec.VolumeId", BeElementOf(volumeIDs)),
+				HaveField("Status.State", Equal(iriv1alpha1.VolumeSnapshotState_VOLUME_SNAPSHOT_READY)),
+			)))
+		}
+
+		By("restoring a volume from a snapshot of the group snapshot")
+		restoreResp, err := volumeClient.CreateVolume(ctx, &iriv1alpha1.CreateVolumeRequest{
+			Volume: &iriv1alpha1.Volume{
+				Metadata: &metav1alpha1.ObjectMetadata{
+					Id: "foo-restored",
+				},
+				Spec: &iriv1alpha1.VolumeSpec{
+					Class: "foo",
+					Resources: &iriv1alpha1.VolumeResources{
+						StorageBytes: 1024 * 1024 * 1024,
+					},
+					VolumeDataSource: &iriv1alpha1.VolumeDataSource{
+						SnapshotDataSource: &iriv1alpha1.SnapshotDataSource{
+							SnapshotId: groupSnapshot.Status.SnapshotIDs[0],
+						},
+					},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		restoredID := restoreResp.Volume.Metadata.Id
+
+		Eventually(func() *iriv1alpha1.VolumeStatus {
+			resp, err := volumeClient.ListVolumes(ctx, &iriv1alpha1.ListVolumesRequest{
+				Filter: &iriv1alpha1.VolumeFilter{
+					Id: restoredID,
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Volumes).NotTo(BeEmpty())
+			return resp.Volumes[0].Status
+		}).Should(HaveField("State", Equal(iriv1alpha1.VolumeState_VOLUME_AVAILABLE)))
+
+		By("deleting the restored volume")
+		_, err = volumeClient.DeleteVolume(ctx, &iriv1alpha1.DeleteVolumeRequest{
+			VolumeId: restoredID,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("deleting the group snapshot")
+		Expect(groupSnapshotStore.Delete(ctx, groupSnapshot.ID)).To(Succeed())
+
+		By("ensuring the group snapshot and its volume snapshots are gone")
+		Eventually(ctx, func() error {
+			_, err := groupSnapshotStore.Get(ctx, groupSnapshot.ID)
+			return err
+		}).Should(MatchError(store.ErrNotFound))
+
+		for _, snapshotID := range groupSnapshot.Status.SnapshotIDs {
+			resp, err := volumeClient.ListVolumeSnapshots(ctx, &iriv1alpha1.ListVolumeSnapshotsRequest{
+				Filter: &iriv1alpha1.VolumeSnapshotFilter{
+					Id: snapshotID,
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.VolumeSnapshots).To(BeEmpty())
+		}
+	})
+})
@@ -4,12 +4,12 @@
 package integration
 
 import (
-	"encoding/json"
 	"fmt"
 	"strings"
 
 	"github.com/ironcore-dev/ceph-provider/api"
 	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	"github.com/ironcore-dev/ceph-provider/internal/strategy"
 	metav1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
 	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
 	. "github.com/onsi/ginkgo/v2"
@@ -41,7 +41,7 @@ var _ = Describe("List Volume", func() {
 			oMap, err := ioctx.GetOmapValues(omap.NameVolumes, "", createResp.Volume.Metadata.Id, 10)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(oMap).To(HaveKey(createResp.Volume.Metadata.Id))
-			Expect(json.Unmarshal(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
+			Expect(strategy.ImageSchema.Decode(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
 			return image
 		}).Should(SatisfyAll(
 			HaveField("Metadata.ID", Equal(createResp.Volume.Metadata.Id)),
@@ -122,4 +122,47 @@ var _ = Describe("List Volume", func() {
 			Expect(resp.Volumes).To(BeEmpty())
 		})
 	})
+
+	It("should list volumes across multiple pages", func(ctx SpecContext) {
+		By("creating more volumes than fit into a single list page")
+		var volumeIDs []string
+		for i := 0; i < 3; i++ {
+			createResp, err := volumeClient.CreateVolume(ctx, &iriv1alpha1.CreateVolumeRequest{
+				Volume: &iriv1alpha1.Volume{
+					Metadata: &metav1alpha1.ObjectMetadata{
+						Id:     fmt.Sprintf("paged-%d", i),
+						Labels: map[string]string{"paged": "true"},
+					},
+					Spec: &iriv1alpha1.VolumeSpec{
+						Class: "foo",
+						Resources: &iriv1alpha1.VolumeResources{
+							StorageBytes: 1024 * 1024 * 1024,
+						},
+					},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			volumeIDs = append(volumeIDs, createResp.Volume.Metadata.Id)
+
+			DeferCleanup(volumeClient.DeleteVolume, &iriv1alpha1.DeleteVolumeRequest{
+				VolumeId: createResp.Volume.Metadata.Id,
+			})
+		}
+
+		By("listing volumes with label selector")
+		Eventually(func() []string {
+			resp, err := volumeClient.ListVolumes(ctx, &iriv1alpha1.ListVolumesRequest{
+				Filter: &iriv1alpha1.VolumeFilter{
+					LabelSelector: map[string]string{"paged": "true"},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			var ids []string
+			for _, volume := range resp.Volumes {
+				ids = append(ids, volume.Metadata.Id)
+			}
+			return ids
+		}).Should(ConsistOf(volumeIDs))
+	})
 })
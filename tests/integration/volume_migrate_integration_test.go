@@ -0,0 +1,268 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package integration
+
+import (
+	"time"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	"github.com/ironcore-dev/ceph-provider/internal/strategy"
+	metav1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
+	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("Migrate Volume", func() {
+	const migrationTimeout = time.Minute
+
+	var imageStore *omap.Store[*api.Image]
+
+	BeforeEach(func() {
+		if cephMigrationPoolname == "" {
+			Skip("CEPH_MIGRATION_POOLNAME is not set")
+		}
+
+		var err error
+		imageStore, err = omap.New(logf.Log.WithName("migrate-image-store"), radosConn, cephPoolname, omap.Options[*api.Image]{
+			OmapName:     omap.NameVolumes,
+			NewFunc:      func() *api.Image { return &api.Image{} },
+			Schema:       strategy.ImageSchema,
+			IteratorSize: 1000,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	createVolume := func(ctx SpecContext, id string) string {
+		createResp, err := volumeClient.CreateVolume(ctx, &iriv1alpha1.CreateVolumeRequest{
+			Volume: &iriv1alpha1.Volume{
+				Metadata: &metav1alpha1.ObjectMetadata{
+					Id: id,
+				},
+				Spec: &iriv1alpha1.VolumeSpec{
+					Class: "foo",
+					Resources: &iriv1alpha1.VolumeResources{
+						StorageBytes: 1024 * 1024 * 1024,
+					},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		volumeID := createResp.Volume.Metadata.Id
+		DeferCleanup(volumeClient.DeleteVolume, &iriv1alpha1.DeleteVolumeRequest{
+			VolumeId: volumeID,
+		})
+
+		Eventually(ctx, func(g Gomega) *api.Image {
+			image, err := imageStore.Get(ctx, volumeID)
+			g.Expect(err).NotTo(HaveOccurred())
+			return image
+		}).Should(HaveField("Status.State", Equal(api.ImageStateAvailable)))
+
+		By("writing data to the rbd image")
+		img, err := librbd.OpenImage(ioctx, "img_"+volumeID, librbd.NoSnapshot)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = img.WriteAt([]byte("foo"), 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(img.Close()).To(Succeed())
+
+		return volumeID
+	}
+
+	updateImage := func(ctx SpecContext, id string, mutate func(image *api.Image)) {
+		// The image is updated concurrently by the reconciler, so conflicting updates are retried.
+		Eventually(ctx, func() error {
+			image, err := imageStore.Get(ctx, id)
+			if err != nil {
+				return err
+			}
+			mutate(image)
+			_, err = imageStore.Update(ctx, image)
+			return err
+		}).Should(Succeed())
+	}
+
+	expectData := func(pool, rbdID string) {
+		poolIoCtx, err := radosConn.OpenIOContext(pool)
+		Expect(err).NotTo(HaveOccurred())
+		defer poolIoCtx.Destroy()
+
+		img, err := librbd.OpenImageReadOnly(poolIoCtx, rbdID, librbd.NoSnapshot)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() {
+			Expect(img.Close()).To(Succeed())
+		}()
+		data := make([]byte, 3)
+		_, err = img.ReadAt(data, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("foo"))
+	}
+
+	prepareMigration := func(rbdID string) {
+		targetIoCtx, err := radosConn.OpenIOContext(cephMigrationPoolname)
+		Expect(err).NotTo(HaveOccurred())
+		defer targetIoCtx.Destroy()
+
+		options := librbd.NewRbdImageOptions()
+		defer options.Destroy()
+		Expect(librbd.MigrationPrepare(ioctx, rbdID, targetIoCtx, rbdID, options)).To(Succeed())
+	}
+
+	It("should migrate a volume to another pool", func(ctx SpecContext) {
+		volumeID := createVolume(ctx, "foo")
+
+		By("requesting the migration of the volume")
+		updateImage(ctx, volumeID, func(image *api.Image) {
+			image.Spec.Migration = &api.ImageMigration{Pool: cephMigrationPoolname}
+		})
+
+		By("ensuring the migration has been committed")
+		Eventually(ctx, func(g Gomega) *api.Image {
+			image, err := imageStore.Get(ctx, volumeID)
+			g.Expect(err).NotTo(HaveOccurred())
+			return image
+		}).WithTimeout(migrationTimeout).Should(SatisfyAll(
+			HaveField("Spec.Migration", BeNil()),
+			HaveField("Spec.Pool", Equal(cephMigrationPoolname)),
+			HaveField("Status.Migration.State", Equal(api.ImageMigrationStateCommitted)),
+		))
+
+		By("ensuring the rbd image has been moved with its data")
+		expectData(cephMigrationPoolname, "img_"+volumeID)
+		names, err := librbd.GetImageNames(ioctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names).NotTo(ContainElement("img_" + volumeID))
+	})
+
+	It("should resume a migration prepared before its state has been recorded", func(ctx SpecContext) {
+		volumeID := createVolume(ctx, "bar")
+
+		By("preparing the migration as if the provider stopped right after preparing it")
+		prepareMigration("img_" + volumeID)
+
+		By("requesting the migration of the volume")
+		updateImage(ctx, volumeID, func(image *api.Image) {
+			image.Spec.Migration = &api.ImageMigration{Pool: cephMigrationPoolname}
+		})
+
+		By("ensuring the migration has been resumed and committed")
+		Eventually(ctx, func(g Gomega) *api.Image {
+			image, err := imageStore.Get(ctx, volumeID)
+			g.Expect(err).NotTo(HaveOccurred())
+			return image
+		}).WithTimeout(migrationTimeout).Should(SatisfyAll(
+			HaveField("Spec.Pool", Equal(cephMigrationPoolname)),
+			HaveField("Status.Migration.SourcePool", Equal(cephPoolname)),
+			HaveField("Status.Migration.State", Equal(api.ImageMigrationStateCommitted)),
+		))
+		expectData(cephMigrationPoolname, "img_"+volumeID)
+	})
+
+	It("should record a migration committed before its state has been recorded", func(ctx SpecContext) {
+		volumeID := createVolume(ctx, "qux")
+
+		By("committing the migration as if the provider stopped right after committing it")
+		prepareMigration("img_" + volumeID)
+		targetIoCtx, err := radosConn.OpenIOContext(cephMigrationPoolname)
+		Expect(err).NotTo(HaveOccurred())
+		defer targetIoCtx.Destroy()
+		Expect(librbd.MigrationExecute(targetIoCtx, "img_"+volumeID)).To(Succeed())
+		Expect(librbd.MigrationCommit(targetIoCtx, "img_"+volumeID)).To(Succeed())
+		updateImage(ctx, volumeID, func(image *api.Image) {
+			image.Spec.Migration = &api.ImageMigration{Pool: cephMigrationPoolname}
+			image.Status.Migration = &api.ImageMigrationStatus{
+				SourcePool:     cephPoolname,
+				SourceDataPool: cephPoolname,
+				Pool:           cephMigrationPoolname,
+				DataPool:       cephMigrationPoolname,
+			}
+			image.Status.Migration.SetState(api.ImageMigrationStateExecuting, "")
+			image.Spec.Pool, image.Spec.DataPool = cephMigrationPoolname, cephMigrationPoolname
+		})
+
+		By("ensuring the migration has been recorded as committed")
+		Eventually(ctx, func(g Gomega) *api.Image {
+			image, err := imageStore.Get(ctx, volumeID)
+			g.Expect(err).NotTo(HaveOccurred())
+			return image
+		}).WithTimeout(migrationTimeout).Should(SatisfyAll(
+			HaveField("Spec.Migration", BeNil()),
+			HaveField("Spec.Pool", Equal(cephMigrationPoolname)),
+			HaveField("Status.Migration.State", Equal(api.ImageMigrationStateCommitted)),
+		))
+		expectData(cephMigrationPoolname, "img_"+volumeID)
+	})
+
+	It("should abort a prepared migration", func(ctx SpecContext) {
+		volumeID := createVolume(ctx, "baz")
+
+		By("preparing the migration")
+		prepareMigration("img_" + volumeID)
+		updateImage(ctx, volumeID, func(image *api.Image) {
+			image.Status.Migration = &api.ImageMigrationStatus{
+				SourcePool:     cephPoolname,
+				SourceDataPool: cephPoolname,
+				Pool:           cephMigrationPoolname,
+				DataPool:       cephMigrationPoolname,
+			}
+			image.Status.Migration.SetState(api.ImageMigrationStatePrepared, "")
+			image.Spec.Pool, image.Spec.DataPool = cephMigrationPoolname, cephMigrationPoolname
+		})
+
+		By("ensuring the migration has been aborted")
+		Eventually(ctx, func(g Gomega) *api.Image {
+			image, err := imageStore.Get(ctx, volumeID)
+			g.Expect(err).NotTo(HaveOccurred())
+			return image
+		}).WithTimeout(migrationTimeout).Should(SatisfyAll(
+			HaveField("Spec.Pool", Equal(cephPoolname)),
+			HaveField("Status.Migration.State", Equal(api.ImageMigrationStateAborted)),
+		))
+
+		By("ensuring the rbd image is used from the source pool again")
+		expectData(cephPoolname, "img_"+volumeID)
+		targetIoCtx, err := radosConn.OpenIOContext(cephMigrationPoolname)
+		Expect(err).NotTo(HaveOccurred())
+		defer targetIoCtx.Destroy()
+		names, err := librbd.GetImageNames(targetIoCtx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names).NotTo(ContainElement("img_" + volumeID))
+	})
+
+	It("should record a migration aborted before its state has been recorded", func(ctx SpecContext) {
+		volumeID := createVolume(ctx, "quux")
+
+		By("aborting the migration as if the provider stopped right after aborting it")
+		prepareMigration("img_" + volumeID)
+		targetIoCtx, err := radosConn.OpenIOContext(cephMigrationPoolname)
+		Expect(err).NotTo(HaveOccurred())
+		defer targetIoCtx.Destroy()
+		Expect(librbd.MigrationAbort(targetIoCtx, "img_"+volumeID)).To(Succeed())
+		updateImage(ctx, volumeID, func(image *api.Image) {
+			image.Status.Migration = &api.ImageMigrationStatus{
+				SourcePool:     cephPoolname,
+				SourceDataPool: cephPoolname,
+				Pool:           cephMigrationPoolname,
+				DataPool:       cephMigrationPoolname,
+			}
+			image.Status.Migration.SetState(api.ImageMigrationStatePrepared, "")
+			image.Spec.Pool, image.Spec.DataPool = cephMigrationPoolname, cephMigrationPoolname
+		})
+
+		By("ensuring the migration has been recorded as aborted")
+		Eventually(ctx, func(g Gomega) *api.Image {
+			image, err := imageStore.Get(ctx, volumeID)
+			g.Expect(err).NotTo(HaveOccurred())
+			return image
+		}).WithTimeout(migrationTimeout).Should(SatisfyAll(
+			HaveField("Spec.Pool", Equal(cephPoolname)),
+			HaveField("Status.Migration.State", Equal(api.ImageMigrationStateAborted)),
+		))
+		expectData(cephPoolname, "img_"+volumeID)
+	})
+})
@@ -0,0 +1,128 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package integration
+
+import (
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	"github.com/ironcore-dev/ceph-provider/internal/strategy"
+	metav1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
+	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("Rollback Volume", func() {
+	It("should revert a volume to one of its snapshots", func(ctx SpecContext) {
+		imageStore, err := omap.New(logf.Log.WithName("rollback-image-store"), radosConn, cephPoolname, omap.Options[*api.Image]{
+			OmapName:     omap.NameVolumes,
+			NewFunc:      func() *api.Image { return &api.Image{} },
+			Schema:       strategy.ImageSchema,
+			IteratorSize: 1000,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("creating a volume")
+		createResp, err := volumeClient.CreateVolume(ctx, &iriv1alpha1.CreateVolumeRequest{
+			Volume: &iriv1alpha1.Volume{
+				Metadata: &metav1alpha1.ObjectMetadata{
+					Id: "foo",
+				},
+				Spec: &iriv1alpha1.VolumeSpec{
+					Class: "foo",
+					Resources: &iriv1alpha1.VolumeResources{
+						StorageBytes: 1024 * 1024 * 1024,
+					},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		volumeID := createResp.Volume.Metadata.Id
+		rbdID := "img_" + volumeID
+
+		By("ensuring volume is in available state")
+		Eventually(func() *iriv1alpha1.VolumeStatus {
+			resp, err := volumeClient.ListVolumes(ctx, &iriv1alpha1.ListVolumesRequest{
+				Filter: &iriv1alpha1.VolumeFilter{
+					Id: volumeID,
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Volumes).NotTo(BeEmpty())
+			return resp.Volumes[0].Status
+		}).Should(HaveField("State", Equal(iriv1alpha1.VolumeState_VOLUME_AVAILABLE)))
+
+		By("writing data to the rbd image")
+		writeImage := func(data string) {
+			img, err := librbd.OpenImage(ioctx, rbdID, librbd.NoSnapshot)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() {
+				Expect(img.Close()).To(Succeed())
+			}()
+			_, err = img.WriteAt([]byte(data), 0)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		writeImage("foo")
+
+		By("creating a volume snapshot")
+		createSnapshotResp, err := volumeClient.CreateVolumeSnapshot(ctx, &iriv1alpha1.CreateVolumeSnapshotRequest{
+			VolumeSnapshot: &iriv1alpha1.VolumeSnapshot{
+				Metadata: &metav1alpha1.ObjectMetadata{
+					Id: "foo-snap",
+				},
+				Spec: &iriv1alpha1.VolumeSnapshotSpec{
+					VolumeId: volumeID,
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		snapshotID := createSnapshotResp.VolumeSnapshot.Metadata.Id
+
+		By("ensuring volume snapshot is in available state")
+		Eventually(func() *iriv1alpha1.VolumeSnapshotStatus {
+			resp, err := volumeClient.ListVolumeSnapshots(ctx, &iriv1alpha1.ListVolumeSnapshotsRequest{
+				Filter: &iriv1alpha1.VolumeSnapshotFilter{
+					Id: snapshotID,
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.VolumeSnapshots).To(HaveLen(1))
+			return resp.VolumeSnapshots[0].Status
+		}).Should(HaveField("State", Equal(iriv1alpha1.VolumeSnapshotState_VOLUME_SNAPSHOT_READY)))
+
+		By("overwriting the data of the rbd image")
+		writeImage("bar")
+
+		By("requesting the rollback of the volume to the snapshot")
+		image, err := imageStore.Get(ctx, volumeID)
+		Expect(err).NotTo(HaveOccurred())
+		image.Spec.Rollback = &api.ImageRollback{SnapshotID: snapshotID}
+		_, err = imageStore.Update(ctx, image)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("ensuring the rollback completed")
+		Eventually(ctx, func(g Gomega) *api.Image {
+			image, err := imageStore.Get(ctx, volumeID)
+			g.Expect(err).NotTo(HaveOccurred())
+			return image
+		}).Should(SatisfyAll(
+			HaveField("Spec.Rollback", BeNil()),
+			HaveField("Status.Rollback.SnapshotID", Equal(snapshotID)),
+			HaveField("Status.Rollback.State", Equal(api.ImageRollbackStateCompleted)),
+		))
+
+		By("ensuring the rbd image contains the data of the snapshot")
+		img, err := librbd.OpenImageReadOnly(ioctx, rbdID, librbd.NoSnapshot)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(img.Close)
+		data := make([]byte, 3)
+		_, err = img.ReadAt(data, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(Equal("foo"))
+	})
+})
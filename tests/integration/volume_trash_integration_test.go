@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package integration
+
+import (
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/ironcore-dev/ceph-provider/api"
+	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	"github.com/ironcore-dev/ceph-provider/internal/strategy"
+	metav1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
+	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
+	"github.com/ironcore-dev/provider-utils/storeutils/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("Trash Volume", func() {
+	var imageStore *omap.Store[*api.Image]
+
+	BeforeEach(func() {
+		var err error
+		imageStore, err = omap.New(logf.Log.WithName("trash-image-store"), radosConn, cephPoolname, omap.Options[*api.Image]{
+			OmapName:     omap.NameVolumes,
+			NewFunc:      func() *api.Image { return &api.Image{} },
+			Schema:       strategy.ImageSchema,
+			IteratorSize: 1000,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	listVolumes := func(ctx SpecContext, g Gomega, volumeID string) []*iriv1alpha1.Volume {
+		resp, err := volumeClient.ListVolumes(ctx, &iriv1alpha1.ListVolumesRequest{
+			Filter: &iriv1alpha1.VolumeFilter{
+				Id: volumeID,
+			},
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+		return resp.Volumes
+	}
+
+	trashedNames := func(g Gomega) []string {
+		entries, err := librbd.GetTrashList(ioctx)
+		g.Expect(err).NotTo(HaveOccurred())
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name)
+		}
+		return names
+	}
+
+	It("should keep a deleted volume in the trash until its deferment ended", func(ctx SpecContext) {
+		By("creating a volume")
+		createResp, err := volumeClient.CreateVolume(ctx, &iriv1alpha1.CreateVolumeRequest{
+			Volume: &iriv1alpha1.Volume{
+				Metadata: &metav1alpha1.ObjectMetadata{
+					Id: "foo",
+				},
+				Spec: &iriv1alpha1.VolumeSpec{
+					Class: "foo",
+					Resources: &iriv1alpha1.VolumeResources{
+						StorageBytes: 1024 * 1024 * 1024,
+					},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		volumeID := createResp.Volume.Metadata.Id
+		rbdID := "img_" + volumeID
+
+		Eventually(ctx, func(g Gomega) []*iriv1alpha1.Volume {
+			return listVolumes(ctx, g, volumeID)
+		}).Should(ConsistOf(HaveField("Status.State", Equal(iriv1alpha1.VolumeState_VOLUME_AVAILABLE))))
+
+		By("deleting the volume")
+		_, err = volumeClient.DeleteVolume(ctx, &iriv1alpha1.DeleteVolumeRequest{
+			VolumeId: volumeID,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("ensuring the rbd image has been moved to the trash")
+		Eventually(ctx, func(g Gomega) *api.Image {
+			image, err := imageStore.Get(ctx, volumeID)
+			g.Expect(err).NotTo(HaveOccurred())
+			return image
+		}).Should(HaveField("Status.Trash", Not(BeNil())))
+		Expect(trashedNames(Default)).To(ContainElement(rbdID))
+		names, err := librbd.GetImageNames(ioctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names).NotTo(ContainElement(rbdID))
+
+		By("ensuring the trashed volume is not listed")
+		Expect(listVolumes(ctx, Default, volumeID)).To(BeEmpty())
+
+		By("restoring the volume")
+		// The image is updated concurrently by the reconciler, so conflicting updates are retried.
+		Eventually(ctx, func() error {
+			image, err := imageStore.Get(ctx, volumeID)
+			if err != nil {
+				return err
+			}
+			image.DeletedAt = nil
+			_, err = imageStore.Update(ctx, image)
+			return err
+		}).Should(Succeed())
+
+		By("ensuring the rbd image has been restored from the trash")
+		Eventually(ctx, func(g Gomega) *api.Image {
+			image, err := imageStore.Get(ctx, volumeID)
+			g.Expect(err).NotTo(HaveOccurred())
+			return image
+		}).Should(HaveField("Status.Trash", BeNil()))
+		Expect(trashedNames(Default)).NotTo(ContainElement(rbdID))
+		names, err = librbd.GetImageNames(ioctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names).To(ContainElement(rbdID))
+
+		By("ensuring the restored volume is listed again")
+		Eventually(ctx, func(g Gomega) []*iriv1alpha1.Volume {
+			return listVolumes(ctx, g, volumeID)
+		}).Should(ConsistOf(HaveField("Status.State", Equal(iriv1alpha1.VolumeState_VOLUME_AVAILABLE))))
+
+		By("deleting the volume again")
+		_, err = volumeClient.DeleteVolume(ctx, &iriv1alpha1.DeleteVolumeRequest{
+			VolumeId: volumeID,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("ensuring the rbd image is purged from the trash after the deferment")
+		Eventually(ctx, func() error {
+			_, err := imageStore.Get(ctx, volumeID)
+			return err
+		}).WithTimeout(trashDeferment + eventuallyTimeout).Should(MatchError(store.ErrNotFound))
+		Expect(trashedNames(Default)).NotTo(ContainElement(rbdID))
+		names, err = librbd.GetImageNames(ioctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names).NotTo(ContainElement(rbdID))
+	})
+})
@@ -4,10 +4,9 @@
 package integration
 
 import (
-	"encoding/json"
-
 	"github.com/ironcore-dev/ceph-provider/api"
 	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	"github.com/ironcore-dev/ceph-provider/internal/strategy"
 	metav1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
 	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
 	. "github.com/onsi/ginkgo/v2"
@@ -42,7 +41,7 @@ var _ = Describe("Create VolumeSnapshot", func() {
 			oMap, err := ioctx.GetOmapValues(omap.NameVolumes, "", createResp.Volume.Metadata.Id, 10)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(oMap).To(HaveKey(createResp.Volume.Metadata.Id))
-			Expect(json.Unmarshal(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
+			Expect(strategy.ImageSchema.Decode(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
 			return image
 		}).Should(SatisfyAll(
 			HaveField("Metadata.ID", Equal(createResp.Volume.Metadata.Id)),
@@ -88,7 +87,7 @@ var _ = Describe("Create VolumeSnapshot", func() {
 			oMap, err := ioctx.GetOmapValues(omap.NameSnapshots, "", snapshotID, 10)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(oMap).To(HaveKey(snapshotID))
-			Expect(json.Unmarshal(oMap[snapshotID], snapshot)).NotTo(HaveOccurred())
+			Expect(strategy.SnapshotSchema.Decode(oMap[snapshotID], snapshot)).NotTo(HaveOccurred())
 			return snapshot
 		}).Should(SatisfyAll(
 			HaveField("Metadata.ID", Equal(snapshotID)),
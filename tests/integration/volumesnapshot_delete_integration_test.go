@@ -4,10 +4,10 @@
 package integration
 
 import (
-	"encoding/json"
-
+	librbd "github.com/ceph/go-ceph/rbd"
 	"github.com/ironcore-dev/ceph-provider/api"
 	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	"github.com/ironcore-dev/ceph-provider/internal/strategy"
 	metav1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
 	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
 	. "github.com/onsi/ginkgo/v2"
@@ -42,7 +42,7 @@ var _ = Describe("Delete VolumeSnapshot", func() {
 			oMap, err := ioctx.GetOmapValues(omap.NameVolumes, "", createResp.Volume.Metadata.Id, 10)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(oMap).To(HaveKey(createResp.Volume.Metadata.Id))
-			Expect(json.Unmarshal(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
+			Expect(strategy.ImageSchema.Decode(oMap[createResp.Volume.Metadata.Id], image)).NotTo(HaveOccurred())
 			return image
 		}).Should(SatisfyAll(
 			HaveField("Metadata.ID", Equal(createResp.Volume.Metadata.Id)),
@@ -84,7 +84,7 @@ var _ = Describe("Delete VolumeSnapshot", func() {
 			oMap, err := ioctx.GetOmapValues(omap.NameSnapshots, "", snapshotID, 10)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(oMap).To(HaveKey(snapshotID))
-			Expect(json.Unmarshal(oMap[snapshotID], snapshot)).NotTo(HaveOccurred())
+			Expect(strategy.SnapshotSchema.Decode(oMap[snapshotID], snapshot)).NotTo(HaveOccurred())
 			return snapshot
 		}).Should(SatisfyAll(
 			HaveField("Metadata.ID", Equal(snapshotID)),
@@ -133,4 +133,140 @@ var _ = Describe("Delete VolumeSnapshot", func() {
 			Expect(oMap).NotTo(HaveKey(snapshotID))
 		})
 	})
+
+	It("should keep a deleted volume snapshot in the trash namespace while volumes restored from it exist", func(ctx SpecContext) {
+		By("creating a volume")
+		createResp, err := volumeClient.CreateVolume(ctx, &iriv1alpha1.CreateVolumeRequest{
+			Volume: &iriv1alpha1.Volume{
+				Metadata: &metav1alpha1.ObjectMetadata{
+					Id: "foo",
+				},
+				Spec: &iriv1alpha1.VolumeSpec{
+					Class: "foo",
+					Resources: &iriv1alpha1.VolumeResources{
+						StorageBytes: 1024 * 1024 * 1024,
+					},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(volumeClient.DeleteVolume, &iriv1alpha1.DeleteVolumeRequest{
+			VolumeId: createResp.Volume.Metadata.Id,
+		})
+
+		By("ensuring volume is in available state")
+		Eventually(func() *iriv1alpha1.VolumeStatus {
+			resp, err := volumeClient.ListVolumes(ctx, &iriv1alpha1.ListVolumesRequest{
+				Filter: &iriv1alpha1.VolumeFilter{
+					Id: createResp.Volume.Metadata.Id,
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Volumes).NotTo(BeEmpty())
+			return resp.Volumes[0].Status
+		}).Should(HaveField("State", Equal(iriv1alpha1.VolumeState_VOLUME_AVAILABLE)))
+
+		By("creating a volume snapshot")
+		createSnapshotResp, err := volumeClient.CreateVolumeSnapshot(ctx, &iriv1alpha1.CreateVolumeSnapshotRequest{
+			VolumeSnapshot: &iriv1alpha1.VolumeSnapshot{
+				Metadata: &metav1alpha1.ObjectMetadata{
+					Id: "foo-snap",
+				},
+				Spec: &iriv1alpha1.VolumeSnapshotSpec{
+					VolumeId: createResp.Volume.Metadata.Id,
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		snapshotID := createSnapshotResp.VolumeSnapshot.Metadata.Id
+
+		By("ensuring volume snapshot is in available state")
+		Eventually(func() *iriv1alpha1.VolumeSnapshotStatus {
+			resp, err := volumeClient.ListVolumeSnapshots(ctx, &iriv1alpha1.ListVolumeSnapshotsRequest{
+				Filter: &iriv1alpha1.VolumeSnapshotFilter{
+					Id: snapshotID,
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.VolumeSnapshots).To(HaveLen(1))
+			return resp.VolumeSnapshots[0].Status
+		}).Should(HaveField("State", Equal(iriv1alpha1.VolumeSnapshotState_VOLUME_SNAPSHOT_READY)))
+
+		By("creating a volume with snapshot data source")
+		restoreResp, err := volumeClient.CreateVolume(ctx, &iriv1alpha1.CreateVolumeRequest{
+			Volume: &iriv1alpha1.Volume{
+				Metadata: &metav1alpha1.ObjectMetadata{
+					Id: "bar",
+				},
+				Spec: &iriv1alpha1.VolumeSpec{
+					Class: "foo",
+					Resources: &iriv1alpha1.VolumeResources{
+						StorageBytes: 1024 * 1024 * 1024,
+					},
+					VolumeDataSource: &iriv1alpha1.VolumeDataSource{
+						SnapshotDataSource: &iriv1alpha1.SnapshotDataSource{
+							SnapshotId: snapshotID,
+						},
+					},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(volumeClient.DeleteVolume, &iriv1alpha1.DeleteVolumeRequest{
+			VolumeId: restoreResp.Volume.Metadata.Id,
+		})
+
+		By("ensuring restored volume is in available state")
+		Eventually(func() *iriv1alpha1.VolumeStatus {
+			resp, err := volumeClient.ListVolumes(ctx, &iriv1alpha1.ListVolumesRequest{
+				Filter: &iriv1alpha1.VolumeFilter{
+					Id: restoreResp.Volume.Metadata.Id,
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Volumes).NotTo(BeEmpty())
+			return resp.Volumes[0].Status
+		}).Should(HaveField("State", Equal(iriv1alpha1.VolumeState_VOLUME_AVAILABLE)))
+
+		By("deleting volume snapshot with snapshot Id")
+		Eventually(func() error {
+			_, err = volumeClient.DeleteVolumeSnapshot(ctx, &iriv1alpha1.DeleteVolumeSnapshotRequest{
+				VolumeSnapshotId: snapshotID,
+			})
+			return err
+		}).ShouldNot(HaveOccurred())
+
+		By("ensuring the snapshot has been deleted from snapshot store")
+		Eventually(ctx, func(g Gomega) {
+			oMap, err := ioctx.GetOmapValues(omap.NameSnapshots, "", snapshotID, 10)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(oMap).NotTo(HaveKey(snapshotID))
+		}).Should(Succeed())
+
+		By("ensuring the rbd image of the restored volume has not been flattened")
+		img, err := librbd.OpenImage(ioctx, "img_"+restoreResp.Volume.Metadata.Id, librbd.NoSnapshot)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(img.Close)
+
+		parent, err := img.GetParent()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parent.Image.ImageName).To(Equal("img_" + createResp.Volume.Metadata.Id))
+
+		By("ensuring the rbd snapshot has been moved to the trash namespace")
+		parentImg, err := librbd.OpenImage(ioctx, "img_"+createResp.Volume.Metadata.Id, librbd.NoSnapshot)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(parentImg.Close)
+
+		snaps, err := parentImg.GetSnapshotNames()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snaps).To(HaveLen(1))
+		Expect(snaps[0].Name).NotTo(Equal(snapshotID))
+
+		nsType, err := parentImg.GetSnapNamespaceType(snaps[0].Id)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nsType).To(Equal(librbd.SnapNamespaceTypeTrash))
+	})
 })
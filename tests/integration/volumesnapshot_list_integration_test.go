@@ -4,10 +4,9 @@
 package integration
 
 import (
-	"encoding/json"
-
 	"github.com/ironcore-dev/ceph-provider/api"
 	"github.com/ironcore-dev/ceph-provider/internal/omap"
+	"github.com/ironcore-dev/ceph-provider/internal/strategy"
 	metav1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
 	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/volume/v1alpha1"
 	. "github.com/onsi/ginkgo/v2"
@@ -40,7 +39,7 @@ var _ = Describe("List VolumeSnapshot", func() {
 			oMap, err := ioctx.GetOmapValues(omap.NameVolumes, "", volumeId, 10)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(oMap).To(HaveKey(volumeId))
-			Expect(json.Unmarshal(oMap[volumeId], image)).NotTo(HaveOccurred())
+			Expect(strategy.ImageSchema.Decode(oMap[volumeId], image)).NotTo(HaveOccurred())
 			return image
 		}).Should(SatisfyAll(
 			HaveField("Metadata.ID", Equal(volumeId)),
@@ -72,7 +71,7 @@ var _ = Describe("List VolumeSnapshot", func() {
 			oMap, err := ioctx.GetOmapValues(omap.NameSnapshots, "", snapshotID, 10)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(oMap).To(HaveKey(snapshotID))
-			Expect(json.Unmarshal(oMap[snapshotID], snapshot)).NotTo(HaveOccurred())
+			Expect(strategy.SnapshotSchema.Decode(oMap[snapshotID], snapshot)).NotTo(HaveOccurred())
 			return snapshot
 		}).Should(SatisfyAll(
 			HaveField("Metadata.ID", Equal(snapshotID)),
@@ -120,7 +119,7 @@ var _ = Describe("List VolumeSnapshot", func() {
 			oMap, err := ioctx.GetOmapValues(omap.NameSnapshots, "", snapshotID, 10)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(oMap).To(HaveKey(snapshotID))
-			Expect(json.Unmarshal(oMap[snapshotID], snapshot1)).NotTo(HaveOccurred())
+			Expect(strategy.SnapshotSchema.Decode(oMap[snapshotID], snapshot1)).NotTo(HaveOccurred())
 			return snapshot1
 		}).Should(SatisfyAll(
 			HaveField("Metadata.ID", Equal(snapshotID)),